@@ -60,7 +60,11 @@ const Shipments: React.FC = () => {
         {
           id: '1',
           shipmentId: 'SHP-2024-001',
-          items: ['ITM-2024-001', 'ITM-2024-002'],
+          lines: [
+            { itemId: 'ITM-2024-001', quantity: 20, unitPrice: 89.99, weightKg: 0.35, dimensions: { lengthCm: 20, widthCm: 18, heightCm: 10 } },
+            { itemId: 'ITM-2024-002', quantity: 50, unitPrice: 24.99, weightKg: 0.2, dimensions: { lengthCm: 30, widthCm: 25, heightCm: 3 } },
+          ],
+          totals: { units: 70, value: 3049.3, grossWeightKg: 17, volumetricWeightKg: 36.9, chargeableWeightKg: 36.9 },
           destination: 'Jakarta',
           status: 'in_transit',
           estimatedDelivery: '2024-01-15T00:00:00Z',
@@ -72,7 +76,10 @@ const Shipments: React.FC = () => {
         {
           id: '2',
           shipmentId: 'SHP-2024-002',
-          items: ['ITM-2024-003'],
+          lines: [
+            { itemId: 'ITM-2024-003', quantity: 40, unitPrice: 19.99, weightKg: 0.4, dimensions: { lengthCm: 30, widthCm: 10, heightCm: 10 } },
+          ],
+          totals: { units: 40, value: 799.6, grossWeightKg: 16, volumetricWeightKg: 24, chargeableWeightKg: 24 },
           destination: 'Surabaya',
           status: 'pending',
           estimatedDelivery: '2024-01-20T00:00:00Z',
@@ -84,7 +91,10 @@ const Shipments: React.FC = () => {
         {
           id: '3',
           shipmentId: 'SHP-2024-003',
-          items: ['ITM-2024-001'],
+          lines: [
+            { itemId: 'ITM-2024-001', quantity: 5, unitPrice: 89.99, weightKg: 0.35, dimensions: { lengthCm: 20, widthCm: 18, heightCm: 10 } },
+          ],
+          totals: { units: 5, value: 449.95, grossWeightKg: 1.75, volumetricWeightKg: 3.6, chargeableWeightKg: 3.6 },
           destination: 'Bandung',
           status: 'delivered',
           estimatedDelivery: '2024-01-08T00:00:00Z',
@@ -159,10 +169,10 @@ const Shipments: React.FC = () => {
       ),
     },
     {
-      field: 'items',
-      headerName: 'Items',
+      field: 'totals',
+      headerName: 'Units',
       width: 100,
-      renderCell: (params: GridRenderCellParams) => params.value.length,
+      renderCell: (params: GridRenderCellParams) => params.value.units,
     },
     {
       field: 'estimatedDelivery',
@@ -264,7 +274,15 @@ const Shipments: React.FC = () => {
                 <Typography><strong>Destination:</strong> {selectedShipment.destination}</Typography>
                 <Typography><strong>Status:</strong> {selectedShipment.status.replace('_', ' ')}</Typography>
                 <Typography><strong>Tracking Number:</strong> {selectedShipment.trackingNumber}</Typography>
-                <Typography><strong>Items:</strong> {selectedShipment.items.join(', ')}</Typography>
+                <Typography>
+                  <strong>Items:</strong>{' '}
+                  {selectedShipment.lines.map((line) => `${line.itemId} × ${line.quantity}`).join(', ')}
+                </Typography>
+                <Typography><strong>Value:</strong> ${selectedShipment.totals.value.toLocaleString()}</Typography>
+                <Typography>
+                  <strong>Weight:</strong> {selectedShipment.totals.grossWeightKg} kg gross,{' '}
+                  {selectedShipment.totals.volumetricWeightKg} kg volumetric
+                </Typography>
                 <Typography><strong>Created:</strong> {new Date(selectedShipment.createdAt).toLocaleString()}</Typography>
                 {selectedShipment.estimatedDelivery && (
                   <Typography><strong>Est. Delivery:</strong> {new Date(selectedShipment.estimatedDelivery).toLocaleString()}</Typography>
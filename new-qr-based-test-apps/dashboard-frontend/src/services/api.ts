@@ -9,7 +9,47 @@ import {
   InventoryTurnover,
   PaginationParams,
   ApiResponse,
-  DashboardStats
+  DashboardStats,
+  AnalyticsFilters,
+  StreamEvent,
+  StreamFilters,
+  StreamTopic,
+  ReportDefinition,
+  ReportRun,
+  ExportFormat,
+  StockMovement,
+  StockMovementRequest,
+  StockMovementResult,
+  WarehouseLocation,
+  LocationLevel,
+  LocationCapacity,
+  BinStock,
+  ItemAvailability,
+  Lot,
+  ExpiringLot,
+  SerialStatus,
+  StockReservation,
+  ShipmentAllocation,
+  ShipmentRequest,
+  ShipmentStatusChange,
+  SerialUnit,
+  SerialTrace,
+  ReorderPolicy,
+  StockAlert,
+  ReorderSuggestion,
+  CountTask,
+  CountTaskRequest,
+  CountScan,
+  CountStatus,
+  CountMethod,
+  ValuationMethod,
+  ValuationPolicy,
+  CostLayer,
+  ValuationReport,
+  PriceChange,
+  PriceChangeRequest,
+  PriceChangeStatus,
+  MarginReport
 } from '../types';
 
 const API_BASE_URL = process.env.REACT_APP_API_URL || 'http://localhost:8001';
@@ -68,6 +108,140 @@ export const inventoryApi = {
     const response = await apiClient.get(`/api/v1/inventory/items/${id}`);
     return response.data;
   },
+
+  getMovements: async (
+    id: string,
+    params: Partial<PaginationParams> & { type?: string; since?: string; until?: string } = {}
+  ): Promise<{ itemId: string; movements: StockMovement[]; total: number; page: number }> => {
+    const response = await apiClient.get(`/api/v1/inventory/items/${id}/movements`, { params });
+    return response.data;
+  },
+
+  recordMovement: async (id: string, movement: StockMovementRequest): Promise<StockMovementResult> => {
+    const response = await apiClient.post(`/api/v1/inventory/items/${id}/movements`, movement);
+    return response.data;
+  },
+
+  getAvailability: async (id: string, location?: string, lot?: string): Promise<ItemAvailability> => {
+    const response = await apiClient.get(`/api/v1/inventory/items/${id}/availability`, { params: { location, lot } });
+    return response.data;
+  },
+
+  getLots: async (id: string): Promise<{ itemId: string; lots: Lot[] }> => {
+    const response = await apiClient.get(`/api/v1/inventory/items/${id}/lots`);
+    return response.data;
+  },
+
+  getExpiringLots: async (
+    params: { days?: number; category?: string } = {}
+  ): Promise<{ days: number; category: string; lots: ExpiringLot[]; total: number }> => {
+    const response = await apiClient.get('/api/v1/inventory/lots/expiring', { params });
+    return response.data;
+  },
+};
+
+// Locations API
+export const locationsApi = {
+  getLocations: async (
+    params: Partial<PaginationParams> & { within?: string; level?: LocationLevel } = {}
+  ): Promise<{ locations: WarehouseLocation[]; total: number; page: number }> => {
+    const response = await apiClient.get('/api/v1/locations', { params });
+    return response.data;
+  },
+
+  getLocation: async (code: string): Promise<WarehouseLocation> => {
+    const response = await apiClient.get(`/api/v1/locations/${code}`);
+    return response.data;
+  },
+
+  createLocation: async (
+    location: { code: string; name?: string; capacity?: LocationCapacity; active?: boolean }
+  ): Promise<WarehouseLocation> => {
+    const response = await apiClient.post('/api/v1/locations', location);
+    return response.data;
+  },
+
+  updateLocation: async (
+    code: string,
+    location: { name?: string; capacity?: LocationCapacity; active?: boolean }
+  ): Promise<WarehouseLocation> => {
+    const response = await apiClient.put(`/api/v1/locations/${code}`, location);
+    return response.data;
+  },
+
+  getStock: async (code: string): Promise<{ location: WarehouseLocation; stock: BinStock[]; total: number }> => {
+    const response = await apiClient.get(`/api/v1/locations/${code}/stock`);
+    return response.data;
+  },
+};
+
+// Reorder API
+export const reorderApi = {
+  getPolicies: async (itemId?: string): Promise<{ policies: ReorderPolicy[] }> => {
+    const response = await apiClient.get('/api/v1/inventory/reorder-policies', { params: { itemId } });
+    return response.data;
+  },
+
+  setPolicy: async (
+    itemId: string,
+    policy: { location?: string; reorderPoint: number; safetyStock: number; reorderQuantity: number }
+  ): Promise<ReorderPolicy> => {
+    const response = await apiClient.put(`/api/v1/inventory/items/${itemId}/reorder-policy`, policy);
+    return response.data;
+  },
+
+  deletePolicy: async (itemId: string, location?: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/inventory/items/${itemId}/reorder-policy`, { params: { location } });
+  },
+
+  getAlerts: async (
+    params: Partial<PaginationParams> & { itemId?: string; status?: StockAlert['status']; severity?: StockAlert['severity'] } = {}
+  ): Promise<{ alerts: StockAlert[]; total: number; page: number }> => {
+    const response = await apiClient.get('/api/v1/inventory/stock-alerts', { params });
+    return response.data;
+  },
+
+  acknowledgeAlert: async (alertId: string): Promise<StockAlert> => {
+    const response = await apiClient.post(`/api/v1/inventory/stock-alerts/${alertId}/acknowledge`);
+    return response.data;
+  },
+
+  getSuggestions: async (
+    params: { days?: number; cover?: number } = {}
+  ): Promise<{ days: number; cover: number; suggestions: ReorderSuggestion[]; total: number }> => {
+    const response = await apiClient.get('/api/v1/inventory/reorder-suggestions', { params });
+    return response.data;
+  },
+};
+
+// Serial numbers API
+export const serialsApi = {
+  getSerials: async (
+    params: Partial<PaginationParams> & { itemId?: string; status?: SerialStatus; location?: string; shipmentId?: string } = {}
+  ): Promise<{ serials: SerialUnit[]; total: number; page: number }> => {
+    const response = await apiClient.get('/api/v1/serials', { params });
+    return response.data;
+  },
+
+  getSerial: async (serialNumber: string): Promise<SerialTrace> => {
+    const response = await apiClient.get(`/api/v1/serials/${encodeURIComponent(serialNumber)}`);
+    return response.data;
+  },
+
+  reserve: async (serialNumber: string, reference: string): Promise<SerialUnit> => {
+    const response = await apiClient.post(`/api/v1/serials/${encodeURIComponent(serialNumber)}/reserve`, { reference });
+    return response.data;
+  },
+
+  release: async (serialNumber: string): Promise<SerialUnit> => {
+    const response = await apiClient.post(`/api/v1/serials/${encodeURIComponent(serialNumber)}/release`);
+    return response.data;
+  },
+
+  setSerialized: async (itemId: string, serialized: boolean): Promise<{ itemId: string; serialized: boolean }> => {
+    const response = await apiClient.put(`/api/v1/inventory/items/${itemId}/serialized`, { serialized });
+    return response.data;
+  },
 };
 
 // Shipments API
@@ -82,35 +256,251 @@ export const shipmentsApi = {
     return response.data;
   },
 
-  updateShipmentStatus: async (id: string, status: string): Promise<Shipment> => {
+  updateShipmentStatus: async (id: string, status: Shipment['status']): Promise<ShipmentStatusChange> => {
     const response = await apiClient.put(`/api/v1/shipments/${id}/status`, { status });
     return response.data;
   },
 
-  createShipment: async (shipment: Partial<Shipment>): Promise<Shipment> => {
+  createShipment: async (shipment: ShipmentRequest): Promise<ShipmentAllocation> => {
     const response = await apiClient.post('/api/v1/shipments', shipment);
     return response.data;
   },
+
+  getAllocation: async (id: string): Promise<ShipmentAllocation> => {
+    const response = await apiClient.get(`/api/v1/shipments/${id}/allocation`);
+    return response.data;
+  },
+
+  getBackorders: async (
+    params: Partial<PaginationParams> & { itemId?: string } = {}
+  ): Promise<{ backorders: StockReservation[]; units: number; total: number; page: number }> => {
+    const response = await apiClient.get('/api/v1/shipments/backorders', { params });
+    return response.data;
+  },
+};
+
+// Cycle counts API
+export const countsApi = {
+  getTasks: async (
+    params: Partial<PaginationParams> & { status?: CountStatus; assignedTo?: string; method?: CountMethod } = {}
+  ): Promise<{ tasks: CountTask[]; total: number; page: number }> => {
+    const response = await apiClient.get('/api/v1/counts', { params });
+    return response.data;
+  },
+
+  getTask: async (id: string): Promise<CountTask> => {
+    const response = await apiClient.get(`/api/v1/counts/${id}`);
+    return response.data;
+  },
+
+  createTask: async (task: CountTaskRequest): Promise<CountTask> => {
+    const response = await apiClient.post('/api/v1/counts', task);
+    return response.data;
+  },
+
+  assign: async (id: string, assignedTo: string): Promise<CountTask> => {
+    const response = await apiClient.put(`/api/v1/counts/${id}/assignee`, { assignedTo });
+    return response.data;
+  },
+
+  cancel: async (id: string): Promise<CountTask> => {
+    const response = await apiClient.post(`/api/v1/counts/${id}/cancel`);
+    return response.data;
+  },
+
+  scan: async (id: string, barcode: string, quantity?: number): Promise<CountScan> => {
+    const response = await apiClient.post(`/api/v1/counts/${id}/scan`, { barcode, quantity });
+    return response.data;
+  },
+
+  recount: async (id: string, itemId: string, location: string, counted: number): Promise<CountTask> => {
+    const response = await apiClient.put(`/api/v1/counts/${id}/lines`, { itemId, location, counted });
+    return response.data;
+  },
+
+  submit: async (id: string): Promise<CountTask> => {
+    const response = await apiClient.post(`/api/v1/counts/${id}/submit`);
+    return response.data;
+  },
+
+  approve: async (id: string): Promise<CountTask> => {
+    const response = await apiClient.post(`/api/v1/counts/${id}/approve`);
+    return response.data;
+  },
+
+  reject: async (id: string): Promise<CountTask> => {
+    const response = await apiClient.post(`/api/v1/counts/${id}/reject`);
+    return response.data;
+  },
+};
+
+// Stock valuation API
+export const valuationApi = {
+  getMethods: async (): Promise<{ policies: ValuationPolicy[] }> => {
+    const response = await apiClient.get('/api/v1/inventory/valuation-methods');
+    return response.data;
+  },
+
+  setMethod: async (category: string, method: ValuationMethod): Promise<ValuationPolicy> => {
+    const response = await apiClient.put(`/api/v1/inventory/valuation-methods/${encodeURIComponent(category)}`, { method });
+    return response.data;
+  },
+
+  getReport: async (params: { at?: string; category?: string } = {}): Promise<ValuationReport> => {
+    const response = await apiClient.get('/api/v1/inventory/valuation', { params });
+    return response.data;
+  },
+
+  getCostLayers: async (
+    itemId: string,
+    open = false
+  ): Promise<{ itemId: string; layers: CostLayer[]; total: number }> => {
+    const response = await apiClient.get(`/api/v1/inventory/items/${itemId}/cost-layers`, { params: { open } });
+    return response.data;
+  },
+};
+
+// Price history API
+export const pricesApi = {
+  getItemPrices: async (
+    itemId: string,
+    params: Partial<PaginationParams> & { status?: PriceChangeStatus } = {}
+  ): Promise<{ changes: PriceChange[]; total: number; page: number }> => {
+    const response = await apiClient.get(`/api/v1/inventory/items/${itemId}/prices`, { params });
+    return response.data;
+  },
+
+  getChanges: async (
+    params: Partial<PaginationParams> & { itemId?: string; status?: PriceChangeStatus } = {}
+  ): Promise<{ changes: PriceChange[]; total: number; page: number }> => {
+    const response = await apiClient.get('/api/v1/inventory/price-changes', { params });
+    return response.data;
+  },
+
+  change: async (itemId: string, change: PriceChangeRequest): Promise<PriceChange> => {
+    const response = await apiClient.post(`/api/v1/inventory/items/${itemId}/prices`, change);
+    return response.data;
+  },
+
+  cancel: async (changeId: string): Promise<PriceChange> => {
+    const response = await apiClient.post(`/api/v1/inventory/price-changes/${changeId}/cancel`);
+    return response.data;
+  },
 };
 
 // Analytics API
 export const analyticsApi = {
-  getProfitMargins: async (): Promise<ProfitAnalytics> => {
-    const response = await apiClient.get('/api/v1/analytics/profit-margins');
+  getProfitMargins: async (filters?: AnalyticsFilters): Promise<ProfitAnalytics> => {
+    const response = await apiClient.get('/api/v1/analytics/profit-margins', { params: filters });
+    return response.data;
+  },
+
+  getShipmentPerformance: async (
+    filters?: AnalyticsFilters & { destination?: string; mode?: 'summary' | 'timeseries' }
+  ): Promise<ShipmentPerformance> => {
+    const response = await apiClient.get('/api/v1/analytics/shipment-performance', { params: filters });
+    return response.data;
+  },
+
+  getInventoryTurnover: async (
+    filters?: AnalyticsFilters & { fastTurnover?: number; deadTurnover?: number }
+  ): Promise<InventoryTurnover> => {
+    const response = await apiClient.get('/api/v1/analytics/inventory-turnover', { params: filters });
     return response.data;
   },
 
-  getShipmentPerformance: async (): Promise<ShipmentPerformance> => {
-    const response = await apiClient.get('/api/v1/analytics/shipment-performance');
+  getMarginsAt: async (params: { at?: string; category?: string } = {}): Promise<MarginReport> => {
+    const response = await apiClient.get('/api/v1/analytics/margins-at', { params });
     return response.data;
   },
+};
 
-  getInventoryTurnover: async (): Promise<InventoryTurnover> => {
-    const response = await apiClient.get('/api/v1/analytics/inventory-turnover');
+// Exports. The item and shipment lists and the analytics endpoints return a
+// file instead of JSON when given a format, with the same filters.
+export const exportApi = {
+  download: async (
+    path: string,
+    format: ExportFormat,
+    params?: Record<string, string | number | undefined>
+  ): Promise<Blob> => {
+    const response = await apiClient.get(path, {
+      params: { ...params, format },
+      responseType: 'blob',
+      timeout: 120000,
+    });
     return response.data;
   },
 };
 
+// Custom reports API
+export const reportsApi = {
+  getReports: async (): Promise<ReportDefinition[]> => {
+    const response = await apiClient.get('/api/v1/reports');
+    return response.data.reports;
+  },
+
+  createReport: async (report: ReportDefinition): Promise<ReportDefinition> => {
+    const response = await apiClient.post('/api/v1/reports', report);
+    return response.data.report;
+  },
+
+  updateReport: async (id: string, report: ReportDefinition): Promise<ReportDefinition> => {
+    const response = await apiClient.put(`/api/v1/reports/${id}`, report);
+    return response.data.report;
+  },
+
+  deleteReport: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/reports/${id}`);
+  },
+
+  runReport: async (id: string): Promise<ReportRun> => {
+    const response = await apiClient.post(`/api/v1/reports/${id}/run`);
+    return response.data.run;
+  },
+
+  getRuns: async (id: string): Promise<ReportRun[]> => {
+    const response = await apiClient.get(`/api/v1/reports/${id}/runs`);
+    return response.data.runs;
+  },
+
+  downloadRun: async (id: string, runId: string, format: ExportFormat = 'csv'): Promise<Blob> => {
+    const response = await apiClient.get(`/api/v1/reports/${id}/runs/${runId}/download`, {
+      params: { format },
+      responseType: 'blob',
+    });
+    return response.data;
+  },
+};
+
+// Live event stream. EventSource cannot send headers, so the token goes in
+// the query string; the browser resumes with Last-Event-ID on reconnect.
+export const streamApi = {
+  subscribe: (
+    filters: StreamFilters,
+    onEvent: (event: StreamEvent) => void,
+    onReset?: () => void
+  ): (() => void) => {
+    const params = new URLSearchParams();
+    if (filters.topics?.length) params.set('topics', filters.topics.join(','));
+    if (filters.entities?.length) params.set('entities', filters.entities.join(','));
+    if (filters.warehouses?.length) params.set('warehouses', filters.warehouses.join(','));
+    const token = localStorage.getItem('authToken');
+    if (token) params.set('access_token', token);
+
+    const source = new EventSource(`${API_BASE_URL}/api/v1/stream?${params.toString()}`);
+    const topics: StreamTopic[] = ['stock', 'shipments', 'scans'];
+    topics.forEach((topic) => {
+      source.addEventListener(topic, (message) => {
+        onEvent(JSON.parse((message as MessageEvent).data));
+      });
+    });
+    source.addEventListener('reset', () => onReset?.());
+    source.addEventListener('expired', () => source.close());
+
+    return () => source.close();
+  },
+};
+
 // Barcode API
 export const barcodeApi = {
   generateBarcode: async (request: BarcodeRequest): Promise<BarcodeResponse> => {
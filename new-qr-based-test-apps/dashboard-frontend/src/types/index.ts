@@ -10,16 +10,230 @@ export interface Item {
   sellingPrice: number;
   profitMargin: number;
   stockLevel: number;
+  stockValue?: number;
+  averageCost?: number;
+  reserved?: number;
   warehouseLocation: string;
+  serialized?: boolean;
   status: 'active' | 'inactive' | 'discontinued';
   createdAt: string;
   updatedAt: string;
 }
 
+export type LocationLevel = 'warehouse' | 'zone' | 'aisle' | 'rack' | 'bin';
+
+export interface LocationCapacity {
+  maxUnits?: number;
+  maxWeightKg?: number;
+  maxVolumeM3?: number;
+}
+
+export interface WarehouseLocation {
+  id: string;
+  code: string;
+  name?: string;
+  level: LocationLevel;
+  parent?: string;
+  warehouse: string;
+  zone?: string;
+  aisle?: string;
+  rack?: string;
+  bin?: string;
+  capacity: LocationCapacity;
+  occupied: number;
+  active: boolean;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface BinStock {
+  id: string;
+  itemId: string;
+  location: string;
+  warehouse: string;
+  lot?: string;
+  expiresAt?: string;
+  quantity: number;
+  updatedAt: string;
+}
+
+export interface ItemAvailability {
+  itemId: string;
+  location: string;
+  lot: string;
+  available: boolean;
+  total: number;
+  warehouses: { warehouse: string; quantity: number }[];
+  bins: BinStock[];
+  expired: BinStock[];
+}
+
+export interface Lot {
+  id: string;
+  itemId: string;
+  lotNumber: string;
+  manufacturedAt?: string;
+  expiresAt?: string;
+  quantity: number;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface ExpiringLot extends Lot {
+  name: string;
+  category: string;
+  unitCost: number;
+  daysLeft: number;
+  value: number;
+}
+
+export type MovementType = 'receipt' | 'issue' | 'adjustment' | 'transfer' | 'return';
+
+export interface StockMovement {
+  id: string;
+  itemId: string;
+  type: MovementType;
+  quantity: number;
+  unitCost: number;
+  unitPrice: number;
+  cogs?: number;
+  stockValue: number;
+  warehouseLocation: string;
+  lot?: string;
+  serials?: string[];
+  reason?: string;
+  reference?: string;
+  userId: string;
+  createdAt: string;
+}
+
+export interface StockMovementRequest {
+  type: MovementType;
+  quantity: number;
+  warehouseLocation?: string;
+  toLocation?: string;
+  lot?: string;
+  manufacturedAt?: string;
+  expiresAt?: string;
+  serials?: string[];
+  reason?: string;
+  reference?: string;
+  unitCost?: number;
+}
+
+export interface StockMovementResult {
+  itemId: string;
+  stockLevel: number;
+  previousStockLevel: number;
+  stockValue: number;
+  movements: StockMovement[];
+}
+
+export type SerialStatus = 'in_stock' | 'reserved' | 'shipped' | 'returned' | 'removed';
+
+export interface SerialEvent {
+  action: MovementType | 'reserved' | 'released';
+  status?: SerialStatus;
+  location: string;
+  reference?: string;
+  movementId?: string;
+  userId: string;
+  at: string;
+}
+
+export interface SerialUnit {
+  id: string;
+  serialNumber: string;
+  itemId: string;
+  status: SerialStatus;
+  location: string;
+  lot?: string;
+  reservedFor?: string;
+  shipmentId?: string;
+  history: SerialEvent[];
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface SerialTrace extends SerialUnit {
+  shipment?: Shipment;
+}
+
+export type StockAlertSeverity = 'low' | 'critical';
+
+export interface ReorderPolicy {
+  id: string;
+  itemId: string;
+  location: string;
+  reorderPoint: number;
+  safetyStock: number;
+  reorderQuantity: number;
+  updatedBy: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface StockAlert {
+  id: string;
+  itemId: string;
+  location: string;
+  severity: StockAlertSeverity;
+  status: 'open' | 'acknowledged' | 'resolved';
+  onHand: number;
+  reorderPoint: number;
+  safetyStock: number;
+  reorderQuantity: number;
+  acknowledgedBy?: string;
+  raisedAt: string;
+  updatedAt: string;
+  resolvedAt?: string;
+}
+
+export interface ReorderSuggestion {
+  itemId: string;
+  name: string;
+  category: string;
+  location: string;
+  severity: StockAlertSeverity;
+  onHand: number;
+  reorderPoint: number;
+  safetyStock: number;
+  reorderQuantity: number;
+  demand: number;
+  dailyDemand: number;
+  daysOfCover: number | null;
+  quantity: number;
+  unitCost: number;
+  value: number;
+}
+
+export interface Dimensions {
+  lengthCm: number;
+  widthCm: number;
+  heightCm: number;
+}
+
+export interface ShipmentLine {
+  itemId: string;
+  quantity: number;
+  unitPrice: number;
+  weightKg: number;
+  dimensions: Dimensions;
+}
+
+export interface ShipmentTotals {
+  units: number;
+  value: number;
+  grossWeightKg: number;
+  volumetricWeightKg: number;
+  chargeableWeightKg: number;
+}
+
 export interface Shipment {
   id: string;
   shipmentId: string;
-  items: string[];
+  lines: ShipmentLine[];
+  totals: ShipmentTotals;
   destination: string;
   status: 'pending' | 'in_transit' | 'delivered' | 'delayed' | 'cancelled';
   estimatedDelivery?: string;
@@ -30,6 +244,198 @@ export interface Shipment {
   updatedAt: string;
 }
 
+export type AllocationStatus = 'allocated' | 'partial' | 'backordered';
+
+export interface StockReservation {
+  id: string;
+  shipmentId: string;
+  itemId: string;
+  requested: number;
+  allocated: number;
+  backordered: number;
+  status: 'active' | 'released' | 'issued';
+  serials?: string[];
+  movementIds?: string[];
+  createdBy: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface ShipmentAllocation {
+  shipment: Shipment;
+  reservations: StockReservation[];
+  allocation: AllocationStatus;
+  requested: number;
+  allocated: number;
+  backordered: number;
+}
+
+export interface ShipmentRequest {
+  shipmentId: string;
+  destination: string;
+  estimatedDelivery?: string;
+  trackingNumber?: string;
+  lines: (Pick<ShipmentLine, 'itemId' | 'quantity'> & Partial<Omit<ShipmentLine, 'itemId' | 'quantity'>>)[];
+}
+
+export interface ShipmentStatusChange {
+  message: string;
+  shipmentId: string;
+  previousStatus: Shipment['status'];
+  newStatus: Shipment['status'];
+  shipment: Shipment;
+  reservations: StockReservation[];
+  movements: StockMovement[];
+}
+
+export type CountMethod = 'zone' | 'abc' | 'random';
+
+export type CountStatus = 'open' | 'in_progress' | 'pending_approval' | 'posted' | 'cancelled';
+
+export interface CountLine {
+  itemId: string;
+  name: string;
+  location: string;
+  expected: number;
+  counted: number | null;
+  variance: number;
+  varianceValue: number;
+  adjustment?: 'pending' | 'posted' | 'rejected';
+  movementIds?: string[];
+}
+
+export interface CountVariance {
+  itemId: string;
+  stockLevel: number;
+  counted: number;
+  variance: number;
+  value: number;
+}
+
+export interface CountTask {
+  id: string;
+  method: CountMethod;
+  scope?: string;
+  bins: string[];
+  counted: string[];
+  currentBin?: string;
+  lines: CountLine[];
+  variances?: CountVariance[];
+  status: CountStatus;
+  assignedTo: string;
+  createdBy: string;
+  reviewedBy?: string;
+  createdAt: string;
+  submittedAt?: string;
+  reviewedAt?: string;
+  updatedAt: string;
+}
+
+export interface CountTaskRequest {
+  method: CountMethod;
+  location?: string;
+  class?: 'A' | 'B' | 'C';
+  days?: number;
+  size?: number;
+  assignedTo: string;
+}
+
+export interface CountScan {
+  task: CountTask;
+  bin: string;
+  line?: CountLine;
+}
+
+export type ValuationMethod = 'fifo' | 'average' | 'standard';
+
+export interface ValuationPolicy {
+  id?: string;
+  category: string;
+  method: ValuationMethod;
+  updatedBy?: string;
+  updatedAt?: string;
+}
+
+export interface CostLayer {
+  id: string;
+  itemId: string;
+  movementId: string;
+  quantity: number;
+  remaining: number;
+  unitCost: number;
+  receivedAt: string;
+}
+
+export interface ItemValuation {
+  itemId: string;
+  name: string;
+  category: string;
+  method: ValuationMethod;
+  stockLevel: number;
+  unitCost: number;
+  value: number;
+}
+
+export interface CategoryValuation {
+  category: string;
+  method: ValuationMethod;
+  items: number;
+  units: number;
+  value: number;
+}
+
+export interface ValuationReport {
+  at: string;
+  units: number;
+  value: number;
+  categories: CategoryValuation[];
+  items: ItemValuation[];
+}
+
+export type PriceChangeStatus = 'scheduled' | 'applied' | 'cancelled';
+
+export interface PriceChange {
+  id: string;
+  itemId: string;
+  costPrice: number;
+  sellingPrice: number;
+  profitMargin: number;
+  previousCostPrice: number;
+  previousSellingPrice: number;
+  effectiveFrom: string;
+  effectiveTo?: string;
+  status: PriceChangeStatus;
+  reason?: string;
+  changedBy: string;
+  cancelledBy?: string;
+  createdAt: string;
+  appliedAt?: string;
+  updatedAt: string;
+}
+
+export interface PriceChangeRequest {
+  costPrice: number;
+  sellingPrice: number;
+  effectiveFrom?: string;
+  reason?: string;
+}
+
+export interface ItemMargin {
+  itemId: string;
+  name: string;
+  category: string;
+  costPrice: number;
+  sellingPrice: number;
+  profitMargin: number;
+  pricedSince?: string;
+}
+
+export interface MarginReport {
+  at: string;
+  averageMargin: number;
+  items: ItemMargin[];
+}
+
 export interface User {
   id: string;
   userId: string;
@@ -80,6 +486,41 @@ export interface ProfitAnalytics {
   topPerformers: string[];
   lowPerformers: string[];
   trendDirection: 'up' | 'down' | 'stable';
+  totalRevenue?: number;
+  totalCost?: number;
+  unitsSold?: number;
+  overallMargin?: number;
+  previousProfit?: number;
+  changePercent?: number;
+  topItems?: ProfitPerformer[];
+  lowItems?: ProfitPerformer[];
+  series?: ProfitPoint[];
+}
+
+export interface ProfitPerformer {
+  itemId: string;
+  name: string;
+  category: string;
+  unitsSold: number;
+  revenue: number;
+  profit: number;
+  profitMargin: number;
+}
+
+export interface ProfitPoint {
+  period: string;
+  unitsSold: number;
+  revenue: number;
+  profit: number;
+  profitMargin: number;
+}
+
+export interface AnalyticsFilters {
+  from?: string;
+  to?: string;
+  category?: string;
+  warehouseLocation?: string;
+  interval?: 'day' | 'week' | 'month';
 }
 
 export interface ShipmentPerformance {
@@ -88,6 +529,19 @@ export interface ShipmentPerformance {
   delayed: number;
   averageDeliveryTime: string;
   successRate: string;
+  delivered?: number;
+  inTransit?: number;
+  cancelled?: number;
+  deliveredLate?: number;
+  overdue?: number;
+  onTimeRate?: number;
+  averageDelayHours?: number;
+  averageTransitHours?: number;
+  p50TransitHours?: number;
+  p90TransitHours?: number;
+  p95TransitHours?: number;
+  byDestination?: (ShipmentPerformance & { destination: string })[];
+  series?: (ShipmentPerformance & { period: string })[];
 }
 
 export interface InventoryTurnover {
@@ -96,6 +550,25 @@ export interface InventoryTurnover {
   slowMoving: number;
   averageTurnover: number;
   categories: { [key: string]: number };
+  deadStock?: number;
+  cogs?: number;
+  daysOnHand?: number | null;
+  items?: ItemTurnover[];
+}
+
+export interface ItemTurnover {
+  itemId: string;
+  name: string;
+  category: string;
+  warehouseLocation: string;
+  stockLevel: number;
+  outboundUnits: number;
+  cogs: number;
+  averageInventoryValue: number;
+  turnover: number;
+  annualTurnover: number;
+  daysOnHand: number | null;
+  class: 'fast' | 'slow' | 'dead';
 }
 
 export interface PaginationParams {
@@ -105,6 +578,8 @@ export interface PaginationParams {
   sortOrder?: 'asc' | 'desc';
 }
 
+export type ExportFormat = 'csv' | 'xlsx' | 'pdf';
+
 export interface ApiResponse<T> {
   data: T;
   total?: number;
@@ -118,9 +593,83 @@ export interface DashboardStats {
   activeShipments: number;
   totalProfit: number;
   averageMargin: number;
+  stockValueAtCost?: number;
+  stockValueAtPrice?: number;
+  lowStockCount?: number;
+  lowStockThreshold?: number;
+  outOfStockCount?: number;
+  overdueShipments?: number;
+  shipmentsByStatus?: { [status: string]: number };
+  scansToday?: { success: number; failure: number };
+  generatedAt?: string;
   recentActivity: {
     type: string;
     description: string;
     timestamp: string;
   }[];
-}
\ No newline at end of file
+}
+export type StreamTopic = 'stock' | 'shipments' | 'scans';
+
+export interface StreamFilters {
+  topics?: StreamTopic[];
+  entities?: string[];
+  warehouses?: string[];
+}
+
+export interface StreamEvent {
+  id: string;
+  topic: StreamTopic;
+  entityId?: string;
+  warehouse?: string;
+  event: {
+    eventType: string;
+    eventId: string;
+    timestamp: string;
+    subject?: string;
+    data: any;
+  };
+}
+
+export type ReportEntity = 'items' | 'shipments' | 'scan_logs';
+
+export interface ReportFilter {
+  field: string;
+  operator: 'eq' | 'ne' | 'gt' | 'gte' | 'lt' | 'lte' | 'in' | 'contains';
+  value: string | number | (string | number)[];
+}
+
+export interface ReportAggregation {
+  function: 'count' | 'sum' | 'avg' | 'min' | 'max';
+  field?: string;
+  alias?: string;
+}
+
+export interface ReportDefinition {
+  id?: string;
+  name: string;
+  description?: string;
+  entity: ReportEntity;
+  columns?: string[];
+  filters?: ReportFilter[];
+  groupBy?: string[];
+  aggregations?: ReportAggregation[];
+  sort?: { field: string; desc?: boolean }[];
+  limit?: number;
+  schedule?: string;
+  nextRunAt?: string;
+  lastRunAt?: string;
+}
+
+export interface ReportRun {
+  id: string;
+  reportId: string;
+  trigger: 'manual' | 'schedule';
+  status: 'running' | 'succeeded' | 'failed';
+  columns: string[];
+  rows?: { [column: string]: any }[];
+  rowCount: number;
+  truncated: boolean;
+  error?: string;
+  startedAt: string;
+  finishedAt?: string;
+}
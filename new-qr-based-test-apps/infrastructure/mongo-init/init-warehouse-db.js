@@ -49,6 +49,15 @@ db.createCollection('items', {
                bsonType: "string",
                enum: ["active", "inactive", "discontinued"],
                description: "must be one of the valid statuses"
+            },
+            serialized: {
+               bsonType: "bool",
+               description: "whether every unit is tracked by serial number"
+            },
+            reserved: {
+               bsonType: "int",
+               minimum: 0,
+               description: "units of the stock level reserved for shipments"
             }
          }
       }
@@ -59,20 +68,28 @@ db.createCollection('shipments', {
    validator: {
       $jsonSchema: {
          bsonType: "object",
-         required: ["shipmentId", "items", "destination", "status"],
+         required: ["shipmentId", "lines", "destination", "status"],
          properties: {
             shipmentId: {
                bsonType: "string",
                pattern: "^SHP-[0-9]{4}-[0-9]{3}$",
                description: "must be a string matching SHP-YYYY-XXX pattern"
             },
-            items: {
+            lines: {
                bsonType: "array",
                minItems: 1,
                items: {
-                  bsonType: "string"
+                  bsonType: "object",
+                  required: ["itemId", "quantity"],
+                  properties: {
+                     itemId: { bsonType: "string" },
+                     quantity: { bsonType: "int", minimum: 1 },
+                     unitPrice: { bsonType: "number", minimum: 0 },
+                     weightKg: { bsonType: "number", minimum: 0 },
+                     dimensions: { bsonType: "object" }
+                  }
                },
-               description: "must be an array of item IDs"
+               description: "must be an array of lines with an item ID and quantity"
             },
             destination: {
                bsonType: "string",
@@ -145,6 +162,44 @@ db.scan_logs.createIndex({ "userId": 1 });
 db.scan_logs.createIndex({ "itemId": 1 });
 db.scan_logs.createIndex({ "result": 1 });
 
+db.stock_movements.createIndex({ "itemId": 1, "createdAt": -1 });
+db.stock_movements.createIndex({ "type": 1, "createdAt": -1 });
+db.stock_movements.createIndex({ "reference": 1 }, { sparse: true });
+
+db.locations.createIndex({ "code": 1 }, { unique: true });
+db.locations.createIndex({ "parent": 1 });
+
+db.bin_stock.createIndex({ "itemId": 1, "location": 1, "lot": 1 }, { unique: true });
+db.bin_stock.createIndex({ "location": 1 });
+
+db.lots.createIndex({ "itemId": 1, "lotNumber": 1 }, { unique: true });
+db.lots.createIndex({ "expiresAt": 1 }, { sparse: true });
+
+db.serials.createIndex({ "serialNumber": 1 }, { unique: true });
+db.serials.createIndex({ "itemId": 1, "status": 1 });
+db.serials.createIndex({ "shipmentId": 1 }, { sparse: true });
+
+db.reorder_policies.createIndex({ "itemId": 1, "location": 1 }, { unique: true });
+db.stock_alerts.createIndex({ "itemId": 1, "location": 1, "status": 1 });
+db.stock_alerts.createIndex({ "status": 1, "raisedAt": -1 });
+db.stock_alerts.createIndex(
+  { "itemId": 1, "location": 1 },
+  { unique: true, partialFilterExpression: { "status": { $in: ["open", "acknowledged"] } } }
+);
+
+db.stock_reservations.createIndex({ "shipmentId": 1, "itemId": 1 }, { unique: true });
+db.stock_reservations.createIndex({ "itemId": 1, "status": 1 });
+db.stock_reservations.createIndex({ "backordered": 1, "createdAt": -1 });
+
+db.count_tasks.createIndex({ "assignedTo": 1, "status": 1 });
+db.count_tasks.createIndex({ "status": 1, "createdAt": -1 });
+
+db.valuation_policies.createIndex({ "category": 1 }, { unique: true });
+db.cost_layers.createIndex({ "itemId": 1, "remaining": 1, "receivedAt": 1 });
+
+db.price_history.createIndex({ "itemId": 1, "effectiveFrom": -1 });
+db.price_history.createIndex({ "status": 1, "effectiveFrom": 1 });
+
 // Insert sample data
 print("Inserting sample data...");
 
@@ -159,7 +214,8 @@ db.items.insertMany([
       "sellingPrice": 89.99,
       "profitMargin": 44.45,
       "stockLevel": 150,
-      "warehouseLocation": "A1-B2-C3",
+      "warehouseLocation": "JKT-A-01-R1-B01",
+      "serialized": true,
       "status": "active",
       "createdAt": new Date(),
       "updatedAt": new Date()
@@ -173,7 +229,7 @@ db.items.insertMany([
       "sellingPrice": 24.99,
       "profitMargin": 51.98,
       "stockLevel": 300,
-      "warehouseLocation": "B1-A2-D1",
+      "warehouseLocation": "JKT-B-02-R1-B01",
       "status": "active",
       "createdAt": new Date(),
       "updatedAt": new Date()
@@ -187,13 +243,239 @@ db.items.insertMany([
       "sellingPrice": 19.99,
       "profitMargin": 57.48,
       "stockLevel": 200,
-      "warehouseLocation": "C1-B1-A3",
+      "reserved": 40,
+      "warehouseLocation": "SBY-A-01-R1-B01",
+      "status": "active",
+      "createdAt": new Date(),
+      "updatedAt": new Date()
+   },
+   {
+      "itemId": "ITM-2024-004",
+      "name": "Canned Tuna 150g",
+      "category": "Food",
+      "barcode": "4567890123456",
+      "costPrice": 1.50,
+      "sellingPrice": 2.99,
+      "profitMargin": 49.83,
+      "stockLevel": 120,
+      "warehouseLocation": "JKT-B-02-R1-B01",
       "status": "active",
       "createdAt": new Date(),
       "updatedAt": new Date()
    }
 ]);
 
+// Sample locations: warehouses JKT (Jakarta) and SBY (Surabaya), each
+// split into zones, aisles, racks and bins. A code is the path of its
+// location, e.g. JKT-A-01-R1-B01 is bin B01 of rack R1 in aisle 01 of zone A.
+const locationLevels = ["warehouse", "zone", "aisle", "rack", "bin"];
+const locationNames = { "JKT": "Jakarta Warehouse", "SBY": "Surabaya Warehouse" };
+const sampleBins = [
+   "JKT-A-01-R1-B01", "JKT-A-01-R1-B02", "JKT-B-02-R1-B01",
+   "SBY-A-01-R1-B01", "SBY-A-01-R1-B02"
+];
+const sampleLocations = {};
+sampleBins.forEach(bin => {
+   const parts = bin.split("-");
+   parts.forEach((part, i) => {
+      const code = parts.slice(0, i + 1).join("-");
+      if (sampleLocations[code]) {
+         return;
+      }
+      const location = {
+         "code": code,
+         "level": locationLevels[i],
+         "warehouse": parts[0],
+         "capacity": i === parts.length - 1 ? { "maxUnits": 500 } : {},
+         "occupied": 0,
+         "active": true,
+         "createdAt": new Date(),
+         "updatedAt": new Date()
+      };
+      if (i > 0) {
+         location.parent = parts.slice(0, i).join("-");
+      }
+      if (locationNames[code]) {
+         location.name = locationNames[code];
+      }
+      locationLevels.slice(1, i + 1).forEach((level, j) => { location[level] = parts[j + 1]; });
+      sampleLocations[code] = location;
+   });
+});
+db.locations.insertMany(Object.values(sampleLocations));
+
+// Lots of the sample food item, one of them expiring within a month
+const days = n => new Date(Date.now() + n * 24 * 60 * 60 * 1000);
+const sampleLots = [
+   { "itemId": "ITM-2024-004", "lotNumber": "B2024-031", "manufacturedAt": days(-330), "expiresAt": days(20), "quantity": 40 },
+   { "itemId": "ITM-2024-004", "lotNumber": "B2024-118", "manufacturedAt": days(-60), "expiresAt": days(300), "quantity": 80 }
+];
+db.lots.insertMany(sampleLots.map(lot => ({ ...lot, "createdAt": new Date(), "updatedAt": new Date() })));
+
+// Stock of the sample items per bin and lot, adding up to their stock
+// levels. Stock not tracked by lot has an empty lot.
+const sampleBinStock = [
+   { "itemId": "ITM-2024-001", "location": "JKT-A-01-R1-B01", "lot": "", "quantity": 100 },
+   { "itemId": "ITM-2024-001", "location": "SBY-A-01-R1-B02", "lot": "", "quantity": 50 },
+   { "itemId": "ITM-2024-002", "location": "JKT-B-02-R1-B01", "lot": "", "quantity": 300 },
+   { "itemId": "ITM-2024-003", "location": "SBY-A-01-R1-B01", "lot": "", "quantity": 150 },
+   { "itemId": "ITM-2024-003", "location": "JKT-A-01-R1-B02", "lot": "", "quantity": 50 },
+   { "itemId": "ITM-2024-004", "location": "JKT-B-02-R1-B01", "lot": "B2024-031", "quantity": 40 },
+   { "itemId": "ITM-2024-004", "location": "JKT-B-02-R1-B01", "lot": "B2024-118", "quantity": 80 }
+];
+db.bin_stock.insertMany(sampleBinStock.map(stock => {
+   const lot = sampleLots.find(l => l.itemId === stock.itemId && l.lotNumber === stock.lot);
+   const bin = { ...stock, "warehouse": stock.location.split("-")[0], "updatedAt": new Date() };
+   if (lot) {
+      bin.expiresAt = lot.expiresAt;
+   }
+   return bin;
+}));
+sampleBinStock.forEach(stock => {
+   db.locations.updateOne({ "code": stock.location }, { $inc: { "occupied": stock.quantity } });
+});
+
+// Units of the serialized sample items, one per unit of their bin stock,
+// numbered WBH2400001 and up
+const serialNumbers = {};
+let nextSerial = 1;
+sampleBinStock.forEach((stock, i) => {
+   const item = db.items.findOne({ "itemId": stock.itemId });
+   if (!item.serialized) {
+      return;
+   }
+   serialNumbers[i] = [];
+   for (let n = 0; n < stock.quantity; n++) {
+      serialNumbers[i].push("WBH24" + String(nextSerial++).padStart(5, "0"));
+   }
+});
+
+// Opening balances, so that the stock ledger of every sample item adds up
+// to its stock level and the stock of its bins. Each opens a cost layer at
+// the item's cost price.
+const stockValues = {};
+sampleBinStock.forEach((stock, i) => {
+   const item = db.items.findOne({ "itemId": stock.itemId });
+   stockValues[stock.itemId] = (stockValues[stock.itemId] || 0) + stock.quantity * item.costPrice;
+   const movement = {
+      "itemId": stock.itemId,
+      "type": "adjustment",
+      "quantity": stock.quantity,
+      "unitCost": item.costPrice,
+      "unitPrice": item.sellingPrice,
+      "stockValue": stockValues[stock.itemId],
+      "warehouseLocation": stock.location,
+      ...(stock.lot ? { "lot": stock.lot } : {}),
+      ...(serialNumbers[i] ? { "serials": serialNumbers[i] } : {}),
+      "reason": "opening balance",
+      "userId": "USR-2024-001",
+      "createdAt": item.createdAt
+   };
+   const movementId = db.stock_movements.insertOne(movement).insertedId;
+   db.cost_layers.insertOne({
+      "itemId": stock.itemId,
+      "movementId": movementId,
+      "quantity": stock.quantity,
+      "remaining": stock.quantity,
+      "unitCost": item.costPrice,
+      "receivedAt": item.createdAt
+   });
+   if (!serialNumbers[i]) {
+      return;
+   }
+   db.serials.insertMany(serialNumbers[i].map(serialNumber => ({
+      "serialNumber": serialNumber,
+      "itemId": stock.itemId,
+      "status": "in_stock",
+      "location": stock.location,
+      "history": [{
+         "action": "adjustment",
+         "status": "in_stock",
+         "location": stock.location,
+         "movementId": movementId,
+         "userId": "USR-2024-001",
+         "at": item.createdAt
+      }],
+      "createdAt": item.createdAt,
+      "updatedAt": item.createdAt
+   })));
+});
+
+Object.entries(stockValues).forEach(([itemId, value]) => {
+   const item = db.items.findOne({ "itemId": itemId });
+   db.items.updateOne({ "itemId": itemId }, { $set: { "stockValue": value, "averageCost": item.costPrice } });
+});
+
+// Price history: the prices of every sample item are in effect since it
+// was created, and the headphones go up next month
+db.items.find().forEach(item => {
+   db.price_history.insertOne({
+      "itemId": item.itemId,
+      "costPrice": item.costPrice,
+      "sellingPrice": item.sellingPrice,
+      "profitMargin": item.profitMargin,
+      "previousCostPrice": item.costPrice,
+      "previousSellingPrice": item.sellingPrice,
+      "effectiveFrom": item.createdAt,
+      "status": "applied",
+      "reason": "initial prices",
+      "changedBy": "USR-2024-001",
+      "createdAt": item.createdAt,
+      "appliedAt": item.createdAt,
+      "updatedAt": item.createdAt
+   });
+});
+const nextMonth = new Date();
+nextMonth.setMonth(nextMonth.getMonth() + 1);
+db.price_history.insertOne({
+   "itemId": "ITM-2024-001",
+   "costPrice": 52.00,
+   "sellingPrice": 94.99,
+   "profitMargin": 45.26,
+   "effectiveFrom": nextMonth,
+   "status": "scheduled",
+   "reason": "supplier price increase",
+   "changedBy": "USR-2024-001",
+   "createdAt": new Date(),
+   "updatedAt": new Date()
+});
+
+// Electronics are valued first in first out, the other categories at the
+// weighted average cost
+db.valuation_policies.insertOne({
+   "category": "Electronics",
+   "method": "fifo",
+   "updatedBy": "USR-2024-001",
+   "updatedAt": new Date()
+});
+
+// Reorder policies of the sample items: all stock of an item, or its stock
+// within a warehouse. The canned tuna is at its reorder point, so it has
+// an open alert as the reorder evaluator would have raised.
+const sampleReorderPolicies = [
+   { "itemId": "ITM-2024-001", "location": "", "reorderPoint": 40, "safetyStock": 15, "reorderQuantity": 100 },
+   { "itemId": "ITM-2024-003", "location": "SBY", "reorderPoint": 60, "safetyStock": 20, "reorderQuantity": 120 },
+   { "itemId": "ITM-2024-004", "location": "", "reorderPoint": 150, "safetyStock": 50, "reorderQuantity": 200 }
+];
+db.reorder_policies.insertMany(sampleReorderPolicies.map(policy => ({
+   ...policy,
+   "updatedBy": "USR-2024-001",
+   "createdAt": new Date(),
+   "updatedAt": new Date()
+})));
+db.stock_alerts.insertOne({
+   "itemId": "ITM-2024-004",
+   "location": "",
+   "severity": "low",
+   "status": "open",
+   "onHand": 120,
+   "reorderPoint": 150,
+   "safetyStock": 50,
+   "reorderQuantity": 200,
+   "raisedAt": new Date(),
+   "updatedAt": new Date()
+});
+
 // Sample users
 db.users.insertMany([
    {
@@ -235,7 +517,13 @@ db.users.insertMany([
 db.shipments.insertMany([
    {
       "shipmentId": "SHP-2024-001",
-      "items": ["ITM-2024-001", "ITM-2024-002"],
+      "lines": [
+         { "itemId": "ITM-2024-001", "quantity": 20, "unitPrice": 89.99, "weightKg": 0.35,
+           "dimensions": { "lengthCm": 20, "widthCm": 18, "heightCm": 10 } },
+         { "itemId": "ITM-2024-002", "quantity": 50, "unitPrice": 24.99, "weightKg": 0.2,
+           "dimensions": { "lengthCm": 30, "widthCm": 25, "heightCm": 3 } }
+      ],
+      "totals": { "units": 70, "value": 3049.3, "grossWeightKg": 17, "volumetricWeightKg": 36.9, "chargeableWeightKg": 36.9 },
       "destination": "Jakarta",
       "status": "in_transit",
       "estimatedDelivery": new Date(Date.now() + 5 * 24 * 60 * 60 * 1000), // 5 days from now
@@ -247,7 +535,11 @@ db.shipments.insertMany([
    },
    {
       "shipmentId": "SHP-2024-002",
-      "items": ["ITM-2024-003"],
+      "lines": [
+         { "itemId": "ITM-2024-003", "quantity": 40, "unitPrice": 19.99, "weightKg": 0.4,
+           "dimensions": { "lengthCm": 30, "widthCm": 10, "heightCm": 10 } }
+      ],
+      "totals": { "units": 40, "value": 799.6, "grossWeightKg": 16, "volumetricWeightKg": 24, "chargeableWeightKg": 24 },
       "destination": "Surabaya",
       "status": "pending",
       "estimatedDelivery": new Date(Date.now() + 7 * 24 * 60 * 60 * 1000), // 7 days from now
@@ -259,6 +551,20 @@ db.shipments.insertMany([
    }
 ]);
 
+// The pending sample shipment holds a reservation of the stock it ships,
+// counted in the reserved units of its item
+db.stock_reservations.insertOne({
+   "shipmentId": "SHP-2024-002",
+   "itemId": "ITM-2024-003",
+   "requested": 40,
+   "allocated": 40,
+   "backordered": 0,
+   "status": "active",
+   "createdBy": "USR-2024-001",
+   "createdAt": new Date(),
+   "updatedAt": new Date()
+});
+
 print("Database initialization completed successfully!");
-print("Created collections: items, shipments, users, scan_logs");
+print("Created collections: items, shipments, users, scan_logs, stock_movements, locations, bin_stock, lots, serials, reorder_policies, stock_alerts, stock_reservations, count_tasks, valuation_policies, cost_layers, price_history");
 print("Inserted sample data for testing purposes");
\ No newline at end of file
@@ -10,6 +10,7 @@ class ApiService {
   static const String scanEndpoint = '/api/v1/scan/validate';
   static const String loginEndpoint = '/api/v1/auth/login';
   static const String historyEndpoint = '/api/v1/scan/logs';
+  static const String countsEndpoint = '/api/v1/counts';
 
   // Get stored auth token
   Future<String?> _getAuthToken() async {
@@ -106,6 +107,63 @@ class ApiService {
     }
   }
 
+  // Get the open and in progress count tasks assigned to a user
+  Future<List<Map<String, dynamic>>> getCountTasks(String userId) async {
+    try {
+      final token = await _getAuthToken();
+      final tasks = <Map<String, dynamic>>[];
+      for (final status in ['open', 'in_progress']) {
+        final response = await http.get(
+          Uri.parse('$authBaseUrl$countsEndpoint?assignedTo=$userId&status=$status'),
+          headers: {
+            'Content-Type': 'application/json',
+            if (token != null) 'Authorization': 'Bearer $token',
+          },
+        );
+        if (response.statusCode != 200) {
+          throw Exception('Failed to fetch count tasks: ${response.statusCode}');
+        }
+        final data = json.decode(response.body);
+        tasks.addAll(List<Map<String, dynamic>>.from(data['tasks'] ?? []));
+      }
+      return tasks;
+    } catch (e) {
+      throw Exception('Count tasks fetch error: $e');
+    }
+  }
+
+  // Record a count scan: a bin barcode starts counting the bin, item
+  // barcodes then add to the count of the item in it
+  Future<Map<String, dynamic>> scanCount(String taskId, String barcode, {int quantity = 1}) async {
+    return _countRequest('$countsEndpoint/$taskId/scan', {
+      'barcode': barcode,
+      'quantity': quantity,
+    });
+  }
+
+  // Submit a count task once all of its bins are counted
+  Future<Map<String, dynamic>> submitCount(String taskId) async {
+    return _countRequest('$countsEndpoint/$taskId/submit', null);
+  }
+
+  Future<Map<String, dynamic>> _countRequest(String path, Map<String, dynamic>? body) async {
+    final token = await _getAuthToken();
+    final response = await http.post(
+      Uri.parse('$authBaseUrl$path'),
+      headers: {
+        'Content-Type': 'application/json',
+        if (token != null) 'Authorization': 'Bearer $token',
+      },
+      body: body != null ? json.encode(body) : null,
+    );
+
+    final data = json.decode(response.body);
+    if (response.statusCode != 200) {
+      throw Exception(data['error'] ?? 'Count request failed: ${response.statusCode}');
+    }
+    return Map<String, dynamic>.from(data);
+  }
+
   // Check API health
   Future<bool> checkHealth() async {
     try {
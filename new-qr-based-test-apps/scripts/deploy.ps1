@@ -135,7 +135,7 @@ function Build-PushImages {
     
     # Build dashboard API
     Write-Info "Building dashboard-api image..."
-    docker build -t "$DockerRegistry/dashboard-api:latest" services/dashboard-api/
+    docker build -t "$DockerRegistry/dashboard-api:latest" -f services/dashboard-api/Dockerfile services/
     
     # Build barcode service
     Write-Info "Building barcode-service image..."
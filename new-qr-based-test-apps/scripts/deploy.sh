@@ -97,7 +97,7 @@ build_and_push_images() {
     
     # Build dashboard API
     log_info "Building dashboard-api image..."
-    docker build -t $DOCKER_REGISTRY/dashboard-api:latest services/dashboard-api/
+    docker build -t $DOCKER_REGISTRY/dashboard-api:latest -f services/dashboard-api/Dockerfile services/
     
     # Build barcode service
     log_info "Building barcode-service image..."
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// errInvalidEvent marks events that can never be turned into documents.
+// They are moved to the dead-letter topic instead of being retried.
+var errInvalidEvent = errors.New("invalid event")
+
+// Document is an analytics document destined for one index. The event ID
+// is used as document ID so that redelivered events overwrite themselves.
+type Document struct {
+	Index string
+	ID    string
+	Body  interface{}
+}
+
+// InventoryDocument is indexed in the inventory analytics index for every inventory event
+type InventoryDocument struct {
+	EventID           string                 `json:"eventId"`
+	EventType         string                 `json:"eventType"`
+	Timestamp         time.Time              `json:"timestamp"`
+	ItemID            string                 `json:"itemId"`
+	Action            string                 `json:"action"`
+	UserID            string                 `json:"userId,omitempty"`
+	Name              string                 `json:"name,omitempty"`
+	Category          string                 `json:"category,omitempty"`
+	WarehouseLocation string                 `json:"warehouseLocation,omitempty"`
+	Status            string                 `json:"status,omitempty"`
+	StockLevel        int                    `json:"stockLevel"`
+	CostPrice         float64                `json:"costPrice"`
+	SellingPrice      float64                `json:"sellingPrice"`
+	InventoryValue    float64                `json:"inventoryValue"` // stock level at cost price
+	Changes           map[string]interface{} `json:"changes,omitempty"`
+}
+
+// ProfitDocument is a snapshot of an item's margin, indexed when an item changes
+type ProfitDocument struct {
+	EventID           string    `json:"eventId"`
+	EventType         string    `json:"eventType"`
+	Timestamp         time.Time `json:"timestamp"`
+	ItemID            string    `json:"itemId"`
+	Name              string    `json:"name"`
+	Category          string    `json:"category"`
+	WarehouseLocation string    `json:"warehouseLocation"`
+	CostPrice         float64   `json:"costPrice"`
+	SellingPrice      float64   `json:"sellingPrice"`
+	UnitProfit        float64   `json:"unitProfit"`
+	ProfitMargin      float64   `json:"profitMargin"`
+	StockLevel        int       `json:"stockLevel"`
+	PotentialProfit   float64   `json:"potentialProfit"` // unit profit over the stock on hand
+}
+
+// ShipmentDocument is indexed in the shipment analytics index for every shipment event
+type ShipmentDocument struct {
+	EventID            string                 `json:"eventId"`
+	EventType          string                 `json:"eventType"`
+	Timestamp          time.Time              `json:"timestamp"`
+	ShipmentID         string                 `json:"shipmentId"`
+	Action             string                 `json:"action"`
+	UserID             string                 `json:"userId,omitempty"`
+	Status             string                 `json:"status,omitempty"`
+	Destination        string                 `json:"destination,omitempty"`
+	Items              []string               `json:"items,omitempty"`
+	ItemCount          int                    `json:"itemCount"`
+	Units              int                    `json:"units"`
+	Value              float64                `json:"value"`
+	GrossWeightKg      float64                `json:"grossWeightKg"`
+	VolumetricWeightKg float64                `json:"volumetricWeightKg"`
+	ChargeableWeightKg float64                `json:"chargeableWeightKg"`
+	CreatedAt          *time.Time             `json:"createdAt,omitempty"`
+	EstimatedDelivery  *time.Time             `json:"estimatedDelivery,omitempty"`
+	ActualDelivery     *time.Time             `json:"actualDelivery,omitempty"`
+	TransitHours       *float64               `json:"transitHours,omitempty"` // creation to delivery
+	OnTime             *bool                  `json:"onTime,omitempty"`       // set once delivered
+	Delayed            bool                   `json:"delayed"`
+	Changes            map[string]interface{} `json:"changes,omitempty"`
+}
+
+// ScanDocument is indexed in the scan logs index for every scan event
+type ScanDocument struct {
+	EventID   string    `json:"eventId"`
+	EventType string    `json:"eventType"`
+	Timestamp time.Time `json:"timestamp"`
+	ScanID    string    `json:"scanId"`
+	ScanType  string    `json:"scanType"`
+	Result    string    `json:"result"`
+	Location  string    `json:"location,omitempty"`
+	DeviceID  string    `json:"deviceId,omitempty"`
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username,omitempty"`
+	UserRole  string    `json:"userRole,omitempty"`
+	ItemID    string    `json:"itemId,omitempty"`
+	ItemName  string    `json:"itemName,omitempty"`
+	Category  string    `json:"category,omitempty"`
+}
+
+// AccessDocument records user events next to the scans in the scan logs index
+type AccessDocument struct {
+	EventID     string                 `json:"eventId"`
+	EventType   string                 `json:"eventType"`
+	Timestamp   time.Time              `json:"timestamp"`
+	ScanType    string                 `json:"scanType"` // always "user_access"
+	UserID      string                 `json:"userId"`
+	Action      string                 `json:"action"`
+	Username    string                 `json:"username,omitempty"`
+	UserRole    string                 `json:"userRole,omitempty"`
+	AccessLevel string                 `json:"accessLevel,omitempty"`
+	Changes     map[string]interface{} `json:"changes,omitempty"`
+}
+
+// Lookup loads the entities referenced by events. Missing entities are
+// returned as nil without an error.
+type Lookup interface {
+	Item(ctx context.Context, itemID string) (*models.Item, error)
+	Shipment(ctx context.Context, shipmentID string) (*models.Shipment, error)
+	User(ctx context.Context, userID string) (*models.User, error)
+}
+
+// DocumentBuilder turns events into denormalized analytics documents
+type DocumentBuilder struct {
+	lookup Lookup
+}
+
+// NewDocumentBuilder creates a new document builder
+func NewDocumentBuilder(lookup Lookup) *DocumentBuilder {
+	return &DocumentBuilder{lookup: lookup}
+}
+
+// Build returns the documents for an event read from a topic
+func (b *DocumentBuilder) Build(ctx context.Context, topic string, event *models.EventMessage) ([]Document, error) {
+	switch topic {
+	case models.TopicInventoryEvents:
+		return b.inventoryDocuments(ctx, event)
+	case models.TopicShipmentEvents:
+		return b.shipmentDocuments(ctx, event)
+	case models.TopicScanEvents:
+		return b.scanDocuments(ctx, event)
+	case models.TopicUserEvents:
+		return b.accessDocuments(ctx, event)
+	default:
+		return nil, fmt.Errorf("%w: unsupported topic %s", errInvalidEvent, topic)
+	}
+}
+
+func (b *DocumentBuilder) inventoryDocuments(ctx context.Context, event *models.EventMessage) ([]Document, error) {
+	var data models.InventoryEvent
+	if err := decodeData(event, &data); err != nil {
+		return nil, err
+	}
+
+	item, err := b.lookup.Item(ctx, data.ItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := InventoryDocument{
+		EventID:   event.EventID,
+		EventType: event.EventType,
+		Timestamp: event.Timestamp,
+		ItemID:    data.ItemID,
+		Action:    data.Action,
+		UserID:    data.UserID,
+		Changes:   data.Changes,
+	}
+	documents := []Document{{Index: database.InventoryAnalyticsIndex, ID: event.EventID, Body: inventory}}
+
+	// Deleted items keep their last margin snapshot
+	if item == nil || event.EventType == models.EventItemDeleted {
+		return documents, nil
+	}
+	item = eventSnapshot(item, data.Changes)
+
+	inventory.Name = item.Name
+	inventory.Category = item.Category
+	inventory.WarehouseLocation = item.WarehouseLocation
+	inventory.Status = item.Status
+	inventory.StockLevel = item.StockLevel
+	inventory.CostPrice = item.CostPrice
+	inventory.SellingPrice = item.SellingPrice
+	inventory.InventoryValue = float64(item.StockLevel) * item.CostPrice
+	documents[0].Body = inventory
+
+	item.CalculateProfitMargin()
+	unitProfit := item.SellingPrice - item.CostPrice
+	documents = append(documents, Document{
+		Index: database.ProfitAnalyticsIndex,
+		ID:    event.EventID,
+		Body: ProfitDocument{
+			EventID:           event.EventID,
+			EventType:         event.EventType,
+			Timestamp:         event.Timestamp,
+			ItemID:            item.ItemID,
+			Name:              item.Name,
+			Category:          item.Category,
+			WarehouseLocation: item.WarehouseLocation,
+			CostPrice:         item.CostPrice,
+			SellingPrice:      item.SellingPrice,
+			UnitProfit:        unitProfit,
+			ProfitMargin:      item.ProfitMargin,
+			StockLevel:        item.StockLevel,
+			PotentialProfit:   unitProfit * float64(item.StockLevel),
+		},
+	})
+	return documents, nil
+}
+
+// eventSnapshot returns the item as it was after an event. The item is
+// looked up when the event is indexed, possibly long after it was published
+// and changed again since, so the stock level and prices the event carries
+// win over the looked up ones; name, category and location are only looked up.
+func eventSnapshot(item *models.Item, changes map[string]interface{}) *models.Item {
+	snapshot := *item
+	if level, ok := number(changes["stockLevel"]); ok {
+		snapshot.StockLevel = int(level)
+	}
+	if cost, ok := number(changes["costPrice"]); ok {
+		snapshot.CostPrice = cost
+	}
+	if selling, ok := number(changes["sellingPrice"]); ok {
+		snapshot.SellingPrice = selling
+	}
+	return &snapshot
+}
+
+// number converts a decoded event value to a float64, reporting false for
+// missing and non-numeric values
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (b *DocumentBuilder) shipmentDocuments(ctx context.Context, event *models.EventMessage) ([]Document, error) {
+	var data models.ShipmentEvent
+	if err := decodeData(event, &data); err != nil {
+		return nil, err
+	}
+
+	shipment, err := b.lookup.Shipment(ctx, data.ShipmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := ShipmentDocument{
+		EventID:    event.EventID,
+		EventType:  event.EventType,
+		Timestamp:  event.Timestamp,
+		ShipmentID: data.ShipmentID,
+		Action:     data.Action,
+		UserID:     data.UserID,
+		Changes:    data.Changes,
+	}
+
+	if shipment != nil {
+		createdAt := shipment.CreatedAt
+		doc.Status = shipment.Status
+		doc.Destination = shipment.Destination
+		doc.Items = shipment.ItemIDs()
+		doc.ItemCount = len(shipment.Lines)
+		doc.Units = shipment.Totals.Units
+		doc.Value = shipment.Totals.Value
+		doc.GrossWeightKg = shipment.Totals.GrossWeightKg
+		doc.VolumetricWeightKg = shipment.Totals.VolumetricWeightKg
+		doc.ChargeableWeightKg = shipment.Totals.ChargeableWeightKg
+		doc.CreatedAt = &createdAt
+		doc.EstimatedDelivery = shipment.EstimatedDelivery
+		doc.ActualDelivery = shipment.ActualDelivery
+		doc.Delayed = shipment.Status == "delayed"
+
+		if shipment.ActualDelivery != nil {
+			transit := shipment.ActualDelivery.Sub(shipment.CreatedAt).Hours()
+			doc.TransitHours = &transit
+			if shipment.EstimatedDelivery != nil {
+				onTime := !shipment.ActualDelivery.After(*shipment.EstimatedDelivery)
+				doc.OnTime = &onTime
+				doc.Delayed = doc.Delayed || !onTime
+			}
+		} else if shipment.EstimatedDelivery != nil && shipment.Status != "cancelled" {
+			doc.Delayed = doc.Delayed || event.Timestamp.After(*shipment.EstimatedDelivery)
+		}
+	}
+
+	return []Document{{Index: database.ShipmentAnalyticsIndex, ID: event.EventID, Body: doc}}, nil
+}
+
+func (b *DocumentBuilder) scanDocuments(ctx context.Context, event *models.EventMessage) ([]Document, error) {
+	var data models.ScanEvent
+	if err := decodeData(event, &data); err != nil {
+		return nil, err
+	}
+
+	doc := ScanDocument{
+		EventID:   event.EventID,
+		EventType: event.EventType,
+		Timestamp: event.Timestamp,
+		ScanID:    data.ScanID,
+		ScanType:  data.ScanType,
+		Result:    data.Result,
+		Location:  data.Location,
+		DeviceID:  data.DeviceID,
+		UserID:    data.UserID,
+		ItemID:    data.ItemID,
+	}
+
+	if data.UserID != "" {
+		user, err := b.lookup.User(ctx, data.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			doc.Username = user.Username
+			doc.UserRole = user.Role
+		}
+	}
+
+	if data.ItemID != "" {
+		item, err := b.lookup.Item(ctx, data.ItemID)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			doc.ItemName = item.Name
+			doc.Category = item.Category
+		}
+	}
+
+	return []Document{{Index: database.ScanLogsIndex, ID: event.EventID, Body: doc}}, nil
+}
+
+func (b *DocumentBuilder) accessDocuments(ctx context.Context, event *models.EventMessage) ([]Document, error) {
+	var data models.UserEvent
+	if err := decodeData(event, &data); err != nil {
+		return nil, err
+	}
+
+	doc := AccessDocument{
+		EventID:   event.EventID,
+		EventType: event.EventType,
+		Timestamp: event.Timestamp,
+		ScanType:  "user_access",
+		UserID:    data.UserID,
+		Action:    data.Action,
+		Changes:   data.Changes,
+	}
+
+	user, err := b.lookup.User(ctx, data.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		doc.Username = user.Username
+		doc.UserRole = user.Role
+		doc.AccessLevel = user.AccessLevel
+	}
+
+	return []Document{{Index: database.ScanLogsIndex, ID: event.EventID, Body: doc}}, nil
+}
+
+// decodeData decodes the event payload, marking malformed payloads as invalid
+func decodeData(event *models.EventMessage, v interface{}) error {
+	if err := event.DecodeData(v); err != nil {
+		return fmt.Errorf("%w: failed to decode %s payload: %v", errInvalidEvent, event.EventType, err)
+	}
+	return nil
+}
+
+// mongoLookup loads entities from MongoDB
+type mongoLookup struct {
+	items     *mongo.Collection
+	shipments *mongo.Collection
+	users     *mongo.Collection
+}
+
+// NewMongoLookup creates a Lookup backed by MongoDB
+func NewMongoLookup(db *database.MongoDB) Lookup {
+	return &mongoLookup{
+		items:     db.GetCollection(database.ItemsCollection),
+		shipments: db.GetCollection(database.ShipmentsCollection),
+		users:     db.GetCollection(database.UsersCollection),
+	}
+}
+
+func (l *mongoLookup) Item(ctx context.Context, itemID string) (*models.Item, error) {
+	var item models.Item
+	if found, err := findOne(ctx, l.items, bson.M{"itemId": itemID}, &item); !found {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (l *mongoLookup) Shipment(ctx context.Context, shipmentID string) (*models.Shipment, error) {
+	var shipment models.Shipment
+	if found, err := findOne(ctx, l.shipments, bson.M{"shipmentId": shipmentID}, &shipment); !found {
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+func (l *mongoLookup) User(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	if found, err := findOne(ctx, l.users, bson.M{"userId": userID}, &user); !found {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// findOne decodes the first matching document and reports whether one was found
+func findOne(ctx context.Context, collection *mongo.Collection, filter bson.M, v interface{}) (bool, error) {
+	err := collection.FindOne(ctx, filter).Decode(v)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", collection.Name(), err)
+	}
+	return true, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/database"
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// fakeLookup serves entities from maps
+type fakeLookup struct {
+	items     map[string]*models.Item
+	shipments map[string]*models.Shipment
+	users     map[string]*models.User
+	err       error
+}
+
+func (l *fakeLookup) Item(ctx context.Context, itemID string) (*models.Item, error) {
+	return l.items[itemID], l.err
+}
+
+func (l *fakeLookup) Shipment(ctx context.Context, shipmentID string) (*models.Shipment, error) {
+	return l.shipments[shipmentID], l.err
+}
+
+func (l *fakeLookup) User(ctx context.Context, userID string) (*models.User, error) {
+	return l.users[userID], l.err
+}
+
+func newFakeLookup() *fakeLookup {
+	return &fakeLookup{
+		items: map[string]*models.Item{
+			"ITM-2024-001": {ItemID: "ITM-2024-001", Name: "Laptop", Category: "Electronics", CostPrice: 800, SellingPrice: 1000, StockLevel: 5, WarehouseLocation: "A-01"},
+		},
+		shipments: map[string]*models.Shipment{},
+		users: map[string]*models.User{
+			"USR-2024-001": {UserID: "USR-2024-001", Username: "jdoe", Role: "scanner_user", AccessLevel: "level_2"},
+		},
+	}
+}
+
+// roundTrip builds an event the way the indexer reads it back from Kafka
+func roundTrip(t *testing.T, eventType string, data interface{}) *models.EventMessage {
+	message, err := kafka.EncodeEvent(models.NewEventMessage(eventType, data), nil, kafka.EventModeStructured)
+	require.NoError(t, err)
+
+	event, err := kafka.DecodeEvent(message)
+	require.NoError(t, err)
+	return event
+}
+
+func TestBuildInventoryDocuments(t *testing.T) {
+	builder := NewDocumentBuilder(newFakeLookup())
+	event := roundTrip(t, models.EventItemUpdated, models.InventoryEvent{ItemID: "ITM-2024-001", Action: "update"})
+
+	documents, err := builder.Build(context.Background(), models.TopicInventoryEvents, event)
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+
+	inventory := documents[0].Body.(InventoryDocument)
+	assert.Equal(t, database.InventoryAnalyticsIndex, documents[0].Index)
+	assert.Equal(t, event.EventID, documents[0].ID)
+	assert.Equal(t, "Electronics", inventory.Category)
+	assert.Equal(t, 4000.0, inventory.InventoryValue)
+
+	profit := documents[1].Body.(ProfitDocument)
+	assert.Equal(t, database.ProfitAnalyticsIndex, documents[1].Index)
+	assert.Equal(t, 200.0, profit.UnitProfit)
+	assert.Equal(t, 20.0, profit.ProfitMargin)
+	assert.Equal(t, 1000.0, profit.PotentialProfit)
+}
+
+func TestBuildInventoryDocumentsUsesEventValues(t *testing.T) {
+	builder := NewDocumentBuilder(newFakeLookup())
+	event := roundTrip(t, models.EventStockUpdated, models.InventoryEvent{
+		ItemID:  "ITM-2024-001",
+		Action:  "stock_update",
+		Changes: map[string]interface{}{"stockLevel": 3, "previousStockLevel": 5, "costPrice": 900, "warehouseLocation": "DOCK-1"},
+	})
+
+	documents, err := builder.Build(context.Background(), models.TopicInventoryEvents, event)
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+
+	inventory := documents[0].Body.(InventoryDocument)
+	assert.Equal(t, "Laptop", inventory.Name)
+	assert.Equal(t, "A-01", inventory.WarehouseLocation, "the movement's bin is not the item's location")
+	assert.Equal(t, 3, inventory.StockLevel)
+	assert.Equal(t, 900.0, inventory.CostPrice)
+	assert.Equal(t, 1000.0, inventory.SellingPrice, "prices missing from the event are looked up")
+	assert.Equal(t, 2700.0, inventory.InventoryValue)
+
+	profit := documents[1].Body.(ProfitDocument)
+	assert.Equal(t, 100.0, profit.UnitProfit)
+	assert.Equal(t, 10.0, profit.ProfitMargin)
+	assert.Equal(t, 300.0, profit.PotentialProfit)
+}
+
+func TestBuildInventoryDocumentsForDeletedItem(t *testing.T) {
+	builder := NewDocumentBuilder(newFakeLookup())
+	event := roundTrip(t, models.EventItemDeleted, models.InventoryEvent{ItemID: "ITM-2024-999", Action: "delete"})
+
+	documents, err := builder.Build(context.Background(), models.TopicInventoryEvents, event)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	assert.Equal(t, "ITM-2024-999", documents[0].Body.(InventoryDocument).ItemID)
+}
+
+func TestBuildShipmentDocumentOnTime(t *testing.T) {
+	lookup := newFakeLookup()
+	created := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	estimated := created.Add(72 * time.Hour)
+	delivered := created.Add(48 * time.Hour)
+	lookup.shipments["SHP-2024-001"] = &models.Shipment{
+		ShipmentID:        "SHP-2024-001",
+		Lines: []models.ShipmentLine{
+			{ItemID: "ITM-2024-001", Quantity: 20, UnitPrice: 89.99, WeightKg: 0.35},
+			{ItemID: "ITM-2024-002", Quantity: 5, UnitPrice: 24.99, WeightKg: 0.2},
+		},
+		Destination:       "Rotterdam",
+		Status:            "delivered",
+		EstimatedDelivery: &estimated,
+		ActualDelivery:    &delivered,
+		CreatedAt:         created,
+	}
+
+	event := roundTrip(t, models.EventShipmentDelivered, models.ShipmentEvent{ShipmentID: "SHP-2024-001", Action: "status_changed"})
+	documents, err := NewDocumentBuilder(lookup).Build(context.Background(), models.TopicShipmentEvents, event)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+
+	doc := documents[0].Body.(ShipmentDocument)
+	assert.Equal(t, 2, doc.ItemCount)
+	assert.Equal(t, []string{"ITM-2024-001", "ITM-2024-002"}, doc.Items)
+	require.NotNil(t, doc.OnTime)
+	assert.True(t, *doc.OnTime)
+	assert.False(t, doc.Delayed)
+	assert.Equal(t, 48.0, *doc.TransitHours)
+}
+
+func TestBuildScanAndAccessDocuments(t *testing.T) {
+	builder := NewDocumentBuilder(newFakeLookup())
+
+	scan := roundTrip(t, models.EventBarcodeScanned, models.ScanEvent{ScanID: "SCN-1", UserID: "USR-2024-001", ItemID: "ITM-2024-001", ScanType: "item_validation", Result: "success"})
+	documents, err := builder.Build(context.Background(), models.TopicScanEvents, scan)
+	require.NoError(t, err)
+	doc := documents[0].Body.(ScanDocument)
+	assert.Equal(t, database.ScanLogsIndex, documents[0].Index)
+	assert.Equal(t, "jdoe", doc.Username)
+	assert.Equal(t, "Laptop", doc.ItemName)
+
+	login := roundTrip(t, models.EventUserLogin, models.UserEvent{UserID: "USR-2024-001", Action: "login"})
+	documents, err = builder.Build(context.Background(), models.TopicUserEvents, login)
+	require.NoError(t, err)
+	access := documents[0].Body.(AccessDocument)
+	assert.Equal(t, "user_access", access.ScanType)
+	assert.Equal(t, "level_2", access.AccessLevel)
+}
+
+func TestBuildErrors(t *testing.T) {
+	lookup := newFakeLookup()
+	builder := NewDocumentBuilder(lookup)
+
+	invalid := &models.EventMessage{EventType: models.EventItemCreated, Data: []byte(`"not an object"`)}
+	_, err := builder.Build(context.Background(), models.TopicInventoryEvents, invalid)
+	assert.ErrorIs(t, err, errInvalidEvent)
+
+	lookup.err = errors.New("mongo unavailable")
+	event := roundTrip(t, models.EventItemCreated, models.InventoryEvent{ItemID: "ITM-2024-001"})
+	_, err = builder.Build(context.Background(), models.TopicInventoryEvents, event)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errInvalidEvent)
+}
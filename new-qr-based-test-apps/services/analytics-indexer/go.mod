@@ -0,0 +1,15 @@
+module analytics-indexer
+
+go 1.21
+
+require (
+	go.mongodb.org/mongo-driver v1.12.1
+	github.com/elastic/go-elasticsearch/v8 v8.9.0
+	github.com/segmentio/kafka-go v0.4.42
+	github.com/stretchr/testify v1.8.4
+	go.uber.org/zap v1.25.0
+	github.com/joho/godotenv v1.4.0
+	warehouse-shared v0.0.0
+)
+
+replace warehouse-shared => ../shared
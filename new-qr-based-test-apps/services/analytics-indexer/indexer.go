@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+	kafkago "github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"warehouse-shared/kafka"
+	"warehouse-shared/logger"
+	"warehouse-shared/models"
+)
+
+// Topics are the event topics indexed into the analytics indices
+var Topics = []string{
+	models.TopicInventoryEvents,
+	models.TopicShipmentEvents,
+	models.TopicScanEvents,
+	models.TopicUserEvents,
+}
+
+// IndexerConfig holds the batching and retry settings of the indexer
+type IndexerConfig struct {
+	GroupID       string
+	BatchSize     int           // messages per bulk request
+	FlushInterval time.Duration // time to wait for a batch to fill up
+	Workers       int           // bulk workers per batch
+	MaxBackoff    time.Duration // longest wait between retries while Elasticsearch is unavailable
+}
+
+// DefaultIndexerConfig returns the default indexer settings
+func DefaultIndexerConfig() IndexerConfig {
+	return IndexerConfig{
+		GroupID:       "analytics-indexer",
+		BatchSize:     500,
+		FlushInterval: time.Second,
+		Workers:       2,
+		MaxBackoff:    30 * time.Second,
+	}
+}
+
+// Indexer consumes the event topics and bulk-indexes analytics documents.
+//
+// Each topic is read in batches. A batch is indexed with its own
+// BulkIndexer and its offsets are committed only once Elasticsearch has
+// confirmed every document or the document was moved to the dead-letter
+// topic. While Elasticsearch is unavailable the batch is retried with a
+// growing backoff and no further messages are read, so the consumer lag
+// absorbs the backlog.
+type Indexer struct {
+	es      *elasticsearch.Client
+	kafka   *kafka.KafkaService
+	builder *DocumentBuilder
+	logger  *logger.Logger
+	config  IndexerConfig
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewIndexer creates a new indexer
+func NewIndexer(es *elasticsearch.Client, kafkaService *kafka.KafkaService, builder *DocumentBuilder, logger *logger.Logger, config IndexerConfig) *Indexer {
+	return &Indexer{
+		es:      es,
+		kafka:   kafkaService,
+		builder: builder,
+		logger:  logger,
+		config:  config,
+	}
+}
+
+// Start starts one consumer loop per topic
+func (i *Indexer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+
+	for _, topic := range Topics {
+		consumer := i.kafka.GetConsumer(topic, i.config.GroupID)
+		i.wg.Add(1)
+		go i.run(ctx, topic, consumer)
+	}
+
+	i.logger.Info("Analytics indexer started", zap.Strings("topics", Topics), zap.String("group", i.config.GroupID))
+}
+
+// Stop stops reading and waits for the batches in progress. Batches that
+// were not confirmed are not committed and will be read again.
+func (i *Indexer) Stop() {
+	if i.cancel != nil {
+		i.cancel()
+		i.wg.Wait()
+	}
+}
+
+// run indexes the messages of a topic batch by batch
+func (i *Indexer) run(ctx context.Context, topic string, consumer *kafka.Consumer) {
+	defer i.wg.Done()
+
+	for ctx.Err() == nil {
+		batch, err := i.fetchBatch(ctx, consumer)
+		if err != nil {
+			if ctx.Err() == nil {
+				i.logger.Error("Failed to read from Kafka", zap.String("topic", topic), zap.Error(err))
+				i.sleep(ctx, time.Second)
+			}
+			continue
+		}
+
+		if err := i.processBatch(ctx, topic, batch); err != nil {
+			return
+		}
+
+		// Commit even when shutting down, the batch has been confirmed
+		commitCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := consumer.CommitMessages(commitCtx, batch...); err != nil {
+			i.logger.Error("Failed to commit offsets", zap.String("topic", topic), zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// fetchBatch blocks until a message is available, then keeps reading until
+// the batch is full or the flush interval has elapsed
+func (i *Indexer) fetchBatch(ctx context.Context, consumer *kafka.Consumer) ([]kafkago.Message, error) {
+	first, err := consumer.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := []kafkago.Message{first}
+	fetchCtx, cancel := context.WithTimeout(ctx, i.config.FlushInterval)
+	defer cancel()
+
+	for len(batch) < i.config.BatchSize {
+		message, err := consumer.FetchMessage(fetchCtx)
+		if err != nil {
+			break
+		}
+		batch = append(batch, message)
+	}
+	return batch, nil
+}
+
+// pendingDocument is a document waiting for Elasticsearch to confirm it
+type pendingDocument struct {
+	Document
+	body    []byte
+	message kafkago.Message
+}
+
+// processBatch builds and indexes the documents of a batch. It only
+// returns early with an error when ctx is cancelled.
+func (i *Indexer) processBatch(ctx context.Context, topic string, batch []kafkago.Message) error {
+	var pending []*pendingDocument
+	for _, message := range batch {
+		documents, err := i.documents(ctx, topic, message)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, documents...)
+	}
+
+	for attempt := 1; len(pending) > 0; attempt++ {
+		pending = i.bulk(ctx, pending)
+		if len(pending) == 0 {
+			break
+		}
+
+		i.logger.Warn("Retrying documents not confirmed by Elasticsearch",
+			zap.String("topic", topic), zap.Int("documents", len(pending)), zap.Int("attempt", attempt))
+		if err := i.sleep(ctx, i.backoff(attempt)); err != nil {
+			return err
+		}
+	}
+
+	i.logger.Debug("Indexed batch", zap.String("topic", topic), zap.Int("messages", len(batch)))
+	return nil
+}
+
+// documents decodes a message and builds its documents. Invalid events are
+// moved to the dead-letter topic; lookup failures are retried.
+func (i *Indexer) documents(ctx context.Context, topic string, message kafkago.Message) ([]*pendingDocument, error) {
+	for attempt := 1; ; attempt++ {
+		pending, err := i.buildDocuments(ctx, topic, message)
+		if err == nil {
+			return pending, nil
+		}
+
+		if errors.Is(err, errInvalidEvent) {
+			i.logger.Warn("Skipping invalid event", zap.String("topic", topic), zap.Int64("offset", message.Offset), zap.Error(err))
+			if i.deadLetter(ctx, message, err) == nil {
+				return nil, nil
+			}
+		} else {
+			i.logger.Warn("Failed to build analytics documents", zap.String("topic", topic), zap.Int("attempt", attempt), zap.Error(err))
+		}
+
+		if err := i.sleep(ctx, i.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// buildDocuments decodes a message and serializes its documents
+func (i *Indexer) buildDocuments(ctx context.Context, topic string, message kafkago.Message) ([]*pendingDocument, error) {
+	event, err := kafka.DecodeEvent(message)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidEvent, err)
+	}
+
+	documents, err := i.builder.Build(ctx, topic, event)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]*pendingDocument, 0, len(documents))
+	for _, doc := range documents {
+		body, err := json.Marshal(doc.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to marshal document: %v", errInvalidEvent, err)
+		}
+		pending = append(pending, &pendingDocument{Document: doc, body: body, message: message})
+	}
+	return pending, nil
+}
+
+// bulk indexes documents and returns the ones to retry. Documents that
+// Elasticsearch rejects permanently are moved to the dead-letter topic.
+func (i *Indexer) bulk(ctx context.Context, documents []*pendingDocument) []*pendingDocument {
+	var (
+		mu       sync.Mutex
+		answered = make([]bool, len(documents))
+		retry    []*pendingDocument
+		rejected = make(map[*pendingDocument]string)
+	)
+
+	bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:        i.es,
+		NumWorkers:    i.config.Workers,
+		FlushInterval: i.config.FlushInterval,
+		OnError: func(ctx context.Context, err error) {
+			i.logger.Error("Bulk request failed", zap.Error(err))
+		},
+	})
+	if err != nil {
+		i.logger.Error("Failed to create bulk indexer", zap.Error(err))
+		return documents
+	}
+
+	for idx, doc := range documents {
+		idx, doc := idx, doc
+		err := bi.Add(ctx, esutil.BulkIndexerItem{
+			Index:      doc.Index,
+			Action:     "index",
+			DocumentID: doc.ID,
+			Body:       bytes.NewReader(doc.body),
+			OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+				mu.Lock()
+				defer mu.Unlock()
+				answered[idx] = true
+			},
+			OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				answered[idx] = true
+				if err != nil || retryableStatus(res.Status) {
+					retry = append(retry, doc)
+					return
+				}
+				rejected[doc] = fmt.Sprintf("%s: %s", res.Error.Type, res.Error.Reason)
+			},
+		})
+		if err != nil {
+			break
+		}
+	}
+
+	// Close flushes the remaining items and waits for every callback
+	if err := bi.Close(context.Background()); err != nil {
+		i.logger.Error("Failed to flush bulk indexer", zap.Error(err))
+	}
+
+	// Items of a bulk request that failed as a whole get no callback
+	for idx, doc := range documents {
+		if !answered[idx] {
+			retry = append(retry, doc)
+		}
+	}
+
+	// A message is moved to the dead-letter topic once, however many of its documents were rejected
+	type position struct {
+		partition int
+		offset    int64
+	}
+	deadLettered := make(map[position]bool)
+	for doc, reason := range rejected {
+		i.logger.Warn("Elasticsearch rejected document",
+			zap.String("index", doc.Index), zap.String("id", doc.ID), zap.String("reason", reason))
+
+		key := position{doc.message.Partition, doc.message.Offset}
+		if deadLettered[key] {
+			continue
+		}
+		if err := i.deadLetter(ctx, doc.message, fmt.Errorf("rejected by %s: %s", doc.Index, reason)); err != nil {
+			retry = append(retry, doc)
+			continue
+		}
+		deadLettered[key] = true
+	}
+
+	return retry
+}
+
+// deadLetter moves a message to the dead-letter topic of its topic
+func (i *Indexer) deadLetter(ctx context.Context, message kafkago.Message, cause error) error {
+	if err := i.kafka.DeadLetter(ctx, message, i.config.GroupID, cause); err != nil {
+		i.logger.Error("Failed to move message to dead-letter topic", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// backoff doubles the retry delay per attempt up to MaxBackoff
+func (i *Indexer) backoff(attempt int) time.Duration {
+	delay := 500 * time.Millisecond
+	for n := 1; n < attempt && delay < i.config.MaxBackoff; n++ {
+		delay *= 2
+	}
+	if delay > i.config.MaxBackoff {
+		return i.config.MaxBackoff
+	}
+	return delay
+}
+
+// sleep waits for d or until ctx is cancelled
+func (i *Indexer) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// retryableStatus reports whether a failed item may succeed when retried
+func retryableStatus(status int) bool {
+	return status == 0 || status == 429 || status >= 500
+}
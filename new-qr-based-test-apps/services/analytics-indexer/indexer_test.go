@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"warehouse-shared/logger"
+)
+
+// newTestIndexer returns an indexer talking to a fake Elasticsearch bulk endpoint
+func newTestIndexer(t *testing.T, handler http.HandlerFunc) *Indexer {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	require.NoError(t, err)
+
+	config := DefaultIndexerConfig()
+	config.Workers = 1
+	return NewIndexer(client, nil, nil, &logger.Logger{Logger: zap.NewNop()}, config)
+}
+
+func testDocuments(ids ...string) []*pendingDocument {
+	documents := make([]*pendingDocument, len(ids))
+	for i, id := range ids {
+		documents[i] = &pendingDocument{Document: Document{Index: "warehouse-test", ID: id}, body: []byte(`{}`)}
+	}
+	return documents
+}
+
+// bulkResponse answers every item of a bulk request with the status chosen by statusOf
+func bulkResponse(w http.ResponseWriter, r *http.Request, statusOf func(id string) int) {
+	body, _ := io.ReadAll(r.Body)
+
+	var items []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		var meta map[string]map[string]string
+		if json.Unmarshal([]byte(line), &meta) != nil || meta["index"] == nil {
+			continue
+		}
+		id := meta["index"]["_id"]
+		result := map[string]interface{}{"_id": id, "_index": "warehouse-test", "status": statusOf(id)}
+		if statusOf(id) >= 300 {
+			result["error"] = map[string]string{"type": "es_rejected_execution_exception", "reason": "queue full"}
+		}
+		items = append(items, map[string]interface{}{"index": result})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": true, "items": items})
+}
+
+func TestBulkRetriesThrottledDocuments(t *testing.T) {
+	indexer := newTestIndexer(t, func(w http.ResponseWriter, r *http.Request) {
+		bulkResponse(w, r, func(id string) int {
+			if id == "throttled" {
+				return http.StatusTooManyRequests
+			}
+			return http.StatusCreated
+		})
+	})
+
+	retry := indexer.bulk(context.Background(), testDocuments("ok-1", "throttled", "ok-2"))
+	require.Len(t, retry, 1)
+	assert.Equal(t, "throttled", retry[0].ID)
+}
+
+func TestBulkRetriesFailedRequest(t *testing.T) {
+	var requests int32
+	indexer := newTestIndexer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	retry := indexer.bulk(context.Background(), testDocuments("a", "b"))
+	assert.Len(t, retry, 2)
+	assert.NotZero(t, atomic.LoadInt32(&requests))
+}
+
+func TestBackoff(t *testing.T) {
+	indexer := &Indexer{config: IndexerConfig{MaxBackoff: 5 * time.Second}}
+
+	assert.Equal(t, 500*time.Millisecond, indexer.backoff(1))
+	assert.Equal(t, 2*time.Second, indexer.backoff(3))
+	assert.Equal(t, 5*time.Second, indexer.backoff(10))
+}
+
+func TestRetryableStatus(t *testing.T) {
+	assert.True(t, retryableStatus(http.StatusTooManyRequests))
+	assert.True(t, retryableStatus(http.StatusServiceUnavailable))
+	assert.False(t, retryableStatus(http.StatusBadRequest))
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/database"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+)
+
+// Grouping intervals of the analytics time series
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Trend directions compared with the previous period
+const (
+	TrendUp     = "up"
+	TrendDown   = "down"
+	TrendStable = "stable"
+)
+
+// defaultAnalyticsRange is used when the request has no date range
+const defaultAnalyticsRange = 30 * 24 * time.Hour
+
+// performersLimit is the number of top and bottom performers returned
+const performersLimit = 5
+
+// analyticsFilter holds the query parameters shared by the analytics endpoints
+type analyticsFilter struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Category string    `json:"category,omitempty"`
+	Location string    `json:"warehouseLocation,omitempty"`
+	Interval string    `json:"interval"`
+}
+
+// previous returns the period of the same length ending where the filter starts
+func (f analyticsFilter) previous() (time.Time, time.Time) {
+	return f.From.Add(-f.To.Sub(f.From)), f.From
+}
+
+// parseAnalyticsFilter reads from, to, category, warehouseLocation and
+// interval from the query string, responding with 400 on failure. Dates are
+// RFC 3339 timestamps or YYYY-MM-DD days; a day in "to" includes the whole day.
+func parseAnalyticsFilter(c *gin.Context) (analyticsFilter, bool) {
+	filter := analyticsFilter{
+		To:       time.Now().UTC(),
+		Category: c.Query("category"),
+		Location: c.Query("warehouseLocation"),
+		Interval: c.DefaultQuery("interval", IntervalDay),
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, isDay, err := parseAnalyticsDate(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+			return filter, false
+		}
+		if isDay {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = to
+	}
+
+	filter.From = filter.To.Add(-defaultAnalyticsRange)
+	if value := c.Query("from"); value != "" {
+		from, _, err := parseAnalyticsDate(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+			return filter, false
+		}
+		filter.From = from
+	}
+
+	if !filter.From.Before(filter.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return filter, false
+	}
+
+	switch filter.Interval {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return filter, false
+	}
+
+	return filter, true
+}
+
+// parseAnalyticsDate parses an RFC 3339 timestamp or a YYYY-MM-DD day
+func parseAnalyticsDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), false, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected RFC 3339 or YYYY-MM-DD, got %q", value)
+	}
+	return t, true, nil
+}
+
+// atParam reads the date of an as-of query from "at", now by default; a
+// day means the end of that day
+func atParam(c *gin.Context) (time.Time, bool) {
+	value := c.Query("at")
+	if value == "" {
+		return time.Now().UTC(), true
+	}
+	at, isDay, err := parseAnalyticsDate(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid at: " + err.Error()})
+		return at, false
+	}
+	if isDay {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, true
+}
+
+// dateTrunc returns the $dateTrunc expression grouping field by the interval
+func dateTrunc(field, interval string) bson.M {
+	trunc := bson.M{"date": field, "unit": interval}
+	if interval == IntervalWeek {
+		trunc["startOfWeek"] = "monday"
+	}
+	return bson.M{"$dateTrunc": trunc}
+}
+
+// trend compares a value with its previous period. Changes within one
+// percent are reported as stable.
+func trend(current, previous float64) (string, float64) {
+	if previous == 0 {
+		switch {
+		case current > 0:
+			return TrendUp, 0
+		case current < 0:
+			return TrendDown, 0
+		default:
+			return TrendStable, 0
+		}
+	}
+
+	change := (current - previous) / math.Abs(previous) * 100
+	switch {
+	case change > 1:
+		return TrendUp, round2(change)
+	case change < -1:
+		return TrendDown, round2(change)
+	default:
+		return TrendStable, round2(change)
+	}
+}
+
+// margin returns profit as a percentage of revenue, like Item.CalculateProfitMargin
+func margin(profit, revenue float64) float64 {
+	if revenue == 0 {
+		return 0
+	}
+	return round2(profit / revenue * 100)
+}
+
+// round2 rounds to two decimals for display
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// profitRow is one item and period of the profit aggregation
+type profitRow struct {
+	ItemID   string    `bson:"itemId"`
+	Name     string    `bson:"name"`
+	Category string    `bson:"category"`
+	Period   time.Time `bson:"period"`
+	Previous bool      `bson:"previous"`
+	Units    int       `bson:"units"`
+	Revenue  float64   `bson:"revenue"`
+	Cost     float64   `bson:"cost"`
+}
+
+// ProfitPerformer is the profit made on one item in the period
+type ProfitPerformer struct {
+	ItemID       string  `json:"itemId"`
+	Name         string  `json:"name"`
+	Category     string  `json:"category"`
+	UnitsSold    int     `json:"unitsSold"`
+	Revenue      float64 `json:"revenue"`
+	Profit       float64 `json:"profit"`
+	ProfitMargin float64 `json:"profitMargin"`
+}
+
+// ProfitPoint is the profit made in one interval of the period
+type ProfitPoint struct {
+	Period       time.Time `json:"period"`
+	UnitsSold    int       `json:"unitsSold"`
+	Revenue      float64   `json:"revenue"`
+	Profit       float64   `json:"profit"`
+	ProfitMargin float64   `json:"profitMargin"`
+}
+
+// ProfitAnalytics summarizes the profit made on issued stock, net of the
+// stock returned
+type ProfitAnalytics struct {
+	TotalProfit    float64 `json:"totalProfit"`
+	TotalRevenue   float64 `json:"totalRevenue"`
+	TotalCost      float64 `json:"totalCost"`
+	UnitsSold      int     `json:"unitsSold"`
+	AverageMargin  float64 `json:"averageMargin"` // mean ProfitMargin of the items sold
+	OverallMargin  float64 `json:"overallMargin"` // total profit over total revenue
+	PreviousProfit float64 `json:"previousProfit"`
+	ChangePercent  float64 `json:"changePercent"`
+	TrendDirection string  `json:"trendDirection"`
+
+	TopPerformers []string          `json:"topPerformers"`
+	LowPerformers []string          `json:"lowPerformers"`
+	TopItems      []ProfitPerformer `json:"topItems"`
+	LowItems      []ProfitPerformer `json:"lowItems"`
+	Series        []ProfitPoint     `json:"series"`
+}
+
+// profitAnalytics aggregates the issue and return movements of the period
+// and the previous period, joined with the items for their name and category
+func (s *Services) profitAnalytics(ctx context.Context, filter analyticsFilter) (*ProfitAnalytics, error) {
+	previousFrom, _ := filter.previous()
+
+	match := bson.M{
+		"type":      bson.M{"$in": bson.A{models.MovementIssue, models.MovementReturn}},
+		"createdAt": bson.M{"$gte": previousFrom, "$lt": filter.To},
+	}
+	if filter.Location != "" {
+		match["warehouseLocation"] = inventory.Within(filter.Location)
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         database.ItemsCollection,
+			"localField":   "itemId",
+			"foreignField": "itemId",
+			"as":           "item",
+		}}},
+		{{Key: "$unwind", Value: "$item"}},
+	}
+	if filter.Category != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"item.category": filter.Category}}})
+	}
+
+	// Movements recorded without prices fall back to the item's current
+	// prices. The cost is the cost of goods sold under the valuation method
+	// of the item's category, recorded on issues since valuation. Returns
+	// count as negative units, taking back the revenue at the price and the
+	// cost at the unit cost recorded on the return.
+	units := bson.M{"$abs": "$quantity"}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$set", Value: bson.M{
+			"units": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$type", models.MovementReturn}},
+				bson.M{"$multiply": bson.A{units, -1}},
+				units,
+			}},
+			"unitPrice": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$unitPrice", 0}}, "$unitPrice", "$item.sellingPrice"}},
+			"unitCost":  bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$unitCost", 0}}, "$unitCost", "$item.costPrice"}},
+		}}},
+		bson.D{{Key: "$set", Value: bson.M{
+			"cogs": bson.M{"$ifNull": bson.A{"$cogs", bson.M{"$multiply": bson.A{"$units", "$unitCost"}}}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"itemId":   "$itemId",
+				"period":   dateTrunc("$createdAt", filter.Interval),
+				"previous": bson.M{"$lt": bson.A{"$createdAt", filter.From}},
+			},
+			"name":     bson.M{"$first": "$item.name"},
+			"category": bson.M{"$first": "$item.category"},
+			"units":    bson.M{"$sum": "$units"},
+			"revenue":  bson.M{"$sum": bson.M{"$multiply": bson.A{"$units", "$unitPrice"}}},
+			"cost":     bson.M{"$sum": "$cogs"},
+		}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"_id":      0,
+			"itemId":   "$_id.itemId",
+			"period":   "$_id.period",
+			"previous": "$_id.previous",
+			"name":     1,
+			"category": 1,
+			"units":    1,
+			"revenue":  1,
+			"cost":     1,
+		}}},
+	)
+
+	cursor, err := s.MongoDB.GetCollection(database.StockMovementsCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate stock movements: %w", err)
+	}
+	var rows []profitRow
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode profit aggregation: %w", err)
+	}
+
+	return summarizeProfit(rows, performersLimit), nil
+}
+
+// summarizeProfit totals the aggregation rows into the current period's
+// figures, ranks the items by profit and compares with the previous period
+func summarizeProfit(rows []profitRow, limit int) *ProfitAnalytics {
+	analytics := &ProfitAnalytics{
+		TopPerformers: []string{},
+		LowPerformers: []string{},
+		TopItems:      []ProfitPerformer{},
+		LowItems:      []ProfitPerformer{},
+		Series:        []ProfitPoint{},
+	}
+
+	items := make(map[string]*ProfitPerformer)
+	points := make(map[time.Time]*ProfitPoint)
+	var previousProfit float64
+
+	for _, row := range rows {
+		profit := row.Revenue - row.Cost
+		if row.Previous {
+			previousProfit += profit
+			continue
+		}
+
+		analytics.TotalRevenue += row.Revenue
+		analytics.TotalCost += row.Cost
+		analytics.UnitsSold += row.Units
+
+		item, ok := items[row.ItemID]
+		if !ok {
+			item = &ProfitPerformer{ItemID: row.ItemID, Name: row.Name, Category: row.Category}
+			items[row.ItemID] = item
+		}
+		item.UnitsSold += row.Units
+		item.Revenue += row.Revenue
+		item.Profit += profit
+
+		point, ok := points[row.Period]
+		if !ok {
+			point = &ProfitPoint{Period: row.Period}
+			points[row.Period] = point
+		}
+		point.UnitsSold += row.Units
+		point.Revenue += row.Revenue
+		point.Profit += profit
+	}
+
+	analytics.TotalProfit = round2(analytics.TotalRevenue - analytics.TotalCost)
+	analytics.OverallMargin = margin(analytics.TotalProfit, analytics.TotalRevenue)
+	analytics.TotalRevenue = round2(analytics.TotalRevenue)
+	analytics.TotalCost = round2(analytics.TotalCost)
+	analytics.PreviousProfit = round2(previousProfit)
+	analytics.TrendDirection, analytics.ChangePercent = trend(analytics.TotalProfit, analytics.PreviousProfit)
+
+	ranked := make([]ProfitPerformer, 0, len(items))
+	var marginSum float64
+	for _, item := range items {
+		item.ProfitMargin = margin(item.Profit, item.Revenue)
+		item.Revenue = round2(item.Revenue)
+		item.Profit = round2(item.Profit)
+		marginSum += item.ProfitMargin
+		ranked = append(ranked, *item)
+	}
+	if len(ranked) > 0 {
+		analytics.AverageMargin = round2(marginSum / float64(len(ranked)))
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Profit != ranked[j].Profit {
+			return ranked[i].Profit > ranked[j].Profit
+		}
+		return ranked[i].ItemID < ranked[j].ItemID
+	})
+
+	// With fewer than two limits of items the bottom list takes what the top list left
+	top := ranked
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	bottomCount := len(ranked) - len(top)
+	if bottomCount > limit {
+		bottomCount = limit
+	}
+	for _, item := range top {
+		analytics.TopItems = append(analytics.TopItems, item)
+		analytics.TopPerformers = append(analytics.TopPerformers, item.ItemID)
+	}
+	for i := len(ranked) - 1; i >= len(ranked)-bottomCount; i-- {
+		analytics.LowItems = append(analytics.LowItems, ranked[i])
+		analytics.LowPerformers = append(analytics.LowPerformers, ranked[i].ItemID)
+	}
+
+	for _, point := range points {
+		point.ProfitMargin = margin(point.Profit, point.Revenue)
+		point.Revenue = round2(point.Revenue)
+		point.Profit = round2(point.Profit)
+		analytics.Series = append(analytics.Series, *point)
+	}
+	sort.Slice(analytics.Series, func(i, j int) bool {
+		return analytics.Series[i].Period.Before(analytics.Series[j].Period)
+	})
+
+	return analytics
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// Shipment analytics modes
+const (
+	ShipmentModeSummary    = "summary"
+	ShipmentModeTimeseries = "timeseries"
+)
+
+// ShipmentKPIs are the delivery figures of a group of shipments. Shipments
+// without an estimated delivery count as delivered but not in the on-time rate.
+type ShipmentKPIs struct {
+	TotalShipments int `json:"totalShipments"`
+	Delivered      int `json:"delivered"`
+	InTransit      int `json:"inTransit"` // pending or in transit and not yet overdue
+	Cancelled      int `json:"cancelled"`
+
+	DeliveredOnTime int     `json:"deliveredOnTime"`
+	DeliveredLate   int     `json:"deliveredLate"`
+	Overdue         int     `json:"overdue"` // not delivered and past the estimated delivery
+	Delayed         int     `json:"delayed"` // delivered late, overdue or marked delayed
+	OnTimeRate      float64 `json:"onTimeRate"`
+	AverageDelay    float64 `json:"averageDelayHours"` // of the shipments delivered late
+
+	AverageTransit float64 `json:"averageTransitHours"`
+	P50Transit     float64 `json:"p50TransitHours"`
+	P90Transit     float64 `json:"p90TransitHours"`
+	P95Transit     float64 `json:"p95TransitHours"`
+
+	// Display strings kept for the dashboard cards
+	AverageDeliveryTime string `json:"averageDeliveryTime"`
+	SuccessRate         string `json:"successRate"`
+}
+
+// DestinationKPIs are the KPIs of one destination
+type DestinationKPIs struct {
+	Destination string `json:"destination"`
+	ShipmentKPIs
+}
+
+// PeriodKPIs are the KPIs of the shipments created in one interval
+type PeriodKPIs struct {
+	Period time.Time `json:"period"`
+	ShipmentKPIs
+}
+
+// ShipmentPerformance is the response of the shipment performance endpoint
+type ShipmentPerformance struct {
+	ShipmentKPIs
+	ByDestination []DestinationKPIs `json:"byDestination,omitempty"`
+	Series        []PeriodKPIs      `json:"series,omitempty"`
+}
+
+// shipmentAccumulator collects the shipments of one group
+type shipmentAccumulator struct {
+	kpis     ShipmentKPIs
+	transits []float64
+	delays   []float64
+}
+
+// add counts a shipment as of now
+func (a *shipmentAccumulator) add(shipment *models.Shipment, now time.Time) {
+	a.kpis.TotalShipments++
+
+	if shipment.Status == "cancelled" {
+		a.kpis.Cancelled++
+		return
+	}
+
+	if shipment.ActualDelivery == nil {
+		switch {
+		case shipment.EstimatedDelivery != nil && now.After(*shipment.EstimatedDelivery):
+			a.kpis.Overdue++
+			a.kpis.Delayed++
+		case shipment.Status == "delayed":
+			a.kpis.Delayed++
+		default:
+			a.kpis.InTransit++
+		}
+		return
+	}
+
+	a.kpis.Delivered++
+	a.transits = append(a.transits, shipment.ActualDelivery.Sub(shipment.CreatedAt).Hours())
+
+	if shipment.EstimatedDelivery == nil {
+		return
+	}
+	if late := shipment.ActualDelivery.Sub(*shipment.EstimatedDelivery); late > 0 {
+		a.kpis.DeliveredLate++
+		a.kpis.Delayed++
+		a.delays = append(a.delays, late.Hours())
+	} else {
+		a.kpis.DeliveredOnTime++
+	}
+}
+
+// result computes the rates, averages and percentiles
+func (a *shipmentAccumulator) result() ShipmentKPIs {
+	kpis := a.kpis
+
+	if scheduled := kpis.DeliveredOnTime + kpis.DeliveredLate; scheduled > 0 {
+		kpis.OnTimeRate = round2(float64(kpis.DeliveredOnTime) / float64(scheduled) * 100)
+	}
+	kpis.AverageDelay = round2(mean(a.delays))
+
+	sort.Float64s(a.transits)
+	kpis.AverageTransit = round2(mean(a.transits))
+	kpis.P50Transit = round2(percentile(a.transits, 50))
+	kpis.P90Transit = round2(percentile(a.transits, 90))
+	kpis.P95Transit = round2(percentile(a.transits, 95))
+
+	kpis.AverageDeliveryTime = fmt.Sprintf("%.1f days", kpis.AverageTransit/24)
+	kpis.SuccessRate = fmt.Sprintf("%.1f%%", kpis.OnTimeRate)
+	return kpis
+}
+
+// mean returns the average of values, or 0 when there are none
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// percentile returns the p-th percentile of sorted values by linear interpolation
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// truncate returns the start of the interval containing t, in UTC. Weeks
+// start on Monday, like the $dateTrunc groups of the other analytics.
+func truncate(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case IntervalWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// summarizeShipments groups the shipments as requested by mode
+func summarizeShipments(shipments []*models.Shipment, mode, interval string, now time.Time) *ShipmentPerformance {
+	total := &shipmentAccumulator{}
+	groups := make(map[string]*shipmentAccumulator)
+	periods := make(map[time.Time]*shipmentAccumulator)
+
+	for _, shipment := range shipments {
+		total.add(shipment, now)
+
+		if mode == ShipmentModeTimeseries {
+			period := truncate(shipment.CreatedAt, interval)
+			if periods[period] == nil {
+				periods[period] = &shipmentAccumulator{}
+			}
+			periods[period].add(shipment, now)
+			continue
+		}
+
+		if groups[shipment.Destination] == nil {
+			groups[shipment.Destination] = &shipmentAccumulator{}
+		}
+		groups[shipment.Destination].add(shipment, now)
+	}
+
+	performance := &ShipmentPerformance{ShipmentKPIs: total.result()}
+
+	if mode == ShipmentModeTimeseries {
+		performance.Series = make([]PeriodKPIs, 0, len(periods))
+		for period, acc := range periods {
+			performance.Series = append(performance.Series, PeriodKPIs{Period: period, ShipmentKPIs: acc.result()})
+		}
+		sort.Slice(performance.Series, func(i, j int) bool {
+			return performance.Series[i].Period.Before(performance.Series[j].Period)
+		})
+		return performance
+	}
+
+	performance.ByDestination = make([]DestinationKPIs, 0, len(groups))
+	for destination, acc := range groups {
+		performance.ByDestination = append(performance.ByDestination, DestinationKPIs{Destination: destination, ShipmentKPIs: acc.result()})
+	}
+	sort.Slice(performance.ByDestination, func(i, j int) bool {
+		a, b := performance.ByDestination[i], performance.ByDestination[j]
+		if a.TotalShipments != b.TotalShipments {
+			return a.TotalShipments > b.TotalShipments
+		}
+		return a.Destination < b.Destination
+	})
+	return performance
+}
+
+// shipmentPerformance loads the shipments created in the filter's period.
+// Percentiles need every transit time, so the figures are computed here
+// rather than in the aggregation; only the fields used are loaded.
+func (s *Services) shipmentPerformance(ctx context.Context, filter analyticsFilter, destination, mode string) (*ShipmentPerformance, error) {
+	query := bson.M{"createdAt": bson.M{"$gte": filter.From, "$lt": filter.To}}
+	if destination != "" {
+		query["destination"] = destination
+	}
+
+	opts := options.Find().SetProjection(bson.M{
+		"destination":       1,
+		"status":            1,
+		"estimatedDelivery": 1,
+		"actualDelivery":    1,
+		"createdAt":         1,
+	})
+
+	cursor, err := s.MongoDB.GetCollection(database.ShipmentsCollection).Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find shipments: %w", err)
+	}
+	var shipments []*models.Shipment
+	if err := cursor.All(ctx, &shipments); err != nil {
+		return nil, fmt.Errorf("failed to decode shipments: %w", err)
+	}
+
+	return summarizeShipments(shipments, mode, filter.Interval, time.Now()), nil
+}
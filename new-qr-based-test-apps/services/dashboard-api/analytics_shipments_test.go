@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/models"
+)
+
+func TestSummarizeShipments(t *testing.T) {
+	now := time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC)
+	at := func(day, hour int) *time.Time {
+		t := time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	shipment := func(destination, status string, created, estimated, actual *time.Time) *models.Shipment {
+		return &models.Shipment{
+			Destination:       destination,
+			Status:            status,
+			CreatedAt:         *created,
+			EstimatedDelivery: estimated,
+			ActualDelivery:    actual,
+		}
+	}
+
+	shipments := []*models.Shipment{
+		shipment("Jakarta", "delivered", at(1, 0), at(3, 0), at(2, 0)),    // on time, 24h
+		shipment("Jakarta", "delivered", at(1, 0), at(3, 0), at(4, 0)),    // 24h late, 72h
+		shipment("Jakarta", "in_transit", at(15, 0), at(18, 0), nil),      // overdue
+		shipment("Surabaya", "delivered", at(8, 0), at(10, 0), at(10, 0)), // on time, 48h
+		shipment("Surabaya", "in_transit", at(19, 0), at(22, 0), nil),     // in transit
+		shipment("Surabaya", "cancelled", at(9, 0), at(12, 0), nil),       // cancelled
+		shipment("Bandung", "delivered", at(2, 0), nil, at(3, 0)),         // no estimate, 24h
+	}
+
+	performance := summarizeShipments(shipments, ShipmentModeSummary, IntervalWeek, now)
+
+	assert.Equal(t, 7, performance.TotalShipments)
+	assert.Equal(t, 4, performance.Delivered)
+	assert.Equal(t, 2, performance.DeliveredOnTime)
+	assert.Equal(t, 1, performance.DeliveredLate)
+	assert.Equal(t, 1, performance.Overdue)
+	assert.Equal(t, 2, performance.Delayed)
+	assert.Equal(t, 1, performance.InTransit)
+	assert.Equal(t, 1, performance.Cancelled)
+	assert.Equal(t, 66.67, performance.OnTimeRate)
+	assert.Equal(t, 24.0, performance.AverageDelay)
+
+	// Transit hours: 24, 24, 48, 72
+	assert.Equal(t, 42.0, performance.AverageTransit)
+	assert.Equal(t, 36.0, performance.P50Transit)
+	assert.Equal(t, 64.8, performance.P90Transit)
+	assert.Equal(t, "1.8 days", performance.AverageDeliveryTime)
+	assert.Equal(t, "66.7%", performance.SuccessRate)
+
+	require.Len(t, performance.ByDestination, 3)
+	assert.Equal(t, "Jakarta", performance.ByDestination[0].Destination)
+	assert.Equal(t, 50.0, performance.ByDestination[0].OnTimeRate)
+	assert.Equal(t, "Surabaya", performance.ByDestination[1].Destination)
+	assert.Nil(t, performance.Series)
+
+	series := summarizeShipments(shipments, ShipmentModeTimeseries, IntervalWeek, now)
+	assert.Equal(t, performance.ShipmentKPIs, series.ShipmentKPIs)
+	assert.Nil(t, series.ByDestination)
+	require.Len(t, series.Series, 3)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), series.Series[0].Period)
+	assert.Equal(t, 3, series.Series[0].TotalShipments)
+	assert.Equal(t, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC), series.Series[1].Period)
+	assert.Equal(t, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), series.Series[2].Period)
+}
+
+func TestTruncate(t *testing.T) {
+	sunday := time.Date(2024, 1, 14, 18, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC), truncate(sunday, IntervalDay))
+	assert.Equal(t, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC), truncate(sunday, IntervalWeek))
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), truncate(sunday, IntervalMonth))
+}
+
+func TestPercentile(t *testing.T) {
+	assert.Zero(t, percentile(nil, 50))
+	assert.Equal(t, 5.0, percentile([]float64{5}, 95))
+	assert.Equal(t, 2.5, percentile([]float64{1, 2, 3, 4}, 50))
+	assert.Equal(t, 4.0, percentile([]float64{1, 2, 3, 4}, 100))
+}
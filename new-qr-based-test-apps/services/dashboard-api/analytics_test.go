@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/database"
+	"warehouse-shared/database/mongotest"
+	"warehouse-shared/models"
+)
+
+func TestParseAnalyticsFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	parse := func(query string) (analyticsFilter, int) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/?"+query, nil)
+		filter, ok := parseAnalyticsFilter(c)
+		if ok {
+			return filter, http.StatusOK
+		}
+		return filter, w.Code
+	}
+
+	filter, status := parse("")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, IntervalDay, filter.Interval)
+	assert.Equal(t, defaultAnalyticsRange, filter.To.Sub(filter.From))
+
+	filter, status = parse("from=2024-01-01&to=2024-01-31&category=Electronics&warehouseLocation=A-01&interval=week")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), filter.From)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), filter.To, "a day in to includes the whole day")
+	assert.Equal(t, "Electronics", filter.Category)
+	assert.Equal(t, "A-01", filter.Location)
+	assert.Equal(t, IntervalWeek, filter.Interval)
+
+	from, to := filter.previous()
+	assert.Equal(t, time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, filter.From, to)
+
+	_, status = parse("from=2024-01-01T00:00:00Z&to=2024-01-01T12:00:00Z")
+	assert.Equal(t, http.StatusOK, status)
+
+	for _, query := range []string{"interval=year", "from=yesterday", "from=2024-02-01&to=2024-01-01"} {
+		_, status = parse(query)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+	}
+}
+
+func TestSummarizeProfit(t *testing.T) {
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	rows := []profitRow{
+		{ItemID: "ITM-2024-001", Name: "Headphones", Category: "Electronics", Period: day1, Units: 10, Revenue: 900, Cost: 500},
+		{ItemID: "ITM-2024-001", Name: "Headphones", Category: "Electronics", Period: day2, Units: 5, Revenue: 450, Cost: 250},
+		{ItemID: "ITM-2024-002", Name: "T-Shirt", Category: "Clothing", Period: day2, Units: 20, Revenue: 200, Cost: 180},
+		{ItemID: "ITM-2024-003", Name: "Hammer", Category: "Tools", Period: day1, Units: 4, Revenue: 100, Cost: 60},
+		{ItemID: "ITM-2024-001", Period: day1.AddDate(0, 0, -7), Previous: true, Units: 10, Revenue: 900, Cost: 500},
+	}
+
+	analytics := summarizeProfit(rows, 2)
+
+	assert.Equal(t, 660.0, analytics.TotalProfit)
+	assert.Equal(t, 1650.0, analytics.TotalRevenue)
+	assert.Equal(t, 39, analytics.UnitsSold)
+	assert.Equal(t, 40.0, analytics.OverallMargin)
+	// (44.44 + 10 + 40) / 3
+	assert.Equal(t, 31.48, analytics.AverageMargin)
+
+	assert.Equal(t, []string{"ITM-2024-001", "ITM-2024-003"}, analytics.TopPerformers)
+	assert.Equal(t, []string{"ITM-2024-002"}, analytics.LowPerformers)
+	assert.Equal(t, 600.0, analytics.TopItems[0].Profit)
+	assert.Equal(t, 15, analytics.TopItems[0].UnitsSold)
+
+	assert.Equal(t, 400.0, analytics.PreviousProfit)
+	assert.Equal(t, TrendUp, analytics.TrendDirection)
+	assert.Equal(t, 65.0, analytics.ChangePercent)
+
+	require.Len(t, analytics.Series, 2)
+	assert.Equal(t, day1, analytics.Series[0].Period)
+	assert.Equal(t, 440.0, analytics.Series[0].Profit)
+	assert.Equal(t, 220.0, analytics.Series[1].Profit)
+}
+
+func TestSummarizeProfitNetsReturns(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := []profitRow{
+		{ItemID: "ITM-2024-001", Name: "Headphones", Category: "Electronics", Period: day, Units: 10, Revenue: 900, Cost: 500},
+		// only returns of the T-shirt in the period
+		{ItemID: "ITM-2024-002", Name: "T-Shirt", Category: "Clothing", Period: day, Units: -2, Revenue: -48, Cost: -24},
+	}
+
+	analytics := summarizeProfit(rows, 1)
+
+	assert.Equal(t, 8, analytics.UnitsSold)
+	assert.Equal(t, 852.0, analytics.TotalRevenue)
+	assert.Equal(t, 476.0, analytics.TotalCost)
+	assert.Equal(t, 376.0, analytics.TotalProfit)
+	assert.Equal(t, []string{"ITM-2024-002"}, analytics.LowPerformers)
+	assert.Equal(t, -24.0, analytics.LowItems[0].Profit)
+	assert.Equal(t, -2, analytics.LowItems[0].UnitsSold)
+}
+
+func TestProfitAnalyticsNetsReturns(t *testing.T) {
+	db := mongotest.Connect(t)
+	ctx := context.Background()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := db.GetCollection(database.ItemsCollection).InsertOne(ctx, models.Item{
+		ItemID: "ITM-2024-001", Name: "Headphones", Category: "Electronics", CostPrice: 60, SellingPrice: 99,
+	})
+	require.NoError(t, err)
+	_, err = db.GetCollection(database.StockMovementsCollection).InsertMany(ctx, []interface{}{
+		models.StockMovement{ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: -10, UnitCost: 50, UnitPrice: 90, COGS: 500,
+			WarehouseLocation: "JKT-A-01-R1-B01", CreatedAt: day.Add(9 * time.Hour)},
+		// returned at the price and cost of the day of the return, not the item's current ones
+		models.StockMovement{ItemID: "ITM-2024-001", Type: models.MovementReturn, Quantity: 2, UnitCost: 55, UnitPrice: 95,
+			WarehouseLocation: "JKT-A-02-R1-B01", CreatedAt: day.Add(15 * time.Hour)},
+		models.StockMovement{ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 20, UnitCost: 50, UnitPrice: 90,
+			WarehouseLocation: "JKT-A-01-R1-B01", CreatedAt: day.Add(8 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	services := &Services{MongoDB: db}
+	filter := analyticsFilter{From: day, To: day.AddDate(0, 0, 1), Interval: IntervalDay}
+	analytics, err := services.profitAnalytics(ctx, filter)
+	require.NoError(t, err)
+
+	assert.Equal(t, 8, analytics.UnitsSold)
+	assert.Equal(t, 710.0, analytics.TotalRevenue)
+	assert.Equal(t, 390.0, analytics.TotalCost)
+	assert.Equal(t, 320.0, analytics.TotalProfit)
+
+	for location, units := range map[string]int{"JKT": 8, "JKT-A-01": 10, "JKT-A-01-R1-B01": 10, "JKT-A-0": 0, "SBY": 0} {
+		filter.Location = location
+		analytics, err = services.profitAnalytics(ctx, filter)
+		require.NoError(t, err)
+		assert.Equal(t, units, analytics.UnitsSold, "locations take in the bins inside them: %s", location)
+	}
+}
+
+func TestSummarizeProfitEmpty(t *testing.T) {
+	analytics := summarizeProfit(nil, performersLimit)
+
+	assert.Zero(t, analytics.TotalProfit)
+	assert.Equal(t, TrendStable, analytics.TrendDirection)
+	assert.NotNil(t, analytics.TopPerformers)
+	assert.NotNil(t, analytics.Series)
+}
+
+func TestTrend(t *testing.T) {
+	direction, change := trend(95, 100)
+	assert.Equal(t, TrendDown, direction)
+	assert.Equal(t, -5.0, change)
+
+	direction, _ = trend(100.5, 100)
+	assert.Equal(t, TrendStable, direction)
+
+	direction, _ = trend(10, 0)
+	assert.Equal(t, TrendUp, direction)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+)
+
+// Mover classes of the inventory turnover
+const (
+	MoverFast = "fast"
+	MoverSlow = "slow"
+	MoverDead = "dead"
+)
+
+// defaultFastTurnover is the annualized turnover from which an item is a fast mover
+const defaultFastTurnover = 4.0
+
+// turnoverThresholds classify the items. Items with no outbound quantity in
+// the window, or an annualized turnover below DeadTurnover, are dead stock;
+// the others are fast or slow movers depending on their annualized turnover.
+type turnoverThresholds struct {
+	FastTurnover float64 `json:"fastTurnover"`
+	DeadTurnover float64 `json:"deadTurnover"` // 0: only items with nothing going out
+}
+
+// ItemTurnover is the turnover of one item over the window
+type ItemTurnover struct {
+	ItemID            string   `json:"itemId"`
+	Name              string   `json:"name"`
+	Category          string   `json:"category"`
+	WarehouseLocation string   `json:"warehouseLocation"`
+	StockLevel        int      `json:"stockLevel"`
+	OutboundUnits     int      `json:"outboundUnits"`
+	COGS              float64  `json:"cogs"`
+	AverageInventory  float64  `json:"averageInventoryValue"`
+	Turnover          float64  `json:"turnover"`
+	AnnualTurnover    float64  `json:"annualTurnover"`
+	DaysOnHand        *float64 `json:"daysOnHand"` // null when nothing went out
+	Class             string   `json:"class"`
+}
+
+// CategoryTurnover is the turnover of one category over the window
+type CategoryTurnover struct {
+	Category         string   `json:"category"`
+	Items            int      `json:"items"`
+	OutboundUnits    int      `json:"outboundUnits"`
+	COGS             float64  `json:"cogs"`
+	AverageInventory float64  `json:"averageInventoryValue"`
+	Turnover         float64  `json:"turnover"`
+	AnnualTurnover   float64  `json:"annualTurnover"`
+	DaysOnHand       *float64 `json:"daysOnHand"`
+}
+
+// InventoryTurnover is the response of the inventory turnover endpoint
+type InventoryTurnover struct {
+	TotalItems      int                `json:"totalItems"`
+	FastMoving      int                `json:"fastMoving"`
+	SlowMoving      int                `json:"slowMoving"`
+	DeadStock       int                `json:"deadStock"`
+	COGS            float64            `json:"cogs"`
+	AverageTurnover float64            `json:"averageTurnover"`
+	DaysOnHand      *float64           `json:"daysOnHand"`
+	Categories      map[string]float64 `json:"categories"` // turnover per category
+	CategoryDetails []CategoryTurnover `json:"categoryDetails"`
+	Items           []ItemTurnover     `json:"items"`
+	Thresholds      turnoverThresholds `json:"thresholds"`
+}
+
+// itemMovements are the movement totals of one item from the start of the window
+type itemMovements struct {
+	ItemID        string  `bson:"_id"`
+	OutboundUnits int     `bson:"outboundUnits"` // issued in the window
+	COGS          float64 `bson:"cogs"`          // cost of the units issued in the window
+	NetInWindow   int     `bson:"netInWindow"`   // stock change in the window
+	NetAfter      int     `bson:"netAfter"`      // stock change since the end of the window
+}
+
+// turnoverRatios computes the turnover and days on hand of a cost of goods
+// sold against an average inventory value over a window
+func turnoverRatios(cogs, averageInventory float64, days float64) (turnover, annual float64, daysOnHand *float64) {
+	if averageInventory > 0 {
+		turnover = cogs / averageInventory
+		annual = turnover * 365 / days
+	}
+	if cogs > 0 {
+		onHand := round2(averageInventory / (cogs / days))
+		daysOnHand = &onHand
+	}
+	return round2(turnover), round2(annual), daysOnHand
+}
+
+// summarizeTurnover rebuilds each item's stock at the start and end of the
+// window from its current level and movements, then computes the turnover
+// per item, per category and overall
+func summarizeTurnover(items []*models.Item, movements map[string]itemMovements, window time.Duration, thresholds turnoverThresholds) *InventoryTurnover {
+	days := window.Hours() / 24
+	result := &InventoryTurnover{
+		Categories:      make(map[string]float64),
+		CategoryDetails: []CategoryTurnover{},
+		Items:           []ItemTurnover{},
+		Thresholds:      thresholds,
+	}
+
+	categories := make(map[string]*CategoryTurnover)
+	var totalInventory float64
+
+	for _, item := range items {
+		result.TotalItems++
+		moved := movements[item.ItemID]
+
+		end := item.StockLevel - moved.NetAfter
+		begin := end - moved.NetInWindow
+		average := float64(begin+end) / 2 * item.CostPrice
+		if average < 0 {
+			average = 0
+		}
+
+		// Out of stock for the whole window and nothing moved: not stock to classify
+		if begin <= 0 && end <= 0 && moved.OutboundUnits == 0 {
+			continue
+		}
+
+		turnover, annual, daysOnHand := turnoverRatios(moved.COGS, average, days)
+		entry := ItemTurnover{
+			ItemID:            item.ItemID,
+			Name:              item.Name,
+			Category:          item.Category,
+			WarehouseLocation: item.WarehouseLocation,
+			StockLevel:        item.StockLevel,
+			OutboundUnits:     moved.OutboundUnits,
+			COGS:              round2(moved.COGS),
+			AverageInventory:  round2(average),
+			Turnover:          turnover,
+			AnnualTurnover:    annual,
+			DaysOnHand:        daysOnHand,
+		}
+
+		switch {
+		case moved.OutboundUnits == 0, average > 0 && annual < thresholds.DeadTurnover:
+			entry.Class = MoverDead
+			result.DeadStock++
+		case annual >= thresholds.FastTurnover || average == 0:
+			entry.Class = MoverFast
+			result.FastMoving++
+		default:
+			entry.Class = MoverSlow
+			result.SlowMoving++
+		}
+		result.Items = append(result.Items, entry)
+
+		category, ok := categories[item.Category]
+		if !ok {
+			category = &CategoryTurnover{Category: item.Category}
+			categories[item.Category] = category
+		}
+		category.Items++
+		category.OutboundUnits += moved.OutboundUnits
+		category.COGS += moved.COGS
+		category.AverageInventory += average
+
+		result.COGS += moved.COGS
+		totalInventory += average
+	}
+
+	for _, category := range categories {
+		category.Turnover, category.AnnualTurnover, category.DaysOnHand = turnoverRatios(category.COGS, category.AverageInventory, days)
+		category.COGS = round2(category.COGS)
+		category.AverageInventory = round2(category.AverageInventory)
+		result.Categories[category.Category] = category.Turnover
+		result.CategoryDetails = append(result.CategoryDetails, *category)
+	}
+	sort.Slice(result.CategoryDetails, func(i, j int) bool {
+		return result.CategoryDetails[i].Category < result.CategoryDetails[j].Category
+	})
+
+	result.AverageTurnover, _, result.DaysOnHand = turnoverRatios(result.COGS, totalInventory, days)
+	result.COGS = round2(result.COGS)
+
+	sort.Slice(result.Items, func(i, j int) bool {
+		if result.Items[i].Turnover != result.Items[j].Turnover {
+			return result.Items[i].Turnover > result.Items[j].Turnover
+		}
+		return result.Items[i].ItemID < result.Items[j].ItemID
+	})
+	return result
+}
+
+// inventoryTurnover loads the items matching the filter and the totals of
+// their movements since the start of the window
+func (s *Services) inventoryTurnover(ctx context.Context, filter analyticsFilter, thresholds turnoverThresholds) (*InventoryTurnover, error) {
+	query := bson.M{}
+	if filter.Category != "" {
+		query["category"] = filter.Category
+	}
+	if filter.Location != "" {
+		query["warehouseLocation"] = inventory.Within(filter.Location)
+	}
+
+	opts := options.Find().SetProjection(bson.M{
+		"itemId":            1,
+		"name":              1,
+		"category":          1,
+		"warehouseLocation": 1,
+		"costPrice":         1,
+		"stockLevel":        1,
+	})
+	cursor, err := s.MongoDB.GetCollection(database.ItemsCollection).Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find items: %w", err)
+	}
+	var items []*models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+
+	itemIDs := make([]string, len(items))
+	costs := make(map[string]float64, len(items))
+	for i, item := range items {
+		itemIDs[i] = item.ItemID
+		costs[item.ItemID] = item.CostPrice
+	}
+
+	match := bson.M{"createdAt": bson.M{"$gte": filter.From}}
+	if len(query) > 0 {
+		match["itemId"] = bson.M{"$in": itemIDs}
+	}
+
+	inWindow := bson.M{"$lt": bson.A{"$createdAt", filter.To}}
+	issued := bson.M{"$and": bson.A{inWindow, bson.M{"$eq": bson.A{"$type", models.MovementIssue}}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           "$itemId",
+			"outboundUnits": bson.M{"$sum": bson.M{"$cond": bson.A{issued, bson.M{"$abs": "$quantity"}, 0}}},
+			"cogsRecorded": bson.M{"$sum": bson.M{"$cond": bson.A{issued,
+				bson.M{"$ifNull": bson.A{"$cogs", bson.M{"$multiply": bson.A{bson.M{"$abs": "$quantity"}, "$unitCost"}}}}, 0}}},
+			"unpricedUnits": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{issued, bson.M{"$lte": bson.A{"$unitCost", 0}}}},
+				bson.M{"$abs": "$quantity"}, 0,
+			}}},
+			"netInWindow": bson.M{"$sum": bson.M{"$cond": bson.A{inWindow, "$quantity", 0}}},
+			"netAfter":    bson.M{"$sum": bson.M{"$cond": bson.A{inWindow, 0, "$quantity"}}},
+		}}},
+	}
+
+	cursor, err = s.MongoDB.GetCollection(database.StockMovementsCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate stock movements: %w", err)
+	}
+	var rows []struct {
+		itemMovements `bson:",inline"`
+		COGSRecorded  float64 `bson:"cogsRecorded"`
+		UnpricedUnits int     `bson:"unpricedUnits"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode movement totals: %w", err)
+	}
+
+	// Issues recorded without a unit cost are valued at the item's current cost
+	movements := make(map[string]itemMovements, len(rows))
+	for _, row := range rows {
+		moved := row.itemMovements
+		moved.COGS = row.COGSRecorded + float64(row.UnpricedUnits)*costs[row.ItemID]
+		movements[row.ItemID] = moved
+	}
+
+	return summarizeTurnover(items, movements, filter.To.Sub(filter.From), thresholds), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/database"
+	"warehouse-shared/database/mongotest"
+	"warehouse-shared/models"
+)
+
+func TestSummarizeTurnover(t *testing.T) {
+	items := []*models.Item{
+		{ItemID: "ITM-2024-001", Category: "Electronics", CostPrice: 10, StockLevel: 20},
+		{ItemID: "ITM-2024-002", Category: "Electronics", CostPrice: 5, StockLevel: 100},
+		{ItemID: "ITM-2024-003", Category: "Books", CostPrice: 2, StockLevel: 50},
+		{ItemID: "ITM-2024-004", Category: "Books", CostPrice: 2, StockLevel: 0},
+	}
+	movements := map[string]itemMovements{
+		// 80 issued in the window, 20 received after it: 80 at the start, 0 at the end
+		"ITM-2024-001": {OutboundUnits: 80, COGS: 800, NetInWindow: -80, NetAfter: 20},
+		// 10 issued in the window: 110 at the start, 100 at the end
+		"ITM-2024-002": {OutboundUnits: 10, COGS: 50, NetInWindow: -10},
+	}
+
+	turnover := summarizeTurnover(items, movements, 30*24*time.Hour, turnoverThresholds{FastTurnover: defaultFastTurnover})
+
+	assert.Equal(t, 4, turnover.TotalItems)
+	assert.Equal(t, 1, turnover.FastMoving)
+	assert.Equal(t, 1, turnover.SlowMoving)
+	assert.Equal(t, 1, turnover.DeadStock)
+	require.Len(t, turnover.Items, 3, "out of stock items without movements are not classified")
+
+	fast := turnover.Items[0]
+	assert.Equal(t, "ITM-2024-001", fast.ItemID)
+	assert.Equal(t, MoverFast, fast.Class)
+	assert.Equal(t, 400.0, fast.AverageInventory)
+	assert.Equal(t, 2.0, fast.Turnover)
+	assert.Equal(t, 24.33, fast.AnnualTurnover)
+	require.NotNil(t, fast.DaysOnHand)
+	assert.Equal(t, 15.0, *fast.DaysOnHand)
+
+	slow := turnover.Items[1]
+	assert.Equal(t, MoverSlow, slow.Class)
+	assert.Equal(t, 525.0, slow.AverageInventory)
+	assert.Equal(t, 0.1, slow.Turnover)
+	assert.Equal(t, 315.0, *slow.DaysOnHand)
+
+	dead := turnover.Items[2]
+	assert.Equal(t, "ITM-2024-003", dead.ItemID)
+	assert.Equal(t, MoverDead, dead.Class)
+	assert.Nil(t, dead.DaysOnHand)
+
+	assert.Equal(t, 850.0, turnover.COGS)
+	assert.Equal(t, 0.83, turnover.AverageTurnover)
+	assert.Equal(t, map[string]float64{"Electronics": 0.92, "Books": 0}, turnover.Categories)
+	require.Len(t, turnover.CategoryDetails, 2)
+	assert.Equal(t, "Books", turnover.CategoryDetails[0].Category)
+	assert.Equal(t, 90, turnover.CategoryDetails[1].OutboundUnits)
+
+	// A higher threshold turns the fast mover into a slow one
+	turnover = summarizeTurnover(items, movements, 30*24*time.Hour, turnoverThresholds{FastTurnover: 30})
+	assert.Equal(t, 0, turnover.FastMoving)
+	assert.Equal(t, 2, turnover.SlowMoving)
+}
+
+func TestTurnoverDeadThreshold(t *testing.T) {
+	// Over a year the annualized turnover is the turnover: COGS over an
+	// average inventory value of 100
+	items := []*models.Item{
+		{ItemID: "ITM-2024-001", CostPrice: 1, StockLevel: 100},
+		{ItemID: "ITM-2024-002", CostPrice: 1, StockLevel: 100},
+		{ItemID: "ITM-2024-003", CostPrice: 1, StockLevel: 100},
+		{ItemID: "ITM-2024-004", CostPrice: 1, StockLevel: 100},
+	}
+	movements := map[string]itemMovements{
+		"ITM-2024-001": {OutboundUnits: 400, COGS: 400},
+		"ITM-2024-002": {OutboundUnits: 100, COGS: 100},
+		"ITM-2024-003": {OutboundUnits: 50, COGS: 50},
+	}
+	classes := func(thresholds turnoverThresholds) map[string]string {
+		turnover := summarizeTurnover(items, movements, 365*24*time.Hour, thresholds)
+		result := map[string]string{}
+		for _, item := range turnover.Items {
+			result[item.ItemID] = item.Class
+		}
+		return result
+	}
+
+	assert.Equal(t, map[string]string{
+		"ITM-2024-001": MoverFast, // at the fast threshold
+		"ITM-2024-002": MoverSlow,
+		"ITM-2024-003": MoverSlow,
+		"ITM-2024-004": MoverDead, // nothing went out
+	}, classes(turnoverThresholds{FastTurnover: 4}))
+
+	assert.Equal(t, map[string]string{
+		"ITM-2024-001": MoverFast,
+		"ITM-2024-002": MoverSlow, // at the dead threshold
+		"ITM-2024-003": MoverDead, // under it
+		"ITM-2024-004": MoverDead,
+	}, classes(turnoverThresholds{FastTurnover: 4, DeadTurnover: 1}))
+}
+
+func TestTurnoverThresholdsValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	for _, query := range []string{"fastTurnover=0", "deadTurnover=-1", "deadTurnover=slow", "deadTurnover=4", "fastTurnover=2&deadTurnover=3"} {
+		w := performRequest(router, http.MethodGet, "/api/v1/analytics/inventory-turnover?"+query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestInventoryTurnoverLocationFilter(t *testing.T) {
+	db := mongotest.Connect(t)
+	ctx := context.Background()
+	_, err := db.GetCollection(database.ItemsCollection).InsertMany(ctx, []interface{}{
+		models.Item{ItemID: "ITM-2024-001", Category: "Electronics", CostPrice: 10, StockLevel: 20, WarehouseLocation: "JKT-A-01-R1-B01"},
+		models.Item{ItemID: "ITM-2024-002", Category: "Electronics", CostPrice: 10, StockLevel: 20, WarehouseLocation: "JKT-B-01-R1-B01"},
+		models.Item{ItemID: "ITM-2024-003", Category: "Electronics", CostPrice: 10, StockLevel: 20, WarehouseLocation: "SBY-A-01-R1-B01"},
+	})
+	require.NoError(t, err)
+
+	services := &Services{MongoDB: db}
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	for location, items := range map[string]int{"": 3, "JKT": 2, "JKT-A": 1, "JKT-A-01-R1-B01": 1, "JK": 0} {
+		turnover, err := services.inventoryTurnover(ctx, analyticsFilter{From: to.AddDate(0, -3, 0), To: to, Location: location},
+			turnoverThresholds{FastTurnover: defaultFastTurnover})
+		require.NoError(t, err)
+		assert.Equal(t, items, turnover.TotalItems, "locations take in the bins inside them: %q", location)
+	}
+}
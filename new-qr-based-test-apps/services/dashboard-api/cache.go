@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/cache"
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// Cached endpoints and lookups, configured with CACHE_TTLS
+const (
+	CacheDashboardStats      = "dashboard-stats"
+	CacheProfitMargins       = "profit-margins"
+	CacheShipmentPerformance = "shipment-performance"
+	CacheInventoryTurnover   = "inventory-turnover"
+	CacheItemBarcode         = "item-barcode"
+)
+
+// defaultCacheTTLs are the TTLs used unless CACHE_TTLS overrides them. The
+// entries are also invalidated by events, so the TTLs mostly bound the
+// staleness of data that changes without one, like scans and the time window.
+var defaultCacheTTLs = cache.TTLs{
+	CacheDashboardStats:      15 * time.Second,
+	CacheProfitMargins:       time.Minute,
+	CacheShipmentPerformance: time.Minute,
+	CacheInventoryTurnover:   5 * time.Minute,
+	CacheItemBarcode:         10 * time.Minute,
+}
+
+// errItemNotFound is returned when no item matches a lookup
+var errItemNotFound = errors.New("item not found")
+
+// cached reads a response through the cache. The key is the cache name and
+// the sorted query string, so every filter combination has its own entry.
+// The export format is left out: exports are built from the same data.
+func (h *Handlers) cached(c *gin.Context, name string, tags []string, dest interface{}, load cache.LoadFunc) error {
+	query := c.Request.URL.Query()
+	query.Del("format")
+	key := name + "?" + query.Encode()
+	return h.services.Cache.GetOrLoad(c.Request.Context(), key, h.services.CacheTTLs.Get(name), tags, dest, load)
+}
+
+// itemByBarcode looks an item up by barcode in two cached steps: the
+// barcode resolves to an item ID, invalidated when any item is created,
+// updated or deleted, and the item itself is invalidated by its own events.
+func (s *Services) itemByBarcode(ctx context.Context, barcode string) (*models.Item, error) {
+	ttl := s.CacheTTLs.Get(CacheItemBarcode)
+
+	var itemID string
+	err := s.Cache.GetOrLoad(ctx, "barcode:"+barcode, ttl, []string{cache.TagItems}, &itemID, func(ctx context.Context) (interface{}, error) {
+		var item models.Item
+		opts := options.FindOne().SetProjection(bson.M{"itemId": 1})
+		if err := s.MongoDB.GetCollection(database.ItemsCollection).FindOne(ctx, bson.M{"barcode": barcode}, opts).Decode(&item); err != nil {
+			return nil, err
+		}
+		return item.ItemID, nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errItemNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find item by barcode: %w", err)
+	}
+
+	return s.itemByID(ctx, itemID)
+}
+
+// itemByID returns an item through the cache
+func (s *Services) itemByID(ctx context.Context, itemID string) (*models.Item, error) {
+	var item models.Item
+	err := s.Cache.GetOrLoad(ctx, "item:"+itemID, s.CacheTTLs.Get(CacheItemBarcode), []string{cache.TagItem(itemID)}, &item, func(ctx context.Context) (interface{}, error) {
+		var item models.Item
+		if err := s.MongoDB.GetCollection(database.ItemsCollection).FindOne(ctx, bson.M{"itemId": itemID}).Decode(&item); err != nil {
+			return nil, err
+		}
+		return &item, nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errItemNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+	return &item, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/cache"
+)
+
+func TestCachedKeysByQuery(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	router, services := newTestRouter(t)
+	services.Cache = cache.NewCache(client, cache.DefaultConfig())
+	services.CacheTTLs = defaultCacheTTLs
+
+	loads := map[string]int{}
+	router.GET("/cached", func(c *gin.Context) {
+		var value string
+		err := NewHandlers(services).cached(c, CacheProfitMargins, []string{cache.TagInventory}, &value, func(ctx context.Context) (interface{}, error) {
+			loads[c.Query("category")]++
+			return c.Query("category"), nil
+		})
+		require.NoError(t, err)
+		c.String(http.StatusOK, value)
+	})
+
+	for _, path := range []string{"/cached?category=a", "/cached?category=a", "/cached?category=b"} {
+		w := performRequest(router, http.MethodGet, path)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, loads)
+
+	require.NoError(t, services.Cache.Invalidate(context.Background(), cache.TagInventory))
+	w := performRequest(router, http.MethodGet, "/cached?category=a")
+	assert.Equal(t, "a", w.Body.String())
+	assert.Equal(t, 2, loads["a"])
+}
+
+func TestCacheTTLOverrides(t *testing.T) {
+	ttls, err := cache.ParseTTLs("item-barcode=0s, profit-margins=2m", defaultCacheTTLs)
+	require.NoError(t, err)
+
+	assert.Zero(t, ttls.Get(CacheItemBarcode))
+	assert.Equal(t, 2*time.Minute, ttls.Get(CacheProfitMargins))
+	assert.Equal(t, defaultCacheTTLs[CacheDashboardStats], ttls.Get(CacheDashboardStats))
+	assert.Equal(t, time.Minute, defaultCacheTTLs[CacheProfitMargins], "defaults must not be modified")
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
+)
+
+// countTaskRequest is the body of the generate count task endpoint
+type countTaskRequest struct {
+	Method     string `json:"method" validate:"required,oneof=zone abc random"`
+	Location   string `json:"location" validate:"max=100"`
+	Class      string `json:"class" validate:"omitempty,oneof=A B C"`
+	Days       int    `json:"days" validate:"min=0,max=365"`
+	Size       int    `json:"size" validate:"min=0,max=100"`
+	AssignedTo string `json:"assignedTo" validate:"required"`
+}
+
+// countAssigneeRequest is the body of the assign count task endpoint
+type countAssigneeRequest struct {
+	AssignedTo string `json:"assignedTo" validate:"required"`
+}
+
+// countScanRequest is the body of the scan endpoint: a bin barcode, or an
+// item barcode or ID with the units scanned, 1 by default
+type countScanRequest struct {
+	Barcode  string `json:"barcode" validate:"required,max=100"`
+	Quantity int    `json:"quantity" validate:"min=0,max=100000"`
+}
+
+// recountRequest is the body of the recount endpoint
+type recountRequest struct {
+	ItemID   string `json:"itemId" validate:"required"`
+	Location string `json:"location" validate:"required"`
+	Counted  *int   `json:"counted" validate:"required,min=0"`
+}
+
+// GetCountTasks lists count tasks, newest first, by status, assignee and
+// method, a page at a time or all of them as an export
+func (h *Handlers) GetCountTasks(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	filter := inventory.CountFilter{
+		Status:     c.Query("status"),
+		AssignedTo: c.Query("assignedTo"),
+		Method:     c.Query("method"),
+	}
+	statuses := []string{models.CountOpen, models.CountInProgress, models.CountPendingApproval, models.CountPosted, models.CountCancelled}
+	if filter.Status != "" && !contains(statuses, filter.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown count status " + filter.Status})
+		return
+	}
+	if filter.Method != "" && !contains([]string{models.CountByZone, models.CountByClass, models.CountAtRandom}, filter.Method) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown count method " + filter.Method})
+		return
+	}
+
+	if format != "" {
+		exportCursor(h, c, format, "count-tasks", filter, h.services.Counts.Cursor, countTasksDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	tasks, total, err := h.services.Counts.List(c.Request.Context(), filter, offset, pagination.GetPageSize())
+	if err != nil {
+		h.internalError(c, "Failed to list count tasks", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tasks": tasks,
+		"total": total,
+		"page":  pagination.Page,
+	})
+}
+
+// CreateCountTask generates a count task of the bins within a location,
+// of the items of an ABC class or of a random sample of items, assigned to
+// an operator
+func (h *Handlers) CreateCountTask(c *gin.Context) {
+	var req countTaskRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.services.Counts.Generate(c.Request.Context(), inventory.NewCountTask{
+		Method:     req.Method,
+		Location:   req.Location,
+		Class:      req.Class,
+		Days:       req.Days,
+		Size:       req.Size,
+		AssignedTo: req.AssignedTo,
+		UserID:     currentClaims(c).UserID,
+	})
+	if err != nil {
+		h.countError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, task)
+}
+
+// GetCountTask returns a count task with its lines and variances
+func (h *Handlers) GetCountTask(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	task, err := h.services.Counts.Get(c.Request.Context(), id)
+	if err != nil {
+		h.countError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// AssignCountTask hands a count task that is not submitted yet to another
+// operator
+func (h *Handlers) AssignCountTask(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req countAssigneeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.services.Counts.Assign(c.Request.Context(), id, req.AssignedTo)
+	if err != nil {
+		h.countError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// CancelCountTask cancels a count task that is not submitted yet
+func (h *Handlers) CancelCountTask(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	task, err := h.services.Counts.Cancel(c.Request.Context(), id, currentClaims(c).UserID)
+	if err != nil {
+		h.countError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// ScanCountTask records a scan of the operator of a count task: a bin to
+// count, then the items in it
+func (h *Handlers) ScanCountTask(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req countScanRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	scan, err := h.services.Counts.Scan(c.Request.Context(), id, currentClaims(c).UserID, req.Barcode, req.Quantity)
+	if err != nil {
+		h.countError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, scan)
+}
+
+// RecountCountLine sets the counted quantity of an item in a counted bin,
+// correcting its scans
+func (h *Handlers) RecountCountLine(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req recountRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.services.Counts.Recount(c.Request.Context(), id, currentClaims(c).UserID, req.ItemID, req.Location, *req.Counted)
+	if err != nil {
+		h.countError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// SubmitCountTask closes the count of a task, posting the variances within
+// the approval threshold as stock adjustments
+func (h *Handlers) SubmitCountTask(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	task, err := h.services.Counts.Submit(c.Request.Context(), id, currentClaims(c).UserID)
+	if err != nil {
+		h.countError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// ApproveCountTask posts the adjustments of a count task above the approval
+// threshold
+func (h *Handlers) ApproveCountTask(c *gin.Context) {
+	h.reviewCountTask(c, true)
+}
+
+// RejectCountTask leaves the stock of the adjustments of a count task above
+// the approval threshold as it is
+func (h *Handlers) RejectCountTask(c *gin.Context) {
+	h.reviewCountTask(c, false)
+}
+
+// reviewCountTask approves or rejects the pending adjustments of a task
+func (h *Handlers) reviewCountTask(c *gin.Context, approve bool) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	task, err := h.services.Counts.Review(c.Request.Context(), id, currentClaims(c).UserID, approve)
+	if err != nil {
+		h.countError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// countError maps count store errors to HTTP responses
+func (h *Handlers) countError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrCountNotFound), errors.Is(err, inventory.ErrUnknownBarcode):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrInvalidCount), errors.Is(err, inventory.ErrInvalidMovement):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrCountAssignee):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrCountStatus), errors.Is(err, inventory.ErrCountIncomplete),
+		errors.Is(err, inventory.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Count request failed", err)
+	}
+}
+
+// countTasksDocument is the export of the count tasks of a cursor
+func countTasksDocument(ctx context.Context, cursor *mongo.Cursor, filter inventory.CountFilter) *export.Document {
+	subtitle := ""
+	for _, part := range [][2]string{{"status", filter.Status}, {"assigned to", filter.AssignedTo}, {"method", filter.Method}} {
+		if part[1] != "" {
+			if subtitle != "" {
+				subtitle += ", "
+			}
+			subtitle += part[0] + " " + part[1]
+		}
+	}
+	if subtitle == "" {
+		subtitle = "All tasks"
+	}
+
+	return &export.Document{
+		Title:    "Cycle count tasks",
+		Subtitle: subtitle,
+		Tables: []export.Table{{
+			Title: "Tasks",
+			Columns: []export.Column{
+				{Title: "Task ID", Width: 1.5},
+				{Title: "Method"},
+				{Title: "Scope"},
+				{Title: "Status"},
+				{Title: "Assigned to"},
+				{Title: "Bins", Type: export.Integer, Total: true},
+				{Title: "Counted", Type: export.Integer, Total: true},
+				{Title: "Variances", Type: export.Integer, Total: true},
+				{Title: "Created", Type: export.Date},
+				{Title: "Reviewed", Type: export.Date},
+			},
+			Rows: cursorRows(ctx, cursor, func(t *models.CountTask) []interface{} {
+				return []interface{}{t.ID.Hex(), t.Method, t.Scope, t.Status, t.AssignedTo,
+					len(t.Bins), len(t.Counted), len(t.Variances), t.CreatedAt, t.ReviewedAt}
+			}),
+		}},
+	}
+}
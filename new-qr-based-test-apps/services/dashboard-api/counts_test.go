@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/auth"
+)
+
+func TestCountRoutesValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/counts")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	task := `{"method": "zone", "location": "JKT-A", "assignedTo": "user-2"}`
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/counts", task)
+	assert.Equal(t, http.StatusForbidden, w.Code, "operators do not generate count tasks")
+
+	for name, body := range map[string]string{
+		"unknown method": `{"method": "weekly", "assignedTo": "user-2"}`,
+		"unknown class":  `{"method": "abc", "class": "D", "assignedTo": "user-2"}`,
+		"huge sample":    `{"method": "random", "size": 1000, "assignedTo": "user-2"}`,
+		"nobody":         `{"method": "zone", "location": "JKT-A"}`,
+	} {
+		w = performAuthRequest(t, router, services, auth.AccessLevel3, http.MethodPost, "/api/v1/counts", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+
+	for _, query := range []string{"status=lost", "format=docx"} {
+		w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/counts?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodPost, "/api/v1/counts/not-an-id/scan", `{"barcode": "JKT-A-01-R1-B01"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	id := "65a000000000000000000001"
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodPost, "/api/v1/counts/"+id+"/scan", `{"quantity": 2}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "scans need a barcode")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodPut, "/api/v1/counts/"+id+"/lines", `{"itemId": "ITM-2024-001", "location": "JKT-A-01-R1-B01", "counted": -1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/counts/"+id+"/approve", "")
+	assert.Equal(t, http.StatusForbidden, w.Code, "only supervisors approve adjustments")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/counts/"+id+"/reject", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
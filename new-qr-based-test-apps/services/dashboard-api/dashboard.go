@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/database"
+)
+
+// DashboardStats is the summary shown on the dashboard home page
+type DashboardStats struct {
+	TotalItems        int            `json:"totalItems"` // number of SKUs
+	StockValueAtCost  float64        `json:"stockValueAtCost"`
+	StockValueAtPrice float64        `json:"stockValueAtPrice"`
+	TotalProfit       float64        `json:"totalProfit"` // potential profit of the stock on hand
+	AverageMargin     float64        `json:"averageMargin"`
+	LowStockCount     int            `json:"lowStockCount"`
+	LowStockThreshold int            `json:"lowStockThreshold"`
+	OutOfStockCount   int            `json:"outOfStockCount"`
+	TotalShipments    int            `json:"totalShipments"`
+	ActiveShipments   int            `json:"activeShipments"` // pending, in transit or delayed
+	OverdueShipments  int            `json:"overdueShipments"`
+	ShipmentsByStatus map[string]int `json:"shipmentsByStatus"`
+	ScansToday        ScanCounts     `json:"scansToday"`
+	RecentActivity    []interface{}  `json:"recentActivity"`
+	GeneratedAt       time.Time      `json:"generatedAt"`
+}
+
+// ScanCounts are the scan results of a day
+type ScanCounts struct {
+	Success int `json:"success"`
+	Failure int `json:"failure"`
+}
+
+// activeShipmentStatuses are the statuses of shipments not yet delivered or cancelled
+var activeShipmentStatuses = []string{"pending", "in_transit", "delayed"}
+
+// dashboardStats computes the stats with one aggregation per collection,
+// run concurrently
+func (s *Services) dashboardStats(ctx context.Context, lowStockThreshold int) (*DashboardStats, error) {
+	now := time.Now().UTC()
+	stats := &DashboardStats{
+		LowStockThreshold: lowStockThreshold,
+		ShipmentsByStatus: make(map[string]int),
+		RecentActivity:    []interface{}{},
+		GeneratedAt:       now,
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		errs[0] = s.itemStats(ctx, stats, lowStockThreshold)
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = s.shipmentStats(ctx, stats, now)
+	}()
+	go func() {
+		defer wg.Done()
+		errs[2] = s.scanStats(ctx, stats, now)
+	}()
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// itemStats counts the SKUs and values the stock on hand
+func (s *Services) itemStats(ctx context.Context, stats *DashboardStats, lowStockThreshold int) error {
+	active := bson.M{"$eq": bson.A{"$status", "active"}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":           nil,
+			"totalItems":    bson.M{"$sum": 1},
+			"valueAtCost":   bson.M{"$sum": bson.M{"$multiply": bson.A{"$stockLevel", "$costPrice"}}},
+			"valueAtPrice":  bson.M{"$sum": bson.M{"$multiply": bson.A{"$stockLevel", "$sellingPrice"}}},
+			"averageMargin": bson.M{"$avg": "$profitMargin"},
+			"lowStock": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{active, bson.M{"$gt": bson.A{"$stockLevel", 0}}, bson.M{"$lte": bson.A{"$stockLevel", lowStockThreshold}}}},
+				1, 0,
+			}}},
+			"outOfStock": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{active, bson.M{"$lte": bson.A{"$stockLevel", 0}}}},
+				1, 0,
+			}}},
+		}}},
+	}
+
+	var rows []struct {
+		TotalItems    int     `bson:"totalItems"`
+		ValueAtCost   float64 `bson:"valueAtCost"`
+		ValueAtPrice  float64 `bson:"valueAtPrice"`
+		AverageMargin float64 `bson:"averageMargin"`
+		LowStock      int     `bson:"lowStock"`
+		OutOfStock    int     `bson:"outOfStock"`
+	}
+	if err := s.aggregate(ctx, database.ItemsCollection, pipeline, &rows); err != nil {
+		return fmt.Errorf("failed to aggregate item stats: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	row := rows[0]
+	stats.TotalItems = row.TotalItems
+	stats.StockValueAtCost = round2(row.ValueAtCost)
+	stats.StockValueAtPrice = round2(row.ValueAtPrice)
+	stats.TotalProfit = round2(row.ValueAtPrice - row.ValueAtCost)
+	stats.AverageMargin = round2(row.AverageMargin)
+	stats.LowStockCount = row.LowStock
+	stats.OutOfStockCount = row.OutOfStock
+	return nil
+}
+
+// shipmentStats counts the shipments per status and the overdue ones
+func (s *Services) shipmentStats(ctx context.Context, stats *DashboardStats, now time.Time) error {
+	overdue := bson.M{"$and": bson.A{
+		bson.M{"$in": bson.A{"$status", activeShipmentStatuses}},
+		bson.M{"$eq": bson.A{bson.M{"$type": "$estimatedDelivery"}, "date"}},
+		bson.M{"$lt": bson.A{"$estimatedDelivery", now}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$status",
+			"count":   bson.M{"$sum": 1},
+			"overdue": bson.M{"$sum": bson.M{"$cond": bson.A{overdue, 1, 0}}},
+		}}},
+	}
+
+	var rows []struct {
+		Status  string `bson:"_id"`
+		Count   int    `bson:"count"`
+		Overdue int    `bson:"overdue"`
+	}
+	if err := s.aggregate(ctx, database.ShipmentsCollection, pipeline, &rows); err != nil {
+		return fmt.Errorf("failed to aggregate shipment stats: %w", err)
+	}
+
+	for _, row := range rows {
+		stats.ShipmentsByStatus[row.Status] = row.Count
+		stats.TotalShipments += row.Count
+		stats.OverdueShipments += row.Overdue
+	}
+	for _, status := range activeShipmentStatuses {
+		stats.ActiveShipments += stats.ShipmentsByStatus[status]
+	}
+	return nil
+}
+
+// scanStats counts today's scan results, the day starting at midnight UTC
+func (s *Services) scanStats(ctx context.Context, stats *DashboardStats, now time.Time) error {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"timestamp": bson.M{"$gte": today}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$result", "count": bson.M{"$sum": 1}}}},
+	}
+
+	var rows []struct {
+		Result string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+	if err := s.aggregate(ctx, database.ScanLogsCollection, pipeline, &rows); err != nil {
+		return fmt.Errorf("failed to aggregate scan stats: %w", err)
+	}
+
+	for _, row := range rows {
+		switch row.Result {
+		case "success":
+			stats.ScansToday.Success = row.Count
+		case "failure":
+			stats.ScansToday.Failure = row.Count
+		}
+	}
+	return nil
+}
+
+// aggregate runs a pipeline on a collection and decodes all results
+func (s *Services) aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, results interface{}) error {
+	cursor, err := s.MongoDB.GetCollection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
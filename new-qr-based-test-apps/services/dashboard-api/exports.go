@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	"warehouse-shared/export"
+	"warehouse-shared/models"
+)
+
+// requestedFormat returns the export format of the format query parameter,
+// or an empty format for a JSON response. It responds on unknown formats.
+func requestedFormat(c *gin.Context) (export.Format, bool) {
+	value := c.Query("format")
+	if value == "" || value == "json" {
+		return "", true
+	}
+
+	format, err := export.ParseFormat(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return format, true
+}
+
+// requireExportLevel leaves the public lists and analytics open, but their
+// exports hold every record with its prices, so a format needs a login at
+// an access level. Unknown formats are left to the handler to reject.
+func (h *Handlers) requireExportLevel(level string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := export.ParseFormat(c.Query("format")); err == nil {
+			if !h.authenticate(c) || !permitted(c, level) {
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// export sends a document as an attachment. CSV documents are streamed as
+// their rows are produced, so a failure halfway can only be logged. XLSX
+// and PDF documents are built first and failures get an error response.
+func (h *Handlers) export(c *gin.Context, format export.Format, name string, doc *export.Document) {
+	doc.GeneratedAt = time.Now()
+	filename := format.Filename(name, doc.GeneratedAt)
+
+	if format == export.FormatCSV {
+		c.Header("Content-Type", format.ContentType())
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Status(http.StatusOK)
+		if err := export.Write(c.Writer, format, doc); err != nil {
+			h.services.Logger.Warn("Failed to stream export",
+				zap.String("export", name),
+				zap.Error(err),
+			)
+		}
+		return
+	}
+
+	var body bytes.Buffer
+	if err := export.Write(&body, format, doc); err != nil {
+		h.internalError(c, "Failed to export "+name, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, format.ContentType(), body.Bytes())
+}
+
+// exportCursor sends the documents matching a filter as an export: open
+// gives a cursor over them and document builds the export streaming from it
+func exportCursor[F any](h *Handlers, c *gin.Context, format export.Format, name string, filter F,
+	open func(context.Context, F) (*mongo.Cursor, error),
+	document func(context.Context, *mongo.Cursor, F) *export.Document) {
+	ctx := c.Request.Context()
+	cursor, err := open(ctx, filter)
+	if err != nil {
+		h.internalError(c, "Failed to export "+name, err)
+		return
+	}
+	defer cursor.Close(ctx)
+	h.export(c, format, name, document(ctx, cursor, filter))
+}
+
+// cursorRows returns a row function that decodes the documents of a cursor
+// one at a time into a T and emits the row built from it
+func cursorRows[T any](ctx context.Context, cursor *mongo.Cursor, row func(*T) []interface{}) export.RowFunc {
+	return func(emit func(values ...interface{}) error) error {
+		for cursor.Next(ctx) {
+			var doc T
+			if err := cursor.Decode(&doc); err != nil {
+				return fmt.Errorf("failed to decode export row: %w", err)
+			}
+			if err := emit(row(&doc)...); err != nil {
+				return err
+			}
+		}
+		return cursor.Err()
+	}
+}
+
+// rowsOf returns a row function over the rows built by row for n entries
+func rowsOf(n int, row func(i int) []interface{}) export.RowFunc {
+	return func(emit func(values ...interface{}) error) error {
+		for i := 0; i < n; i++ {
+			if err := emit(row(i)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// filterSubtitle describes the window and filters of an analytics export
+func filterSubtitle(filter analyticsFilter, extra ...string) string {
+	parts := []string{fmt.Sprintf("%s to %s by %s",
+		filter.From.Format("2006-01-02 15:04"), filter.To.Format("2006-01-02 15:04"), filter.Interval)}
+	if filter.Category != "" {
+		parts = append(parts, "category "+filter.Category)
+	}
+	if filter.Location != "" {
+		parts = append(parts, "location "+filter.Location)
+	}
+	for _, part := range extra {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// profitPerformerTable is a table of top or low profit performers
+func profitPerformerTable(title string, performers []ProfitPerformer) export.Table {
+	return export.Table{
+		Title: title,
+		Columns: []export.Column{
+			{Title: "Item ID"},
+			{Title: "Name", Width: 2},
+			{Title: "Category"},
+			{Title: "Units sold", Type: export.Integer, Total: true},
+			{Title: "Revenue", Type: export.Currency, Total: true},
+			{Title: "Profit", Type: export.Currency, Total: true, Bar: true},
+			{Title: "Margin", Type: export.Percent},
+		},
+		Rows: rowsOf(len(performers), func(i int) []interface{} {
+			p := performers[i]
+			return []interface{}{p.ItemID, p.Name, p.Category, p.UnitsSold, p.Revenue, p.Profit, p.ProfitMargin}
+		}),
+	}
+}
+
+// profitDocument is the export of the profit analytics
+func profitDocument(analytics *ProfitAnalytics, filter analyticsFilter) *export.Document {
+	series := analytics.Series
+	return &export.Document{
+		Title:    "Profit margins",
+		Subtitle: filterSubtitle(filter),
+		Figures: []export.Figure{
+			{Label: "Revenue", Value: analytics.TotalRevenue, Type: export.Currency},
+			{Label: "Cost", Value: analytics.TotalCost, Type: export.Currency},
+			{Label: "Profit", Value: analytics.TotalProfit, Type: export.Currency},
+			{Label: "Units sold", Value: analytics.UnitsSold, Type: export.Integer},
+			{Label: "Overall margin", Value: analytics.OverallMargin, Type: export.Percent},
+			{Label: "Average item margin", Value: analytics.AverageMargin, Type: export.Percent},
+			{Label: "Previous period profit", Value: analytics.PreviousProfit, Type: export.Currency},
+			{Label: "Change", Value: analytics.ChangePercent, Type: export.Percent},
+		},
+		Tables: []export.Table{
+			{
+				Title: "Profit by " + filter.Interval,
+				Columns: []export.Column{
+					{Title: "Period", Type: export.Date},
+					{Title: "Units sold", Type: export.Integer, Total: true},
+					{Title: "Revenue", Type: export.Currency, Total: true},
+					{Title: "Profit", Type: export.Currency, Total: true, Bar: true},
+					{Title: "Margin", Type: export.Percent},
+				},
+				Rows: rowsOf(len(series), func(i int) []interface{} {
+					p := series[i]
+					return []interface{}{p.Period, p.UnitsSold, p.Revenue, p.Profit, p.ProfitMargin}
+				}),
+			},
+			profitPerformerTable("Top performers", analytics.TopItems),
+			profitPerformerTable("Low performers", analytics.LowItems),
+		},
+	}
+}
+
+// shipmentKPIColumns are the columns of a table of shipment KPIs after its
+// first column
+var shipmentKPIColumns = []export.Column{
+	{Title: "Shipments", Type: export.Integer, Total: true, Bar: true},
+	{Title: "Delivered", Type: export.Integer, Total: true},
+	{Title: "In transit", Type: export.Integer, Total: true},
+	{Title: "Overdue", Type: export.Integer, Total: true},
+	{Title: "Cancelled", Type: export.Integer, Total: true},
+	{Title: "On time", Type: export.Percent},
+	{Title: "Avg delay (h)", Type: export.Number},
+	{Title: "Avg transit (h)", Type: export.Number},
+	{Title: "P90 transit (h)", Type: export.Number},
+}
+
+// shipmentKPIValues are the values of the shipment KPI columns
+func shipmentKPIValues(first interface{}, k *ShipmentKPIs) []interface{} {
+	return []interface{}{first, k.TotalShipments, k.Delivered, k.InTransit, k.Overdue, k.Cancelled,
+		k.OnTimeRate, k.AverageDelay, k.AverageTransit, k.P90Transit}
+}
+
+// shipmentDocument is the export of the shipment performance
+func shipmentDocument(performance *ShipmentPerformance, filter analyticsFilter, destination string) *export.Document {
+	if destination != "" {
+		destination = "destination " + destination
+	}
+
+	doc := &export.Document{
+		Title:    "Shipment performance",
+		Subtitle: filterSubtitle(filter, destination),
+		Figures: []export.Figure{
+			{Label: "Shipments", Value: performance.TotalShipments, Type: export.Integer},
+			{Label: "Delivered", Value: performance.Delivered, Type: export.Integer},
+			{Label: "On-time rate", Value: performance.OnTimeRate, Type: export.Percent},
+			{Label: "Delayed", Value: performance.Delayed, Type: export.Integer},
+			{Label: "Average transit (hours)", Value: performance.AverageTransit, Type: export.Number},
+			{Label: "P50 transit (hours)", Value: performance.P50Transit, Type: export.Number},
+			{Label: "P95 transit (hours)", Value: performance.P95Transit, Type: export.Number},
+			{Label: "Average delay (hours)", Value: performance.AverageDelay, Type: export.Number},
+		},
+	}
+
+	if destinations := performance.ByDestination; len(destinations) > 0 {
+		doc.Tables = append(doc.Tables, export.Table{
+			Title:   "By destination",
+			Columns: append([]export.Column{{Title: "Destination", Width: 1.5}}, shipmentKPIColumns...),
+			Rows: rowsOf(len(destinations), func(i int) []interface{} {
+				return shipmentKPIValues(destinations[i].Destination, &destinations[i].ShipmentKPIs)
+			}),
+		})
+	}
+	if series := performance.Series; len(series) > 0 {
+		doc.Tables = append(doc.Tables, export.Table{
+			Title:   "By " + filter.Interval,
+			Columns: append([]export.Column{{Title: "Period", Type: export.Date, Width: 1.5}}, shipmentKPIColumns...),
+			Rows: rowsOf(len(series), func(i int) []interface{} {
+				return shipmentKPIValues(series[i].Period, &series[i].ShipmentKPIs)
+			}),
+		})
+	}
+	return doc
+}
+
+// turnoverThresholdsSubtitle describes the classification of the movers
+func turnoverThresholdsSubtitle(thresholds turnoverThresholds) string {
+	subtitle := fmt.Sprintf("fast movers from %g turns a year", thresholds.FastTurnover)
+	if thresholds.DeadTurnover > 0 {
+		subtitle += fmt.Sprintf(", dead stock under %g", thresholds.DeadTurnover)
+	}
+	return subtitle
+}
+
+// turnoverDocument is the export of the inventory turnover
+func turnoverDocument(turnover *InventoryTurnover, filter analyticsFilter) *export.Document {
+	categories, items := turnover.CategoryDetails, turnover.Items
+	return &export.Document{
+		Title:    "Inventory turnover",
+		Subtitle: filterSubtitle(filter, turnoverThresholdsSubtitle(turnover.Thresholds)),
+		Figures: []export.Figure{
+			{Label: "Items", Value: turnover.TotalItems, Type: export.Integer},
+			{Label: "Fast movers", Value: turnover.FastMoving, Type: export.Integer},
+			{Label: "Slow movers", Value: turnover.SlowMoving, Type: export.Integer},
+			{Label: "Dead stock", Value: turnover.DeadStock, Type: export.Integer},
+			{Label: "Cost of goods sold", Value: turnover.COGS, Type: export.Currency},
+			{Label: "Average turnover", Value: turnover.AverageTurnover, Type: export.Number},
+			{Label: "Days on hand", Value: turnover.DaysOnHand, Type: export.Number},
+		},
+		Tables: []export.Table{
+			{
+				Title: "By category",
+				Columns: []export.Column{
+					{Title: "Category"},
+					{Title: "Items", Type: export.Integer, Total: true},
+					{Title: "Units out", Type: export.Integer, Total: true},
+					{Title: "COGS", Type: export.Currency, Total: true},
+					{Title: "Avg inventory value", Type: export.Currency, Total: true},
+					{Title: "Turnover", Type: export.Number, Bar: true},
+					{Title: "Annual turnover", Type: export.Number},
+					{Title: "Days on hand", Type: export.Number},
+				},
+				Rows: rowsOf(len(categories), func(i int) []interface{} {
+					c := categories[i]
+					return []interface{}{c.Category, c.Items, c.OutboundUnits, c.COGS, c.AverageInventory,
+						c.Turnover, c.AnnualTurnover, c.DaysOnHand}
+				}),
+			},
+			{
+				Title: "Items",
+				Columns: []export.Column{
+					{Title: "Item ID"},
+					{Title: "Name", Width: 2},
+					{Title: "Category"},
+					{Title: "Location"},
+					{Title: "Stock", Type: export.Integer, Total: true},
+					{Title: "Units out", Type: export.Integer, Total: true},
+					{Title: "COGS", Type: export.Currency, Total: true},
+					{Title: "Annual turnover", Type: export.Number},
+					{Title: "Days on hand", Type: export.Number},
+					{Title: "Class"},
+				},
+				Rows: rowsOf(len(items), func(i int) []interface{} {
+					item := items[i]
+					return []interface{}{item.ItemID, item.Name, item.Category, item.WarehouseLocation, item.StockLevel,
+						item.OutboundUnits, item.COGS, item.AnnualTurnover, item.DaysOnHand, item.Class}
+				}),
+			},
+		},
+	}
+}
+
+// reportRunDocument is the export of the rows of a report run. Column types
+// are taken from the first value of each column; aggregated counts and sums
+// get a totals row.
+func reportRunDocument(def *models.ReportDefinition, run *models.ReportRun) *export.Document {
+	totals := map[string]bool{}
+	for _, aggregation := range def.Aggregations {
+		if aggregation.Function == "count" || aggregation.Function == "sum" {
+			totals[aggregation.Alias] = true
+		}
+	}
+
+	columns := make([]export.Column, len(run.Columns))
+	for i, name := range run.Columns {
+		columns[i] = export.Column{Title: name, Type: reportColumnType(run.Rows, name), Total: totals[name]}
+	}
+
+	subtitle := fmt.Sprintf("%s run of %s", run.Trigger, run.StartedAt.UTC().Format("2006-01-02 15:04"))
+	if run.Truncated {
+		subtitle += ", truncated to the report limit"
+	}
+
+	rows := run.Rows
+	return &export.Document{
+		Title:    def.Name,
+		Subtitle: subtitle,
+		Tables: []export.Table{{
+			Title:   def.Name,
+			Columns: columns,
+			Rows: rowsOf(len(rows), func(i int) []interface{} {
+				values := make([]interface{}, len(run.Columns))
+				for j, name := range run.Columns {
+					values[j] = rows[i][name]
+				}
+				return values
+			}),
+		}},
+	}
+}
+
+// reportColumnType infers the type of a report column from its values
+func reportColumnType(rows []map[string]interface{}, column string) export.ColumnType {
+	for _, row := range rows {
+		switch row[column].(type) {
+		case nil:
+			continue
+		case float64, int32, int64:
+			return export.Number
+		case time.Time, primitive.DateTime:
+			return export.Date
+		}
+		return export.Text
+	}
+	return export.Text
+}
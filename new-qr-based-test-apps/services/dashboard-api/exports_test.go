@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+)
+
+func TestUnknownExportFormat(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	for _, path := range []string{
+		"/api/v1/inventory/items?format=docx",
+		"/api/v1/shipments?format=docx",
+		"/api/v1/analytics/profit-margins?format=docx",
+		"/api/v1/analytics/inventory-turnover?format=docx",
+	} {
+		w := performRequest(router, http.MethodGet, path)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, w.Body.String(), "unsupported export format", path)
+	}
+}
+
+func TestExportNeedsSupervisor(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	for _, path := range []string{
+		"/api/v1/inventory/items?format=csv",
+		"/api/v1/shipments?format=xlsx",
+		"/api/v1/analytics/profit-margins?format=pdf",
+		"/api/v1/analytics/shipment-performance?format=csv",
+		"/api/v1/analytics/inventory-turnover?format=CSV",
+	} {
+		w := performRequest(router, http.MethodGet, path)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+
+		w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, path, "")
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+	}
+
+	w := performAuthRequest(t, router, services, auth.AccessLevel3, http.MethodGet, "/api/v1/analytics/profit-margins?format=csv&from=bad", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "supervisors reach the handler")
+}
+
+func TestExportAttachment(t *testing.T) {
+	_, services := newTestRouter(t)
+	h := NewHandlers(services)
+	doc := shipmentDocument(&ShipmentPerformance{
+		ShipmentKPIs: ShipmentKPIs{TotalShipments: 3, Delivered: 2, OnTimeRate: 50},
+		ByDestination: []DestinationKPIs{
+			{Destination: "Jakarta", ShipmentKPIs: ShipmentKPIs{TotalShipments: 2, Delivered: 1}},
+			{Destination: "Bandung", ShipmentKPIs: ShipmentKPIs{TotalShipments: 1, Delivered: 1}},
+		},
+	}, analyticsFilter{
+		From:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+		Interval: IntervalDay,
+	}, "")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	h.export(c, export.FormatXLSX, "shipment-performance", doc)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, export.FormatXLSX.ContentType(), w.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="shipment-performance-\d{8}-\d{6}\.xlsx"$`, w.Header().Get("Content-Disposition"))
+
+	f, err := excelize.OpenReader(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, []string{"Summary", "By destination"}, f.GetSheetList())
+
+	rows, err := f.GetRows("By destination")
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	assert.Equal(t, []string{"Total", "3", "2"}, rows[3][:3])
+}
+
+// exportWith returns an export of the documents of a cursor through
+// exportCursor with a filter, which returns the subtitle of the document
+func exportWith[F any](filter F, document func(context.Context, *mongo.Cursor, F) *export.Document) func(*Handlers, *gin.Context, *mongo.Cursor) string {
+	return func(h *Handlers, c *gin.Context, cursor *mongo.Cursor) string {
+		var subtitle string
+		exportCursor(h, c, export.FormatCSV, "export", filter,
+			func(context.Context, F) (*mongo.Cursor, error) { return cursor, nil },
+			func(ctx context.Context, cursor *mongo.Cursor, filter F) *export.Document {
+				doc := document(ctx, cursor, filter)
+				subtitle = doc.Subtitle
+				return doc
+			})
+		return subtitle
+	}
+}
+
+func TestCursorExports(t *testing.T) {
+	_, services := newTestRouter(t)
+	h := NewHandlers(services)
+	created := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	taskID := primitive.NewObjectID()
+
+	for _, tc := range []struct {
+		name     string
+		docs     []interface{}
+		export   func(*Handlers, *gin.Context, *mongo.Cursor) string
+		subtitle string
+		csv      string
+	}{
+		{
+			name: "count tasks",
+			docs: []interface{}{
+				models.CountTask{ID: taskID, Method: models.CountByZone, Scope: "JKT-A", Status: models.CountInProgress, AssignedTo: "user-2",
+					Bins: []string{"JKT-A-01-R1-B01", "JKT-A-01-R1-B02"}, Counted: []string{"JKT-A-01-R1-B01"}, CreatedAt: created},
+			},
+			export:   exportWith(inventory.CountFilter{Status: models.CountInProgress, AssignedTo: "user-2"}, countTasksDocument),
+			subtitle: "status in_progress, assigned to user-2",
+			csv: "Task ID,Method,Scope,Status,Assigned to,Bins,Counted,Variances,Created,Reviewed\n" +
+				taskID.Hex() + ",zone,JKT-A,in_progress,user-2,2,1,0,2024-03-01T08:00:00Z,\n" +
+				"Total,,,,,2,1,0,,\n",
+		},
+		{
+			name: "locations",
+			docs: []interface{}{
+				models.Location{Code: "JKT", Name: "Jakarta", Level: models.LevelWarehouse, Warehouse: "JKT", Active: true},
+				models.Location{Code: "JKT-A-01-R1-B01", Level: models.LevelBin, Warehouse: "JKT", Capacity: models.Capacity{MaxUnits: 200}, Occupied: 35, Active: true},
+			},
+			export:   exportWith(inventory.LocationFilter{Within: "JKT"}, locationsDocument),
+			subtitle: "Within JKT",
+			csv: "Code,Name,Level,Warehouse,Max units,Occupied,Active\n" +
+				"JKT,Jakarta,warehouse,JKT,,0,true\n" +
+				"JKT-A-01-R1-B01,,bin,JKT,200,35,true\n",
+		},
+		{
+			name: "price changes",
+			docs: []interface{}{
+				models.PriceChange{ItemID: "ITM-2024-001", Status: models.PriceScheduled, EffectiveFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+					CostPrice: 52, SellingPrice: 94.99, ProfitMargin: 45.26, PreviousCostPrice: 50, PreviousSellingPrice: 89.99,
+					Reason: "=supplier increase", ChangedBy: "user-1"},
+			},
+			export:   exportWith(inventory.PriceFilter{Status: models.PriceScheduled}, priceChangesDocument),
+			subtitle: "All items, status scheduled",
+			csv: "Item ID,Status,Effective from,Effective to,Cost price,Selling price,Margin,Previous cost,Previous selling,Reason,Changed by\n" +
+				"ITM-2024-001,scheduled,2024-03-01T00:00:00Z,,52.00,94.99,45.26,50.00,89.99,'=supplier increase,user-1\n",
+		},
+		{
+			name: "stock alerts",
+			docs: []interface{}{
+				models.StockAlert{ItemID: "ITM-2024-001", Location: "JKT-A", Severity: models.AlertCritical, Status: models.AlertOpen,
+					OnHand: 4, ReorderPoint: 40, SafetyStock: 10, ReorderQuantity: 100, RaisedAt: created},
+			},
+			export:   exportWith(inventory.AlertFilter{Severity: models.AlertCritical}, alertsDocument),
+			subtitle: "Status unresolved, severity critical",
+			csv: "Item,Location,Severity,Status,On hand,Reorder point,Safety stock,Reorder quantity,Raised,Resolved\n" +
+				"ITM-2024-001,JKT-A,critical,open,4,40,10,100,2024-03-01T08:00:00Z,\n" +
+				"Total,,,,,,,100,,\n",
+		},
+		{
+			name: "backorders",
+			docs: []interface{}{
+				models.StockReservation{ShipmentID: "SHP-2024-001", ItemID: "ITM-2024-001", Requested: 10, Allocated: 4, Backordered: 6, CreatedAt: created},
+				models.StockReservation{ShipmentID: "SHP-2024-002", ItemID: "ITM-2024-001", Requested: 5, Backordered: 5, CreatedAt: created},
+			},
+			export:   exportWith("ITM-2024-001", backordersDocument),
+			subtitle: "Item ITM-2024-001",
+			csv: "Shipment,Item,Requested,Allocated,Backordered,Since\n" +
+				"SHP-2024-001,ITM-2024-001,10,4,6,2024-03-01T08:00:00Z\n" +
+				"SHP-2024-002,ITM-2024-001,5,0,5,2024-03-01T08:00:00Z\n" +
+				"Total,,15,4,11,\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cursor, err := mongo.NewCursorFromDocuments(tc.docs, nil, nil)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			assert.Equal(t, tc.subtitle, tc.export(h, c, cursor))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Regexp(t, `^attachment; filename="export-\d{8}-\d{6}\.csv"$`, w.Header().Get("Content-Disposition"))
+			assert.Equal(t, tc.csv, w.Body.String())
+		})
+	}
+}
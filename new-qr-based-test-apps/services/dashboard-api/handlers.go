@@ -1,9 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/cache"
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
 )
 
 // Handlers holds all HTTP handlers
@@ -16,6 +28,95 @@ func NewHandlers(services *Services) *Handlers {
 	return &Handlers{services: services}
 }
 
+// validate checks request bodies against their validate tags
+var validate = validator.New()
+
+// bindJSON decodes and validates the request body, responding with 400 on failure
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := validate.Struct(obj); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// objectIDParam parses a MongoDB ObjectID path parameter, responding with 400 on failure
+func objectIDParam(c *gin.Context, name string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+// claimsKey is the context key of the authenticated user's JWT claims
+const claimsKey = "claims"
+
+// requireAuth rejects requests without a valid JWT and stores its claims in
+// the context. Browsers cannot set headers on an EventSource, so the token
+// may also be passed as the access_token query parameter.
+func (h *Handlers) requireAuth(c *gin.Context) {
+	if h.authenticate(c) {
+		c.Next()
+	}
+}
+
+// authenticate validates the JWT of a request and stores its claims in the
+// context, or aborts with 401
+func (h *Handlers) authenticate(c *gin.Context) bool {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		token = c.Query("access_token")
+	}
+	if token == "" || h.services.JWTService == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return false
+	}
+
+	claims, err := h.services.JWTService.ValidateToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return false
+	}
+	c.Set(claimsKey, claims)
+	return true
+}
+
+// requireLevel rejects authenticated users below an access level
+func requireLevel(level string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if permitted(c, level) {
+			c.Next()
+		}
+	}
+}
+
+// permitted checks that the authenticated user has an access level, or
+// aborts with 403
+func permitted(c *gin.Context, level string) bool {
+	if !auth.HasPermission(currentClaims(c).AccessLevel, level) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient access level"})
+		return false
+	}
+	return true
+}
+
+// currentClaims returns the claims stored by requireAuth
+func currentClaims(c *gin.Context) *auth.JWTClaims {
+	return c.MustGet(claimsKey).(*auth.JWTClaims)
+}
+
+// internalError logs err and responds with 500
+func (h *Handlers) internalError(c *gin.Context, message string, err error) {
+	h.services.Logger.Error(message, zap.Error(err), zap.String("path", c.FullPath()))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
 // Health check handler
 func (h *Handlers) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -25,27 +126,71 @@ func (h *Handlers) HealthCheck(c *gin.Context) {
 	})
 }
 
+// Dashboard handlers
+func (h *Handlers) GetDashboardStats(c *gin.Context) {
+	var stats DashboardStats
+	err := h.cached(c, CacheDashboardStats, []string{cache.TagInventory, cache.TagShipments}, &stats, func(ctx context.Context) (interface{}, error) {
+		return h.services.dashboardStats(ctx, h.services.LowStockThreshold)
+	})
+	if err != nil {
+		h.internalError(c, "Failed to compute dashboard stats", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
 // Inventory handlers
+// GetItems lists the items matching the category, status and
+// warehouseLocation filters, a page at a time or all of them as an export
 func (h *Handlers) GetItems(c *gin.Context) {
-	// Placeholder implementation
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+	query := itemsQuery(c)
+
+	if format != "" {
+		exportCursor(h, c, format, "items", query, h.services.find, itemsDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	items := []models.Item{}
+	total, err := h.services.list(c.Request.Context(), query, offset, pagination.GetPageSize(), &items)
+	if err != nil {
+		h.internalError(c, "Failed to list items", err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"items": []map[string]interface{}{
-			{
-				"itemId":      "ITM-2024-001",
-				"name":        "Wireless Bluetooth Headphones",
-				"category":    "Electronics",
-				"stockLevel":  150,
-				"costPrice":   50.00,
-				"sellingPrice": 89.99,
-				"profitMargin": 44.45,
-				"status":      "active",
-			},
-		},
-		"total": 1,
-		"page":  1,
+		"items":    items,
+		"total":    total,
+		"page":     pagination.Page,
+		"pageSize": pagination.GetPageSize(),
 	})
 }
 
+func (h *Handlers) GetItemByBarcode(c *gin.Context) {
+	item, err := h.services.itemByBarcode(c.Request.Context(), c.Param("barcode"))
+	if errors.Is(err, errItemNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+		return
+	}
+	if err != nil {
+		h.internalError(c, "Failed to look up item", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"item": item})
+}
+
 func (h *Handlers) CreateItem(c *gin.Context) {
 	// Placeholder implementation
 	c.JSON(http.StatusCreated, gin.H{
@@ -74,64 +219,156 @@ func (h *Handlers) DeleteItem(c *gin.Context) {
 
 // Analytics handlers
 func (h *Handlers) GetProfitMargins(c *gin.Context) {
-	// Placeholder implementation
+	filter, ok := parseAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	var analytics ProfitAnalytics
+	err := h.cached(c, CacheProfitMargins, []string{cache.TagInventory}, &analytics, func(ctx context.Context) (interface{}, error) {
+		return h.services.profitAnalytics(ctx, filter)
+	})
+	if err != nil {
+		h.internalError(c, "Failed to compute profit analytics", err)
+		return
+	}
+
+	if format != "" {
+		h.export(c, format, "profit-margins", profitDocument(&analytics, filter))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"analytics": map[string]interface{}{
-			"totalProfit":     15000.50,
-			"averageMargin":   45.67,
-			"topPerformers":   []string{"ITM-2024-001", "ITM-2024-003"},
-			"lowPerformers":   []string{"ITM-2024-002"},
-			"trendDirection":  "up",
-		},
+		"analytics": analytics,
+		"filters":   filter,
 	})
 }
 
 func (h *Handlers) GetShipmentPerformance(c *gin.Context) {
-	// Placeholder implementation
+	filter, ok := parseAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	mode := c.DefaultQuery("mode", ShipmentModeSummary)
+	if mode != ShipmentModeSummary && mode != ShipmentModeTimeseries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be summary or timeseries"})
+		return
+	}
+
+	var performance ShipmentPerformance
+	err := h.cached(c, CacheShipmentPerformance, []string{cache.TagShipments}, &performance, func(ctx context.Context) (interface{}, error) {
+		return h.services.shipmentPerformance(ctx, filter, c.Query("destination"), mode)
+	})
+	if err != nil {
+		h.internalError(c, "Failed to compute shipment performance", err)
+		return
+	}
+
+	if format != "" {
+		h.export(c, format, "shipment-performance", shipmentDocument(&performance, filter, c.Query("destination")))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"performance": map[string]interface{}{
-			"totalShipments":   125,
-			"deliveredOnTime":  98,
-			"delayed":          15,
-			"averageDeliveryTime": "3.2 days",
-			"successRate":      "78.4%",
-		},
+		"performance": performance,
+		"filters":     filter,
 	})
 }
 
 func (h *Handlers) GetInventoryTurnover(c *gin.Context) {
-	// Placeholder implementation
+	filter, ok := parseAnalyticsFilter(c)
+	if !ok {
+		return
+	}
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	thresholds := turnoverThresholds{FastTurnover: defaultFastTurnover}
+	if value := c.Query("fastTurnover"); value != "" {
+		fast, err := strconv.ParseFloat(value, 64)
+		if err != nil || fast <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "fastTurnover must be a positive number"})
+			return
+		}
+		thresholds.FastTurnover = fast
+	}
+	if value := c.Query("deadTurnover"); value != "" {
+		dead, err := strconv.ParseFloat(value, 64)
+		if err != nil || dead < 0 || dead >= thresholds.FastTurnover {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "deadTurnover must be a number from 0 up to fastTurnover"})
+			return
+		}
+		thresholds.DeadTurnover = dead
+	}
+
+	var turnover InventoryTurnover
+	err := h.cached(c, CacheInventoryTurnover, []string{cache.TagInventory}, &turnover, func(ctx context.Context) (interface{}, error) {
+		return h.services.inventoryTurnover(ctx, filter, thresholds)
+	})
+	if err != nil {
+		h.internalError(c, "Failed to compute inventory turnover", err)
+		return
+	}
+
+	if format != "" {
+		h.export(c, format, "inventory-turnover", turnoverDocument(&turnover, filter))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"turnover": map[string]interface{}{
-			"totalItems":      1250,
-			"fastMoving":      450,
-			"slowMoving":      200,
-			"averageTurnover": 4.2,
-			"categories": map[string]float64{
-				"Electronics": 5.1,
-				"Clothing":    3.8,
-				"Books":       2.1,
-			},
-		},
+		"turnover": turnover,
+		"filters":  filter,
 	})
 }
 
 // Shipment handlers
+// GetShipments lists the shipments matching the status and destination
+// filters, a page at a time or all of them as an export
 func (h *Handlers) GetShipments(c *gin.Context) {
-	// Placeholder implementation
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+	query := shipmentsQuery(c)
+
+	if format != "" {
+		exportCursor(h, c, format, "shipments", query, h.services.find, shipmentsDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	shipments := []models.Shipment{}
+	total, err := h.services.list(c.Request.Context(), query, offset, pagination.GetPageSize(), &shipments)
+	if err != nil {
+		h.internalError(c, "Failed to list shipments", err)
+		return
+	}
+	for i := range shipments {
+		shipments[i].CalculateRemainingTime()
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"shipments": []map[string]interface{}{
-			{
-				"shipmentId":       "SHP-2024-001",
-				"destination":      "Jakarta",
-				"status":           "in_transit",
-				"estimatedDelivery": "2024-01-15T00:00:00Z",
-				"remainingTime":    "4 days 12 hours",
-				"trackingNumber":   "TRK123456789",
-			},
-		},
-		"total": 1,
-		"page":  1,
+		"shipments": shipments,
+		"total":     total,
+		"page":      pagination.Page,
+		"pageSize":  pagination.GetPageSize(),
 	})
 }
 
@@ -158,16 +395,6 @@ func (h *Handlers) GetShipmentStatus(c *gin.Context) {
 	})
 }
 
-func (h *Handlers) UpdateShipmentStatus(c *gin.Context) {
-	shipmentID := c.Param("id")
-	// Placeholder implementation
-	c.JSON(http.StatusOK, gin.H{
-		"message":    "Shipment status updated",
-		"shipmentId": shipmentID,
-		"newStatus":  "delivered",
-	})
-}
-
 // setupRoutes configures all API routes
 func setupRoutes(router *gin.Engine, handlers *Handlers) {
 	// Health check
@@ -176,29 +403,122 @@ func setupRoutes(router *gin.Engine, handlers *Handlers) {
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
+		// Dashboard routes
+		v1.GET("/dashboard/stats", handlers.GetDashboardStats)
+		v1.GET("/stream", handlers.requireAuth, handlers.StreamEvents)
+
 		// Inventory routes
 		inventory := v1.Group("/inventory")
 		{
-			inventory.GET("/items", handlers.GetItems)
+			inventory.GET("/items", handlers.requireExportLevel(auth.AccessLevel3), handlers.GetItems)
+			inventory.GET("/items/barcode/:barcode", handlers.GetItemByBarcode)
 			inventory.POST("/items", handlers.CreateItem)
 			inventory.PUT("/items/:id", handlers.UpdateItem)
 			inventory.DELETE("/items/:id", handlers.DeleteItem)
+			inventory.GET("/items/:id/movements", handlers.requireAuth, handlers.GetStockMovements)
+			inventory.POST("/items/:id/movements", handlers.requireAuth, requireLevel(auth.AccessLevel2), handlers.RecordStockMovement)
+			inventory.GET("/items/:id/availability", handlers.requireAuth, handlers.GetItemAvailability)
+			inventory.GET("/items/:id/lots", handlers.requireAuth, handlers.GetItemLots)
+			inventory.GET("/items/:id/lots/:lot", handlers.requireAuth, handlers.GetItemLot)
+			inventory.GET("/lots/expiring", handlers.requireAuth, handlers.GetExpiringLots)
+			inventory.PUT("/items/:id/serialized", handlers.requireAuth, requireLevel(auth.AccessLevel3), handlers.SetItemSerialized)
+			inventory.GET("/reorder-policies", handlers.requireAuth, handlers.GetReorderPolicies)
+			inventory.PUT("/items/:id/reorder-policy", handlers.requireAuth, requireLevel(auth.AccessLevel3), handlers.SetReorderPolicy)
+			inventory.DELETE("/items/:id/reorder-policy", handlers.requireAuth, requireLevel(auth.AccessLevel3), handlers.DeleteReorderPolicy)
+			inventory.GET("/reorder-suggestions", handlers.requireAuth, handlers.GetReorderSuggestions)
+			inventory.GET("/stock-alerts", handlers.requireAuth, handlers.GetStockAlerts)
+			inventory.POST("/stock-alerts/:alertId/acknowledge", handlers.requireAuth, requireLevel(auth.AccessLevel2), handlers.AcknowledgeStockAlert)
+			inventory.GET("/items/:id/cost-layers", handlers.requireAuth, handlers.GetItemCostLayers)
+			inventory.GET("/valuation", handlers.requireAuth, handlers.GetStockValuation)
+			inventory.GET("/valuation-methods", handlers.requireAuth, handlers.GetValuationMethods)
+			inventory.PUT("/valuation-methods/:category", handlers.requireAuth, requireLevel(auth.AccessLevel4), handlers.SetValuationMethod)
+			inventory.GET("/items/:id/prices", handlers.requireAuth, handlers.GetItemPrices)
+			inventory.POST("/items/:id/prices", handlers.requireAuth, requireLevel(auth.AccessLevel4), handlers.ChangeItemPrices)
+			inventory.GET("/price-changes", handlers.requireAuth, handlers.GetPriceChanges)
+			inventory.POST("/price-changes/:changeId/cancel", handlers.requireAuth, requireLevel(auth.AccessLevel4), handlers.CancelPriceChange)
+		}
+
+		// Serial number routes
+		serials := v1.Group("/serials", handlers.requireAuth)
+		{
+			serials.GET("", handlers.GetSerials)
+			serials.GET("/:serial", handlers.GetSerial)
+			serials.POST("/:serial/reserve", requireLevel(auth.AccessLevel2), handlers.ReserveSerial)
+			serials.POST("/:serial/release", requireLevel(auth.AccessLevel2), handlers.ReleaseSerial)
+		}
+
+		// Location routes
+		locations := v1.Group("/locations", handlers.requireAuth)
+		{
+			locations.GET("", handlers.GetLocations)
+			locations.POST("", requireLevel(auth.AccessLevel3), handlers.CreateLocation)
+			locations.GET("/:code", handlers.GetLocation)
+			locations.PUT("/:code", requireLevel(auth.AccessLevel3), handlers.UpdateLocation)
+			locations.GET("/:code/stock", handlers.GetLocationStock)
 		}
 
 		// Analytics routes
 		analytics := v1.Group("/analytics")
 		{
-			analytics.GET("/profit-margins", handlers.GetProfitMargins)
-			analytics.GET("/shipment-performance", handlers.GetShipmentPerformance)
-			analytics.GET("/inventory-turnover", handlers.GetInventoryTurnover)
+			analytics.GET("/profit-margins", handlers.requireExportLevel(auth.AccessLevel3), handlers.GetProfitMargins)
+			analytics.GET("/shipment-performance", handlers.requireExportLevel(auth.AccessLevel3), handlers.GetShipmentPerformance)
+			analytics.GET("/inventory-turnover", handlers.requireExportLevel(auth.AccessLevel3), handlers.GetInventoryTurnover)
+			analytics.GET("/margins-at", handlers.requireAuth, handlers.GetMarginsAt)
 		}
 
 		// Shipment routes
 		shipments := v1.Group("/shipments")
 		{
-			shipments.GET("", handlers.GetShipments)
+			shipments.GET("", handlers.requireExportLevel(auth.AccessLevel3), handlers.GetShipments)
+			shipments.POST("", handlers.requireAuth, requireLevel(auth.AccessLevel2), handlers.CreateShipment)
+			shipments.GET("/backorders", handlers.requireAuth, handlers.GetBackorders)
 			shipments.GET("/:id/status", handlers.GetShipmentStatus)
-			shipments.PUT("/:id/status", handlers.UpdateShipmentStatus)
+			shipments.PUT("/:id/status", handlers.requireAuth, requireLevel(auth.AccessLevel2), handlers.UpdateShipmentStatus)
+			shipments.GET("/:id/allocation", handlers.requireAuth, handlers.GetShipmentAllocation)
+		}
+
+		// Cycle count routes. Supervisors generate and review count tasks,
+		// the operator they are assigned to scans them on the handheld.
+		counts := v1.Group("/counts", handlers.requireAuth)
+		{
+			counts.GET("", handlers.GetCountTasks)
+			counts.POST("", requireLevel(auth.AccessLevel3), handlers.CreateCountTask)
+			counts.GET("/:id", handlers.GetCountTask)
+			counts.PUT("/:id/assignee", requireLevel(auth.AccessLevel3), handlers.AssignCountTask)
+			counts.POST("/:id/cancel", requireLevel(auth.AccessLevel3), handlers.CancelCountTask)
+			counts.POST("/:id/scan", handlers.ScanCountTask)
+			counts.PUT("/:id/lines", handlers.RecountCountLine)
+			counts.POST("/:id/submit", handlers.SubmitCountTask)
+			counts.POST("/:id/approve", requireLevel(auth.AccessLevel3), handlers.ApproveCountTask)
+			counts.POST("/:id/reject", requireLevel(auth.AccessLevel3), handlers.RejectCountTask)
+		}
+
+		// Report builder routes, scoped to the authenticated user
+		reports := v1.Group("/reports", handlers.requireAuth)
+		{
+			reports.GET("", handlers.GetReports)
+			reports.POST("", handlers.CreateReport)
+			reports.GET("/fields", handlers.GetReportFields)
+			reports.GET("/:id", handlers.GetReport)
+			reports.PUT("/:id", handlers.UpdateReport)
+			reports.DELETE("/:id", handlers.DeleteReport)
+			reports.POST("/:id/run", handlers.RunReport)
+			reports.GET("/:id/runs", handlers.GetReportRuns)
+			reports.GET("/:id/runs/:runId", handlers.GetReportRun)
+			reports.GET("/:id/runs/:runId/download", handlers.DownloadReportRun)
+		}
+
+		// Webhook routes
+		webhooks := v1.Group("/webhooks", handlers.requireAuth, requireLevel(auth.AccessLevel4))
+		{
+			webhooks.GET("", handlers.GetWebhooks)
+			webhooks.POST("", handlers.CreateWebhook)
+			webhooks.GET("/deliveries", handlers.GetWebhookDeliveries)
+			webhooks.POST("/deliveries/:deliveryId/replay", handlers.ReplayWebhookDelivery)
+			webhooks.GET("/:id", handlers.GetWebhook)
+			webhooks.PUT("/:id", handlers.UpdateWebhook)
+			webhooks.DELETE("/:id", handlers.DeleteWebhook)
+			webhooks.GET("/:id/deliveries", handlers.GetWebhookDeliveries)
 		}
 	}
 }
\ No newline at end of file
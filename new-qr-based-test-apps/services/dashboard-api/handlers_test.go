@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/kafka"
+	"warehouse-shared/logger"
+)
+
+// newTestRouter builds the real router backed by an in-memory event bus
+func newTestRouter(t *testing.T) (*gin.Engine, *Services) {
+	gin.SetMode(gin.TestMode)
+
+	bus := kafka.NewMemoryBus()
+	t.Cleanup(func() { bus.Close() })
+
+	services := &Services{
+		Events: bus,
+		Logger: &logger.Logger{Logger: zap.NewNop()},
+	}
+
+	router := gin.New()
+	setupRoutes(router, NewHandlers(services))
+	return router, services
+}
+
+func performRequest(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// performAuthRequest makes a request with the token of a user at an access
+// level, signed with the test secret
+func performAuthRequest(t *testing.T, router *gin.Engine, services *Services, level, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	if services.JWTService == nil {
+		services.JWTService = auth.NewJWTService("test-secret", "test")
+	}
+	token, err := services.JWTService.GenerateToken("user-1", "tester", auth.RoleWarehouseOperator, level, time.Hour)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHealthCheck(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/health")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "healthy", response["status"])
+	assert.Equal(t, "dashboard-api", response["service"])
+}
+
+func TestNewEventBus(t *testing.T) {
+	bus, err := NewEventBus(&Config{EventBus: "memory"})
+	require.NoError(t, err)
+	assert.IsType(t, &kafka.MemoryBus{}, bus)
+	bus.Close()
+
+	bus, err = NewEventBus(&Config{EventBus: "kafka", KafkaBrokers: "localhost:9092", KafkaEventModes: "scan-events=binary"})
+	require.NoError(t, err)
+	assert.Equal(t, kafka.EventModeBinary, bus.(*kafka.KafkaService).EventMode("scan-events"))
+	bus.Close()
+
+	_, err = NewEventBus(&Config{EventBus: "rabbitmq"})
+	assert.Error(t, err)
+
+	_, err = NewEventBus(&Config{EventBus: "kafka", KafkaBrokers: "localhost:9092", KafkaAcks: "most"})
+	assert.Error(t, err)
+}
+
+func TestProducerOptions(t *testing.T) {
+	options, err := producerOptions(&Config{KafkaAcks: "leader", KafkaCompression: "lz4", KafkaBatchSize: 500})
+	require.NoError(t, err)
+	assert.Equal(t, kafkago.RequireOne, options.RequiredAcks)
+	assert.Equal(t, kafkago.Lz4, options.Compression)
+	assert.Equal(t, 500, options.BatchSize)
+	assert.False(t, options.Async)
+}
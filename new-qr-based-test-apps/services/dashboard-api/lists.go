@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/export"
+	"warehouse-shared/models"
+)
+
+// listQuery is the MongoDB query of a list endpoint
+type listQuery struct {
+	collection string
+	filter     bson.M
+	sort       bson.D
+}
+
+// equalityFilter builds a filter from the query parameters that match a
+// field exactly, keyed by parameter with the field as value
+func equalityFilter(c *gin.Context, params map[string]string) bson.M {
+	filter := bson.M{}
+	for param, field := range params {
+		if value := c.Query(param); value != "" {
+			filter[field] = value
+		}
+	}
+	return filter
+}
+
+// itemsQuery lists the items matching the category, status and
+// warehouseLocation parameters by item ID
+func itemsQuery(c *gin.Context) listQuery {
+	return listQuery{
+		collection: database.ItemsCollection,
+		filter: equalityFilter(c, map[string]string{
+			"category":          "category",
+			"status":            "status",
+			"warehouseLocation": "warehouseLocation",
+		}),
+		sort: bson.D{{Key: "itemId", Value: 1}},
+	}
+}
+
+// shipmentsQuery lists the shipments matching the status and destination
+// parameters, newest first
+func shipmentsQuery(c *gin.Context) listQuery {
+	return listQuery{
+		collection: database.ShipmentsCollection,
+		filter: equalityFilter(c, map[string]string{
+			"status":      "status",
+			"destination": "destination",
+		}),
+		sort: bson.D{{Key: "createdAt", Value: -1}},
+	}
+}
+
+// list decodes a page of a query into dest and returns the total count
+func (s *Services) list(ctx context.Context, query listQuery, offset, limit int, dest interface{}) (int64, error) {
+	collection := s.MongoDB.GetCollection(query.collection)
+
+	total, err := collection.CountDocuments(ctx, query.filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", query.collection, err)
+	}
+
+	opts := options.Find().SetSort(query.sort).SetSkip(int64(offset)).SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, query.filter, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", query.collection, err)
+	}
+	if err := cursor.All(ctx, dest); err != nil {
+		return 0, fmt.Errorf("failed to decode %s: %w", query.collection, err)
+	}
+	return total, nil
+}
+
+// find opens a cursor over every document of a query, for exports
+func (s *Services) find(ctx context.Context, query listQuery) (*mongo.Cursor, error) {
+	cursor, err := s.MongoDB.GetCollection(query.collection).Find(ctx, query.filter, options.Find().SetSort(query.sort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", query.collection, err)
+	}
+	return cursor, nil
+}
+
+// itemsDocument is the export of the items of a cursor
+func itemsDocument(ctx context.Context, cursor *mongo.Cursor, query listQuery) *export.Document {
+	return &export.Document{
+		Title:    "Inventory items",
+		Subtitle: listSubtitle(query),
+		Tables: []export.Table{{
+			Title: "Items",
+			Columns: []export.Column{
+				{Title: "Item ID"},
+				{Title: "Name", Width: 2},
+				{Title: "Category"},
+				{Title: "Barcode"},
+				{Title: "Location"},
+				{Title: "Status"},
+				{Title: "Stock", Type: export.Integer, Total: true},
+				{Title: "Cost price", Type: export.Currency},
+				{Title: "Selling price", Type: export.Currency},
+				{Title: "Margin", Type: export.Percent},
+				{Title: "Stock value", Type: export.Currency, Total: true},
+				{Title: "Updated", Type: export.Date},
+			},
+			Rows: cursorRows(ctx, cursor, func(item *models.Item) []interface{} {
+				return []interface{}{item.ItemID, item.Name, item.Category, item.Barcode, item.WarehouseLocation,
+					item.Status, item.StockLevel, item.CostPrice, item.SellingPrice, item.ProfitMargin,
+					float64(item.StockLevel) * item.CostPrice, item.UpdatedAt}
+			}),
+		}},
+	}
+}
+
+// shipmentsDocument is the export of the shipments of a cursor
+func shipmentsDocument(ctx context.Context, cursor *mongo.Cursor, query listQuery) *export.Document {
+	return &export.Document{
+		Title:    "Shipments",
+		Subtitle: listSubtitle(query),
+		Tables: []export.Table{{
+			Title: "Shipments",
+			Columns: []export.Column{
+				{Title: "Shipment ID"},
+				{Title: "Destination", Width: 1.5},
+				{Title: "Status"},
+				{Title: "Tracking number"},
+				{Title: "Items", Type: export.Integer},
+				{Title: "Units", Type: export.Integer, Total: true},
+				{Title: "Value", Type: export.Currency, Total: true},
+				{Title: "Chargeable kg", Type: export.Number, Total: true},
+				{Title: "Created", Type: export.Date},
+				{Title: "Estimated delivery", Type: export.Date},
+				{Title: "Delivered", Type: export.Date},
+				{Title: "Remaining"},
+			},
+			Rows: cursorRows(ctx, cursor, func(shipment *models.Shipment) []interface{} {
+				shipment.CalculateRemainingTime()
+				return []interface{}{shipment.ShipmentID, shipment.Destination, shipment.Status, shipment.TrackingNumber,
+					len(shipment.Lines), shipment.Totals.Units, shipment.Totals.Value, shipment.Totals.ChargeableWeightKg, shipment.CreatedAt, shipment.EstimatedDelivery, shipment.ActualDelivery,
+					shipment.RemainingTime}
+			}),
+		}},
+	}
+}
+
+// listSubtitle describes the filters of a list export
+func listSubtitle(query listQuery) string {
+	if len(query.filter) == 0 {
+		return "All records"
+	}
+	subtitle := ""
+	for _, field := range []string{"category", "status", "warehouseLocation", "destination"} {
+		if value, ok := query.filter[field]; ok {
+			if subtitle != "" {
+				subtitle += ", "
+			}
+			subtitle += fmt.Sprintf("%s %v", field, value)
+		}
+	}
+	return subtitle
+}
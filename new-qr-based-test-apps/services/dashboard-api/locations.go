@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
+)
+
+// locationRequest is the body of the create and update location endpoints.
+// The code is only read on create; active defaults to true.
+type locationRequest struct {
+	Code     string          `json:"code"`
+	Name     string          `json:"name" validate:"max=100"`
+	Capacity models.Capacity `json:"capacity"`
+	Active   *bool           `json:"active"`
+}
+
+// active returns the requested active flag, or fallback when not given
+func (r *locationRequest) active(fallback bool) bool {
+	if r.Active == nil {
+		return fallback
+	}
+	return *r.Active
+}
+
+// GetLocations lists the location hierarchy, optionally only the locations
+// within a location code and of one level
+func (h *Handlers) GetLocations(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	filter := inventory.LocationFilter{Within: c.Query("within"), Level: c.Query("level")}
+	if filter.Level != "" && !contains(models.LocationLevels, filter.Level) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown location level " + filter.Level})
+		return
+	}
+
+	if format != "" {
+		exportCursor(h, c, format, "locations", filter, h.services.Locations.Cursor, locationsDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	locations, total, err := h.services.Locations.List(c.Request.Context(), filter, offset, pagination.GetPageSize())
+	if err != nil {
+		h.internalError(c, "Failed to list locations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"locations": locations,
+		"total":     total,
+		"page":      pagination.Page,
+	})
+}
+
+// CreateLocation adds a warehouse, zone, aisle, rack or bin. Every level
+// but a warehouse needs its parent to exist.
+func (h *Handlers) CreateLocation(c *gin.Context) {
+	var req locationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	location := &models.Location{
+		Code:     req.Code,
+		Name:     req.Name,
+		Capacity: req.Capacity,
+		Active:   req.active(true),
+	}
+	if err := h.services.Locations.Create(c.Request.Context(), location); err != nil {
+		h.locationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, location)
+}
+
+// GetLocation returns a location with the units it holds
+func (h *Handlers) GetLocation(c *gin.Context) {
+	location, err := h.services.Locations.Get(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, location)
+}
+
+// UpdateLocation changes the name, capacity or active flag of a location
+func (h *Handlers) UpdateLocation(c *gin.Context) {
+	var req locationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	current, err := h.services.Locations.Get(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	location, err := h.services.Locations.Update(c.Request.Context(), current.Code, req.Name, req.Capacity, req.active(current.Active))
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, location)
+}
+
+// GetLocationStock returns what is held within a location, by bin and item
+func (h *Handlers) GetLocationStock(c *gin.Context) {
+	location, err := h.services.Locations.Get(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	stock, err := h.services.Locations.Contents(c.Request.Context(), location.Code)
+	if err != nil {
+		h.internalError(c, "Failed to get location stock", err)
+		return
+	}
+
+	total := 0
+	for _, bin := range stock {
+		total += bin.Quantity
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"location": location,
+		"stock":    stock,
+		"total":    total,
+	})
+}
+
+// GetItemAvailability returns the bins holding an item and its quantity
+// per warehouse. With a location, only bins within it count, and with a
+// lot only that lot, which is how a scan of the item at that location is
+// validated. Expired lots are not available.
+func (h *Handlers) GetItemAvailability(c *gin.Context) {
+	location := c.Query("location")
+	if location != "" {
+		if _, err := inventory.ParseLocation(location); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	availability, err := h.services.Locations.Availability(c.Request.Context(), c.Param("id"), location, c.Query("lot"))
+	if err != nil {
+		h.internalError(c, "Failed to get item availability", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"itemId":     availability.ItemID,
+		"location":   availability.Location,
+		"lot":        availability.Lot,
+		"available":  availability.Holds(),
+		"total":      availability.Total,
+		"warehouses": availability.Warehouses,
+		"bins":       availability.Bins,
+		"expired":    availability.Expired,
+	})
+}
+
+// locationError maps location store errors to HTTP responses
+func (h *Handlers) locationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrLocationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrInvalidLocation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrLocationExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Location request failed", err)
+	}
+}
+
+// locationsDocument is the export of the locations of a cursor. A capacity
+// of zero is unlimited and left empty.
+func locationsDocument(ctx context.Context, cursor *mongo.Cursor, filter inventory.LocationFilter) *export.Document {
+	subtitle := "All locations"
+	if filter.Within != "" {
+		subtitle = "Within " + filter.Within
+	}
+	if filter.Level != "" {
+		subtitle += ", level " + filter.Level
+	}
+
+	return &export.Document{
+		Title:    "Locations",
+		Subtitle: subtitle,
+		Tables: []export.Table{{
+			Title: "Locations",
+			Columns: []export.Column{
+				{Title: "Code", Width: 1.5},
+				{Title: "Name", Width: 1.5},
+				{Title: "Level"},
+				{Title: "Warehouse"},
+				{Title: "Max units", Type: export.Integer},
+				{Title: "Occupied", Type: export.Integer},
+				{Title: "Active"},
+			},
+			Rows: cursorRows(ctx, cursor, func(l *models.Location) []interface{} {
+				var maxUnits interface{}
+				if l.Capacity.MaxUnits > 0 {
+					maxUnits = l.Capacity.MaxUnits
+				}
+				return []interface{}{l.Code, l.Name, l.Level, l.Warehouse, maxUnits, l.Occupied, l.Active}
+			}),
+		}},
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/auth"
+)
+
+func TestLocationRoutesValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/locations")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, http.MethodGet, "/api/v1/inventory/items/ITM-2024-001/availability")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/locations", `{"code": "JKT-A"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "only supervisors change the hierarchy")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPut, "/api/v1/locations/JKT-A", `{"name": "Zone A"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	for _, query := range []string{"level=shelf", "format=docx"} {
+		w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/locations?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/inventory/items/ITM-2024-001/availability?location=Mobile%20Scanner", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid location")
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+)
+
+// defaultExpiryDays is the window of the near-expiry report
+const defaultExpiryDays = 30
+
+// GetItemLots returns the lots of an item with their dates and quantities
+func (h *Handlers) GetItemLots(c *gin.Context) {
+	itemID := c.Param("id")
+	lots, err := h.services.Lots.List(c.Request.Context(), itemID)
+	if err != nil {
+		h.internalError(c, "Failed to list lots", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"itemId": itemID, "lots": lots})
+}
+
+// GetItemLot returns a lot of an item with the bins holding it
+func (h *Handlers) GetItemLot(c *gin.Context) {
+	lot, err := h.services.Lots.Get(c.Request.Context(), c.Param("id"), c.Param("lot"))
+	if err != nil {
+		h.lotError(c, err)
+		return
+	}
+
+	availability, err := h.services.Locations.Availability(c.Request.Context(), lot.ItemID, "", lot.LotNumber)
+	if err != nil {
+		h.internalError(c, "Failed to get lot availability", err)
+		return
+	}
+
+	now := time.Now()
+	response := gin.H{
+		"lot":     lot,
+		"expired": lot.Expired(now),
+		"bins":    append(availability.Bins, availability.Expired...),
+	}
+	if lot.ExpiresAt != nil {
+		response["daysLeft"] = inventory.DaysLeft(lot, now)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetExpiringLots is the near-expiry report: the lots in stock expiring
+// within days (default 30), expired lots included, optionally of one
+// category
+func (h *Handlers) GetExpiringLots(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	days := defaultExpiryDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a number from 0 to 365"})
+			return
+		}
+		days = parsed
+	}
+	category := c.Query("category")
+
+	now := time.Now()
+	lots, err := h.services.Lots.NearExpiry(c.Request.Context(), now.AddDate(0, 0, days), category)
+	if err != nil {
+		h.internalError(c, "Failed to find expiring lots", err)
+		return
+	}
+
+	if format != "" {
+		h.export(c, format, "expiring-lots", expiringLotsDocument(lots, days, category, now))
+		return
+	}
+
+	type expiringLot struct {
+		inventory.ExpiringLot
+		DaysLeft int     `json:"daysLeft"`
+		Value    float64 `json:"value"`
+	}
+	report := make([]expiringLot, len(lots))
+	for i := range lots {
+		report[i] = expiringLot{
+			ExpiringLot: lots[i],
+			DaysLeft:    inventory.DaysLeft(&lots[i].Lot, now),
+			Value:       float64(lots[i].Quantity) * lots[i].UnitCost,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"days":     days,
+		"category": category,
+		"lots":     report,
+		"total":    len(report),
+	})
+}
+
+// expiringLotsDocument is the export of the near-expiry report. The value
+// is what the lots cost, the stock at risk of being written off.
+func expiringLotsDocument(lots []inventory.ExpiringLot, days int, category string, now time.Time) *export.Document {
+	expired, value := 0, 0.0
+	for i := range lots {
+		if lots[i].Expired(now) {
+			expired++
+		}
+		value += float64(lots[i].Quantity) * lots[i].UnitCost
+	}
+
+	subtitle := fmt.Sprintf("Lots expiring within %d days", days)
+	if category != "" {
+		subtitle += ", category " + category
+	}
+	return &export.Document{
+		Title:    "Near-expiry lots",
+		Subtitle: subtitle,
+		Figures: []export.Figure{
+			{Label: "Lots", Value: len(lots), Type: export.Integer},
+			{Label: "Expired", Value: expired, Type: export.Integer},
+			{Label: "Value at risk", Value: value, Type: export.Currency},
+		},
+		Tables: []export.Table{{
+			Title: "Lots",
+			Columns: []export.Column{
+				{Title: "Item"},
+				{Title: "Name", Width: 1.5},
+				{Title: "Category"},
+				{Title: "Lot"},
+				{Title: "Expires", Type: export.Date},
+				{Title: "Days left", Type: export.Integer},
+				{Title: "Quantity", Type: export.Integer, Total: true},
+				{Title: "Value", Type: export.Currency, Total: true, Bar: true},
+			},
+			Rows: rowsOf(len(lots), func(i int) []interface{} {
+				lot := &lots[i]
+				return []interface{}{lot.ItemID, lot.Name, lot.Category, lot.LotNumber, lot.ExpiresAt,
+					inventory.DaysLeft(&lot.Lot, now), lot.Quantity, float64(lot.Quantity) * lot.UnitCost}
+			}),
+		}},
+	}
+}
+
+// lotError maps lot store errors to HTTP responses
+func (h *Handlers) lotError(c *gin.Context, err error) {
+	if errors.Is(err, inventory.ErrLotNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	h.internalError(c, "Lot request failed", err)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+)
+
+func TestGetExpiringLotsValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/inventory/lots/expiring")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	for _, query := range []string{"days=soon", "days=-1", "days=400", "format=docx"} {
+		w := performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/inventory/lots/expiring?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestExpiringLotsDocument(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	expired, soon := now.AddDate(0, 0, -2), now.AddDate(0, 0, 5)
+	lots := []inventory.ExpiringLot{
+		{Lot: models.Lot{ItemID: "ITM-2024-004", LotNumber: "B240101", ExpiresAt: &expired, Quantity: 10},
+			Name: "Canned Tuna", Category: "Food", UnitCost: 1.5},
+		{Lot: models.Lot{ItemID: "ITM-2024-004", LotNumber: "B240201", ExpiresAt: &soon, Quantity: 40},
+			Name: "Canned Tuna", Category: "Food", UnitCost: 1.5},
+	}
+
+	doc := expiringLotsDocument(lots, 30, "Food", now)
+	assert.Equal(t, "Lots expiring within 30 days, category Food", doc.Subtitle)
+	assert.Equal(t, 1, doc.Figures[1].Value, "one lot has expired")
+	assert.Equal(t, 75.0, doc.Figures[2].Value)
+
+	var buf bytes.Buffer
+	require.NoError(t, export.Write(&buf, export.FormatCSV, doc))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.True(t, len(lines) > 4)
+	rows := lines[len(lines)-4:]
+	assert.Equal(t, "Item,Name,Category,Lot,Expires,Days left,Quantity,Value", rows[0])
+	assert.Equal(t, "ITM-2024-004,Canned Tuna,Food,B240101,2024-03-13T12:00:00Z,-2,10,15.00", rows[1])
+	assert.Equal(t, "Total,,,,,,50,75.00", rows[3])
+}
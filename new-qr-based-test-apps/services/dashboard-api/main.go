@@ -7,7 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -15,6 +15,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/cache"
+	"warehouse-shared/database"
+	"warehouse-shared/inventory"
+	"warehouse-shared/logger"
+	"warehouse-shared/models"
+	"warehouse-shared/report"
+	"warehouse-shared/webhook"
 )
 
 func main() {
@@ -27,36 +36,164 @@ func main() {
 	config := LoadConfig()
 
 	// Initialize logger
-	logger, err := NewLogger(config.LogLevel, config.LogFormat)
+	logger, err := logger.NewLogger(config.LogLevel, config.LogFormat)
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 	defer logger.Close()
 
 	// Initialize database connections
-	mongoDB, err := ConnectMongoDB(config.MongoURI, config.MongoDatabase)
+	mongoDB, err := database.ConnectMongoDB(config.MongoURI, config.MongoDatabase)
 	if err != nil {
 		logger.Fatal("Failed to connect to MongoDB", zap.Error(err))
 	}
 	defer mongoDB.Close()
 
-	elasticsearch, err := ConnectElasticsearch(config.ElasticsearchURL)
+	elasticsearch, err := database.ConnectElasticsearch(config.ElasticsearchURL)
 	if err != nil {
 		logger.Fatal("Failed to connect to Elasticsearch", zap.Error(err))
 	}
 
-	// Initialize Kafka service
-	kafkaService := NewKafkaService(strings.Split(config.KafkaBrokers, ","))
-	defer kafkaService.Close()
+	// Initialize event bus
+	eventBus, err := NewEventBus(config)
+	if err != nil {
+		logger.Fatal("Failed to initialize event bus", zap.Error(err))
+	}
+	defer eventBus.Close()
+
+	ReconcileTopics(config, logger)
 
 	// Initialize services
 	services := &Services{
 		MongoDB:       mongoDB,
 		Elasticsearch: elasticsearch,
-		Kafka:         kafkaService,
+		Events:        eventBus,
 		Logger:        logger,
-		JWTService:    NewJWTService(config.JWTSecret, "warehouse-dashboard"),
+		JWTService:    auth.NewJWTService(config.JWTSecret, "warehouse-dashboard"),
+
+		LowStockThreshold: config.LowStockThreshold,
+	}
+
+	// Initialize cache
+	services.CacheTTLs, err = cache.ParseTTLs(config.CacheTTLs, defaultCacheTTLs)
+	if err != nil {
+		logger.Fatal("Invalid cache TTLs", zap.Error(err))
+	}
+
+	redisClient, err := database.ConnectRedis(config.RedisURL)
+	if err != nil {
+		logger.Warn("Redis unavailable, running without cache", zap.Error(err))
+	} else {
+		defer redisClient.Close()
+		services.Cache = cache.NewCache(redisClient, cache.DefaultConfig())
+
+		invalidator := cache.NewInvalidator(services.Cache, eventBus)
+		if err := invalidator.Start(); err != nil {
+			logger.Fatal("Failed to start cache invalidator", zap.Error(err))
+		}
+		defer invalidator.Stop()
+	}
+
+	// Initialize stock ledger, locations, lots, serials, reorder policies,
+	// shipment reservations and count tasks
+	services.Ledger = inventory.NewLedger(mongoDB, eventBus)
+	if err := services.Ledger.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create stock movement indexes", zap.Error(err))
+	}
+	services.Locations = inventory.NewLocations(mongoDB)
+	if err := services.Locations.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create location indexes", zap.Error(err))
+	}
+	services.Lots = inventory.NewLots(mongoDB)
+	if err := services.Lots.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create lot indexes", zap.Error(err))
+	}
+	services.Serials = inventory.NewSerials(mongoDB)
+	if err := services.Serials.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create serial indexes", zap.Error(err))
+	}
+	services.Reorder = inventory.NewReorder(mongoDB, eventBus)
+	if err := services.Reorder.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create reorder indexes", zap.Error(err))
+	}
+	services.Shipments = inventory.NewShipments(mongoDB, services.Ledger, eventBus)
+	if err := services.Shipments.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create reservation indexes", zap.Error(err))
+	}
+	services.Counts = inventory.NewCounts(mongoDB, services.Ledger, inventory.CountThreshold{
+		Units: getEnvInt("COUNT_APPROVAL_UNITS", 10),
+		Value: float64(getEnvInt("COUNT_APPROVAL_VALUE", 500)),
+	})
+	if err := services.Counts.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create count task indexes", zap.Error(err))
+	}
+	services.Valuation = inventory.NewValuation(mongoDB)
+	if err := services.Valuation.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create valuation indexes", zap.Error(err))
+	}
+	services.Prices = inventory.NewPrices(mongoDB, eventBus)
+	if err := services.Prices.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create price history indexes", zap.Error(err))
+	}
+
+	expiryMonitor := inventory.NewExpiryMonitor(mongoDB, eventBus,
+		time.Duration(getEnvInt("LOT_EXPIRY_WARNING_DAYS", 30))*24*time.Hour,
+		time.Duration(getEnvInt("LOT_EXPIRY_CHECK_INTERVAL_MINUTES", 60))*time.Minute)
+	expiryMonitor.Start()
+	defer expiryMonitor.Stop()
+
+	priceScheduler := inventory.NewPriceScheduler(services.Prices,
+		time.Duration(getEnvInt("PRICE_SCHEDULE_INTERVAL_MINUTES", 5))*time.Minute)
+	priceScheduler.Start()
+	defer priceScheduler.Stop()
+
+	reorderEvaluator := inventory.NewReorderEvaluator(services.Reorder, eventBus)
+	if err := reorderEvaluator.Start(); err != nil {
+		logger.Fatal("Failed to start reorder evaluator", zap.Error(err))
+	}
+	defer reorderEvaluator.Stop()
+
+	backorderAllocator := inventory.NewBackorderAllocator(services.Shipments, eventBus)
+	if err := backorderAllocator.Start(); err != nil {
+		logger.Fatal("Failed to start backorder allocator", zap.Error(err))
 	}
+	defer backorderAllocator.Stop()
+
+	// Initialize webhook dispatcher
+	services.WebhookStore = webhook.NewStore(mongoDB)
+	if err := services.WebhookStore.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create webhook indexes", zap.Error(err))
+	}
+
+	webhookConfig := webhook.DefaultDispatcherConfig()
+	webhookConfig.MaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", webhookConfig.MaxAttempts)
+	webhookConfig.DisableAfter = getEnvInt("WEBHOOK_DISABLE_AFTER", webhookConfig.DisableAfter)
+	services.WebhookDispatcher = webhook.NewDispatcher(services.WebhookStore, eventBus, webhookConfig)
+	if err := services.WebhookDispatcher.Start(); err != nil {
+		logger.Fatal("Failed to start webhook dispatcher", zap.Error(err))
+	}
+	defer services.WebhookDispatcher.Stop()
+
+	// Initialize report builder
+	services.ReportStore = report.NewStore(mongoDB)
+	if err := services.ReportStore.EnsureIndexes(context.Background()); err != nil {
+		logger.Warn("Failed to create report indexes", zap.Error(err))
+	}
+
+	reportTimeout := time.Duration(getEnvInt("REPORT_RUN_TIMEOUT_SECONDS", 60)) * time.Second
+	services.ReportRunner = report.NewRunner(services.ReportStore, mongoDB, elasticsearch, reportTimeout)
+
+	reportScheduler := report.NewScheduler(services.ReportStore, services.ReportRunner,
+		time.Duration(getEnvInt("REPORT_SCHEDULER_INTERVAL_SECONDS", 30))*time.Second)
+	reportScheduler.Start()
+	defer reportScheduler.Stop()
+
+	// Initialize event stream
+	services.Stream = NewStreamHub(eventBus, logger)
+	if err := services.Stream.Start(); err != nil {
+		logger.Fatal("Failed to start event stream", zap.Error(err))
+	}
+	defer services.Stream.Stop()
 
 	// Initialize handlers
 	handlers := NewHandlers(services)
@@ -119,10 +256,30 @@ type Config struct {
 	MongoDatabase    string
 	ElasticsearchURL string
 	KafkaBrokers     string
+	KafkaEventModes  string
+	EventBus         string
 	JWTSecret        string
 	LogLevel         string
 	LogFormat        string
 	GinMode          string
+
+	RedisURL          string
+	CacheTTLs         string // name=duration overrides of defaultCacheTTLs
+	LowStockThreshold int
+
+	KafkaTopicsReconcile   string // off, check or apply
+	KafkaReplicationFactor int
+
+	KafkaAcks          string
+	KafkaCompression   string
+	KafkaBatchSize     int
+	KafkaBatchTimeout  time.Duration
+	KafkaAsyncTopics   string
+	KafkaTLS           bool
+	KafkaTLSCAFile     string
+	KafkaSASLMechanism string
+	KafkaUsername      string
+	KafkaPassword      string
 }
 
 // LoadConfig loads configuration from environment variables
@@ -133,10 +290,30 @@ func LoadConfig() *Config {
 		MongoDatabase:    getEnv("MONGODB_DATABASE", "warehouse_db"),
 		ElasticsearchURL: getEnv("ELASTICSEARCH_URL", "http://localhost:9200"),
 		KafkaBrokers:     getEnv("KAFKA_BROKERS", "localhost:9092"),
+		KafkaEventModes:  getEnv("KAFKA_EVENT_MODES", ""),
+		EventBus:         getEnv("EVENT_BUS", "kafka"),
 		JWTSecret:        getEnv("JWT_SECRET", "warehouse-super-secret-jwt-key-2024"),
 		LogLevel:         getEnv("LOG_LEVEL", "info"),
 		LogFormat:        getEnv("LOG_FORMAT", "json"),
 		GinMode:          getEnv("GIN_MODE", "debug"),
+
+		RedisURL:          getEnv("REDIS_URL", "redis://localhost:6379"),
+		CacheTTLs:         getEnv("CACHE_TTLS", ""),
+		LowStockThreshold: getEnvInt("LOW_STOCK_THRESHOLD", 10),
+
+		KafkaTopicsReconcile:   getEnv("KAFKA_TOPICS_RECONCILE", "check"),
+		KafkaReplicationFactor: getEnvInt("KAFKA_REPLICATION_FACTOR", 1),
+
+		KafkaAcks:          getEnv("KAFKA_ACKS", "all"),
+		KafkaCompression:   getEnv("KAFKA_COMPRESSION", ""),
+		KafkaBatchSize:     getEnvInt("KAFKA_BATCH_SIZE", 0),
+		KafkaBatchTimeout:  time.Duration(getEnvInt("KAFKA_BATCH_TIMEOUT_MS", 0)) * time.Millisecond,
+		KafkaAsyncTopics:   getEnv("KAFKA_ASYNC_TOPICS", models.TopicScanEvents),
+		KafkaTLS:           getEnv("KAFKA_TLS", "false") == "true",
+		KafkaTLSCAFile:     getEnv("KAFKA_TLS_CA_FILE", ""),
+		KafkaSASLMechanism: getEnv("KAFKA_SASL_MECHANISM", ""),
+		KafkaUsername:      getEnv("KAFKA_USERNAME", ""),
+		KafkaPassword:      getEnv("KAFKA_PASSWORD", ""),
 	}
 }
 
@@ -145,4 +322,11 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
 }
\ No newline at end of file
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
+)
+
+// movementRequest is the body of the record stock movement endpoint
+type movementRequest struct {
+	Type       string   `json:"type" validate:"required,oneof=receipt issue adjustment transfer return"`
+	Quantity   int      `json:"quantity" validate:"required"`
+	Location   string   `json:"warehouseLocation" validate:"max=100"`
+	ToLocation string   `json:"toLocation" validate:"max=100"`
+	Lot        string   `json:"lot" validate:"max=50"`
+	Serials    []string `json:"serials" validate:"max=1000,dive,max=100"`
+	Reason     string   `json:"reason" validate:"max=200"`
+	Reference  string   `json:"reference" validate:"max=100"`
+	UnitCost   float64  `json:"unitCost" validate:"min=0"`
+
+	ManufacturedAt *time.Time `json:"manufacturedAt"`
+	ExpiresAt      *time.Time `json:"expiresAt"`
+}
+
+// RecordStockMovement records a receipt, issue, adjustment, transfer or
+// return of an item. Adjustments rewrite what the ledger says is on hand,
+// so they need a supervisor. Stock leaving without a lot is picked first
+// expired first out. Movements of serialized items name their units.
+// Receipts may name their purchase cost, which opens the cost layer of the
+// units received.
+func (h *Handlers) RecordStockMovement(c *gin.Context) {
+	var req movementRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	claims := currentClaims(c)
+	if req.Type == models.MovementAdjustment && !auth.HasPermission(claims.AccessLevel, auth.AccessLevel3) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Adjustments need supervisor access"})
+		return
+	}
+
+	entry, err := h.services.Ledger.Record(c.Request.Context(), inventory.Movement{
+		ItemID:     c.Param("id"),
+		Type:       req.Type,
+		Quantity:   req.Quantity,
+		Location:   req.Location,
+		ToLocation: req.ToLocation,
+		Lot:        req.Lot,
+		Serials:    req.Serials,
+		Reason:     req.Reason,
+		Reference:  req.Reference,
+		UnitCost:   req.UnitCost,
+		UserID:     claims.UserID,
+
+		ManufacturedAt: req.ManufacturedAt,
+		ExpiresAt:      req.ExpiresAt,
+	})
+	if err != nil {
+		h.ledgerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":            "Stock movement recorded",
+		"itemId":             entry.Item.ItemID,
+		"stockLevel":         entry.Item.StockLevel,
+		"previousStockLevel": entry.PreviousLevel,
+		"stockValue":         entry.Item.StockValue,
+		"movements":          entry.Movements,
+	})
+}
+
+// GetStockMovements returns the ledger of an item, newest first. It
+// accepts type, reference, since and until (RFC 3339) filters and exports
+// the whole ledger, oldest first, with a format.
+func (h *Handlers) GetStockMovements(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	filter := inventory.MovementFilter{
+		ItemID:    c.Param("id"),
+		Type:      c.Query("type"),
+		Reference: c.Query("reference"),
+	}
+	for param, target := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + " date, expected RFC 3339"})
+				return
+			}
+			*target = &parsed
+		}
+	}
+
+	if format != "" {
+		exportCursor(h, c, format, "stock-movements-"+filter.ItemID, filter, h.services.Ledger.MovementCursor, movementsDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	movements, total, err := h.services.Ledger.ListMovements(c.Request.Context(), filter, offset, pagination.GetPageSize())
+	if err != nil {
+		h.internalError(c, "Failed to list stock movements", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"itemId":    filter.ItemID,
+		"movements": movements,
+		"total":     total,
+		"page":      pagination.Page,
+	})
+}
+
+// ledgerError maps stock ledger errors to HTTP responses
+func (h *Handlers) ledgerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrInvalidMovement):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrInsufficientStock), errors.Is(err, inventory.ErrCapacityExceeded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Failed to record stock movement", err)
+	}
+}
+
+// movementsDocument is the export of the stock ledger of an item. The
+// quantity total is the net change over the exported movements.
+func movementsDocument(ctx context.Context, cursor *mongo.Cursor, filter inventory.MovementFilter) *export.Document {
+	return &export.Document{
+		Title:    "Stock movements of " + filter.ItemID,
+		Subtitle: "Quantities are positive for stock in and negative for stock out",
+		Tables: []export.Table{{
+			Title: "Movements",
+			Columns: []export.Column{
+				{Title: "Date", Type: export.Date},
+				{Title: "Type"},
+				{Title: "Quantity", Type: export.Integer, Total: true},
+				{Title: "Location"},
+				{Title: "Lot"},
+				{Title: "Serials", Width: 1.5},
+				{Title: "Unit cost", Type: export.Currency},
+				{Title: "Value", Type: export.Currency, Total: true},
+				{Title: "Reason", Width: 1.5},
+				{Title: "Reference"},
+				{Title: "User"},
+			},
+			Rows: cursorRows(ctx, cursor, func(m *models.StockMovement) []interface{} {
+				return []interface{}{m.CreatedAt, m.Type, m.Quantity, m.WarehouseLocation, m.Lot, strings.Join(m.Serials, " "), m.UnitCost,
+					float64(m.Quantity) * m.UnitCost, m.Reason, m.Reference, m.UserID}
+			}),
+		}},
+	}
+}
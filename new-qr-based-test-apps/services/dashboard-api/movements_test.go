@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/auth"
+)
+
+func TestRecordStockMovementAccess(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodPost, "/api/v1/inventory/items/ITM-2024-001/movements")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodPost, "/api/v1/inventory/items/ITM-2024-001/movements", `{"type": "issue", "quantity": 1}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "scanner users cannot move stock")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/inventory/items/ITM-2024-001/movements", `{"type": "adjustment", "quantity": -3, "reason": "damaged"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "adjustments need a supervisor")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/inventory/items/ITM-2024-001/movements", `{"type": "theft", "quantity": 1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/inventory/items/ITM-2024-001/movements", `{"type": "receipt"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "quantity is required")
+}
+
+func TestGetStockMovementsValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	for _, query := range []string{"since=yesterday", "format=docx"} {
+		w := performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/inventory/items/ITM-2024-001/movements?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
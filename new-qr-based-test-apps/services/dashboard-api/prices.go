@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
+)
+
+// priceChangeRequest is the body of the change prices endpoint
+type priceChangeRequest struct {
+	CostPrice     float64    `json:"costPrice" validate:"required,gt=0"`
+	SellingPrice  float64    `json:"sellingPrice" validate:"required,gt=0"`
+	EffectiveFrom *time.Time `json:"effectiveFrom"`
+	Reason        string     `json:"reason" validate:"max=200"`
+}
+
+// GetItemPrices lists the price history of an item, latest effective
+// first, with its scheduled and cancelled changes
+func (h *Handlers) GetItemPrices(c *gin.Context) {
+	h.listPriceChanges(c, inventory.PriceFilter{ItemID: c.Param("id"), Status: c.Query("status")})
+}
+
+// GetPriceChanges lists the price changes of all items by status, the
+// scheduled ones with status=scheduled
+func (h *Handlers) GetPriceChanges(c *gin.Context) {
+	h.listPriceChanges(c, inventory.PriceFilter{ItemID: c.Query("itemId"), Status: c.Query("status")})
+}
+
+// listPriceChanges responds with a page of the price changes matching a
+// filter, or with all of them in an export
+func (h *Handlers) listPriceChanges(c *gin.Context, filter inventory.PriceFilter) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	if filter.Status != "" && !contains([]string{models.PriceScheduled, models.PriceApplied, models.PriceCancelled}, filter.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown price change status " + filter.Status})
+		return
+	}
+
+	if format != "" {
+		exportCursor(h, c, format, "price-changes", filter, h.services.Prices.Cursor, priceChangesDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	changes, total, err := h.services.Prices.List(c.Request.Context(), filter, offset, pagination.GetPageSize())
+	if err != nil {
+		h.internalError(c, "Failed to list price changes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"changes": changes,
+		"total":   total,
+		"page":    pagination.Page,
+	})
+}
+
+// ChangeItemPrices sets the cost and selling price of an item, now or from
+// a future effective date when the change is applied by the scheduler
+func (h *Handlers) ChangeItemPrices(c *gin.Context) {
+	var req priceChangeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	change := inventory.NewPriceChange{
+		ItemID:       c.Param("id"),
+		CostPrice:    req.CostPrice,
+		SellingPrice: req.SellingPrice,
+		Reason:       req.Reason,
+		UserID:       currentClaims(c).UserID,
+	}
+	if req.EffectiveFrom != nil {
+		change.EffectiveFrom = *req.EffectiveFrom
+	}
+
+	applied, err := h.services.Prices.Change(c.Request.Context(), change)
+	if err != nil {
+		h.priceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, applied)
+}
+
+// CancelPriceChange withdraws a scheduled price change
+func (h *Handlers) CancelPriceChange(c *gin.Context) {
+	id, ok := objectIDParam(c, "changeId")
+	if !ok {
+		return
+	}
+
+	change, err := h.services.Prices.Cancel(c.Request.Context(), id, currentClaims(c).UserID)
+	if err != nil {
+		h.priceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, change)
+}
+
+// GetMarginsAt returns the prices and profit margin of the items as they
+// were at a date, now by default; a day means the end of that day
+func (h *Handlers) GetMarginsAt(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+	at, ok := atParam(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.services.Prices.Margins(c.Request.Context(), at, c.Query("category"))
+	if err != nil {
+		h.internalError(c, "Failed to compute profit margins", err)
+		return
+	}
+
+	if format != "" {
+		h.export(c, format, "profit-margins-at", marginsDocument(report, c.Query("category")))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// priceError maps price history errors to HTTP responses
+func (h *Handlers) priceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrItemNotFound), errors.Is(err, inventory.ErrPriceChangeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrInvalidPrice):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrPriceChangeStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Price change failed", err)
+	}
+}
+
+// priceChangesDocument is the export of the price changes of a cursor
+func priceChangesDocument(ctx context.Context, cursor *mongo.Cursor, filter inventory.PriceFilter) *export.Document {
+	subtitle := "All items"
+	if filter.ItemID != "" {
+		subtitle = "Item " + filter.ItemID
+	}
+	if filter.Status != "" {
+		subtitle += ", status " + filter.Status
+	}
+
+	return &export.Document{
+		Title:    "Price changes",
+		Subtitle: subtitle,
+		Tables: []export.Table{{
+			Title: "Changes",
+			Columns: []export.Column{
+				{Title: "Item ID"},
+				{Title: "Status"},
+				{Title: "Effective from", Type: export.Date},
+				{Title: "Effective to", Type: export.Date},
+				{Title: "Cost price", Type: export.Currency},
+				{Title: "Selling price", Type: export.Currency},
+				{Title: "Margin", Type: export.Percent},
+				{Title: "Previous cost", Type: export.Currency},
+				{Title: "Previous selling", Type: export.Currency},
+				{Title: "Reason", Width: 2},
+				{Title: "Changed by"},
+			},
+			Rows: cursorRows(ctx, cursor, func(p *models.PriceChange) []interface{} {
+				return []interface{}{p.ItemID, p.Status, p.EffectiveFrom, p.EffectiveTo, p.CostPrice, p.SellingPrice,
+					p.ProfitMargin, p.PreviousCostPrice, p.PreviousSellingPrice, p.Reason, p.ChangedBy}
+			}),
+		}},
+	}
+}
+
+// marginsDocument is the export of the profit margins of the items at a
+// date
+func marginsDocument(report *inventory.MarginReport, category string) *export.Document {
+	subtitle := "Prices as they were at " + report.At.Format("2006-01-02 15:04 MST")
+	if category != "" {
+		subtitle += fmt.Sprintf(", category %s", category)
+	}
+
+	items := report.Items
+	return &export.Document{
+		Title:    "Profit margins",
+		Subtitle: subtitle,
+		Figures: []export.Figure{
+			{Label: "Items", Value: len(items), Type: export.Integer},
+			{Label: "Average margin", Value: report.AverageMargin, Type: export.Percent},
+		},
+		Tables: []export.Table{{
+			Title: "Items",
+			Columns: []export.Column{
+				{Title: "Item ID"},
+				{Title: "Name", Width: 2},
+				{Title: "Category"},
+				{Title: "Cost price", Type: export.Currency},
+				{Title: "Selling price", Type: export.Currency},
+				{Title: "Margin", Type: export.Percent, Bar: true},
+				{Title: "Priced since", Type: export.Date},
+			},
+			Rows: rowsOf(len(items), func(i int) []interface{} {
+				item := &items[i]
+				var since interface{}
+				if item.PricedSince != nil {
+					since = *item.PricedSince
+				}
+				return []interface{}{item.ItemID, item.Name, item.Category, item.CostPrice, item.SellingPrice,
+					item.ProfitMargin, since}
+			}),
+		}},
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/inventory"
+)
+
+func TestPriceRoutesValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/inventory/items/ITM-2024-001/prices")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	change := `{"costPrice": 52, "sellingPrice": 94.99}`
+	w = performAuthRequest(t, router, services, auth.AccessLevel3, http.MethodPost, "/api/v1/inventory/items/ITM-2024-001/prices", change)
+	assert.Equal(t, http.StatusForbidden, w.Code, "only managers change prices")
+
+	for name, body := range map[string]string{
+		"no selling price": `{"costPrice": 52}`,
+		"negative cost":    `{"costPrice": -1, "sellingPrice": 94.99}`,
+		"bad date":         `{"costPrice": 52, "sellingPrice": 94.99, "effectiveFrom": "next week"}`,
+	} {
+		w = performAuthRequest(t, router, services, auth.AccessLevel4, http.MethodPost, "/api/v1/inventory/items/ITM-2024-001/prices", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+
+	for _, query := range []string{"status=pending", "format=docx"} {
+		w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/inventory/price-changes?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel4, http.MethodPost, "/api/v1/inventory/price-changes/not-an-id/cancel", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, http.MethodGet, "/api/v1/analytics/margins-at")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "cost prices need a login")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodGet, "/api/v1/analytics/margins-at?at=last-year", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMarginsDocument(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	report := &inventory.MarginReport{
+		At:            time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		AverageMargin: 47.22,
+		Items: []inventory.ItemMargin{
+			{ItemID: "ITM-2024-001", Name: "Headphones", Category: "Electronics", CostPrice: 50, SellingPrice: 89.99, ProfitMargin: 44.44, PricedSince: &since},
+			{ItemID: "ITM-2024-002", Name: "T-Shirt", Category: "Clothing", CostPrice: 12, SellingPrice: 24, ProfitMargin: 50},
+		},
+	}
+
+	doc := marginsDocument(report, "Electronics")
+	assert.Contains(t, doc.Subtitle, "2024-04-01")
+	assert.Contains(t, doc.Subtitle, "category Electronics")
+	require.Len(t, doc.Tables, 1)
+	assert.Len(t, doc.Tables[0].Columns, 7)
+	assert.Equal(t, 47.22, doc.Figures[1].Value)
+}
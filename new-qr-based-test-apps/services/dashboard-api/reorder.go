@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
+)
+
+// Defaults of the reorder suggestions: the days of demand averaged and the
+// days of demand a reorder covers
+const (
+	defaultDemandDays = 30
+	defaultCoverDays  = 30
+)
+
+// reorderPolicyRequest is the body of the set reorder policy endpoint
+type reorderPolicyRequest struct {
+	Location        string `json:"location" validate:"max=100"`
+	ReorderPoint    int    `json:"reorderPoint" validate:"min=0"`
+	SafetyStock     int    `json:"safetyStock" validate:"min=0"`
+	ReorderQuantity int    `json:"reorderQuantity" validate:"required,min=1"`
+}
+
+// GetReorderPolicies lists the reorder policies, of one item with itemId
+func (h *Handlers) GetReorderPolicies(c *gin.Context) {
+	policies, err := h.services.Reorder.Policies(c.Request.Context(), c.Query("itemId"))
+	if err != nil {
+		h.internalError(c, "Failed to list reorder policies", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// SetReorderPolicy sets the reorder point, safety stock and reorder
+// quantity of an item, or of its stock within a location, and evaluates
+// its stock against them right away
+func (h *Handlers) SetReorderPolicy(c *gin.Context) {
+	var req reorderPolicyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	policy := &models.ReorderPolicy{
+		ItemID:          c.Param("id"),
+		Location:        req.Location,
+		ReorderPoint:    req.ReorderPoint,
+		SafetyStock:     req.SafetyStock,
+		ReorderQuantity: req.ReorderQuantity,
+		UpdatedBy:       currentClaims(c).UserID,
+	}
+	if err := h.services.Reorder.SetPolicy(c.Request.Context(), policy); err != nil {
+		h.reorderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeleteReorderPolicy removes the policy of an item, or with location the
+// policy of its stock within that location, and resolves its alert
+func (h *Handlers) DeleteReorderPolicy(c *gin.Context) {
+	itemID := c.Param("id")
+	if err := h.services.Reorder.DeletePolicy(c.Request.Context(), itemID, c.Query("location")); err != nil {
+		h.reorderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Reorder policy deleted", "itemId": itemID})
+}
+
+// GetStockAlerts lists stock alerts, newest first. Without a status only
+// the unresolved ones are listed.
+func (h *Handlers) GetStockAlerts(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	filter := inventory.AlertFilter{
+		ItemID:   c.Query("itemId"),
+		Status:   c.Query("status"),
+		Severity: c.Query("severity"),
+	}
+	if filter.Status != "" && !contains([]string{models.AlertOpen, models.AlertAcknowledged, models.AlertResolved}, filter.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown alert status " + filter.Status})
+		return
+	}
+	if filter.Severity != "" && !contains([]string{models.AlertLow, models.AlertCritical}, filter.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown alert severity " + filter.Severity})
+		return
+	}
+
+	if format != "" {
+		exportCursor(h, c, format, "stock-alerts", filter, h.services.Reorder.AlertCursor, alertsDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	alerts, total, err := h.services.Reorder.Alerts(c.Request.Context(), filter, offset, pagination.GetPageSize())
+	if err != nil {
+		h.internalError(c, "Failed to list stock alerts", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"total":  total,
+		"page":   pagination.Page,
+	})
+}
+
+// AcknowledgeStockAlert marks an alert as seen
+func (h *Handlers) AcknowledgeStockAlert(c *gin.Context) {
+	id, ok := objectIDParam(c, "alertId")
+	if !ok {
+		return
+	}
+
+	alert, err := h.services.Reorder.Acknowledge(c.Request.Context(), id, currentClaims(c).UserID)
+	if err != nil {
+		h.reorderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+// GetReorderSuggestions proposes a reorder for every policy at its reorder
+// point, sized from the demand of the past days (default 30) to cover
+// cover days (default 30)
+func (h *Handlers) GetReorderSuggestions(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	days, ok := dayParam(c, "days", defaultDemandDays)
+	if !ok {
+		return
+	}
+	cover, ok := dayParam(c, "cover", defaultCoverDays)
+	if !ok {
+		return
+	}
+
+	suggestions, err := h.services.Reorder.Suggestions(c.Request.Context(), days, cover, time.Now())
+	if err != nil {
+		h.internalError(c, "Failed to compute reorder suggestions", err)
+		return
+	}
+
+	if format != "" {
+		h.export(c, format, "reorder-suggestions", reorderDocument(suggestions, days, cover))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"days":        days,
+		"cover":       cover,
+		"suggestions": suggestions,
+		"total":       len(suggestions),
+	})
+}
+
+// dayParam reads a number of days from 1 to 365, responding with 400 when
+// it is not one
+func dayParam(c *gin.Context, name string, fallback int) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, true
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 || days > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a number from 1 to 365"})
+		return 0, false
+	}
+	return days, true
+}
+
+// reorderError maps reorder store errors to HTTP responses
+func (h *Handlers) reorderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrItemNotFound), errors.Is(err, inventory.ErrPolicyNotFound),
+		errors.Is(err, inventory.ErrAlertNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrInvalidPolicy):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrAlertResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Reorder request failed", err)
+	}
+}
+
+// reorderDocument is the export of the reorder suggestions, a purchase
+// list with what it costs
+func reorderDocument(suggestions []inventory.ReorderSuggestion, days, cover int) *export.Document {
+	critical, value := 0, 0.0
+	for i := range suggestions {
+		if suggestions[i].Severity == models.AlertCritical {
+			critical++
+		}
+		value += suggestions[i].Value
+	}
+
+	return &export.Document{
+		Title:    "Reorder suggestions",
+		Subtitle: fmt.Sprintf("Demand of the past %d days, reorders covering %d days", days, cover),
+		Figures: []export.Figure{
+			{Label: "Suggestions", Value: len(suggestions), Type: export.Integer},
+			{Label: "Critical", Value: critical, Type: export.Integer},
+			{Label: "Reorder value", Value: value, Type: export.Currency},
+		},
+		Tables: []export.Table{{
+			Title: "Suggestions",
+			Columns: []export.Column{
+				{Title: "Item"},
+				{Title: "Name", Width: 1.5},
+				{Title: "Location"},
+				{Title: "Severity"},
+				{Title: "On hand", Type: export.Integer},
+				{Title: "Reorder point", Type: export.Integer},
+				{Title: "Daily demand", Type: export.Number},
+				{Title: "Quantity", Type: export.Integer, Total: true},
+				{Title: "Value", Type: export.Currency, Total: true, Bar: true},
+			},
+			Rows: rowsOf(len(suggestions), func(i int) []interface{} {
+				s := &suggestions[i]
+				return []interface{}{s.ItemID, s.Name, s.Location, s.Severity, s.OnHand, s.ReorderPoint,
+					s.DailyDemand, s.Quantity, s.Value}
+			}),
+		}},
+	}
+}
+
+// alertsDocument is the export of the stock alerts of a cursor
+func alertsDocument(ctx context.Context, cursor *mongo.Cursor, filter inventory.AlertFilter) *export.Document {
+	status := filter.Status
+	if status == "" {
+		status = "unresolved"
+	}
+	subtitle := "Status " + status
+	if filter.Severity != "" {
+		subtitle += ", severity " + filter.Severity
+	}
+	if filter.ItemID != "" {
+		subtitle += ", item " + filter.ItemID
+	}
+
+	return &export.Document{
+		Title:    "Stock alerts",
+		Subtitle: subtitle,
+		Tables: []export.Table{{
+			Title: "Alerts",
+			Columns: []export.Column{
+				{Title: "Item"},
+				{Title: "Location"},
+				{Title: "Severity"},
+				{Title: "Status"},
+				{Title: "On hand", Type: export.Integer},
+				{Title: "Reorder point", Type: export.Integer},
+				{Title: "Safety stock", Type: export.Integer},
+				{Title: "Reorder quantity", Type: export.Integer, Total: true},
+				{Title: "Raised", Type: export.Date},
+				{Title: "Resolved", Type: export.Date},
+			},
+			Rows: cursorRows(ctx, cursor, func(a *models.StockAlert) []interface{} {
+				return []interface{}{a.ItemID, a.Location, a.Severity, a.Status, a.OnHand, a.ReorderPoint,
+					a.SafetyStock, a.ReorderQuantity, a.RaisedAt, a.ResolvedAt}
+			}),
+		}},
+	}
+}
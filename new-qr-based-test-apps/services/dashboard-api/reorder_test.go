@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+)
+
+func TestReorderRoutesValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/inventory/stock-alerts")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	policy := `{"reorderPoint": 40, "safetyStock": 10, "reorderQuantity": 100}`
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPut, "/api/v1/inventory/items/ITM-2024-001/reorder-policy", policy)
+	assert.Equal(t, http.StatusForbidden, w.Code, "only supervisors set reorder policies")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel3, http.MethodPut, "/api/v1/inventory/items/ITM-2024-001/reorder-policy", `{"reorderPoint": 40}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "reorder quantity is required")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodPost, "/api/v1/inventory/stock-alerts/65f0c0ffee0000000000000a/acknowledge", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/inventory/stock-alerts/not-an-id/acknowledge", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	for _, query := range []string{"status=closed", "severity=high", "format=docx"} {
+		w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/inventory/stock-alerts?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	for _, query := range []string{"days=0", "cover=year", "format=docx"} {
+		w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/inventory/reorder-suggestions?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestReorderDocument(t *testing.T) {
+	suggestions := []inventory.ReorderSuggestion{
+		{ItemID: "ITM-2024-001", Severity: models.AlertCritical, Quantity: 80, Value: 4000},
+		{ItemID: "ITM-2024-003", Location: "SBY", Severity: models.AlertLow, Quantity: 50, Value: 750},
+	}
+
+	doc := reorderDocument(suggestions, 30, 14)
+	assert.Equal(t, "Demand of the past 30 days, reorders covering 14 days", doc.Subtitle)
+	assert.Equal(t, 1, doc.Figures[1].Value)
+	assert.Equal(t, 4750.0, doc.Figures[2].Value)
+}
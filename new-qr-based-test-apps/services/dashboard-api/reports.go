@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"warehouse-shared/export"
+	"warehouse-shared/models"
+	"warehouse-shared/report"
+)
+
+// reportRequest is the body of the create and update report endpoints
+type reportRequest struct {
+	Name         string                     `json:"name" validate:"required,max=100"`
+	Description  string                     `json:"description" validate:"max=500"`
+	Entity       string                     `json:"entity" validate:"required,oneof=items shipments scan_logs"`
+	Columns      []string                   `json:"columns"`
+	Filters      []models.ReportFilter      `json:"filters" validate:"dive"`
+	GroupBy      []string                   `json:"groupBy"`
+	Aggregations []models.ReportAggregation `json:"aggregations" validate:"dive"`
+	Sort         []models.ReportSort        `json:"sort" validate:"dive"`
+	Limit        int                        `json:"limit" validate:"min=0"`
+	Schedule     string                     `json:"schedule"`
+}
+
+// definition builds the report definition of a request
+func (r *reportRequest) definition(ownerID string) *models.ReportDefinition {
+	return &models.ReportDefinition{
+		OwnerID:      ownerID,
+		Name:         r.Name,
+		Description:  r.Description,
+		Entity:       r.Entity,
+		Columns:      r.Columns,
+		Filters:      r.Filters,
+		GroupBy:      r.GroupBy,
+		Aggregations: r.Aggregations,
+		Sort:         r.Sort,
+		Limit:        r.Limit,
+		Schedule:     r.Schedule,
+	}
+}
+
+// Report handlers
+func (h *Handlers) CreateReport(c *gin.Context) {
+	var req reportRequest
+	if !bindJSON(c, &req) || !canReport(c, req.Entity) {
+		return
+	}
+
+	def := req.definition(currentClaims(c).UserID)
+	if err := report.Validate(def); err != nil {
+		h.reportError(c, err)
+		return
+	}
+	if err := h.services.ReportStore.CreateDefinition(c.Request.Context(), def); err != nil {
+		h.reportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Report created successfully",
+		"report":  def,
+	})
+}
+
+func (h *Handlers) GetReports(c *gin.Context) {
+	defs, err := h.services.ReportStore.ListDefinitions(c.Request.Context(), currentClaims(c).UserID)
+	if err != nil {
+		h.internalError(c, "Failed to list reports", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": defs,
+		"total":   len(defs),
+	})
+}
+
+// GetReportFields lists the entities a report can query and their fields
+func (h *Handlers) GetReportFields(c *gin.Context) {
+	entities := gin.H{}
+	for _, entity := range []string{models.ReportEntityItems, models.ReportEntityShipments, models.ReportEntityScanLogs} {
+		entities[entity] = report.Fields(entity)
+	}
+	c.JSON(http.StatusOK, gin.H{"entities": entities})
+}
+
+func (h *Handlers) GetReport(c *gin.Context) {
+	def, ok := h.reportDefinition(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": def})
+}
+
+func (h *Handlers) UpdateReport(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req reportRequest
+	if !bindJSON(c, &req) || !canReport(c, req.Entity) {
+		return
+	}
+
+	def := req.definition(currentClaims(c).UserID)
+	def.ID = id
+	if err := report.Validate(def); err != nil {
+		h.reportError(c, err)
+		return
+	}
+	if err := h.services.ReportStore.UpdateDefinition(c.Request.Context(), def); err != nil {
+		h.reportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Report updated successfully",
+		"report":  def,
+	})
+}
+
+func (h *Handlers) DeleteReport(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.services.ReportStore.DeleteDefinition(c.Request.Context(), id, currentClaims(c).UserID); err != nil {
+		h.reportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Report deleted successfully",
+		"id":      id.Hex(),
+	})
+}
+
+// RunReport runs a report now and returns the run with its rows
+func (h *Handlers) RunReport(c *gin.Context) {
+	def, ok := h.reportDefinition(c)
+	if !ok || !canReport(c, def.Entity) {
+		return
+	}
+
+	run, err := h.services.ReportRunner.Run(c.Request.Context(), def, models.ReportTriggerManual)
+	if err != nil {
+		h.internalError(c, "Failed to run report", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"run": run})
+}
+
+// GetReportRuns lists the runs of a report without their rows
+func (h *Handlers) GetReportRuns(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	runs, err := h.services.ReportStore.ListRuns(c.Request.Context(), id, currentClaims(c).UserID, limit)
+	if err != nil {
+		h.internalError(c, "Failed to list report runs", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs":  runs,
+		"total": len(runs),
+	})
+}
+
+func (h *Handlers) GetReportRun(c *gin.Context) {
+	run, ok := h.reportRun(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"run": run})
+}
+
+// DownloadReportRun sends the rows of a run as a CSV, XLSX or PDF
+// attachment, CSV unless the format parameter says otherwise
+func (h *Handlers) DownloadReportRun(c *gin.Context) {
+	format := export.FormatCSV
+	if value := c.Query("format"); value != "" {
+		parsed, err := export.ParseFormat(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		format = parsed
+	}
+
+	def, ok := h.reportDefinition(c)
+	if !ok || !canReport(c, def.Entity) {
+		return
+	}
+	run, ok := h.reportRun(c)
+	if !ok {
+		return
+	}
+	if run.Status != models.ReportRunSucceeded {
+		c.JSON(http.StatusConflict, gin.H{"error": "report run has no results", "status": run.Status})
+		return
+	}
+
+	h.export(c, format, "report-"+run.ReportID.Hex(), reportRunDocument(def, run))
+}
+
+// canReport responds with 403 unless the user may report on an entity
+func canReport(c *gin.Context, entity string) bool {
+	if !report.CanReport(currentClaims(c).AccessLevel, entity) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient access level for " + entity + " reports"})
+		return false
+	}
+	return true
+}
+
+// reportDefinition loads the report of the id parameter, responding on failure
+func (h *Handlers) reportDefinition(c *gin.Context) (*models.ReportDefinition, bool) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return nil, false
+	}
+
+	def, err := h.services.ReportStore.GetDefinition(c.Request.Context(), id, currentClaims(c).UserID)
+	if err != nil {
+		h.reportError(c, err)
+		return nil, false
+	}
+	return def, true
+}
+
+// reportRun loads the run of the id and runId parameters, responding on failure
+func (h *Handlers) reportRun(c *gin.Context) (*models.ReportRun, bool) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return nil, false
+	}
+	runID, ok := objectIDParam(c, "runId")
+	if !ok {
+		return nil, false
+	}
+
+	run, err := h.services.ReportStore.GetRun(c.Request.Context(), id, runID, currentClaims(c).UserID)
+	if err != nil {
+		h.reportError(c, err)
+		return nil, false
+	}
+	return run, true
+}
+
+// reportError maps report errors to HTTP responses
+func (h *Handlers) reportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, report.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, report.ErrInvalidDefinition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Report request failed", err)
+	}
+}
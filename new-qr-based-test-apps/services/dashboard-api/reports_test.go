@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/export"
+	"warehouse-shared/models"
+)
+
+func TestReportsRequireAuth(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/reports")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestCreateReportValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+	post := func(level, body string) *httptest.ResponseRecorder {
+		return performAuthRequest(t, router, services, level, http.MethodPost, "/api/v1/reports", body)
+	}
+
+	w := post(auth.AccessLevel4, `{"name": "Stock", "entity": "users"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = post(auth.AccessLevel4, `{"name": "Stock", "entity": "items", "groupBy": ["stockLevel"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "cannot group by")
+
+	w = post(auth.AccessLevel4, `{"name": "Stock", "entity": "items", "schedule": "sometimes"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "schedule")
+
+	scans := `{"name": "Scans", "entity": "scan_logs", "groupBy": ["timestamp"]}`
+	w = post(auth.AccessLevel2, scans)
+	assert.Equal(t, http.StatusForbidden, w.Code, "scan logs name the users who scanned")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPut, "/api/v1/reports/"+primitive.NewObjectID().Hex(), scans)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = post(auth.AccessLevel3, scans)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "supervisors get past the access check")
+	assert.Contains(t, w.Body.String(), "cannot group by")
+}
+
+func TestGetReportFields(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performAuthRequest(t, router, services, auth.AccessLevel4, http.MethodGet, "/api/v1/reports/fields", "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Entities map[string]map[string]string `json:"entities"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "number", response.Entities["items"]["stockLevel"])
+	assert.Equal(t, "date", response.Entities["scan_logs"]["timestamp"])
+}
+
+func TestReportRunDocumentCSV(t *testing.T) {
+	at := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	def := &models.ReportDefinition{
+		Name:         "Stock by location",
+		Aggregations: []models.ReportAggregation{{Function: "sum", Field: "stockLevel", Alias: "stock"}},
+	}
+	run := &models.ReportRun{
+		Trigger:   models.ReportTriggerManual,
+		Columns:   []string{"location", "stock", "updated"},
+		StartedAt: at,
+		Rows: []map[string]interface{}{
+			{"location": "WH-A", "stock": 12.5, "updated": at},
+			{"location": nil, "stock": 3.0, "updated": primitive.NewDateTimeFromTime(at)},
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, export.Write(&out, export.FormatCSV, reportRunDocument(def, run)))
+	assert.Equal(t, "location,stock,updated\n"+
+		"WH-A,12.5,2024-03-01T08:30:00Z\n"+
+		",3,2024-03-01T08:30:00Z\n"+
+		"Total,15.5,\n", out.String())
+}
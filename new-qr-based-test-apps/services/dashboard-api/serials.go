@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
+)
+
+// serialStatuses are the statuses the serial list filters by
+var serialStatuses = []string{models.SerialInStock, models.SerialReserved, models.SerialShipped,
+	models.SerialReturned, models.SerialRemoved}
+
+// serializedRequest is the body of the item serialization endpoint
+type serializedRequest struct {
+	Serialized *bool `json:"serialized" validate:"required"`
+}
+
+// reserveRequest is the body of the reserve serial endpoint
+type reserveRequest struct {
+	Reference string `json:"reference" validate:"required,max=100"`
+}
+
+// SetItemSerialized switches serial number tracking of an item. It only
+// switches while the item holds no stock.
+func (h *Handlers) SetItemSerialized(c *gin.Context) {
+	var req serializedRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	itemID := c.Param("id")
+	if err := h.services.Serials.SetSerialized(c.Request.Context(), itemID, *req.Serialized); err != nil {
+		h.serialError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"itemId": itemID, "serialized": *req.Serialized})
+}
+
+// GetSerials lists units by itemId, status, location (the units held
+// within it) and shipmentId, a page at a time or all of them as an export
+func (h *Handlers) GetSerials(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	filter := inventory.SerialFilter{
+		ItemID:     c.Query("itemId"),
+		Status:     c.Query("status"),
+		Within:     c.Query("location"),
+		ShipmentID: c.Query("shipmentId"),
+	}
+	if filter.Status != "" && !contains(serialStatuses, filter.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown serial status " + filter.Status})
+		return
+	}
+
+	if format != "" {
+		exportCursor(h, c, format, "serials", filter, h.services.Serials.Cursor, serialsDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	serials, total, err := h.services.Serials.List(c.Request.Context(), filter, offset, pagination.GetPageSize())
+	if err != nil {
+		h.internalError(c, "Failed to list serials", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"serials": serials,
+		"total":   total,
+		"page":    pagination.Page,
+	})
+}
+
+// GetSerial returns a unit by serial number with its history from receipt
+// and the shipment it went out with, for warranty claims
+func (h *Handlers) GetSerial(c *gin.Context) {
+	trace, err := h.services.Serials.Trace(c.Request.Context(), c.Param("serial"))
+	if err != nil {
+		h.serialError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, trace)
+}
+
+// ReserveSerial sets a unit in stock aside for a shipment or other
+// reference; only an issue under that reference ships it
+func (h *Handlers) ReserveSerial(c *gin.Context) {
+	var req reserveRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	serial, err := h.services.Serials.Reserve(c.Request.Context(), c.Param("serial"), req.Reference, currentClaims(c).UserID)
+	if err != nil {
+		h.serialError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, serial)
+}
+
+// ReleaseSerial puts a reserved unit back in stock
+func (h *Handlers) ReleaseSerial(c *gin.Context) {
+	serial, err := h.services.Serials.Release(c.Request.Context(), c.Param("serial"), currentClaims(c).UserID)
+	if err != nil {
+		h.serialError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, serial)
+}
+
+// serialError maps serial store errors to HTTP responses
+func (h *Handlers) serialError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrSerialNotFound), errors.Is(err, inventory.ErrItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrSerialUnavailable), errors.Is(err, inventory.ErrItemHoldsStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Serial request failed", err)
+	}
+}
+
+// serialsDocument is the export of the serial list
+func serialsDocument(ctx context.Context, cursor *mongo.Cursor, filter inventory.SerialFilter) *export.Document {
+	subtitle := ""
+	for _, part := range [][2]string{{"item", filter.ItemID}, {"status", filter.Status},
+		{"location", filter.Within}, {"shipment", filter.ShipmentID}} {
+		if part[1] != "" {
+			if subtitle != "" {
+				subtitle += ", "
+			}
+			subtitle += part[0] + " " + part[1]
+		}
+	}
+	if subtitle == "" {
+		subtitle = "All records"
+	}
+
+	return &export.Document{
+		Title:    "Serial numbers",
+		Subtitle: subtitle,
+		Tables: []export.Table{{
+			Title: "Units",
+			Columns: []export.Column{
+				{Title: "Serial number", Width: 1.5},
+				{Title: "Item"},
+				{Title: "Status"},
+				{Title: "Location"},
+				{Title: "Lot"},
+				{Title: "Reserved for"},
+				{Title: "Shipment"},
+				{Title: "Updated", Type: export.Date},
+			},
+			Rows: cursorRows(ctx, cursor, func(s *models.Serial) []interface{} {
+				return []interface{}{s.SerialNumber, s.ItemID, s.Status, s.Location, s.Lot, s.ReservedFor, s.ShipmentID, s.UpdatedAt}
+			}),
+		}},
+	}
+}
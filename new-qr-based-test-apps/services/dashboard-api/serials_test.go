@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/auth"
+)
+
+func TestSerialRoutesValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/serials/WBH2400001")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodPost, "/api/v1/serials/WBH2400001/reserve", `{"reference": "SHP-2024-001"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "scanner users cannot reserve units")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/serials/WBH2400001/reserve", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "reservations need a reference")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/serials?status=lost", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPut, "/api/v1/inventory/items/ITM-2024-001/serialized", `{"serialized": true}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "only supervisors switch serialization")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel3, http.MethodPut, "/api/v1/inventory/items/ITM-2024-001/serialized", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "serialized is required")
+}
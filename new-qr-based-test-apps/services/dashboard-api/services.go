@@ -1,93 +1,161 @@
 package main
 
 import (
-	"github.com/elastic/go-elasticsearch/v8"
-	"go.mongodb.org/mongo-driver/mongo"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"go.uber.org/zap"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/cache"
+	"warehouse-shared/database"
+	"warehouse-shared/inventory"
+	"warehouse-shared/kafka"
+	"warehouse-shared/logger"
+	"warehouse-shared/report"
+	"warehouse-shared/webhook"
 )
 
 // Services holds all service dependencies
 type Services struct {
-	MongoDB       *MongoDB
-	Elasticsearch *ElasticsearchClient
-	Kafka         *KafkaService
-	Logger        *Logger
-	JWTService    *JWTService
-}
-
-// MongoDB represents a MongoDB connection
-type MongoDB struct {
-	Client   *mongo.Client
-	Database *mongo.Database
-}
-
-// ElasticsearchClient represents an Elasticsearch connection
-type ElasticsearchClient struct {
-	Client *elasticsearch.Client
-}
-
-// KafkaService manages Kafka operations
-type KafkaService struct {
-	brokers   []string
-	producers map[string]*Producer
-	consumers map[string]*Consumer
-}
-
-// Logger represents the application logger
-type Logger struct {
-	*zap.Logger
+	MongoDB       *database.MongoDB
+	Elasticsearch *database.ElasticsearchClient
+	Events        kafka.EventBus
+	Logger        *logger.Logger
+	JWTService    *auth.JWTService
+
+	Ledger    *inventory.Ledger
+	Locations *inventory.Locations
+	Lots      *inventory.Lots
+	Serials   *inventory.Serials
+	Reorder   *inventory.Reorder
+	Shipments *inventory.Shipments
+	Counts    *inventory.Counts
+	Valuation *inventory.Valuation
+	Prices    *inventory.Prices
+
+	WebhookStore      *webhook.Store
+	WebhookDispatcher *webhook.Dispatcher
+	Stream            *StreamHub
+
+	ReportStore  *report.Store
+	ReportRunner *report.Runner
+
+	Cache             *cache.Cache // nil when Redis is unavailable
+	CacheTTLs         cache.TTLs
+	LowStockThreshold int
 }
 
-// JWTService handles JWT operations
-type JWTService struct {
-	secretKey string
-	issuer    string
+// NewEventBus creates the event bus selected by the configuration. The
+// memory bus runs the whole stack in one process without a Kafka broker.
+func NewEventBus(config *Config) (kafka.EventBus, error) {
+	switch config.EventBus {
+	case "memory":
+		return kafka.NewMemoryBus(), nil
+	case "kafka", "":
+		modes, err := kafka.ParseTopicEventModes(config.KafkaEventModes)
+		if err != nil {
+			return nil, err
+		}
+
+		security, err := kafkaSecurity(config)
+		if err != nil {
+			return nil, err
+		}
+
+		options, err := producerOptions(config)
+		if err != nil {
+			return nil, err
+		}
+
+		service := kafka.NewKafkaService(strings.Split(config.KafkaBrokers, ","))
+		service.SetSecurity(security)
+		service.SetProducerOptions(options)
+		for topic, mode := range modes {
+			service.SetEventMode(topic, mode)
+		}
+
+		// Scan events come in bursts from many handhelds, publishing them
+		// asynchronously keeps the broker round trip out of the request
+		async := options
+		async.Async = true
+		for _, topic := range strings.Split(config.KafkaAsyncTopics, ",") {
+			if topic = strings.TrimSpace(topic); topic != "" {
+				service.SetTopicProducerOptions(topic, async)
+			}
+		}
+		return service, nil
+	default:
+		return nil, fmt.Errorf("unknown event bus: %q", config.EventBus)
+	}
 }
 
-// Producer represents a Kafka producer
-type Producer struct {
-	// Implementation details
+// producerOptions builds the Kafka producer options from the configuration
+func producerOptions(config *Config) (kafka.ProducerOptions, error) {
+	options := kafka.DefaultProducerOptions()
+
+	acks, err := kafka.ParseRequiredAcks(config.KafkaAcks)
+	if err != nil {
+		return options, err
+	}
+	options.RequiredAcks = acks
+
+	if config.KafkaCompression != "" {
+		compression, err := kafka.ParseCompression(config.KafkaCompression)
+		if err != nil {
+			return options, err
+		}
+		options.Compression = compression
+	}
+
+	if config.KafkaBatchSize > 0 {
+		options.BatchSize = config.KafkaBatchSize
+	}
+	if config.KafkaBatchTimeout > 0 {
+		options.BatchTimeout = config.KafkaBatchTimeout
+	}
+	return options, nil
 }
 
-// Consumer represents a Kafka consumer
-type Consumer struct {
-	// Implementation details
+// kafkaSecurity builds the Kafka TLS and SASL settings from the configuration
+func kafkaSecurity(config *Config) (*kafka.SecurityConfig, error) {
+	return kafka.NewSecurityConfig(config.KafkaTLS, config.KafkaTLSCAFile,
+		config.KafkaSASLMechanism, config.KafkaUsername, config.KafkaPassword)
 }
 
-// Placeholder implementations - these would be moved to separate files in a real implementation
-
-// ConnectMongoDB establishes a connection to MongoDB
-func ConnectMongoDB(uri, database string) (*MongoDB, error) {
-	// Implementation placeholder
-	return &MongoDB{}, nil
-}
-
-// ConnectElasticsearch establishes a connection to Elasticsearch
-func ConnectElasticsearch(url string) (*ElasticsearchClient, error) {
-	// Implementation placeholder
-	return &ElasticsearchClient{}, nil
-}
-
-// NewKafkaService creates a new Kafka service
-func NewKafkaService(brokers []string) *KafkaService {
-	// Implementation placeholder
-	return &KafkaService{brokers: brokers}
+// ReconcileTopics checks the Kafka topics against their specs at startup.
+// In "apply" mode missing topics are created and configs updated. Drift is
+// logged and never stops the service.
+func ReconcileTopics(config *Config, logger *logger.Logger) {
+	if config.EventBus == "memory" || config.KafkaTopicsReconcile == "off" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	security, err := kafkaSecurity(config)
+	if err != nil {
+		logger.Warn("Invalid Kafka security settings", zap.Error(err))
+		return
+	}
+
+	admin := kafka.NewTopicAdmin(strings.Split(config.KafkaBrokers, ","), security)
+	specs := kafka.DefaultTopicSpecs(config.KafkaReplicationFactor)
+	report, err := admin.Reconcile(ctx, specs, config.KafkaTopicsReconcile == "apply")
+	if err != nil {
+		logger.Warn("Failed to reconcile Kafka topics", zap.Error(err))
+		return
+	}
+
+	for _, drift := range report.Drift {
+		logger.Warn("Kafka topic drift",
+			zap.String("topic", drift.Topic),
+			zap.String("field", drift.Field),
+			zap.String("expected", drift.Expected),
+			zap.String("actual", drift.Actual),
+			zap.String("action", drift.Action))
+	}
 }
-
-// NewLogger creates a new logger instance
-func NewLogger(level, format string) (*Logger, error) {
-	// Implementation placeholder
-	logger, _ := zap.NewDevelopment()
-	return &Logger{logger}, nil
-}
-
-// NewJWTService creates a new JWT service
-func NewJWTService(secretKey, issuer string) *JWTService {
-	// Implementation placeholder
-	return &JWTService{secretKey: secretKey, issuer: issuer}
-}
-
-// Close methods
-func (m *MongoDB) Close() error        { return nil }
-func (k *KafkaService) Close() error   { return nil }
-func (l *Logger) Close() error         { return l.Sync() }
\ No newline at end of file
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
+)
+
+// shipmentRequest is the body of the create shipment endpoint. Lines
+// without a unit price take the selling price of their item.
+type shipmentRequest struct {
+	ShipmentID        string                `json:"shipmentId" validate:"required"`
+	Destination       string                `json:"destination" validate:"required,min=2,max=100"`
+	EstimatedDelivery *time.Time            `json:"estimatedDelivery"`
+	TrackingNumber    string                `json:"trackingNumber" validate:"max=50"`
+	Lines             []models.ShipmentLine `json:"lines" validate:"required,min=1,max=200,dive"`
+}
+
+// shipmentStatusRequest is the body of the update shipment status endpoint
+type shipmentStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=pending in_transit delivered delayed cancelled"`
+}
+
+// CreateShipment creates a pending shipment from its lines, computes its
+// value and weights and reserves the stock of its items. Items short of available stock are allocated in part or
+// backordered, which the response reports per item.
+func (h *Handlers) CreateShipment(c *gin.Context) {
+	var req shipmentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	allocation, err := h.services.Shipments.Create(c.Request.Context(), inventory.NewShipment{
+		ShipmentID:        req.ShipmentID,
+		Destination:       req.Destination,
+		EstimatedDelivery: req.EstimatedDelivery,
+		TrackingNumber:    req.TrackingNumber,
+		Lines:             req.Lines,
+		UserID:            currentClaims(c).UserID,
+	})
+	if err != nil {
+		h.shipmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, allocation)
+}
+
+// UpdateShipmentStatus moves a shipment to a status. Going in transit
+// issues its reserved stock and cancelling releases it.
+func (h *Handlers) UpdateShipmentStatus(c *gin.Context) {
+	var req shipmentStatusRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	change, err := h.services.Shipments.SetStatus(c.Request.Context(), c.Param("id"), req.Status, currentClaims(c).UserID)
+	if err != nil {
+		h.shipmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Shipment status updated",
+		"shipmentId":     change.Shipment.ShipmentID,
+		"previousStatus": change.PreviousStatus,
+		"newStatus":      change.Shipment.Status,
+		"shipment":       change.Shipment,
+		"reservations":   change.Reservations,
+		"movements":      change.Movements,
+	})
+}
+
+// GetShipmentAllocation returns a shipment with the stock reserved for it
+// per item and what is backordered
+func (h *Handlers) GetShipmentAllocation(c *gin.Context) {
+	allocation, err := h.services.Shipments.Allocation(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.shipmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, allocation)
+}
+
+// GetBackorders lists the items of shipments not yet shipped that are
+// short of stock, oldest first, of one item with itemId
+func (h *Handlers) GetBackorders(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	if format != "" {
+		exportCursor(h, c, format, "backorders", c.Query("itemId"), h.services.Shipments.BackorderCursor, backordersDocument)
+		return
+	}
+
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := pagination.GetOffset()
+
+	backorders, total, err := h.services.Shipments.Backorders(c.Request.Context(), c.Query("itemId"), offset, pagination.GetPageSize())
+	if err != nil {
+		h.internalError(c, "Failed to list backorders", err)
+		return
+	}
+
+	units := 0
+	for i := range backorders {
+		units += backorders[i].Backordered
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"backorders": backorders,
+		"units":      units,
+		"total":      total,
+		"page":       pagination.Page,
+	})
+}
+
+// shipmentError maps shipment store errors to HTTP responses. Issuing the
+// reserved stock of a shipment fails with a conflict when the stock is no
+// longer where it was reserved.
+func (h *Handlers) shipmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrShipmentNotFound), errors.Is(err, inventory.ErrItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrInvalidShipment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, inventory.ErrShipmentExists), errors.Is(err, inventory.ErrInvalidStatusChange),
+		errors.Is(err, inventory.ErrInsufficientStock), errors.Is(err, inventory.ErrInvalidMovement),
+		errors.Is(err, inventory.ErrSerialUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Shipment request failed", err)
+	}
+}
+
+// backordersDocument is the export of the backorders of a cursor
+func backordersDocument(ctx context.Context, cursor *mongo.Cursor, itemID string) *export.Document {
+	subtitle := "All items"
+	if itemID != "" {
+		subtitle = "Item " + itemID
+	}
+
+	return &export.Document{
+		Title:    "Backorders",
+		Subtitle: subtitle,
+		Tables: []export.Table{{
+			Title: "Backorders",
+			Columns: []export.Column{
+				{Title: "Shipment"},
+				{Title: "Item"},
+				{Title: "Requested", Type: export.Integer, Total: true},
+				{Title: "Allocated", Type: export.Integer, Total: true},
+				{Title: "Backordered", Type: export.Integer, Total: true, Bar: true},
+				{Title: "Since", Type: export.Date},
+			},
+			Rows: cursorRows(ctx, cursor, func(r *models.StockReservation) []interface{} {
+				return []interface{}{r.ShipmentID, r.ItemID, r.Requested, r.Allocated, r.Backordered, r.CreatedAt}
+			}),
+		}},
+	}
+}
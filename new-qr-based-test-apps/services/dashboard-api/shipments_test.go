@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/auth"
+)
+
+func TestShipmentRoutesValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodPut, "/api/v1/shipments/SHP-2024-001/status")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, http.MethodGet, "/api/v1/shipments/backorders")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	shipment := `{"shipmentId": "SHP-2024-010", "destination": "Jakarta", "lines": [{"itemId": "ITM-2024-001", "quantity": 5}]}`
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodPost, "/api/v1/shipments", shipment)
+	assert.Equal(t, http.StatusForbidden, w.Code, "scanner users cannot create shipments")
+
+	for name, body := range map[string]string{
+		"no items":       `{"shipmentId": "SHP-2024-010", "destination": "Jakarta", "lines": []}`,
+		"zero quantity":  `{"shipmentId": "SHP-2024-010", "destination": "Jakarta", "lines": [{"itemId": "ITM-2024-001", "quantity": 0}]}`,
+		"no item":        `{"shipmentId": "SHP-2024-010", "destination": "Jakarta", "lines": [{"quantity": 2}]}`,
+		"no id":          `{"destination": "Jakarta", "lines": [{"itemId": "ITM-2024-001", "quantity": 2}]}`,
+		"heavy negative": `{"shipmentId": "SHP-2024-010", "destination": "Jakarta", "lines": [{"itemId": "ITM-2024-001", "quantity": 2, "weightKg": -1}]}`,
+		"flat box":       `{"shipmentId": "SHP-2024-010", "destination": "Jakarta", "lines": [{"itemId": "ITM-2024-001", "quantity": 2, "dimensions": {"heightCm": -5}}]}`,
+	} {
+		w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/shipments", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPut, "/api/v1/shipments/SHP-2024-001/status", `{"status": "lost"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodPut, "/api/v1/shipments/SHP-2024-001/status", `{"status": "in_transit"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel1, http.MethodGet, "/api/v1/shipments/backorders?format=docx", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
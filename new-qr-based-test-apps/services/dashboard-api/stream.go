@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/kafka"
+	"warehouse-shared/logger"
+	"warehouse-shared/models"
+)
+
+// Stream topics a dashboard can subscribe to
+const (
+	StreamStock     = "stock"
+	StreamShipments = "shipments"
+	StreamScans     = "scans"
+)
+
+// Stream settings
+const (
+	streamBufferSize   = 1000             // events kept for clients resuming with Last-Event-ID
+	streamClientBuffer = 64               // events queued per client before it is disconnected
+	streamHeartbeat    = 15 * time.Second // interval of the keep-alive comments
+	streamMaxEventAge  = 5 * time.Minute  // older events are history, not live updates
+)
+
+// streamTopic describes the events behind a stream topic and who may see them
+type streamTopic struct {
+	Topic       string
+	EventType   string
+	AccessLevel string
+}
+
+// streamTopics maps the stream topics to their Kafka events. Scans carry
+// the user and device of every scan, so they are limited to supervisors.
+var streamTopics = map[string]streamTopic{
+	StreamStock:     {Topic: models.TopicInventoryEvents, EventType: models.EventStockUpdated, AccessLevel: auth.AccessLevel2},
+	StreamShipments: {Topic: models.TopicShipmentEvents, EventType: models.EventShipmentStatusChanged, AccessLevel: auth.AccessLevel2},
+	StreamScans:     {Topic: models.TopicScanEvents, EventType: models.EventBarcodeScanned, AccessLevel: auth.AccessLevel3},
+}
+
+// StreamEvent is an event sent to the dashboards
+type StreamEvent struct {
+	ID        string               `json:"id"`
+	Topic     string               `json:"topic"`
+	EntityID  string               `json:"entityId,omitempty"`
+	Warehouse string               `json:"warehouse,omitempty"`
+	Event     *models.EventMessage `json:"event"`
+}
+
+// streamFilter selects the events of a subscription. Empty sets match all.
+type streamFilter struct {
+	Topics     []string `json:"topics"`
+	Entities   []string `json:"entities,omitempty"`
+	Warehouses []string `json:"warehouses,omitempty"`
+}
+
+// errStreamForbidden is returned when the claims do not allow a subscription
+var errStreamForbidden = errors.New("subscription not allowed")
+
+// authorize restricts the filter to what the claims allow. Without topics
+// the subscription gets every topic the user may see; requesting a topic or
+// warehouse the user may not see is an error.
+func (f *streamFilter) authorize(claims *auth.JWTClaims) error {
+	if len(f.Topics) == 0 {
+		for _, name := range []string{StreamStock, StreamShipments, StreamScans} {
+			if auth.HasPermission(claims.AccessLevel, streamTopics[name].AccessLevel) {
+				f.Topics = append(f.Topics, name)
+			}
+		}
+		if len(f.Topics) == 0 {
+			return fmt.Errorf("%w: no topic is available at access level %q", errStreamForbidden, claims.AccessLevel)
+		}
+	}
+
+	for _, name := range f.Topics {
+		topic, ok := streamTopics[name]
+		if !ok {
+			return fmt.Errorf("unknown stream topic %q", name)
+		}
+		if !auth.HasPermission(claims.AccessLevel, topic.AccessLevel) {
+			return fmt.Errorf("%w: topic %s requires %s", errStreamForbidden, name, topic.AccessLevel)
+		}
+	}
+
+	if len(claims.Warehouses) == 0 {
+		return nil
+	}
+	if len(f.Warehouses) == 0 {
+		f.Warehouses = claims.Warehouses
+		return nil
+	}
+	for _, warehouse := range f.Warehouses {
+		if !contains(claims.Warehouses, warehouse) {
+			return fmt.Errorf("%w: warehouse %s", errStreamForbidden, warehouse)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the event belongs to the subscription
+func (f *streamFilter) matches(event StreamEvent) bool {
+	if !contains(f.Topics, event.Topic) {
+		return false
+	}
+	if len(f.Entities) > 0 && !contains(f.Entities, event.EntityID) {
+		return false
+	}
+	if len(f.Warehouses) > 0 && !contains(f.Warehouses, event.Warehouse) {
+		return false
+	}
+	return true
+}
+
+// streamClient is a connected dashboard
+type streamClient struct {
+	filter streamFilter
+	events chan StreamEvent
+	closed bool
+}
+
+// StreamHub fans the events of the event bus out to the connected
+// dashboards. Every dashboard-api instance reads the topics without a
+// consumer group from the latest event on, so each instance sees every
+// event and none is replayed on restart. The last events are kept in
+// memory for dashboards reconnecting with the ID of the last event they got.
+type StreamHub struct {
+	bus    kafka.EventBus
+	logger *logger.Logger
+
+	mu            sync.Mutex
+	buffer        []StreamEvent // ring of the last streamBufferSize events
+	next          int           // position of the next event in buffer
+	seen          map[string]bool
+	clients       map[*streamClient]bool
+	subscriptions []kafka.Subscription
+}
+
+// NewStreamHub creates a new stream hub
+func NewStreamHub(bus kafka.EventBus, logger *logger.Logger) *StreamHub {
+	return &StreamHub{
+		bus:     bus,
+		logger:  logger,
+		seen:    make(map[string]bool),
+		clients: make(map[*streamClient]bool),
+	}
+}
+
+// Start subscribes to the topics of the streamed events
+func (h *StreamHub) Start() error {
+	for name, topic := range streamTopics {
+		name, topic := name, topic
+		sub, err := h.bus.SubscribeLatest(topic.Topic, func(ctx context.Context, event *models.EventMessage) error {
+			if event.EventType == topic.EventType {
+				h.publish(name, event)
+			}
+			return nil
+		})
+		if err != nil {
+			h.Stop()
+			return fmt.Errorf("failed to subscribe to %s: %w", topic.Topic, err)
+		}
+		h.subscriptions = append(h.subscriptions, sub)
+	}
+	return nil
+}
+
+// Stop closes the subscriptions and disconnects every client
+func (h *StreamHub) Stop() {
+	for _, sub := range h.subscriptions {
+		sub.Close()
+	}
+	h.subscriptions = nil
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		h.disconnect(client)
+	}
+}
+
+// publish buffers an event and sends it to the matching clients. Clients
+// that cannot keep up are disconnected and resume from the buffer.
+func (h *StreamHub) publish(topic string, event *models.EventMessage) {
+	if time.Since(event.Timestamp) > streamMaxEventAge {
+		return
+	}
+
+	streamEvent := StreamEvent{
+		ID:        event.EventID,
+		Topic:     topic,
+		EntityID:  event.Subject,
+		Warehouse: eventWarehouse(event),
+		Event:     event,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Delivery is at-least-once, a redelivered event was already sent
+	if h.seen[streamEvent.ID] {
+		return
+	}
+	if len(h.buffer) < streamBufferSize {
+		h.buffer = append(h.buffer, streamEvent)
+	} else {
+		delete(h.seen, h.buffer[h.next].ID)
+		h.buffer[h.next] = streamEvent
+	}
+	h.next = (h.next + 1) % streamBufferSize
+	h.seen[streamEvent.ID] = true
+
+	for client := range h.clients {
+		if !client.filter.matches(streamEvent) {
+			continue
+		}
+		select {
+		case client.events <- streamEvent:
+		default:
+			h.logger.Warn("Stream client too slow, disconnecting", zap.Strings("topics", client.filter.Topics))
+			h.disconnect(client)
+		}
+	}
+}
+
+// subscribe connects a client. With a lastEventID it also returns the
+// buffered events after it; resumed is false when that event is no longer
+// buffered and the client has to reload its state.
+func (h *StreamHub) subscribe(filter streamFilter, lastEventID string) (client *streamClient, backlog []StreamEvent, resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client = &streamClient{filter: filter, events: make(chan StreamEvent, streamClientBuffer)}
+	h.clients[client] = true
+
+	if lastEventID == "" {
+		return client, nil, true
+	}
+	if !h.seen[lastEventID] {
+		return client, nil, false
+	}
+
+	found := false
+	for _, event := range h.ordered() {
+		if found && filter.matches(event) {
+			backlog = append(backlog, event)
+		}
+		if event.ID == lastEventID {
+			found = true
+		}
+	}
+	return client, backlog, true
+}
+
+// unsubscribe disconnects a client
+func (h *StreamHub) unsubscribe(client *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.disconnect(client)
+}
+
+// disconnect removes a client and closes its channel. Callers hold mu.
+func (h *StreamHub) disconnect(client *streamClient) {
+	if client.closed {
+		return
+	}
+	client.closed = true
+	delete(h.clients, client)
+	close(client.events)
+}
+
+// ordered returns the buffered events from the oldest. Callers hold mu.
+func (h *StreamHub) ordered() []StreamEvent {
+	if len(h.buffer) < streamBufferSize {
+		return h.buffer
+	}
+	return append(append([]StreamEvent{}, h.buffer[h.next:]...), h.buffer[:h.next]...)
+}
+
+// StreamEvents streams live events to a dashboard as server-sent events.
+//
+// On reconnect the browser sends the Last-Event-ID header and the events
+// missed in between are replayed; a "reset" event tells the dashboard they
+// are gone and it should reload.
+func (h *Handlers) StreamEvents(c *gin.Context) {
+	claims := currentClaims(c)
+
+	filter := streamFilter{
+		Topics:     parseList(c.Query("topics")),
+		Entities:   parseList(c.Query("entities")),
+		Warehouses: parseList(c.Query("warehouses")),
+	}
+	if err := filter.authorize(claims); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errStreamForbidden) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	hub := h.services.Stream
+	if hub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event stream is not available"})
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	client, backlog, resumed := hub.subscribe(filter, lastEventID)
+	defer hub.unsubscribe(client)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	writeStreamEvent(w, "", "ready", filter)
+	if !resumed {
+		writeStreamEvent(w, "", "reset", gin.H{"lastEventId": lastEventID})
+	}
+	for _, event := range backlog {
+		writeStreamEvent(w, event.ID, event.Topic, event)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	var expired <-chan time.Time
+	if claims.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-client.events:
+			if !ok {
+				// Disconnected by the hub, the browser reconnects and resumes
+				return
+			}
+			writeStreamEvent(w, event.ID, event.Topic, event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-expired:
+			writeStreamEvent(w, "", "expired", gin.H{"userId": claims.UserID})
+			w.Flush()
+			return
+		}
+		w.Flush()
+	}
+}
+
+// writeStreamEvent writes a server-sent event with a JSON payload
+func writeStreamEvent(w io.Writer, id, name string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+}
+
+// eventWarehouse returns the warehouse an event happened in: the location
+// of a scan, or the warehouse recorded in the changes of stock and shipment
+// events, falling back to their warehouse location
+func eventWarehouse(event *models.EventMessage) string {
+	var data struct {
+		Location string                 `json:"location"`
+		Changes  map[string]interface{} `json:"changes"`
+	}
+	if err := event.DecodeData(&data); err != nil {
+		return ""
+	}
+	if data.Location != "" {
+		return data.Location
+	}
+	if warehouse, ok := data.Changes["warehouse"].(string); ok {
+		return warehouse
+	}
+	warehouse, _ := data.Changes["warehouseLocation"].(string)
+	return warehouse
+}
+
+// parseList splits a comma-separated query value
+func parseList(value string) []string {
+	var list []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// contains reports whether list contains value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/models"
+)
+
+func stockEvent(itemID, warehouse string) *models.EventMessage {
+	return models.NewEventMessage(models.EventStockUpdated, models.InventoryEvent{
+		ItemID:  itemID,
+		Action:  "update",
+		Changes: map[string]interface{}{"warehouseLocation": warehouse},
+	})
+}
+
+func TestEventWarehouse(t *testing.T) {
+	assert.Equal(t, "WH-A", eventWarehouse(stockEvent("ITEM-1", "WH-A")))
+
+	binEvent := models.NewEventMessage(models.EventStockUpdated, models.InventoryEvent{
+		ItemID:  "ITEM-1",
+		Changes: map[string]interface{}{"warehouseLocation": "JKT-A-01-R1-B01", "warehouse": "JKT"},
+	})
+	assert.Equal(t, "JKT", eventWarehouse(binEvent))
+
+	scan := models.NewEventMessage(models.EventBarcodeScanned, models.ScanEvent{Location: "SBY"})
+	assert.Equal(t, "SBY", eventWarehouse(scan))
+}
+
+func TestStreamFilterAuthorize(t *testing.T) {
+	operator := &auth.JWTClaims{AccessLevel: auth.AccessLevel2}
+
+	filter := streamFilter{}
+	require.NoError(t, filter.authorize(operator))
+	assert.Equal(t, []string{StreamStock, StreamShipments}, filter.Topics)
+
+	filter = streamFilter{Topics: []string{StreamScans}}
+	assert.ErrorIs(t, filter.authorize(operator), errStreamForbidden)
+
+	filter = streamFilter{Topics: []string{"payroll"}}
+	err := filter.authorize(operator)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errStreamForbidden)
+
+	filter = streamFilter{}
+	assert.ErrorIs(t, filter.authorize(&auth.JWTClaims{AccessLevel: auth.AccessLevel1}), errStreamForbidden)
+
+	limited := &auth.JWTClaims{AccessLevel: auth.AccessLevel3, Warehouses: []string{"WH-A"}}
+	filter = streamFilter{Topics: []string{StreamScans}}
+	require.NoError(t, filter.authorize(limited))
+	assert.Equal(t, []string{"WH-A"}, filter.Warehouses)
+
+	filter = streamFilter{Warehouses: []string{"WH-B"}}
+	assert.ErrorIs(t, filter.authorize(limited), errStreamForbidden)
+}
+
+func TestStreamHubResume(t *testing.T) {
+	_, services := newTestRouter(t)
+	hub := NewStreamHub(services.Events, services.Logger)
+
+	first, second, third := stockEvent("ITEM-1", "WH-A"), stockEvent("ITEM-2", "WH-B"), stockEvent("ITEM-1", "WH-A")
+	for _, event := range []*models.EventMessage{first, second, third, third} {
+		hub.publish(StreamStock, event)
+	}
+
+	filter := streamFilter{Topics: []string{StreamStock}, Entities: []string{"ITEM-1"}}
+	client, backlog, resumed := hub.subscribe(filter, first.EventID)
+	assert.True(t, resumed)
+	require.Len(t, backlog, 1, "redelivered events are only buffered once")
+	assert.Equal(t, third.EventID, backlog[0].ID)
+	assert.Equal(t, "WH-A", backlog[0].Warehouse)
+
+	hub.publish(StreamStock, stockEvent("ITEM-2", "WH-B"))
+	live := stockEvent("ITEM-1", "WH-A")
+	hub.publish(StreamStock, live)
+	assert.Equal(t, live.EventID, (<-client.events).ID)
+
+	hub.unsubscribe(client)
+	_, ok := <-client.events
+	assert.False(t, ok)
+
+	_, backlog, resumed = hub.subscribe(filter, "evicted")
+	assert.False(t, resumed)
+	assert.Empty(t, backlog)
+
+	stale := stockEvent("ITEM-1", "WH-A")
+	stale.Timestamp = time.Now().Add(-time.Hour)
+	hub.publish(StreamStock, stale)
+	assert.False(t, hub.seen[stale.EventID])
+}
+
+func TestStreamEvents(t *testing.T) {
+	router, services := newTestRouter(t)
+	services.JWTService = auth.NewJWTService("test-secret", "test")
+	services.Stream = NewStreamHub(services.Events, services.Logger)
+	require.NoError(t, services.Stream.Start())
+	t.Cleanup(services.Stream.Stop)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/stream")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	token, err := services.JWTService.GenerateToken("user-1", "operator", auth.RoleWarehouseOperator, auth.AccessLevel2, time.Hour)
+	require.NoError(t, err)
+
+	w = performRequest(router, http.MethodGet, "/api/v1/stream?topics=scans&access_token="+token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/stream?topics=stock&warehouses=WH-A", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	next := func(prefix string) string {
+		for {
+			select {
+			case line, ok := <-lines:
+				require.True(t, ok, "stream closed before %q", prefix)
+				if strings.HasPrefix(line, prefix) {
+					return strings.TrimPrefix(line, prefix)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %q", prefix)
+			}
+		}
+	}
+	assert.Equal(t, "ready", next("event: "))
+
+	require.NoError(t, services.Events.Publish(ctx, models.TopicInventoryEvents, "ITEM-2", stockEvent("ITEM-2", "WH-B")))
+	event := stockEvent("ITEM-1", "WH-A")
+	require.NoError(t, services.Events.Publish(ctx, models.TopicInventoryEvents, "ITEM-1", event))
+
+	assert.Equal(t, event.EventID, next("id: "))
+	assert.Equal(t, StreamStock, next("event: "))
+	assert.Contains(t, next("data: "), `"entityId":"ITEM-1"`)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"warehouse-shared/export"
+	"warehouse-shared/inventory"
+)
+
+// valuationMethodRequest is the body of the set valuation method endpoint
+type valuationMethodRequest struct {
+	Method string `json:"method" validate:"required,oneof=fifo average standard"`
+}
+
+// GetValuationMethods lists the valuation method of every item category
+func (h *Handlers) GetValuationMethods(c *gin.Context) {
+	policies, err := h.services.Valuation.Policies(c.Request.Context())
+	if err != nil {
+		h.internalError(c, "Failed to list valuation methods", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// SetValuationMethod values the stock of a category FIFO, at the weighted
+// average cost or at standard cost. Items switch method on their next
+// movement.
+func (h *Handlers) SetValuationMethod(c *gin.Context) {
+	var req valuationMethodRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	policy, err := h.services.Valuation.SetMethod(c.Request.Context(), c.Param("category"), req.Method, currentClaims(c).UserID)
+	if err != nil {
+		h.valuationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// GetStockValuation values the stock by item and category as it was at a
+// date, now by default; a day values it at the end of that day. It exports
+// with a format.
+func (h *Handlers) GetStockValuation(c *gin.Context) {
+	format, ok := requestedFormat(c)
+	if !ok {
+		return
+	}
+
+	at, ok := atParam(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.services.Valuation.Report(c.Request.Context(), at, c.Query("category"))
+	if err != nil {
+		h.internalError(c, "Failed to value stock", err)
+		return
+	}
+
+	if format != "" {
+		h.export(c, format, "stock-valuation", valuationDocument(report))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetItemCostLayers lists the cost layers of an item oldest first, only
+// those with stock left with open=true
+func (h *Handlers) GetItemCostLayers(c *gin.Context) {
+	layers, err := h.services.Valuation.Layers(c.Request.Context(), c.Param("id"), c.Query("open") == "true")
+	if err != nil {
+		h.internalError(c, "Failed to list cost layers", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"itemId": c.Param("id"),
+		"layers": layers,
+		"total":  len(layers),
+	})
+}
+
+// valuationError maps valuation store errors to HTTP responses
+func (h *Handlers) valuationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInvalidValuation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Valuation request failed", err)
+	}
+}
+
+// valuationDocument is the export of the stock valuation, by category and
+// by item
+func valuationDocument(report *inventory.ValuationReport) *export.Document {
+	categories, items := report.Categories, report.Items
+	return &export.Document{
+		Title:    "Stock valuation",
+		Subtitle: "Stock as it was at " + report.At.Format("2006-01-02 15:04 MST"),
+		Figures: []export.Figure{
+			{Label: "Items", Value: len(items), Type: export.Integer},
+			{Label: "Units", Value: report.Units, Type: export.Integer},
+			{Label: "Stock value", Value: report.Value, Type: export.Currency},
+		},
+		Tables: []export.Table{
+			{
+				Title: "By category",
+				Columns: []export.Column{
+					{Title: "Category"},
+					{Title: "Method"},
+					{Title: "Items", Type: export.Integer, Total: true},
+					{Title: "Units", Type: export.Integer, Total: true},
+					{Title: "Value", Type: export.Currency, Total: true, Bar: true},
+				},
+				Rows: rowsOf(len(categories), func(i int) []interface{} {
+					c := &categories[i]
+					return []interface{}{c.Category, c.Method, c.Items, c.Units, c.Value}
+				}),
+			},
+			{
+				Title: "Items",
+				Columns: []export.Column{
+					{Title: "Item ID"},
+					{Title: "Name", Width: 2},
+					{Title: "Category"},
+					{Title: "Method"},
+					{Title: "Stock", Type: export.Integer, Total: true},
+					{Title: "Unit cost", Type: export.Currency},
+					{Title: "Value", Type: export.Currency, Total: true},
+				},
+				Rows: rowsOf(len(items), func(i int) []interface{} {
+					item := &items[i]
+					return []interface{}{item.ItemID, item.Name, item.Category, item.Method, item.StockLevel, item.UnitCost, item.Value}
+				}),
+			},
+		},
+	}
+}
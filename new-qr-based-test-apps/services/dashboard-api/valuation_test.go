@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/inventory"
+)
+
+func TestValuationRoutesValidation(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	w := performRequest(router, http.MethodGet, "/api/v1/inventory/valuation")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel3, http.MethodPut, "/api/v1/inventory/valuation-methods/Electronics", `{"method": "fifo"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "only managers change valuation methods")
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel4, http.MethodPut, "/api/v1/inventory/valuation-methods/Electronics", `{"method": "lifo"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/inventory/valuation?at=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodGet, "/api/v1/inventory/valuation?format=docx", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel2, http.MethodPost, "/api/v1/inventory/items/ITM-2024-001/movements", `{"type": "receipt", "quantity": 5, "unitCost": -2}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "unit costs must not be negative")
+}
+
+func TestValuationDocument(t *testing.T) {
+	report := &inventory.ValuationReport{
+		At:    time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC),
+		Units: 14,
+		Value: 130,
+		Categories: []inventory.CategoryValuation{
+			{Category: "Electronics", Method: "fifo", Items: 2, Units: 14, Value: 130},
+		},
+		Items: []inventory.ItemValuation{
+			{ItemID: "ITM-2024-001", Name: "Scanner", Category: "Electronics", Method: "fifo", StockLevel: 10, UnitCost: 12, Value: 120},
+			{ItemID: "ITM-2024-003", Name: "Cable", Category: "Electronics", Method: "fifo", StockLevel: 4, UnitCost: 2.5, Value: 10},
+		},
+	}
+
+	doc := valuationDocument(report)
+	assert.Equal(t, "Stock valuation", doc.Title)
+	assert.Contains(t, doc.Subtitle, "2024-06-30")
+	require.Len(t, doc.Tables, 2)
+	assert.Len(t, doc.Tables[1].Columns, 7)
+	assert.Equal(t, 130.0, doc.Figures[2].Value)
+}
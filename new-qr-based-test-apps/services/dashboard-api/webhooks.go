@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"warehouse-shared/models"
+	"warehouse-shared/utils"
+	"warehouse-shared/webhook"
+)
+
+// webhookRequest is the body of the create and update webhook endpoints
+type webhookRequest struct {
+	URL         string   `json:"url" validate:"required,url"`
+	EventTypes  []string `json:"eventTypes" validate:"required,min=1"`
+	Secret      string   `json:"secret" validate:"omitempty,min=16"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+// Webhook handlers
+func (h *Handlers) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		generated, err := webhook.GenerateSecret()
+		if err != nil {
+			h.internalError(c, "Failed to generate webhook secret", err)
+			return
+		}
+		secret = generated
+	}
+
+	sub := &models.WebhookSubscription{
+		URL:         req.URL,
+		EventTypes:  req.EventTypes,
+		Secret:      secret,
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+	}
+	if err := h.services.WebhookStore.CreateSubscription(c.Request.Context(), sub); err != nil {
+		h.internalError(c, "Failed to create webhook", err)
+		return
+	}
+
+	// The secret is only returned once, when the subscription is created
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": sub,
+		"secret":  secret,
+	})
+}
+
+func (h *Handlers) GetWebhooks(c *gin.Context) {
+	subs, err := h.services.WebhookStore.ListSubscriptions(c.Request.Context())
+	if err != nil {
+		h.internalError(c, "Failed to list webhooks", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": subs,
+		"total":    len(subs),
+	})
+}
+
+func (h *Handlers) GetWebhook(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	sub, err := h.services.WebhookStore.GetSubscription(c.Request.Context(), id)
+	if err != nil {
+		h.webhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": sub})
+}
+
+func (h *Handlers) UpdateWebhook(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	changes := bson.M{
+		"url":         req.URL,
+		"eventTypes":  req.EventTypes,
+		"description": req.Description,
+	}
+	if req.Secret != "" {
+		changes["secret"] = req.Secret
+	}
+	if req.Active != nil {
+		changes["active"] = *req.Active
+	}
+
+	sub, err := h.services.WebhookStore.UpdateSubscription(c.Request.Context(), id, changes)
+	if err != nil {
+		h.webhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook updated successfully",
+		"webhook": sub,
+	})
+}
+
+func (h *Handlers) DeleteWebhook(c *gin.Context) {
+	id, ok := objectIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.services.WebhookStore.DeleteSubscription(c.Request.Context(), id); err != nil {
+		h.webhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook deleted successfully",
+		"id":      id.Hex(),
+	})
+}
+
+// GetWebhookDeliveries queries the delivery log. It accepts subscription,
+// eventId, eventType, status, since and until (RFC 3339) filters.
+func (h *Handlers) GetWebhookDeliveries(c *gin.Context) {
+	var pagination utils.PaginationParams
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := webhook.DeliveryFilter{
+		EventID:   c.Query("eventId"),
+		EventType: c.Query("eventType"),
+		Status:    c.Query("status"),
+	}
+
+	subscription := c.Query("subscription")
+	if id := c.Param("id"); id != "" {
+		subscription = id
+	}
+	if subscription != "" {
+		id, err := primitive.ObjectIDFromHex(subscription)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+		filter.SubscriptionID = &id
+	}
+
+	for param, target := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + " date, expected RFC 3339"})
+				return
+			}
+			*target = &parsed
+		}
+	}
+
+	deliveries, total, err := h.services.WebhookStore.ListDeliveries(c.Request.Context(), filter,
+		pagination.GetOffset(), pagination.GetPageSize())
+	if err != nil {
+		h.internalError(c, "Failed to list webhook deliveries", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       pagination.Page,
+	})
+}
+
+func (h *Handlers) ReplayWebhookDelivery(c *gin.Context) {
+	id, ok := objectIDParam(c, "deliveryId")
+	if !ok {
+		return
+	}
+
+	delivery, err := h.services.WebhookDispatcher.Replay(c.Request.Context(), id)
+	if err != nil {
+		h.webhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Webhook delivery queued for replay",
+		"delivery": delivery,
+	})
+}
+
+// webhookError maps webhook store errors to HTTP responses
+func (h *Handlers) webhookError(c *gin.Context, err error) {
+	if errors.Is(err, webhook.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	h.services.Logger.Warn("Webhook request failed", zap.Error(err))
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
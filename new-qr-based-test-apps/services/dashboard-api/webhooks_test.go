@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/auth"
+)
+
+func TestWebhookRoutesAccess(t *testing.T) {
+	router, services := newTestRouter(t)
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/webhooks"},
+		{http.MethodPost, "/api/v1/webhooks"},
+		{http.MethodGet, "/api/v1/webhooks/deliveries"},
+		{http.MethodPost, "/api/v1/webhooks/deliveries/65a000000000000000000001/replay"},
+		{http.MethodDelete, "/api/v1/webhooks/65a000000000000000000001"},
+	} {
+		w := performRequest(router, route.method, route.path)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, route.path)
+
+		w = performAuthRequest(t, router, services, auth.AccessLevel3, route.method, route.path, "")
+		assert.Equal(t, http.StatusForbidden, w.Code, "only managers manage webhooks: %s %s", route.method, route.path)
+	}
+
+	body := `{"url": "not a url", "eventTypes": ["stock_updated"]}`
+	w := performAuthRequest(t, router, services, auth.AccessLevel4, http.MethodPost, "/api/v1/webhooks", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAuthRequest(t, router, services, auth.AccessLevel4, http.MethodGet, "/api/v1/webhooks/not-an-id", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
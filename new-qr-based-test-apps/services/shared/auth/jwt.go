@@ -9,10 +9,11 @@ import (
 
 // JWTClaims represents the JWT claims
 type JWTClaims struct {
-	UserID      string `json:"userId"`
-	Username    string `json:"username"`
-	Role        string `json:"role"`
-	AccessLevel string `json:"accessLevel"`
+	UserID      string   `json:"userId"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	AccessLevel string   `json:"accessLevel"`
+	Warehouses  []string `json:"warehouses,omitempty"` // warehouses the user is limited to, all when empty
 	jwt.RegisteredClaims
 }
 
@@ -111,4 +112,4 @@ func HasPermission(userLevel, requiredLevel string) bool {
 	requiredLevelInt := levels[requiredLevel]
 
 	return userLevelInt >= requiredLevelInt
-}
\ No newline at end of file
+}
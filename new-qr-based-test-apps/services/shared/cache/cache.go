@@ -0,0 +1,284 @@
+// Package cache provides a Redis read-through cache shared by the warehouse
+// services.
+//
+// Entries are invalidated by tag. Every tag has a generation counter in
+// Redis that is part of the key of the entries tagged with it, so
+// invalidating a tag only increments its counter: the old entries are never
+// read again and expire on their own, and a value loaded while the tag was
+// being invalidated is stored under the old generation instead of hiding the
+// change.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Tags invalidated by the events of the warehouse services
+const (
+	TagInventory = "inventory" // any item or stock change
+	TagItems     = "items"     // items created, deleted or updated
+	TagShipments = "shipments" // any shipment change
+)
+
+// TagItem returns the tag of a single item
+func TagItem(itemID string) string {
+	return "item:" + itemID
+}
+
+// Config holds the cache settings
+type Config struct {
+	Prefix      string        // prepended to every Redis key
+	LockTTL     time.Duration // how long a loader holds the lock of a key
+	LockWait    time.Duration // how long other callers wait for the loader before loading themselves
+	LoadTimeout time.Duration // how long a load shared by concurrent callers may run
+	Jitter      float64       // fraction of the TTL randomly added to spread expirations
+}
+
+// DefaultConfig returns the default cache settings
+func DefaultConfig() Config {
+	return Config{
+		Prefix:      "warehouse:cache:",
+		LockTTL:     10 * time.Second,
+		LockWait:    3 * time.Second,
+		LoadTimeout: 30 * time.Second,
+		Jitter:      0.1,
+	}
+}
+
+// Cache is a read-through cache in Redis.
+//
+// A nil *Cache is valid and caches nothing, so services keep working
+// without Redis. Redis errors are logged and the value is loaded directly.
+type Cache struct {
+	client *redis.Client
+	config Config
+
+	mu       sync.Mutex
+	inflight map[string]*call
+}
+
+// call is a load in progress in this process
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// NewCache creates a new cache
+func NewCache(client *redis.Client, config Config) *Cache {
+	return &Cache{
+		client:   client,
+		config:   config,
+		inflight: make(map[string]*call),
+	}
+}
+
+// LoadFunc loads a value on a cache miss
+type LoadFunc func(ctx context.Context) (interface{}, error)
+
+// GetOrLoad decodes the cached value of key into dest, or calls load and
+// caches its result for ttl. Stampedes are prevented twice: callers in the
+// same process share one load, and across processes only the holder of a
+// short Redis lock loads while the others wait for its result.
+func (c *Cache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, tags []string, dest interface{}, load LoadFunc) error {
+	if c == nil || ttl <= 0 {
+		return loadInto(ctx, load, dest)
+	}
+
+	fullKey, err := c.key(ctx, key, tags)
+	if err != nil {
+		log.Printf("Cache unavailable for %s: %v", key, err)
+		return loadInto(ctx, load, dest)
+	}
+
+	raw, err := c.client.Get(ctx, fullKey).Bytes()
+	if err == nil {
+		return json.Unmarshal(raw, dest)
+	}
+	if !errors.Is(err, redis.Nil) {
+		log.Printf("Failed to read cache key %s: %v", key, err)
+		return loadInto(ctx, load, dest)
+	}
+
+	raw, err = c.do(ctx, fullKey, func(ctx context.Context) ([]byte, error) {
+		return c.fill(ctx, fullKey, ttl, load)
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+// Invalidate makes every entry tagged with one of the tags stale
+func (c *Cache) Invalidate(ctx context.Context, tags ...string) error {
+	if c == nil || len(tags) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+	for _, tag := range tags {
+		pipe.Incr(ctx, c.generationKey(tag))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to invalidate cache tags %v: %w", tags, err)
+	}
+	return nil
+}
+
+// key builds the Redis key of an entry from the generations of its tags
+func (c *Cache) key(ctx context.Context, key string, tags []string) (string, error) {
+	if len(tags) == 0 {
+		return c.config.Prefix + key, nil
+	}
+
+	generationKeys := make([]string, len(tags))
+	for i, tag := range tags {
+		generationKeys[i] = c.generationKey(tag)
+	}
+	generations, err := c.client.MGet(ctx, generationKeys...).Result()
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, len(generations))
+	for i, generation := range generations {
+		if generation == nil {
+			generation = "0"
+		}
+		parts[i] = fmt.Sprint(generation)
+	}
+	return c.config.Prefix + key + "@" + strings.Join(parts, "."), nil
+}
+
+// generationKey returns the Redis key of a tag's generation counter
+func (c *Cache) generationKey(tag string) string {
+	return c.config.Prefix + "gen:" + tag
+}
+
+// fill loads and stores a value under the Redis lock of its key. Callers
+// that do not get the lock wait for the holder, then load uncached.
+func (c *Cache) fill(ctx context.Context, key string, ttl time.Duration, load LoadFunc) ([]byte, error) {
+	lockKey := key + ":lock"
+	locked, err := c.client.SetNX(ctx, lockKey, 1, c.config.LockTTL).Result()
+	if err != nil {
+		log.Printf("Failed to lock cache key %s: %v", key, err)
+		return loadJSON(ctx, load)
+	}
+
+	if !locked {
+		if raw, ok := c.wait(ctx, key); ok {
+			return raw, nil
+		}
+		return loadJSON(ctx, load)
+	}
+	defer c.client.Del(context.Background(), lockKey)
+
+	raw, err := loadJSON(ctx, load)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.client.Set(ctx, key, raw, c.jitter(ttl)).Err(); err != nil {
+		log.Printf("Failed to write cache key %s: %v", key, err)
+	}
+	return raw, nil
+}
+
+// wait polls key until another process has stored it or LockWait elapses
+func (c *Cache) wait(ctx context.Context, key string) ([]byte, bool) {
+	deadline := time.Now().Add(c.config.LockWait)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		raw, err := c.client.Get(ctx, key).Bytes()
+		if err == nil {
+			return raw, true
+		}
+		if !errors.Is(err, redis.Nil) {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// do runs fn once for concurrent callers with the same key. The shared
+// run is detached from the context of the caller that started it, so that
+// caller going away does not fail the others, and is bounded by
+// LoadTimeout instead. Every caller stops waiting when its own context ends.
+func (c *Cache) do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	current, ok := c.inflight[key]
+	if !ok {
+		current = &call{done: make(chan struct{})}
+		c.inflight[key] = current
+		go c.run(context.WithoutCancel(ctx), key, current, fn)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-current.done:
+		return current.value, current.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run runs the shared load of a key and hands its result to the callers
+func (c *Cache) run(ctx context.Context, key string, current *call, fn func(ctx context.Context) ([]byte, error)) {
+	if c.config.LoadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.LoadTimeout)
+		defer cancel()
+	}
+	current.value, current.err = fn(ctx)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(current.done)
+}
+
+// jitter adds up to Jitter of the TTL so that entries do not expire together
+func (c *Cache) jitter(ttl time.Duration) time.Duration {
+	if c.config.Jitter <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Float64()*c.config.Jitter*float64(ttl))
+}
+
+// loadJSON calls load and encodes its result
+func loadJSON(ctx context.Context, load LoadFunc) ([]byte, error) {
+	value, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cache value: %w", err)
+	}
+	return raw, nil
+}
+
+// loadInto calls load and copies its result into dest through JSON, the
+// same way a cached value would be decoded
+func loadInto(ctx context.Context, load LoadFunc, dest interface{}) error {
+	raw, err := loadJSON(ctx, load)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dest)
+}
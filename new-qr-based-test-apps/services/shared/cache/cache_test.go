@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	config := DefaultConfig()
+	config.Jitter = 0
+	return NewCache(client, config), server
+}
+
+type value struct {
+	Count int `json:"count"`
+}
+
+// counter returns a loader counting its calls
+func counter(calls *int32) LoadFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		return value{Count: int(atomic.AddInt32(calls, 1))}, nil
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	cache, server := newTestCache(t)
+	ctx := context.Background()
+	var calls int32
+
+	var got value
+	require.NoError(t, cache.GetOrLoad(ctx, "stats", time.Minute, nil, &got, counter(&calls)))
+	assert.Equal(t, 1, got.Count)
+
+	require.NoError(t, cache.GetOrLoad(ctx, "stats", time.Minute, nil, &got, counter(&calls)))
+	assert.Equal(t, 1, got.Count, "second read is served from Redis")
+
+	server.FastForward(2 * time.Minute)
+	require.NoError(t, cache.GetOrLoad(ctx, "stats", time.Minute, nil, &got, counter(&calls)))
+	assert.Equal(t, 2, got.Count, "expired entries are loaded again")
+}
+
+func TestGetOrLoadSharesConcurrentLoads(t *testing.T) {
+	cache, _ := newTestCache(t)
+	var calls int32
+	slow := func(ctx context.Context) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		return counter(&calls)(ctx)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got value
+			assert.NoError(t, cache.GetOrLoad(context.Background(), "stats", time.Minute, nil, &got, slow))
+			assert.Equal(t, 1, got.Count)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGetOrLoadSharedLoadOutlivesFirstCaller(t *testing.T) {
+	cache, _ := newTestCache(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return value{Count: 7}, nil
+	}
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		var got value
+		firstErr <- cache.GetOrLoad(first, "stats", time.Minute, nil, &got, load)
+	}()
+	<-started
+
+	waiterErr := make(chan error, 1)
+	var got value
+	go func() {
+		waiterErr <- cache.GetOrLoad(context.Background(), "stats", time.Minute, nil, &got, counter(new(int32)))
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled, "the first caller stops waiting")
+	close(release)
+	require.NoError(t, <-waiterErr, "the load goes on for the other callers")
+	assert.Equal(t, 7, got.Count)
+}
+
+func TestGetOrLoadSharedLoadTimesOut(t *testing.T) {
+	cache, _ := newTestCache(t)
+	cache.config.LoadTimeout = 20 * time.Millisecond
+
+	var got value
+	err := cache.GetOrLoad(context.Background(), "stats", time.Minute, nil, &got, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestGetOrLoadWaitsForLockHolder(t *testing.T) {
+	cache, server := newTestCache(t)
+	ctx := context.Background()
+
+	// Another process holds the lock and stores the value shortly after
+	fullKey, err := cache.key(ctx, "stats", nil)
+	require.NoError(t, err)
+	require.NoError(t, server.Set(fullKey+":lock", "1"))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		server.Set(fullKey, `{"count":42}`)
+	}()
+
+	var calls int32
+	var got value
+	require.NoError(t, cache.GetOrLoad(ctx, "stats", time.Minute, nil, &got, counter(&calls)))
+	assert.Equal(t, 42, got.Count)
+	assert.Zero(t, atomic.LoadInt32(&calls))
+}
+
+func TestInvalidate(t *testing.T) {
+	cache, _ := newTestCache(t)
+	ctx := context.Background()
+	var calls int32
+
+	var got value
+	require.NoError(t, cache.GetOrLoad(ctx, "item", time.Minute, []string{TagItem("ITM-2024-001")}, &got, counter(&calls)))
+	require.NoError(t, cache.GetOrLoad(ctx, "other", time.Minute, []string{TagItem("ITM-2024-002")}, &got, counter(&calls)))
+	assert.Equal(t, int32(2), calls)
+
+	require.NoError(t, cache.Invalidate(ctx, TagItem("ITM-2024-001")))
+
+	require.NoError(t, cache.GetOrLoad(ctx, "item", time.Minute, []string{TagItem("ITM-2024-001")}, &got, counter(&calls)))
+	assert.Equal(t, 3, got.Count, "invalidated entries are loaded again")
+	require.NoError(t, cache.GetOrLoad(ctx, "other", time.Minute, []string{TagItem("ITM-2024-002")}, &got, counter(&calls)))
+	assert.Equal(t, 2, got.Count, "other tags are kept")
+}
+
+func TestGetOrLoadErrors(t *testing.T) {
+	cache, _ := newTestCache(t)
+	ctx := context.Background()
+
+	var got value
+	err := cache.GetOrLoad(ctx, "stats", time.Minute, nil, &got, func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("mongo unavailable")
+	})
+	assert.Error(t, err)
+
+	// Errors are not cached
+	var calls int32
+	require.NoError(t, cache.GetOrLoad(ctx, "stats", time.Minute, nil, &got, counter(&calls)))
+	assert.Equal(t, 1, got.Count)
+}
+
+func TestGetOrLoadWithoutRedis(t *testing.T) {
+	var calls int32
+	var got value
+
+	// A nil cache and a zero TTL load every time
+	var cache *Cache
+	require.NoError(t, cache.GetOrLoad(context.Background(), "stats", time.Minute, nil, &got, counter(&calls)))
+	require.NoError(t, cache.Invalidate(context.Background(), TagInventory))
+
+	cache, server := newTestCache(t)
+	require.NoError(t, cache.GetOrLoad(context.Background(), "stats", 0, nil, &got, counter(&calls)))
+	assert.Equal(t, 2, got.Count)
+
+	// Redis going away falls back to loading
+	server.Close()
+	require.NoError(t, cache.GetOrLoad(context.Background(), "stats", time.Minute, nil, &got, counter(&calls)))
+	assert.Equal(t, 3, got.Count)
+}
+
+func TestParseTTLs(t *testing.T) {
+	defaults := TTLs{"profit-margins": time.Minute, "item-barcode": 5 * time.Minute}
+
+	ttls, err := ParseTTLs("profit-margins=2m, item-barcode=0s,dashboard-stats=15s", defaults)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, ttls.Get("profit-margins"))
+	assert.Zero(t, ttls.Get("item-barcode"))
+	assert.Equal(t, 15*time.Second, ttls.Get("dashboard-stats"))
+	assert.Zero(t, ttls.Get("unknown"))
+	assert.Equal(t, time.Minute, defaults.Get("profit-margins"), "defaults are not modified")
+
+	ttls, err = ParseTTLs("", defaults)
+	require.NoError(t, err)
+	assert.Equal(t, defaults, ttls)
+
+	for _, spec := range []string{"profit-margins", "profit-margins=soon", "profit-margins=-1s"} {
+		_, err := ParseTTLs(spec, defaults)
+		assert.Error(t, err, spec)
+	}
+}
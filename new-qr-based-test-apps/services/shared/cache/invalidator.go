@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// InvalidatorGroupID is the consumer group of the cache invalidator. The
+// cache is shared in Redis, so one instance per event is enough.
+const InvalidatorGroupID = "cache-invalidator"
+
+// Invalidator invalidates cache tags as inventory and shipment events arrive
+type Invalidator struct {
+	cache         *Cache
+	bus           kafka.EventBus
+	subscriptions []kafka.Subscription
+}
+
+// NewInvalidator creates a new invalidator
+func NewInvalidator(cache *Cache, bus kafka.EventBus) *Invalidator {
+	return &Invalidator{cache: cache, bus: bus}
+}
+
+// Start subscribes to the inventory and shipment topics
+func (i *Invalidator) Start() error {
+	for _, topic := range []string{models.TopicInventoryEvents, models.TopicShipmentEvents} {
+		topic := topic
+		sub, err := i.bus.Subscribe(topic, InvalidatorGroupID, func(ctx context.Context, event *models.EventMessage) error {
+			return i.cache.Invalidate(ctx, TagsForEvent(topic, event)...)
+		})
+		if err != nil {
+			i.Stop()
+			return err
+		}
+		i.subscriptions = append(i.subscriptions, sub)
+	}
+	return nil
+}
+
+// Stop closes the subscriptions
+func (i *Invalidator) Stop() {
+	for _, sub := range i.subscriptions {
+		sub.Close()
+	}
+	i.subscriptions = nil
+}
+
+// TagsForEvent returns the tags made stale by an event
+func TagsForEvent(topic string, event *models.EventMessage) []string {
+	switch topic {
+	case models.TopicInventoryEvents:
+		tags := []string{TagInventory}
+		itemID := event.Subject
+		if itemID == "" {
+			var data models.InventoryEvent
+			if event.DecodeData(&data) == nil {
+				itemID = data.ItemID
+			}
+		}
+		if itemID != "" {
+			tags = append(tags, TagItem(itemID))
+		}
+		if event.EventType != models.EventStockUpdated {
+			tags = append(tags, TagItems)
+		}
+		return tags
+	case models.TopicShipmentEvents:
+		return []string{TagShipments}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+func TestTagsForEvent(t *testing.T) {
+	stock := models.NewEventMessage(models.EventStockUpdated, models.InventoryEvent{ItemID: "ITM-2024-001"})
+	assert.Equal(t, []string{TagInventory, TagItem("ITM-2024-001")}, TagsForEvent(models.TopicInventoryEvents, stock))
+
+	updated := models.NewEventMessage(models.EventItemUpdated, models.InventoryEvent{ItemID: "ITM-2024-001"})
+	updated.Subject = ""
+	assert.Equal(t, []string{TagInventory, TagItem("ITM-2024-001"), TagItems}, TagsForEvent(models.TopicInventoryEvents, updated))
+
+	shipment := models.NewEventMessage(models.EventShipmentCreated, models.ShipmentEvent{ShipmentID: "SHP-2024-001"})
+	assert.Equal(t, []string{TagShipments}, TagsForEvent(models.TopicShipmentEvents, shipment))
+
+	scan := models.NewEventMessage(models.EventBarcodeScanned, models.ScanEvent{ScanID: "SCN-1"})
+	assert.Empty(t, TagsForEvent(models.TopicScanEvents, scan))
+}
+
+func TestInvalidator(t *testing.T) {
+	cache, _ := newTestCache(t)
+	bus := kafka.NewMemoryBus()
+	defer bus.Close()
+
+	invalidator := NewInvalidator(cache, bus)
+	require.NoError(t, invalidator.Start())
+	defer invalidator.Stop()
+
+	ctx := context.Background()
+	var calls int32
+	var got value
+	require.NoError(t, cache.GetOrLoad(ctx, "shipment-performance", time.Minute, []string{TagShipments}, &got, counter(&calls)))
+
+	event := models.NewEventMessage(models.EventShipmentStatusChanged, models.ShipmentEvent{ShipmentID: "SHP-2024-001"})
+	require.NoError(t, bus.Publish(ctx, models.TopicShipmentEvents, "", event))
+
+	assert.Eventually(t, func() bool {
+		var got value
+		require.NoError(t, cache.GetOrLoad(ctx, "shipment-performance", time.Minute, []string{TagShipments}, &got, counter(&calls)))
+		return got.Count > 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TTLs holds the cache TTL of each endpoint or lookup by name
+type TTLs map[string]time.Duration
+
+// Get returns the TTL of name, or 0 (not cached) when it has none
+func (t TTLs) Get(name string) time.Duration {
+	return t[name]
+}
+
+// ParseTTLs overrides the defaults with a comma-separated list of
+// name=duration pairs, e.g. "profit-margins=2m,item-barcode=0s". A zero
+// duration disables caching for that name.
+func ParseTTLs(spec string, defaults TTLs) (TTLs, error) {
+	ttls := make(TTLs, len(defaults))
+	for name, ttl := range defaults {
+		ttls[name] = ttl
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid cache TTL %q, expected name=duration", pair)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid cache TTL for %s: %q", name, value)
+		}
+		ttls[strings.TrimSpace(name)] = ttl
+	}
+	return ttls, nil
+}
@@ -0,0 +1,71 @@
+// Command es-bootstrap installs the warehouse Elasticsearch templates.
+//
+// By default it only reports ILM policies, component templates and index
+// templates that are missing or differ from the code, and exits with status 1
+// when any are found. With -apply it installs them and creates the scan log
+// rollover alias. -reindex moves existing indices to the current templates.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"warehouse-shared/database"
+)
+
+func main() {
+	url := flag.String("url", getEnv("ELASTICSEARCH_URL", "http://localhost:9200"), "Elasticsearch URL")
+	apply := flag.Bool("apply", false, "install templates and policies instead of only checking them")
+	reindex := flag.String("reindex", "", "comma-separated indices to move to the current templates after bootstrapping")
+	timeout := flag.Duration("timeout", 30*time.Minute, "timeout for the whole run")
+	flag.Parse()
+
+	es, err := database.ConnectElasticsearch(*url)
+	if err != nil {
+		log.Fatalf("Failed to connect to Elasticsearch: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// Reindexing only makes sense once the current templates are installed
+	report, err := es.Bootstrap(ctx, *apply || *reindex != "")
+	if err != nil {
+		log.Fatalf("Failed to bootstrap Elasticsearch: %v", err)
+	}
+
+	if !report.HasDrift() {
+		fmt.Println("All Elasticsearch templates and policies are up to date")
+	}
+	for _, drift := range report.Drift {
+		fmt.Println(drift)
+	}
+
+	if *reindex != "" {
+		for _, index := range strings.Split(*reindex, ",") {
+			index = strings.TrimSpace(index)
+			target, err := es.Reindex(ctx, index)
+			if err != nil {
+				log.Fatalf("Failed to reindex %s: %v", index, err)
+			}
+			fmt.Printf("Reindexed %s into %s\n", index, target)
+		}
+		return
+	}
+
+	if len(report.Unresolved()) > 0 {
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,65 @@
+// Command kafka-topics reconciles the warehouse Kafka topics with their specs.
+//
+// By default it only reports drift and exits with status 1 when any is
+// found. With -apply it creates missing topics, adds partitions and updates
+// topic configs; drift that cannot be fixed automatically is still reported.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"warehouse-shared/kafka"
+)
+
+func main() {
+	brokers := flag.String("brokers", getEnv("KAFKA_BROKERS", "localhost:9092"), "comma-separated Kafka brokers")
+	replication := flag.Int("replication", 1, "replication factor of the topics")
+	apply := flag.Bool("apply", false, "create and update topics instead of only checking them")
+	timeout := flag.Duration("timeout", time.Minute, "timeout for the whole reconciliation")
+	useTLS := flag.Bool("tls", os.Getenv("KAFKA_TLS") == "true", "connect to the brokers over TLS")
+	caFile := flag.String("tls-ca", os.Getenv("KAFKA_TLS_CA_FILE"), "CA certificate file for TLS")
+	mechanism := flag.String("sasl", os.Getenv("KAFKA_SASL_MECHANISM"), "SASL mechanism: plain, scram-sha-256 or scram-sha-512")
+	flag.Parse()
+
+	// SASL credentials are only read from the environment to keep them out of the process list
+	security, err := kafka.NewSecurityConfig(*useTLS, *caFile, *mechanism,
+		os.Getenv("KAFKA_USERNAME"), os.Getenv("KAFKA_PASSWORD"))
+	if err != nil {
+		log.Fatalf("Invalid Kafka security settings: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	admin := kafka.NewTopicAdmin(strings.Split(*brokers, ","), security)
+	report, err := admin.Reconcile(ctx, kafka.DefaultTopicSpecs(*replication), *apply)
+	if err != nil {
+		log.Fatalf("Failed to reconcile Kafka topics: %v", err)
+	}
+
+	if !report.HasDrift() {
+		fmt.Println("All Kafka topics match their specs")
+		return
+	}
+
+	for _, drift := range report.Drift {
+		fmt.Println(drift)
+	}
+
+	if len(report.Unresolved()) > 0 {
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
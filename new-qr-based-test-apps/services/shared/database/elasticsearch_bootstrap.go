@@ -0,0 +1,522 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexTemplateVersion is bumped whenever a template, component template or
+// ILM policy below changes. Existing indices keep their old mapping until
+// they are reindexed.
+const IndexTemplateVersion = 2
+
+// ScanLogsPolicy is the ILM policy rolling over and expiring the scan log indices
+const ScanLogsPolicy = "warehouse-scan-logs-policy"
+
+// Component templates shared by the index templates
+const (
+	settingsComponentTemplate = "warehouse-settings"
+	eventsComponentTemplate   = "warehouse-event-mappings"
+)
+
+// Asset kinds installed by Bootstrap
+const (
+	AssetILMPolicy         = "ilm_policy"
+	AssetComponentTemplate = "component_template"
+	AssetIndexTemplate     = "index_template"
+	AssetAlias             = "alias"
+)
+
+// esObject is a JSON object sent to Elasticsearch
+type esObject = map[string]interface{}
+
+// esAsset is a policy or template managed by Bootstrap
+type esAsset struct {
+	kind string
+	name string
+	body esObject
+}
+
+// path returns the API path of the asset
+func (a esAsset) path() string {
+	switch a.kind {
+	case AssetILMPolicy:
+		return "/_ilm/policy/" + a.name
+	case AssetComponentTemplate:
+		return "/_component_template/" + a.name
+	default:
+		return "/_index_template/" + a.name
+	}
+}
+
+// hash fingerprints the asset so that edits made by hand are detected
+func (a esAsset) hash() string {
+	raw, _ := json.Marshal(a.body) // map keys are sorted, so the output is stable
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// document returns the request body with the version metadata attached
+func (a esAsset) document() esObject {
+	meta := esObject{"managed_by": "warehouse", "version": IndexTemplateVersion, "hash": a.hash()}
+
+	doc := esObject{}
+	for key, value := range a.body {
+		doc[key] = value
+	}
+	doc["_meta"] = meta
+	if a.kind == AssetILMPolicy {
+		return esObject{"policy": doc}
+	}
+	doc["version"] = IndexTemplateVersion
+	return doc
+}
+
+// keyword, date, double, integer and flattened are shorthand for field mappings
+var (
+	keyword   = esObject{"type": "keyword"}
+	date      = esObject{"type": "date"}
+	double    = esObject{"type": "double"}
+	integer   = esObject{"type": "integer"}
+	boolean   = esObject{"type": "boolean"}
+	flattened = esObject{"type": "flattened"}
+	nameField = esObject{"type": "text", "fields": esObject{"keyword": esObject{"type": "keyword", "ignore_above": 256}}}
+)
+
+// elasticsearchAssets returns the policies and templates in install order
+func elasticsearchAssets() []esAsset {
+	indexTemplate := func(name string, patterns []string, properties esObject, settings esObject) esAsset {
+		template := esObject{"mappings": esObject{"properties": properties}}
+		if settings != nil {
+			template["settings"] = settings
+		}
+		return esAsset{kind: AssetIndexTemplate, name: name, body: esObject{
+			"index_patterns": patterns,
+			"composed_of":    []string{settingsComponentTemplate, eventsComponentTemplate},
+			"priority":       600,
+			"template":       template,
+		}}
+	}
+	versioned := func(index string) []string {
+		return []string{index, index + "-v*"}
+	}
+
+	return []esAsset{
+		{kind: AssetILMPolicy, name: ScanLogsPolicy, body: esObject{"phases": esObject{
+			"hot": esObject{"actions": esObject{"rollover": esObject{
+				"max_age":                "1d",
+				"max_primary_shard_size": "25gb",
+			}}},
+			"warm": esObject{"min_age": "7d", "actions": esObject{
+				"forcemerge": esObject{"max_num_segments": 1},
+			}},
+			"delete": esObject{"min_age": "90d", "actions": esObject{"delete": esObject{}}},
+		}}},
+
+		{kind: AssetComponentTemplate, name: settingsComponentTemplate, body: esObject{"template": esObject{
+			"settings": esObject{
+				"number_of_shards":   2,
+				"number_of_replicas": 0,
+				"refresh_interval":   "5s",
+				"max_result_window":  50000,
+			},
+		}}},
+		{kind: AssetComponentTemplate, name: eventsComponentTemplate, body: esObject{"template": esObject{
+			"mappings": esObject{
+				"dynamic_templates": []esObject{{"strings_as_keywords": esObject{
+					"match_mapping_type": "string",
+					"mapping":            esObject{"type": "keyword", "ignore_above": 256},
+				}}},
+				"properties": esObject{
+					"timestamp": esObject{"type": "date", "format": "strict_date_optional_time||epoch_millis"},
+					"eventType": keyword,
+					"eventId":   keyword,
+				},
+			},
+		}}},
+
+		indexTemplate("warehouse-inventory-analytics", versioned(InventoryAnalyticsIndex), esObject{
+			"itemId":            keyword,
+			"action":            keyword,
+			"userId":            keyword,
+			"name":              nameField,
+			"category":          keyword,
+			"warehouseLocation": keyword,
+			"status":            keyword,
+			"stockLevel":        integer,
+			"costPrice":         double,
+			"sellingPrice":      double,
+			"inventoryValue":    double,
+			"changes":           flattened,
+		}, nil),
+		indexTemplate("warehouse-profit-analytics", versioned(ProfitAnalyticsIndex), esObject{
+			"itemId":            keyword,
+			"name":              nameField,
+			"category":          keyword,
+			"warehouseLocation": keyword,
+			"costPrice":         double,
+			"sellingPrice":      double,
+			"unitProfit":        double,
+			"profitMargin":      double,
+			"stockLevel":        integer,
+			"potentialProfit":   double,
+		}, nil),
+		indexTemplate("warehouse-shipment-analytics", versioned(ShipmentAnalyticsIndex), esObject{
+			"shipmentId":         keyword,
+			"action":             keyword,
+			"userId":             keyword,
+			"status":             keyword,
+			"destination":        keyword,
+			"items":              keyword,
+			"itemCount":          integer,
+			"units":              integer,
+			"value":              double,
+			"grossWeightKg":      double,
+			"volumetricWeightKg": double,
+			"chargeableWeightKg": double,
+			"createdAt":          date,
+			"estimatedDelivery":  date,
+			"actualDelivery":     date,
+			"transitHours":       double,
+			"onTime":             boolean,
+			"delayed":            boolean,
+			"changes":            flattened,
+		}, nil),
+		indexTemplate("warehouse-scan-logs", []string{ScanLogsIndex + "-*"}, esObject{
+			"scanId":      keyword,
+			"scanType":    keyword,
+			"result":      keyword,
+			"location":    keyword,
+			"deviceId":    keyword,
+			"userId":      keyword,
+			"username":    keyword,
+			"userRole":    keyword,
+			"itemId":      keyword,
+			"itemName":    nameField,
+			"category":    keyword,
+			"action":      keyword,
+			"accessLevel": keyword,
+			"changes":     flattened,
+		}, esObject{
+			"index.lifecycle.name":           ScanLogsPolicy,
+			"index.lifecycle.rollover_alias": ScanLogsIndex,
+		}),
+	}
+}
+
+// ElasticsearchDrift describes a template, policy or alias that differs from the code
+type ElasticsearchDrift struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Action   string `json:"action"` // installed, manual (run a reindex) or none (check only)
+}
+
+// String formats the drift for logs and CLI output
+func (d ElasticsearchDrift) String() string {
+	return fmt.Sprintf("%s %s: expected %s, actual %s (%s)", d.Kind, d.Name, d.Expected, d.Actual, d.Action)
+}
+
+// BootstrapReport lists the drift found by Bootstrap
+type BootstrapReport struct {
+	Drift []ElasticsearchDrift `json:"drift"`
+}
+
+// HasDrift reports whether anything differed from the code
+func (r *BootstrapReport) HasDrift() bool {
+	return len(r.Drift) > 0
+}
+
+// Unresolved returns the drift that is still present after Bootstrap
+func (r *BootstrapReport) Unresolved() []ElasticsearchDrift {
+	var unresolved []ElasticsearchDrift
+	for _, d := range r.Drift {
+		if d.Action != "installed" {
+			unresolved = append(unresolved, d)
+		}
+	}
+	return unresolved
+}
+
+// Bootstrap compares the ILM policies, component templates and index
+// templates with the cluster and, with apply set, installs the ones that are
+// missing or outdated. It also creates the first scan log index behind its
+// rollover alias. Existing indices keep their mapping; use Reindex to move
+// them to the current templates.
+func (es *ElasticsearchClient) Bootstrap(ctx context.Context, apply bool) (*BootstrapReport, error) {
+	report := &BootstrapReport{}
+
+	for _, asset := range elasticsearchAssets() {
+		actual, err := es.installedVersion(ctx, asset)
+		if err != nil {
+			return report, err
+		}
+
+		expected := fmt.Sprintf("v%d/%s", IndexTemplateVersion, asset.hash())
+		if actual == expected {
+			continue
+		}
+
+		drift := ElasticsearchDrift{Kind: asset.kind, Name: asset.name, Expected: expected, Actual: actual, Action: "none"}
+		if apply {
+			if _, _, err := es.request(ctx, http.MethodPut, asset.path(), asset.document(), http.StatusOK); err != nil {
+				return report, fmt.Errorf("failed to install %s %s: %w", asset.kind, asset.name, err)
+			}
+			drift.Action = "installed"
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+
+	if err := es.bootstrapRolloverAlias(ctx, ScanLogsIndex, apply, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// installedVersion returns "v<version>/<hash>" of an installed asset, "missing"
+// when it does not exist and "unmanaged" when it was not installed by Bootstrap
+func (es *ElasticsearchClient) installedVersion(ctx context.Context, asset esAsset) (string, error) {
+	status, body, err := es.request(ctx, http.MethodGet, asset.path(), nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s %s: %w", asset.kind, asset.name, err)
+	}
+	if status == http.StatusNotFound {
+		return "missing", nil
+	}
+
+	var response struct {
+		ComponentTemplates []struct {
+			ComponentTemplate struct {
+				Meta esObject `json:"_meta"`
+			} `json:"component_template"`
+		} `json:"component_templates"`
+		IndexTemplates []struct {
+			IndexTemplate struct {
+				Meta esObject `json:"_meta"`
+			} `json:"index_template"`
+		} `json:"index_templates"`
+	}
+	policies := map[string]struct {
+		Policy struct {
+			Meta esObject `json:"_meta"`
+		} `json:"policy"`
+	}{}
+
+	var meta esObject
+	switch asset.kind {
+	case AssetILMPolicy:
+		if err := json.Unmarshal(body, &policies); err != nil {
+			return "", fmt.Errorf("failed to decode %s %s: %w", asset.kind, asset.name, err)
+		}
+		meta = policies[asset.name].Policy.Meta
+	case AssetComponentTemplate:
+		if err := json.Unmarshal(body, &response); err != nil {
+			return "", fmt.Errorf("failed to decode %s %s: %w", asset.kind, asset.name, err)
+		}
+		if len(response.ComponentTemplates) > 0 {
+			meta = response.ComponentTemplates[0].ComponentTemplate.Meta
+		}
+	default:
+		if err := json.Unmarshal(body, &response); err != nil {
+			return "", fmt.Errorf("failed to decode %s %s: %w", asset.kind, asset.name, err)
+		}
+		if len(response.IndexTemplates) > 0 {
+			meta = response.IndexTemplates[0].IndexTemplate.Meta
+		}
+	}
+
+	if meta == nil || meta["managed_by"] != "warehouse" {
+		return "unmanaged", nil
+	}
+	return fmt.Sprintf("v%v/%v", meta["version"], meta["hash"]), nil
+}
+
+// bootstrapRolloverAlias creates the first index behind a rollover alias.
+// A concrete index already using the alias name has to be reindexed.
+func (es *ElasticsearchClient) bootstrapRolloverAlias(ctx context.Context, alias string, apply bool, report *BootstrapReport) error {
+	isAlias, exists, err := es.resolve(ctx, alias)
+	if err != nil {
+		return err
+	}
+	if isAlias {
+		return nil
+	}
+
+	drift := ElasticsearchDrift{Kind: AssetAlias, Name: alias, Expected: "rollover alias", Actual: "missing", Action: "none"}
+	switch {
+	case exists:
+		drift.Actual = "concrete index"
+		drift.Action = "manual"
+	case apply:
+		first := alias + "-000001"
+		body := esObject{"aliases": esObject{alias: esObject{"is_write_index": true}}}
+		if _, _, err := es.request(ctx, http.MethodPut, "/"+first, body, http.StatusOK); err != nil {
+			return fmt.Errorf("failed to create index %s: %w", first, err)
+		}
+		drift.Action = "installed"
+	}
+
+	report.Drift = append(report.Drift, drift)
+	return nil
+}
+
+// Reindex moves an index to the current templates. A rollover alias is
+// rolled over so that new writes use the new mapping. Any other index is
+// copied into a new versioned index, which then replaces it behind an alias
+// of the same name; the old index is deleted. Writes made to the old index
+// while the copy runs are lost, so stop the indexer first.
+func (es *ElasticsearchClient) Reindex(ctx context.Context, name string) (string, error) {
+	isAlias, exists, err := es.resolve(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("index %s does not exist", name)
+	}
+
+	rollover := name == ScanLogsIndex
+	if isAlias && rollover {
+		_, body, err := es.request(ctx, http.MethodPost, "/"+name+"/_rollover", nil, http.StatusOK)
+		if err != nil {
+			return "", fmt.Errorf("failed to roll over %s: %w", name, err)
+		}
+		var response struct {
+			NewIndex string `json:"new_index"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return "", fmt.Errorf("failed to decode rollover response: %w", err)
+		}
+		return response.NewIndex, nil
+	}
+
+	sources := []string{name}
+	if isAlias {
+		if sources, err = es.aliasIndices(ctx, name); err != nil {
+			return "", err
+		}
+	}
+
+	target := fmt.Sprintf("%s-v%d-%d", name, IndexTemplateVersion, time.Now().Unix())
+	if rollover {
+		// The first scan log index behind the rollover alias
+		target = name + "-000001"
+	}
+	if _, _, err := es.request(ctx, http.MethodPut, "/"+target, nil, http.StatusOK); err != nil {
+		return "", fmt.Errorf("failed to create index %s: %w", target, err)
+	}
+
+	reindex := esObject{"source": esObject{"index": sources}, "dest": esObject{"index": target}}
+	if _, _, err := es.request(ctx, http.MethodPost, "/_reindex?wait_for_completion=true&refresh=true", reindex, http.StatusOK); err != nil {
+		return "", fmt.Errorf("failed to reindex %s into %s: %w", name, target, err)
+	}
+
+	// Swap atomically: the old indices are deleted and the name now points to the target
+	var actions []esObject
+	for _, source := range sources {
+		actions = append(actions, esObject{"remove_index": esObject{"index": source}})
+	}
+	actions = append(actions, esObject{"add": esObject{"index": target, "alias": name, "is_write_index": true}})
+	if _, _, err := es.request(ctx, http.MethodPost, "/_aliases", esObject{"actions": actions}, http.StatusOK); err != nil {
+		return "", fmt.Errorf("failed to point %s to %s: %w", name, target, err)
+	}
+
+	return target, nil
+}
+
+// resolve reports whether name is an alias and whether an index or alias exists under it
+func (es *ElasticsearchClient) resolve(ctx context.Context, name string) (isAlias bool, exists bool, err error) {
+	status, _, err := es.request(ctx, http.MethodHead, "/_alias/"+name, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to check alias %s: %w", name, err)
+	}
+	if status == http.StatusOK {
+		return true, true, nil
+	}
+
+	status, _, err = es.request(ctx, http.MethodHead, "/"+name, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to check index %s: %w", name, err)
+	}
+	return false, status == http.StatusOK, nil
+}
+
+// aliasIndices returns the indices behind an alias
+func (es *ElasticsearchClient) aliasIndices(ctx context.Context, alias string) ([]string, error) {
+	_, body, err := es.request(ctx, http.MethodGet, "/_alias/"+alias, nil, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alias %s: %w", alias, err)
+	}
+
+	var indices map[string]json.RawMessage
+	if err := json.Unmarshal(body, &indices); err != nil {
+		return nil, fmt.Errorf("failed to decode alias %s: %w", alias, err)
+	}
+
+	names := make([]string, 0, len(indices))
+	for index := range indices {
+		names = append(names, index)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Search runs a search request against an index or alias and decodes the
+// response into result
+func (es *ElasticsearchClient) Search(ctx context.Context, index string, body interface{}, result interface{}) error {
+	_, payload, err := es.request(ctx, http.MethodPost, "/"+index+"/_search", body, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("failed to search %s: %w", index, err)
+	}
+	if err := json.Unmarshal(payload, result); err != nil {
+		return fmt.Errorf("failed to decode search response: %w", err)
+	}
+	return nil
+}
+
+// request sends a JSON request and fails unless the response has one of the accepted statuses
+func (es *ElasticsearchClient) request(ctx context.Context, method, path string, body interface{}, accepted ...int) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := es.Client.Perform(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	payload, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, nil, err
+	}
+
+	for _, status := range accepted {
+		if res.StatusCode == status {
+			return res.StatusCode, payload, nil
+		}
+	}
+	return res.StatusCode, payload, fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(payload)))
+}
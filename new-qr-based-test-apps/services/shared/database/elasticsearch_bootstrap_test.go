@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeElasticsearch stores templates, policies and indices in memory
+type fakeElasticsearch struct {
+	mu       sync.Mutex
+	assets   map[string]json.RawMessage // path -> stored body
+	indices  map[string]bool
+	aliases  map[string]string // alias -> index
+	requests []string
+}
+
+func newFakeElasticsearch(t *testing.T) (*fakeElasticsearch, *ElasticsearchClient) {
+	fake := &fakeElasticsearch{
+		assets:  make(map[string]json.RawMessage),
+		indices: make(map[string]bool),
+		aliases: make(map[string]string),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(server.Close)
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	require.NoError(t, err)
+	return fake, &ElasticsearchClient{Client: client}
+}
+
+func (f *fakeElasticsearch) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	body, _ := io.ReadAll(r.Body)
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/_ilm/") || strings.HasPrefix(path, "/_component_template/") || strings.HasPrefix(path, "/_index_template/"):
+		if r.Method == http.MethodPut {
+			f.assets[path] = body
+			w.Write([]byte(`{"acknowledged":true}`))
+			return
+		}
+		stored, ok := f.assets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{}`))
+			return
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		switch {
+		case strings.HasPrefix(path, "/_ilm/"):
+			var doc struct {
+				Policy json.RawMessage `json:"policy"`
+			}
+			json.Unmarshal(stored, &doc)
+			json.NewEncoder(w).Encode(map[string]interface{}{name: map[string]json.RawMessage{"policy": doc.Policy}})
+		case strings.HasPrefix(path, "/_component_template/"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"component_templates": []interface{}{
+				map[string]interface{}{"name": name, "component_template": stored},
+			}})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"index_templates": []interface{}{
+				map[string]interface{}{"name": name, "index_template": stored},
+			}})
+		}
+	case strings.HasPrefix(path, "/_alias/"):
+		alias := strings.TrimPrefix(path, "/_alias/")
+		index, ok := f.aliases[alias]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{index: map[string]interface{}{}})
+	case path == "/_reindex":
+		w.Write([]byte(`{"total":1}`))
+	case path == "/_aliases":
+		var request struct {
+			Actions []map[string]map[string]interface{} `json:"actions"`
+		}
+		json.Unmarshal(body, &request)
+		for _, action := range request.Actions {
+			if remove, ok := action["remove_index"]; ok {
+				delete(f.indices, remove["index"].(string))
+			}
+			if add, ok := action["add"]; ok {
+				f.aliases[add["alias"].(string)] = add["index"].(string)
+			}
+		}
+		w.Write([]byte(`{"acknowledged":true}`))
+	case strings.HasSuffix(path, "/_rollover"):
+		w.Write([]byte(`{"new_index":"warehouse-scan-logs-000002"}`))
+	default:
+		index := strings.TrimPrefix(path, "/")
+		switch r.Method {
+		case http.MethodPut:
+			f.indices[index] = true
+			var request struct {
+				Aliases map[string]interface{} `json:"aliases"`
+			}
+			json.Unmarshal(body, &request)
+			for alias := range request.Aliases {
+				f.aliases[alias] = index
+			}
+			w.Write([]byte(`{"acknowledged":true}`))
+		case http.MethodHead:
+			if !f.indices[index] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	fake, es := newFakeElasticsearch(t)
+	ctx := context.Background()
+	assets := elasticsearchAssets()
+
+	// Check only: everything is missing and nothing is installed
+	report, err := es.Bootstrap(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, report.Drift, len(assets)+1)
+	assert.Len(t, report.Unresolved(), len(assets)+1)
+	assert.Empty(t, fake.assets)
+
+	// Apply installs the assets and the scan log rollover alias
+	report, err = es.Bootstrap(ctx, true)
+	require.NoError(t, err)
+	assert.Len(t, report.Drift, len(assets)+1)
+	assert.Empty(t, report.Unresolved())
+	assert.Len(t, fake.assets, len(assets))
+	assert.Equal(t, ScanLogsIndex+"-000001", fake.aliases[ScanLogsIndex])
+
+	// A second run finds nothing to do
+	report, err = es.Bootstrap(ctx, true)
+	require.NoError(t, err)
+	assert.False(t, report.HasDrift())
+
+	// A template edited by hand is reported and reinstalled
+	path := "/_index_template/warehouse-profit-analytics"
+	fake.assets[path] = json.RawMessage(`{"index_patterns":["warehouse-profit-analytics"]}`)
+	report, err = es.Bootstrap(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, report.Drift, 1)
+	assert.Equal(t, "unmanaged", report.Drift[0].Actual)
+	assert.Equal(t, "none", report.Drift[0].Action)
+}
+
+func TestBootstrapConcreteScanLogsIndex(t *testing.T) {
+	fake, es := newFakeElasticsearch(t)
+	fake.indices[ScanLogsIndex] = true
+
+	report, err := es.Bootstrap(context.Background(), true)
+	require.NoError(t, err)
+
+	unresolved := report.Unresolved()
+	require.Len(t, unresolved, 1)
+	assert.Equal(t, AssetAlias, unresolved[0].Kind)
+	assert.Equal(t, "manual", unresolved[0].Action)
+
+	// Reindexing moves the documents behind the rollover alias
+	target, err := es.Reindex(context.Background(), ScanLogsIndex)
+	require.NoError(t, err)
+	assert.Equal(t, ScanLogsIndex+"-000001", target)
+	assert.Equal(t, target, fake.aliases[ScanLogsIndex])
+	assert.False(t, fake.indices[ScanLogsIndex])
+}
+
+func TestReindex(t *testing.T) {
+	fake, es := newFakeElasticsearch(t)
+	fake.indices[ProfitAnalyticsIndex] = true
+
+	target, err := es.Reindex(context.Background(), ProfitAnalyticsIndex)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(target, ProfitAnalyticsIndex+"-v2-"))
+	assert.Equal(t, target, fake.aliases[ProfitAnalyticsIndex])
+	assert.False(t, fake.indices[ProfitAnalyticsIndex])
+	assert.Contains(t, fake.requests, "POST /_reindex")
+
+	_, err = es.Reindex(context.Background(), "warehouse-missing")
+	assert.Error(t, err)
+}
+
+func TestAssetHashIgnoresMetadata(t *testing.T) {
+	for _, asset := range elasticsearchAssets() {
+		doc := asset.document()
+		if asset.kind == AssetILMPolicy {
+			doc = doc["policy"].(esObject)
+		} else {
+			assert.Equal(t, IndexTemplateVersion, doc["version"], asset.name)
+		}
+
+		meta := doc["_meta"].(esObject)
+		assert.Equal(t, asset.hash(), meta["hash"], asset.name)
+		assert.NotContains(t, asset.body, "_meta", asset.name)
+	}
+}
@@ -59,4 +59,26 @@ const (
 	ShipmentsCollection = "shipments"
 	UsersCollection    = "users"
 	ScanLogsCollection = "scan_logs"
+
+	StockMovementsCollection = "stock_movements"
+	LocationsCollection      = "locations"
+	BinStockCollection       = "bin_stock"
+	LotsCollection           = "lots"
+	SerialsCollection        = "serials"
+
+	ReorderPoliciesCollection = "reorder_policies"
+	StockAlertsCollection     = "stock_alerts"
+
+	ReservationsCollection = "stock_reservations"
+	CountTasksCollection   = "count_tasks"
+
+	ValuationPoliciesCollection = "valuation_policies"
+	CostLayersCollection        = "cost_layers"
+	PriceHistoryCollection      = "price_history"
+
+	WebhookSubscriptionsCollection = "webhook_subscriptions"
+	WebhookDeliveriesCollection    = "webhook_deliveries"
+
+	ReportDefinitionsCollection = "report_definitions"
+	ReportRunsCollection        = "report_runs"
 )
\ No newline at end of file
@@ -0,0 +1,50 @@
+// Package mongotest connects tests to a throwaway MongoDB database.
+//
+// Tests that need MongoDB run only when MONGODB_TEST_URI points at a
+// server, so that the default go test stays offline. Stock transactions
+// need a replica set, for example:
+//
+//	docker run -d -p 27017:27017 mongo:7 --replSet rs0
+//	docker exec <container> mongosh --eval 'rs.initiate()'
+//	MONGODB_TEST_URI='mongodb://localhost:27017/?replicaSet=rs0&directConnection=true' go test ./...
+package mongotest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"warehouse-shared/database"
+)
+
+// EnvURI is the environment variable holding the test server URI
+const EnvURI = "MONGODB_TEST_URI"
+
+// Connect returns a connection to a new database that is dropped when the
+// test ends. It skips the test when no test server is configured.
+func Connect(t *testing.T) *database.MongoDB {
+	t.Helper()
+
+	uri := os.Getenv(EnvURI)
+	if uri == "" {
+		t.Skipf("%s is not set", EnvURI)
+	}
+
+	name := fmt.Sprintf("warehouse_test_%d", time.Now().UnixNano())
+	db, err := database.ConnectMongoDB(uri, name)
+	if err != nil {
+		t.Fatalf("failed to connect to the test MongoDB: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.Database.Drop(ctx); err != nil {
+			t.Logf("failed to drop test database %s: %v", name, err)
+		}
+		db.Close()
+	})
+	return db
+}
@@ -0,0 +1,98 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+)
+
+// csvFlushRows is the number of rows written between flushes of the
+// underlying writer, so that long exports reach the client as they go
+const csvFlushRows = 500
+
+// flusher is implemented by writers that buffer, like HTTP responses
+type flusher interface {
+	Flush()
+}
+
+// writeCSV writes a document as CSV. A document with a single table and no
+// figures is written as a plain table; otherwise the figures and each
+// table are written as sections separated by blank lines.
+func writeCSV(w io.Writer, doc *Document) error {
+	cw := csv.NewWriter(w)
+	sections := len(doc.Tables) > 1 || len(doc.Figures) > 0
+
+	if sections {
+		cw.Write([]string{doc.Title})
+		if doc.Subtitle != "" {
+			cw.Write([]string{doc.Subtitle})
+		}
+		cw.Write([]string{"Generated", doc.GeneratedAt.UTC().Format(time.RFC3339)})
+		for _, figure := range doc.Figures {
+			cw.Write([]string{figure.Label, rawValue(Column{Type: figure.Type}, figure.Value)})
+		}
+	}
+
+	for i := range doc.Tables {
+		table := &doc.Tables[i]
+		if sections {
+			cw.Write(nil)
+			cw.Write([]string{table.Title})
+		}
+		if err := writeCSVTable(cw, w, table); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV export: %w", err)
+	}
+	return nil
+}
+
+// writeCSVTable writes the header, the rows and the totals of a table
+func writeCSVTable(cw *csv.Writer, w io.Writer, table *Table) error {
+	header := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		header[i] = column.Title
+	}
+	cw.Write(header)
+
+	sums := make(totals, len(table.Columns))
+	rows := 0
+	err := table.Rows(func(values ...interface{}) error {
+		record := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			if i < len(values) {
+				record[i] = rawValue(column, values[i])
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+		sums.add(table.Columns, values)
+
+		rows++
+		if rows%csvFlushRows == 0 {
+			cw.Flush()
+			if f, ok := w.(flusher); ok {
+				f.Flush()
+			}
+		}
+		return cw.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	if table.hasTotals() {
+		record := make([]string, len(table.Columns))
+		for i, value := range sums.row(table.Columns) {
+			record[i] = rawValue(table.Columns[i], value)
+		}
+		cw.Write(record)
+	}
+	return nil
+}
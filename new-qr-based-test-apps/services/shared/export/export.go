@@ -0,0 +1,308 @@
+// Package export writes tabular documents as CSV, XLSX or PDF files. A
+// document is a title, a few key figures and tables whose rows are
+// produced by a callback, so list endpoints can stream rows from a cursor.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Format is an export file format
+type Format string
+
+// Supported formats
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+	FormatPDF  Format = "pdf"
+)
+
+// ErrUnsupportedFormat is returned for an unknown format
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// ParseFormat parses a format name such as the format query parameter
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(strings.ToLower(value)); format {
+	case FormatCSV, FormatXLSX, FormatPDF:
+		return format, nil
+	}
+	return "", fmt.Errorf("%w: %q, use csv, xlsx or pdf", ErrUnsupportedFormat, value)
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Filename returns the attachment name of an export generated at a time
+func (f Format) Filename(name string, at time.Time) string {
+	return fmt.Sprintf("%s-%s.%s", name, at.UTC().Format("20060102-150405"), f)
+}
+
+// ColumnType is the type of the values of a column. It sets the cell type
+// and number format in spreadsheets and the alignment in PDFs.
+type ColumnType int
+
+// Column types
+const (
+	Text ColumnType = iota
+	Integer
+	Number
+	Currency
+	Percent // a percentage such as 45.5, not a fraction
+	Date
+)
+
+// numeric reports whether values of the type are numbers
+func (t ColumnType) numeric() bool {
+	return t == Integer || t == Number || t == Currency || t == Percent
+}
+
+// Column describes a column of a table
+type Column struct {
+	Title string
+	Type  ColumnType
+	Width float64 // relative width, 1 when zero
+	Total bool    // summed in a totals row
+	Bar   bool    // drawn as a bar chart in PDFs
+}
+
+// width returns the relative width of the column
+func (c Column) width() float64 {
+	switch {
+	case c.Width > 0:
+		return c.Width
+	case c.Bar:
+		return 2
+	}
+	return 1
+}
+
+// RowFunc produces the rows of a table by calling emit once per row, with
+// one value per column. An error returned by emit must be returned.
+type RowFunc func(emit func(values ...interface{}) error) error
+
+// Table is a titled table of a document
+type Table struct {
+	Title   string
+	Columns []Column
+	Rows    RowFunc
+}
+
+// hasTotals reports whether the table has a totals row
+func (t *Table) hasTotals() bool {
+	for _, column := range t.Columns {
+		if column.Total {
+			return true
+		}
+	}
+	return false
+}
+
+// Figure is a key figure shown above the tables
+type Figure struct {
+	Label string
+	Value interface{}
+	Type  ColumnType
+}
+
+// Document is an export: a title, key figures and tables
+type Document struct {
+	Title       string
+	Subtitle    string // usually the filters of the data
+	GeneratedAt time.Time
+	Figures     []Figure
+	Tables      []Table
+}
+
+// Write writes a document in a format. CSV rows are written as they are
+// produced; XLSX and PDF files are assembled before being written.
+func Write(w io.Writer, format Format, doc *Document) error {
+	if doc.GeneratedAt.IsZero() {
+		doc.GeneratedAt = time.Now()
+	}
+
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, doc)
+	case FormatXLSX:
+		return writeXLSX(w, doc)
+	case FormatPDF:
+		return writePDF(w, doc)
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+}
+
+// totals sums the total columns of a table while its rows are emitted
+type totals []float64
+
+// add adds a row to the totals
+func (t totals) add(columns []Column, values []interface{}) {
+	for i, column := range columns {
+		if column.Total && i < len(values) {
+			if value, ok := toFloat(values[i]); ok {
+				t[i] += value
+			}
+		}
+	}
+}
+
+// row returns the totals as row values, labelled in the first column when
+// it is not a total itself
+func (t totals) row(columns []Column) []interface{} {
+	row := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if column.Total {
+			row[i] = t[i]
+		}
+	}
+	if len(columns) > 0 && !columns[0].Total {
+		row[0] = "Total"
+	}
+	return row
+}
+
+// toFloat converts a numeric value, reporting false for missing values
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case *float64:
+		if v == nil {
+			return 0, false
+		}
+		return *v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// toTime converts a date value, reporting false for missing values
+func toTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, !v.IsZero()
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, false
+		}
+		return *v, true
+	case primitive.DateTime:
+		return v.Time(), true
+	}
+	return time.Time{}, false
+}
+
+// isNil reports whether a value is missing
+func isNil(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case *float64:
+		return v == nil
+	case *time.Time:
+		return v == nil
+	}
+	return false
+}
+
+// rawValue formats a value for a CSV cell: numbers without grouping and
+// dates in RFC 3339, so that they parse back
+func rawValue(column Column, value interface{}) string {
+	if isNil(value) {
+		return ""
+	}
+	if column.Type.numeric() {
+		if number, ok := toFloat(value); ok {
+			switch column.Type {
+			case Integer:
+				return strconv.FormatInt(int64(math.Round(number)), 10)
+			case Currency:
+				return strconv.FormatFloat(number, 'f', 2, 64)
+			}
+			return strconv.FormatFloat(number, 'f', -1, 64)
+		}
+	}
+	if t, ok := toTime(value); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	if column.Type == Text {
+		return escapeFormula(fmt.Sprint(value))
+	}
+	return fmt.Sprint(value)
+}
+
+// escapeFormula quotes text that a spreadsheet would run as a formula, such
+// as an item name starting with "=", so that it is shown as typed
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// displayValue formats a value for reading: grouped numbers, two decimals
+// and short dates
+func displayValue(column Column, value interface{}) string {
+	if isNil(value) {
+		return ""
+	}
+	if column.Type.numeric() {
+		if number, ok := toFloat(value); ok {
+			switch column.Type {
+			case Integer:
+				return groupDigits(number, 0)
+			case Percent:
+				return groupDigits(number, 1) + "%"
+			}
+			return groupDigits(number, 2)
+		}
+	}
+	if t, ok := toTime(value); ok {
+		return t.UTC().Format("2006-01-02 15:04")
+	}
+	return fmt.Sprint(value)
+}
+
+// groupDigits formats a number with thousands separators
+func groupDigits(value float64, decimals int) string {
+	formatted := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+	whole, fraction := formatted, ""
+	if i := strings.IndexByte(formatted, '.'); i >= 0 {
+		whole, fraction = formatted[:i], formatted[i:]
+	}
+
+	var b strings.Builder
+	if value < 0 && strings.Trim(formatted, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	b.WriteString(fraction)
+	return b.String()
+}
@@ -0,0 +1,213 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+var generatedAt = time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+// stockDocument is a document with figures and a table of items
+func stockDocument(rows int) *Document {
+	updated := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	return &Document{
+		Title:       "Stock levels",
+		Subtitle:    "Category: Electronics",
+		GeneratedAt: generatedAt,
+		Figures: []Figure{
+			{Label: "Items", Value: rows, Type: Integer},
+			{Label: "Average margin", Value: 41.25, Type: Percent},
+		},
+		Tables: []Table{{
+			Title: "Items",
+			Columns: []Column{
+				{Title: "Item ID"},
+				{Title: "Name", Width: 2},
+				{Title: "Stock", Type: Integer, Total: true, Bar: true},
+				{Title: "Value", Type: Currency, Total: true},
+				{Title: "Updated", Type: Date},
+			},
+			Rows: func(emit func(values ...interface{}) error) error {
+				for i := 1; i <= rows; i++ {
+					if err := emit(fmt.Sprintf("ITM-2024-%03d", i), "Bluetooth headphones", i*10, float64(i)*12.5, updated); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("XLSX")
+	require.NoError(t, err)
+	assert.Equal(t, FormatXLSX, format)
+	assert.Equal(t, "stock-20240315-120000.xlsx", format.Filename("stock", generatedAt))
+
+	_, err = ParseFormat("docx")
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestGroupDigits(t *testing.T) {
+	assert.Equal(t, "1,234,567.89", groupDigits(1234567.891, 2))
+	assert.Equal(t, "-1,000", groupDigits(-1000, 0))
+	assert.Equal(t, "999.5", groupDigits(999.5, 1))
+	assert.Equal(t, "0.00", groupDigits(-0.001, 2))
+}
+
+func TestWriteCSVPlainTable(t *testing.T) {
+	doc := stockDocument(2)
+	doc.Figures = nil
+
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, FormatCSV, doc))
+	assert.Equal(t, strings.Join([]string{
+		"Item ID,Name,Stock,Value,Updated",
+		"ITM-2024-001,Bluetooth headphones,10,12.50,2024-03-01T09:30:00Z",
+		"ITM-2024-002,Bluetooth headphones,20,25.00,2024-03-01T09:30:00Z",
+		"Total,,30,37.50,",
+		"",
+	}, "\n"), out.String())
+}
+
+func TestWriteCSVSections(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, FormatCSV, stockDocument(1)))
+	assert.True(t, strings.HasPrefix(out.String(), strings.Join([]string{
+		"Stock levels",
+		"Category: Electronics",
+		"Generated,2024-03-15T12:00:00Z",
+		"Items,1",
+		"Average margin,41.25",
+		"",
+		"Items",
+		"Item ID,Name,Stock,Value,Updated",
+	}, "\n")), out.String())
+}
+
+// flushRecorder counts the flushes of a streamed export
+type flushRecorder struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+}
+
+func TestWriteCSVStreams(t *testing.T) {
+	var out flushRecorder
+	require.NoError(t, Write(&out, FormatCSV, stockDocument(3*csvFlushRows+1)))
+	assert.Equal(t, 3, out.flushes)
+	assert.Equal(t, 3*csvFlushRows+1+9, strings.Count(out.String(), "\n"))
+}
+
+func TestWriteStopsOnRowError(t *testing.T) {
+	failure := errors.New("cursor closed")
+	doc := stockDocument(0)
+	doc.Tables[0].Rows = func(emit func(values ...interface{}) error) error {
+		return failure
+	}
+
+	for _, format := range []Format{FormatCSV, FormatXLSX, FormatPDF} {
+		assert.ErrorIs(t, Write(&bytes.Buffer{}, format, doc), failure, format)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, FormatXLSX, stockDocument(3)))
+
+	f, err := excelize.OpenReader(&out)
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, []string{"Summary", "Items"}, f.GetSheetList())
+
+	label, err := f.GetCellValue("Summary", "A5")
+	require.NoError(t, err)
+	assert.Equal(t, "Items", label)
+
+	rows, err := f.GetRows("Items", excelize.Options{RawCellValue: true})
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+	assert.Equal(t, []string{"Item ID", "Name", "Stock", "Value", "Updated"}, rows[0])
+	assert.Equal(t, []string{"ITM-2024-003", "Bluetooth headphones", "30", "37.5"}, rows[3][:4])
+	assert.Equal(t, []string{"Total", "", "60", "75"}, rows[4])
+
+	formula, err := f.GetCellFormula("Items", "C5")
+	require.NoError(t, err)
+	assert.Equal(t, "SUM(C2:C4)", formula)
+
+	cellType, err := f.GetCellType("Items", "C2")
+	require.NoError(t, err)
+	assert.NotEqual(t, excelize.CellTypeSharedString, cellType, "numbers are stored as numbers")
+}
+
+func TestWriteEscapesFormulas(t *testing.T) {
+	names := []string{"=HYPERLINK(\"http://evil\")", "+1", "-2+3", "@SUM(A1)", "\tcmd", "\rcmd", "Bluetooth - headphones"}
+	doc := &Document{
+		Title:       "Items",
+		GeneratedAt: generatedAt,
+		Tables: []Table{{
+			Title:   "Items",
+			Columns: []Column{{Title: "Name"}, {Title: "Stock", Type: Integer}},
+			Rows: func(emit func(values ...interface{}) error) error {
+				for _, name := range names {
+					if err := emit(name, -5); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}},
+	}
+	expected := []string{"'=HYPERLINK(\"http://evil\")", "'+1", "'-2+3", "'@SUM(A1)", "'\tcmd", "'\rcmd", "Bluetooth - headphones"}
+
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, FormatCSV, doc))
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, len(names)+1)
+	for i, record := range records[1:] {
+		assert.Equal(t, expected[i], record[0])
+		assert.Equal(t, "-5", record[1], "numbers are not quoted")
+	}
+
+	out.Reset()
+	require.NoError(t, Write(&out, FormatXLSX, doc))
+	f, err := excelize.OpenReader(&out)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rows, err := f.GetRows("Items", excelize.Options{RawCellValue: true})
+	require.NoError(t, err)
+	require.Len(t, rows, len(names)+1)
+	for i, row := range rows[1:] {
+		assert.Equal(t, expected[i], row[0])
+		assert.Equal(t, "-5", row[1])
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	used := map[string]bool{}
+	assert.Equal(t, "Top items (margin)", sheetName("Top items [margin]", used))
+	assert.Equal(t, "Top items (margin) (2)", sheetName("Top items [margin]", used))
+	assert.Len(t, sheetName(strings.Repeat("x", 40), used), maxSheetName)
+}
+
+func TestWritePDF(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, FormatPDF, stockDocument(120)))
+	assert.True(t, bytes.HasPrefix(out.Bytes(), []byte("%PDF-")))
+	assert.Greater(t, bytes.Count(out.Bytes(), []byte("/Type /Page\n")), 1, "long tables span several pages")
+}
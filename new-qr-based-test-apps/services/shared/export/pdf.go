@@ -0,0 +1,273 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// PDF layout in millimetres on landscape A4
+const (
+	pdfMargin      = 12.0
+	pdfRowHeight   = 6.0
+	pdfFigureWidth = 65.0
+	pdfFigureRows  = 4 // figures per line
+)
+
+// pdfWriter lays out a document on PDF pages
+type pdfWriter struct {
+	pdf *gofpdf.Fpdf
+	tr  func(string) string
+	doc *Document
+}
+
+// writePDF writes a document as a landscape PDF: a page header with the
+// title and filters, the figures as cards and each table with its totals.
+// Bar columns are drawn as bars scaled to the largest value of the column,
+// which is why the rows of a table are collected before drawing it.
+func writePDF(w io.Writer, doc *Document) error {
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	p := &pdfWriter{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor(""), doc: doc}
+
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(false, pdfMargin)
+	pdf.SetTitle(doc.Title, true)
+	pdf.AliasNbPages("")
+	pdf.SetHeaderFunc(p.header)
+	pdf.SetFooterFunc(p.footer)
+	pdf.AddPage()
+
+	if len(doc.Figures) > 0 {
+		p.figures()
+	}
+	for i := range doc.Tables {
+		if err := p.table(&doc.Tables[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to write PDF export: %w", err)
+	}
+	return nil
+}
+
+// header draws the title, filters and generation time on every page
+func (p *pdfWriter) header() {
+	pdf := p.pdf
+	width := p.contentWidth()
+
+	pdf.SetFont("Helvetica", "B", 15)
+	pdf.SetTextColor(31, 56, 100)
+	pdf.CellFormat(width, 8, p.tr(p.doc.Title), "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetTextColor(90, 90, 90)
+	generated := "Generated " + p.doc.GeneratedAt.UTC().Format("2006-01-02 15:04 MST")
+	pdf.CellFormat(width*0.7, 5, p.tr(p.doc.Subtitle), "", 0, "L", false, 0, "")
+	pdf.CellFormat(width*0.3, 5, generated, "", 1, "R", false, 0, "")
+
+	pdf.SetDrawColor(31, 56, 100)
+	pdf.Line(pdfMargin, pdf.GetY()+1, pdfMargin+width, pdf.GetY()+1)
+	pdf.Ln(4)
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// footer draws the page number
+func (p *pdfWriter) footer() {
+	pdf := p.pdf
+	pdf.SetY(-pdfMargin + 2)
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.SetTextColor(120, 120, 120)
+	pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+}
+
+// figures draws the key figures as cards, a few per line
+func (p *pdfWriter) figures() {
+	pdf := p.pdf
+	gap := (p.contentWidth() - pdfFigureRows*pdfFigureWidth) / (pdfFigureRows - 1)
+
+	for i, figure := range p.doc.Figures {
+		column := i % pdfFigureRows
+		if column == 0 && i > 0 {
+			pdf.Ln(18)
+		}
+		x := pdfMargin + float64(column)*(pdfFigureWidth+gap)
+		y := pdf.GetY()
+
+		pdf.SetFillColor(242, 245, 250)
+		pdf.Rect(x, y, pdfFigureWidth, 15, "F")
+		pdf.SetXY(x+3, y+2)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(90, 90, 90)
+		pdf.CellFormat(pdfFigureWidth-6, 4, p.tr(figure.Label), "", 0, "L", false, 0, "")
+		pdf.SetXY(x+3, y+7)
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.CellFormat(pdfFigureWidth-6, 6, p.fit(displayValue(Column{Type: figure.Type}, figure.Value), pdfFigureWidth-6), "", 0, "L", false, 0, "")
+		pdf.SetXY(pdfMargin, y)
+	}
+	pdf.Ln(22)
+}
+
+// table draws a table, repeating its header on every page it spans
+func (p *pdfWriter) table(table *Table) error {
+	var rows [][]interface{}
+	sums := make(totals, len(table.Columns))
+	err := table.Rows(func(values ...interface{}) error {
+		rows = append(rows, values)
+		sums.add(table.Columns, values)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	widths := p.columnWidths(table.Columns)
+	maxima := make([]float64, len(table.Columns))
+	for _, row := range rows {
+		for i, column := range table.Columns {
+			if column.Bar && i < len(row) {
+				if value, ok := toFloat(row[i]); ok {
+					maxima[i] = math.Max(maxima[i], math.Abs(value))
+				}
+			}
+		}
+	}
+
+	pdf := p.pdf
+	if !p.fits(3 * pdfRowHeight) {
+		pdf.AddPage()
+	}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 8, p.tr(table.Title), "", 1, "L", false, 0, "")
+	p.tableHeader(table.Columns, widths)
+
+	for i, row := range rows {
+		if !p.fits(pdfRowHeight) {
+			pdf.AddPage()
+			p.tableHeader(table.Columns, widths)
+		}
+		p.tableRow(table.Columns, widths, maxima, row, i%2 == 1, false)
+	}
+	if len(rows) == 0 {
+		pdf.SetFont("Helvetica", "I", 9)
+		pdf.CellFormat(0, pdfRowHeight, "No data", "", 1, "L", false, 0, "")
+	}
+
+	if table.hasTotals() {
+		if !p.fits(pdfRowHeight) {
+			pdf.AddPage()
+			p.tableHeader(table.Columns, widths)
+		}
+		p.tableRow(table.Columns, widths, nil, sums.row(table.Columns), false, true)
+	}
+	pdf.Ln(6)
+	return nil
+}
+
+// tableHeader draws the header row of a table
+func (p *pdfWriter) tableHeader(columns []Column, widths []float64) {
+	pdf := p.pdf
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.SetFillColor(48, 84, 150)
+	pdf.SetTextColor(255, 255, 255)
+	for i, column := range columns {
+		pdf.CellFormat(widths[i], pdfRowHeight+1, p.fit(column.Title, widths[i]), "", 0, alignment(column), true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// tableRow draws a body or totals row. Bar cells get a bar scaled to the
+// maximum of their column behind the value.
+func (p *pdfWriter) tableRow(columns []Column, widths, maxima []float64, values []interface{}, shaded, total bool) {
+	pdf := p.pdf
+	style := ""
+	border := ""
+	if total {
+		style = "B"
+		border = "T"
+	}
+	pdf.SetFont("Helvetica", style, 8)
+	pdf.SetFillColor(242, 245, 250)
+	pdf.SetDrawColor(0, 0, 0)
+
+	y := pdf.GetY()
+	for i, column := range columns {
+		var value interface{}
+		if i < len(values) {
+			value = values[i]
+		}
+		x := pdf.GetX()
+
+		if shaded {
+			pdf.Rect(x, y, widths[i], pdfRowHeight, "F")
+		}
+		if column.Bar && maxima != nil && maxima[i] > 0 {
+			if number, ok := toFloat(value); ok && number != 0 {
+				if number < 0 {
+					pdf.SetFillColor(226, 107, 10)
+				} else {
+					pdf.SetFillColor(91, 155, 213)
+				}
+				pdf.Rect(x+1, y+1, (widths[i]-2)*math.Abs(number)/maxima[i], pdfRowHeight-2, "F")
+				pdf.SetFillColor(242, 245, 250)
+			}
+		}
+
+		pdf.SetXY(x, y)
+		text := p.fit(displayValue(column, value), widths[i])
+		pdf.CellFormat(widths[i], pdfRowHeight, text, border, 0, alignment(column), false, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+// columnWidths spreads the page width over the columns by relative width
+func (p *pdfWriter) columnWidths(columns []Column) []float64 {
+	total := 0.0
+	for _, column := range columns {
+		total += column.width()
+	}
+
+	widths := make([]float64, len(columns))
+	for i, column := range columns {
+		widths[i] = p.contentWidth() * column.width() / total
+	}
+	return widths
+}
+
+// fits reports whether a block of a height fits above the footer
+func (p *pdfWriter) fits(height float64) bool {
+	_, pageHeight := p.pdf.GetPageSize()
+	return p.pdf.GetY()+height <= pageHeight-pdfMargin-4
+}
+
+// contentWidth is the page width inside the margins
+func (p *pdfWriter) contentWidth() float64 {
+	pageWidth, _ := p.pdf.GetPageSize()
+	return pageWidth - 2*pdfMargin
+}
+
+// fit translates a text and shortens it to fit a cell width
+func (p *pdfWriter) fit(text string, width float64) string {
+	text = p.tr(text)
+	limit := width - 2*p.pdf.GetCellMargin()
+	if p.pdf.GetStringWidth(text) <= limit {
+		return text
+	}
+	for len(text) > 0 && p.pdf.GetStringWidth(text+"...") > limit {
+		text = text[:len(text)-1]
+	}
+	return text + "..."
+}
+
+// alignment aligns numbers right and text left
+func alignment(column Column) string {
+	if column.Type.numeric() {
+		return "R"
+	}
+	return "L"
+}
@@ -0,0 +1,285 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Excel limits sheet names to 31 characters without these characters
+const maxSheetName = 31
+
+var sheetNameReplacer = strings.NewReplacer(":", " ", `\`, " ", "/", " ", "?", " ", "*", " ", "[", "(", "]", ")")
+
+// xlsxStyles are the cell styles of a workbook
+type xlsxStyles struct {
+	title  int
+	header int
+	label  int
+	body   map[ColumnType]int
+	total  map[ColumnType]int
+}
+
+// writeXLSX writes a document as a workbook with a summary sheet when the
+// document has figures and one sheet per table. Sheets are written with a
+// stream writer, which keeps large tables on disk instead of in memory.
+func writeXLSX(w io.Writer, doc *Document) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	styles, err := newXLSXStyles(f)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	first := true
+	addSheet := func(title string) (string, error) {
+		name := sheetName(title, names)
+		if first {
+			first = false
+			return name, f.SetSheetName("Sheet1", name)
+		}
+		_, err := f.NewSheet(name)
+		return name, err
+	}
+
+	if len(doc.Figures) > 0 {
+		name, err := addSheet("Summary")
+		if err != nil {
+			return fmt.Errorf("failed to add summary sheet: %w", err)
+		}
+		if err := writeXLSXSummary(f, name, doc, styles); err != nil {
+			return err
+		}
+	}
+
+	for i := range doc.Tables {
+		table := &doc.Tables[i]
+		name, err := addSheet(table.Title)
+		if err != nil {
+			return fmt.Errorf("failed to add sheet %q: %w", table.Title, err)
+		}
+		if err := writeXLSXTable(f, name, table, styles); err != nil {
+			return err
+		}
+	}
+
+	f.SetActiveSheet(0)
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("failed to write XLSX export: %w", err)
+	}
+	return nil
+}
+
+// newXLSXStyles registers the styles of the header, body and totals cells
+func newXLSXStyles(f *excelize.File) (*xlsxStyles, error) {
+	formats := map[ColumnType]excelize.Style{
+		Text:     {},
+		Integer:  {NumFmt: 3}, // #,##0
+		Number:   {NumFmt: 4}, // #,##0.00
+		Currency: {CustomNumFmt: stringPtr("#,##0.00;[Red]-#,##0.00")},
+		Percent:  {CustomNumFmt: stringPtr(`0.0"%"`)},
+		Date:     {CustomNumFmt: stringPtr("yyyy-mm-dd hh:mm")},
+	}
+
+	styles := &xlsxStyles{body: map[ColumnType]int{}, total: map[ColumnType]int{}}
+	var err error
+	newStyle := func(style excelize.Style) int {
+		if err != nil {
+			return 0
+		}
+		var id int
+		id, err = f.NewStyle(&style)
+		return id
+	}
+
+	styles.title = newStyle(excelize.Style{Font: &excelize.Font{Bold: true, Size: 14}})
+	styles.label = newStyle(excelize.Style{Font: &excelize.Font{Bold: true}})
+	styles.header = newStyle(excelize.Style{
+		Font:   &excelize.Font{Bold: true, Color: "FFFFFF"},
+		Fill:   excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"305496"}},
+		Border: []excelize.Border{{Type: "bottom", Color: "1F3864", Style: 1}},
+	})
+	for columnType, style := range formats {
+		styles.body[columnType] = newStyle(style)
+
+		style.Font = &excelize.Font{Bold: true}
+		style.Border = []excelize.Border{{Type: "top", Color: "000000", Style: 1}}
+		styles.total[columnType] = newStyle(style)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create XLSX styles: %w", err)
+	}
+	return styles, nil
+}
+
+// writeXLSXSummary writes the title, subtitle and figures of a document
+func writeXLSXSummary(f *excelize.File, sheet string, doc *Document, styles *xlsxStyles) error {
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to open summary sheet: %w", err)
+	}
+	sw.SetColWidth(1, 1, 32)
+	sw.SetColWidth(2, 2, 20)
+
+	rows := [][]interface{}{
+		{excelize.Cell{StyleID: styles.title, Value: doc.Title}},
+		{doc.Subtitle},
+		{"Generated", excelize.Cell{StyleID: styles.body[Date], Value: doc.GeneratedAt.UTC()}},
+		nil,
+	}
+	for _, figure := range doc.Figures {
+		rows = append(rows, []interface{}{
+			excelize.Cell{StyleID: styles.label, Value: figure.Label},
+			excelize.Cell{StyleID: styles.body[figure.Type], Value: xlsxValue(figure.Type, figure.Value)},
+		})
+	}
+
+	for i, row := range rows {
+		if err := sw.SetRow(cellName(1, i+1), row); err != nil {
+			return fmt.Errorf("failed to write summary row: %w", err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("failed to write summary sheet: %w", err)
+	}
+	return nil
+}
+
+// writeXLSXTable writes a table with a frozen header row and a totals row
+// made of SUM formulas, with the totals as cached values
+func writeXLSXTable(f *excelize.File, sheet string, table *Table, styles *xlsxStyles) error {
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to open sheet %q: %w", sheet, err)
+	}
+
+	header := make([]interface{}, len(table.Columns))
+	for i, column := range table.Columns {
+		width := 14.0
+		if column.Type == Text {
+			width = 24
+		}
+		if column.Type == Date {
+			width = 18
+		}
+		sw.SetColWidth(i+1, i+1, width*column.width())
+		header[i] = excelize.Cell{StyleID: styles.header, Value: column.Title}
+	}
+	sw.SetPanes(&excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+		Selection:   []excelize.Selection{{SQRef: "A2", ActiveCell: "A2", Pane: "bottomLeft"}},
+	})
+	if err := sw.SetRow("A1", header); err != nil {
+		return fmt.Errorf("failed to write header of %q: %w", sheet, err)
+	}
+
+	sums := make(totals, len(table.Columns))
+	row := 1
+	err = table.Rows(func(values ...interface{}) error {
+		cells := make([]interface{}, len(table.Columns))
+		for i, column := range table.Columns {
+			if i < len(values) && !isNil(values[i]) {
+				cells[i] = excelize.Cell{StyleID: styles.body[column.Type], Value: xlsxValue(column.Type, values[i])}
+			}
+		}
+		row++
+		if err := sw.SetRow(cellName(1, row), cells); err != nil {
+			return fmt.Errorf("failed to write row of %q: %w", sheet, err)
+		}
+		sums.add(table.Columns, values)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if table.hasTotals() {
+		cells := make([]interface{}, len(table.Columns))
+		for i, value := range sums.row(table.Columns) {
+			column := table.Columns[i]
+			cell := excelize.Cell{StyleID: styles.total[column.Type], Value: value}
+			if column.Total {
+				cell.Value = xlsxValue(column.Type, value)
+				if row > 1 {
+					cell.Formula = fmt.Sprintf("SUM(%s:%s)", cellName(i+1, 2), cellName(i+1, row))
+				}
+			}
+			if value != nil {
+				cells[i] = cell
+			}
+		}
+		if err := sw.SetRow(cellName(1, row+1), cells); err != nil {
+			return fmt.Errorf("failed to write totals of %q: %w", sheet, err)
+		}
+	}
+
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("failed to write sheet %q: %w", sheet, err)
+	}
+	return nil
+}
+
+// xlsxValue converts a value to the cell value of its column type
+func xlsxValue(columnType ColumnType, value interface{}) interface{} {
+	if isNil(value) {
+		return nil
+	}
+	if columnType.numeric() {
+		if number, ok := toFloat(value); ok {
+			if columnType == Integer {
+				return int64(math.Round(number))
+			}
+			return number
+		}
+	}
+	if columnType == Date {
+		if t, ok := toTime(value); ok {
+			return t.UTC()
+		}
+	}
+	if columnType == Text {
+		return escapeFormula(fmt.Sprint(value))
+	}
+	return value
+}
+
+// sheetName returns a valid sheet name for a title that is not yet used
+func sheetName(title string, used map[string]bool) string {
+	base := strings.TrimSpace(sheetNameReplacer.Replace(title))
+	if base == "" {
+		base = "Sheet"
+	}
+	if len(base) > maxSheetName {
+		base = base[:maxSheetName]
+	}
+
+	name := base
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		if len(base)+len(suffix) > maxSheetName {
+			name = base[:maxSheetName-len(suffix)] + suffix
+		} else {
+			name = base + suffix
+		}
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// cellName returns the name of a cell such as B3
+func cellName(col, row int) string {
+	name, _ := excelize.CoordinatesToCellName(col, row)
+	return name
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -10,5 +10,10 @@ require (
 	github.com/segmentio/kafka-go v0.4.42
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/google/uuid v1.3.1
+	github.com/stretchr/testify v1.8.4
 	go.uber.org/zap v1.25.0
+	github.com/alicebob/miniredis/v2 v2.30.4
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/xuri/excelize/v2 v2.8.1
+	github.com/jung-kurt/gofpdf v1.16.2
 )
\ No newline at end of file
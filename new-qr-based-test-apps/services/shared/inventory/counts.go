@@ -0,0 +1,903 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// Errors returned by the count store
+var (
+	ErrInvalidCount    = errors.New("invalid count task")
+	ErrCountNotFound   = errors.New("count task not found")
+	ErrCountStatus     = errors.New("count task status does not allow it")
+	ErrCountAssignee   = errors.New("count task is assigned to another operator")
+	ErrCountIncomplete = errors.New("count task has bins left to count")
+	ErrUnknownBarcode  = errors.New("barcode matches no bin or item")
+)
+
+// CountReason is the reason of the adjustments posted by count tasks
+const CountReason = "cycle count"
+
+// Defaults of generated count tasks: the days of issues ABC classes are
+// computed over and the items of a random sample
+const (
+	DefaultClassDays  = 90
+	DefaultSampleSize = 10
+)
+
+// scanning are the statuses of a task its operator records counts in
+var scanning = []string{models.CountOpen, models.CountInProgress}
+
+// CountThreshold is the variance of a count line from which its adjustment
+// waits for approval, in units or in value at cost. Zero means no limit.
+type CountThreshold struct {
+	Units int
+	Value float64
+}
+
+// exceeds tells whether the variance of a line needs approval
+func (t CountThreshold) exceeds(line *models.CountLine) bool {
+	units := line.Variance
+	if units < 0 {
+		units = -units
+	}
+	return (t.Units > 0 && units > t.Units) || (t.Value > 0 && math.Abs(line.VarianceValue) > t.Value)
+}
+
+// NewCountTask is a count task to generate
+type NewCountTask struct {
+	Method     string
+	Location   string // location whose bins a zone task counts
+	Class      string // class an ABC task counts
+	Days       int    // days of issues ABC classes are computed over
+	Size       int    // items a random task counts
+	AssignedTo string
+	UserID     string
+}
+
+// validate checks a new count task and fills in its defaults
+func (n *NewCountTask) validate() error {
+	switch n.Method {
+	case models.CountByZone:
+		if n.Location == "" {
+			return fmt.Errorf("%w: zone counts need a location", ErrInvalidCount)
+		}
+		if _, err := ParseLocation(n.Location); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCount, err)
+		}
+	case models.CountByClass:
+		if !containsString([]string{models.ClassA, models.ClassB, models.ClassC}, n.Class) {
+			return fmt.Errorf("%w: class must be A, B or C", ErrInvalidCount)
+		}
+		if n.Days == 0 {
+			n.Days = DefaultClassDays
+		}
+		if n.Days < 1 || n.Days > 365 {
+			return fmt.Errorf("%w: days must be from 1 to 365", ErrInvalidCount)
+		}
+	case models.CountAtRandom:
+		if n.Size == 0 {
+			n.Size = DefaultSampleSize
+		}
+		if n.Size < 1 || n.Size > 100 {
+			return fmt.Errorf("%w: size must be from 1 to 100", ErrInvalidCount)
+		}
+	default:
+		return fmt.Errorf("%w: unknown method %q", ErrInvalidCount, n.Method)
+	}
+	if n.AssignedTo == "" {
+		return fmt.Errorf("%w: assignedTo is required", ErrInvalidCount)
+	}
+	return nil
+}
+
+// CountScan is the outcome of a scan: the task, the bin being counted and,
+// when an item was scanned, its line
+type CountScan struct {
+	Task *models.CountTask `json:"task"`
+	Bin  string            `json:"bin"`
+	Line *models.CountLine `json:"line,omitempty"`
+}
+
+// adjusted is an adjustment posted by a count, published once committed
+type adjusted struct {
+	movement Movement
+	entry    *Entry
+}
+
+// Counts generates cycle count tasks and records their scans. Submitted
+// counts are compared with the stock of their bins; variances within the
+// threshold are posted as adjustments right away, the others wait for a
+// supervisor to approve or reject them.
+type Counts struct {
+	client    *mongo.Client
+	tasks     *mongo.Collection
+	items     *mongo.Collection
+	bins      *mongo.Collection
+	movements *mongo.Collection
+	ledger    *Ledger
+	threshold CountThreshold
+}
+
+// NewCounts creates a new count store posting adjustments through a ledger
+func NewCounts(db *database.MongoDB, ledger *Ledger, threshold CountThreshold) *Counts {
+	return &Counts{
+		client:    db.Client,
+		tasks:     db.GetCollection(database.CountTasksCollection),
+		items:     db.GetCollection(database.ItemsCollection),
+		bins:      db.GetCollection(database.BinStockCollection),
+		movements: db.GetCollection(database.StockMovementsCollection),
+		ledger:    ledger,
+		threshold: threshold,
+	}
+}
+
+// EnsureIndexes creates the indexes of the task lists
+func (s *Counts) EnsureIndexes(ctx context.Context) error {
+	_, err := s.tasks.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "assignedTo", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create count task indexes: %w", err)
+	}
+	return nil
+}
+
+// Generate creates an open count task of every bin holding the items it
+// selects: the stock within a location, the items of an ABC class or a
+// random sample of items. Serialized items are counted by their units and
+// are left out.
+func (s *Counts) Generate(ctx context.Context, n NewCountTask) (*models.CountTask, error) {
+	if err := n.validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	match := bson.M{}
+	task := &models.CountTask{
+		ID:         primitive.NewObjectID(),
+		Method:     n.Method,
+		Status:     models.CountOpen,
+		Counted:    []string{},
+		AssignedTo: n.AssignedTo,
+		CreatedBy:  n.UserID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	switch n.Method {
+	case models.CountByZone:
+		task.Scope = n.Location
+		match["location"] = Within(n.Location)
+	case models.CountByClass:
+		task.Scope = n.Class
+		classes, err := s.classes(ctx, now.AddDate(0, 0, -n.Days))
+		if err != nil {
+			return nil, err
+		}
+		itemIDs := []string{}
+		for itemID, class := range classes {
+			if class == n.Class {
+				itemIDs = append(itemIDs, itemID)
+			}
+		}
+		match["itemId"] = bson.M{"$in": itemIDs}
+	case models.CountAtRandom:
+		itemIDs, err := s.sample(ctx, n.Size)
+		if err != nil {
+			return nil, err
+		}
+		match["itemId"] = bson.M{"$in": itemIDs}
+	}
+
+	stock, err := s.stock(ctx, match)
+	if err != nil {
+		return nil, err
+	}
+	itemIDs := make([]string, 0, len(stock))
+	for itemID := range stock {
+		itemIDs = append(itemIDs, itemID)
+	}
+	items, err := s.itemsByID(ctx, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	task.Lines = countLines(stock, items)
+	if len(task.Lines) == 0 {
+		return nil, fmt.Errorf("%w: no stock to count", ErrInvalidCount)
+	}
+	task.Bins = binsOf(task.Lines)
+
+	if _, err := s.tasks.InsertOne(ctx, task); err != nil {
+		return nil, fmt.Errorf("failed to create count task: %w", err)
+	}
+	return task, nil
+}
+
+// countLines lists the stock per item and bin of the items that are not
+// serialized, by bin and then item
+func countLines(stock map[string]map[string]int, items map[string]models.Item) []models.CountLine {
+	lines := []models.CountLine{}
+	for itemID, bins := range stock {
+		item, ok := items[itemID]
+		if !ok || item.Serialized {
+			continue
+		}
+		for location, quantity := range bins {
+			lines = append(lines, models.CountLine{
+				ItemID:   itemID,
+				Name:     item.Name,
+				Location: location,
+				Expected: quantity,
+			})
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Location != lines[j].Location {
+			return lines[i].Location < lines[j].Location
+		}
+		return lines[i].ItemID < lines[j].ItemID
+	})
+	return lines
+}
+
+// binsOf returns the bins of count lines in their order
+func binsOf(lines []models.CountLine) []string {
+	bins := []string{}
+	for i := range lines {
+		if !containsString(bins, lines[i].Location) {
+			bins = append(bins, lines[i].Location)
+		}
+	}
+	return bins
+}
+
+// classes returns the ABC class of the active items by the value at cost
+// of their issues since a time
+func (s *Counts) classes(ctx context.Context, since time.Time) (map[string]string, error) {
+	cursor, err := s.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"type": models.MovementIssue, "createdAt": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$itemId",
+			"value": bson.M{"$sum": bson.M{"$multiply": bson.A{-1, "$quantity", "$unitCost"}}},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute issue values: %w", err)
+	}
+	var rows []struct {
+		ItemID string  `bson:"_id"`
+		Value  float64 `bson:"value"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode issue values: %w", err)
+	}
+	values := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		values[row.ItemID] = row.Value
+	}
+
+	cursor, err = s.items.Find(ctx, bson.M{"status": "active"}, options.Find().SetProjection(bson.M{"itemId": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find items: %w", err)
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+	itemIDs := make([]string, len(items))
+	for i := range items {
+		itemIDs[i] = items[i].ItemID
+	}
+	return classify(itemIDs, values), nil
+}
+
+// classify sorts items by value, highest first. Items before 80% of the
+// total value are A items, items before 95% B items and the rest, and items
+// of no value, C items.
+func classify(itemIDs []string, values map[string]float64) map[string]string {
+	sorted := append([]string(nil), itemIDs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if values[sorted[i]] != values[sorted[j]] {
+			return values[sorted[i]] > values[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	total := 0.0
+	for _, itemID := range sorted {
+		total += values[itemID]
+	}
+
+	classes := make(map[string]string, len(sorted))
+	cumulative := 0.0
+	for _, itemID := range sorted {
+		value := values[itemID]
+		switch {
+		case value <= 0:
+			classes[itemID] = models.ClassC
+		case cumulative < 0.8*total:
+			classes[itemID] = models.ClassA
+		case cumulative < 0.95*total:
+			classes[itemID] = models.ClassB
+		default:
+			classes[itemID] = models.ClassC
+		}
+		cumulative += value
+	}
+	return classes
+}
+
+// sample returns the IDs of a random sample of the active items in stock
+// that are not serialized
+func (s *Counts) sample(ctx context.Context, size int) ([]string, error) {
+	cursor, err := s.items.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": "active", "stockLevel": bson.M{"$gt": 0}, "serialized": bson.M{"$ne": true}}}},
+		{{Key: "$sample", Value: bson.M{"size": size}}},
+		{{Key: "$project", Value: bson.M{"itemId": 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample items: %w", err)
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+	itemIDs := make([]string, len(items))
+	for i := range items {
+		itemIDs[i] = items[i].ItemID
+	}
+	return itemIDs, nil
+}
+
+// stock returns the quantity per item and bin of the matching bin stock,
+// over all lots
+func (s *Counts) stock(ctx context.Context, match bson.M) (map[string]map[string]int, error) {
+	match["quantity"] = bson.M{"$gt": 0}
+	cursor, err := s.bins.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"itemId": "$itemId", "location": "$location"},
+			"quantity": bson.M{"$sum": "$quantity"},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum bin stock: %w", err)
+	}
+	var rows []struct {
+		ID struct {
+			ItemID   string `bson:"itemId"`
+			Location string `bson:"location"`
+		} `bson:"_id"`
+		Quantity int `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode bin stock: %w", err)
+	}
+
+	stock := map[string]map[string]int{}
+	for _, row := range rows {
+		if stock[row.ID.ItemID] == nil {
+			stock[row.ID.ItemID] = map[string]int{}
+		}
+		stock[row.ID.ItemID][row.ID.Location] += row.Quantity
+	}
+	return stock, nil
+}
+
+// itemsByID returns items by item ID
+func (s *Counts) itemsByID(ctx context.Context, itemIDs []string) (map[string]models.Item, error) {
+	cursor, err := s.items.Find(ctx, bson.M{"itemId": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find items: %w", err)
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+
+	byID := make(map[string]models.Item, len(items))
+	for _, item := range items {
+		byID[item.ItemID] = item
+	}
+	return byID, nil
+}
+
+// Get returns a count task
+func (s *Counts) Get(ctx context.Context, id primitive.ObjectID) (*models.CountTask, error) {
+	var task models.CountTask
+	err := s.tasks.FindOne(ctx, bson.M{"_id": id}).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrCountNotFound, id.Hex())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get count task: %w", err)
+	}
+	return &task, nil
+}
+
+// CountFilter selects the count tasks of List
+type CountFilter struct {
+	Status     string
+	AssignedTo string
+	Method     string
+}
+
+// query builds the MongoDB filter of a count filter
+func (f CountFilter) query() bson.M {
+	query := bson.M{}
+	if f.Status != "" {
+		query["status"] = f.Status
+	}
+	if f.AssignedTo != "" {
+		query["assignedTo"] = f.AssignedTo
+	}
+	if f.Method != "" {
+		query["method"] = f.Method
+	}
+	return query
+}
+
+// List returns a page of count tasks, newest first, and the total number
+// of matches
+func (s *Counts) List(ctx context.Context, filter CountFilter, offset, limit int) ([]models.CountTask, int64, error) {
+	query := filter.query()
+	total, err := s.tasks.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count count tasks: %w", err)
+	}
+
+	cursor, err := s.tasks.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list count tasks: %w", err)
+	}
+
+	tasks := []models.CountTask{}
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode count tasks: %w", err)
+	}
+	return tasks, total, nil
+}
+
+// Cursor opens a cursor over every matching count task, newest first, for
+// exports
+func (s *Counts) Cursor(ctx context.Context, filter CountFilter) (*mongo.Cursor, error) {
+	cursor, err := s.tasks.Find(ctx, filter.query(), options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list count tasks: %w", err)
+	}
+	return cursor, nil
+}
+
+// Assign hands a task that is not submitted yet to another operator
+func (s *Counts) Assign(ctx context.Context, id primitive.ObjectID, assignedTo string) (*models.CountTask, error) {
+	if assignedTo == "" {
+		return nil, fmt.Errorf("%w: assignedTo is required", ErrInvalidCount)
+	}
+	return s.update(ctx, bson.M{"_id": id, "status": bson.M{"$in": scanning}},
+		bson.M{"$set": bson.M{"assignedTo": assignedTo, "updatedAt": time.Now()}})
+}
+
+// Cancel cancels a task that is not submitted yet. Nothing was posted.
+func (s *Counts) Cancel(ctx context.Context, id primitive.ObjectID, userID string) (*models.CountTask, error) {
+	now := time.Now()
+	return s.update(ctx, bson.M{"_id": id, "status": bson.M{"$in": scanning}},
+		bson.M{"$set": bson.M{"status": models.CountCancelled, "reviewedBy": userID, "reviewedAt": now, "updatedAt": now}})
+}
+
+// update applies an update to the task the filter matches, telling a
+// missing task from one in another status
+func (s *Counts) update(ctx context.Context, filter, update bson.M) (*models.CountTask, error) {
+	var task models.CountTask
+	err := s.tasks.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		id := filter["_id"].(primitive.ObjectID)
+		current, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: task %s is %s", ErrCountStatus, id.Hex(), current.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update count task: %w", err)
+	}
+	return &task, nil
+}
+
+// scannable loads a task its operator can record counts in
+func (s *Counts) scannable(ctx context.Context, id primitive.ObjectID, userID string) (*models.CountTask, error) {
+	task, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(scanning, task.Status) {
+		return nil, fmt.Errorf("%w: task %s is %s", ErrCountStatus, id.Hex(), task.Status)
+	}
+	if task.AssignedTo != userID {
+		return nil, fmt.Errorf("%w: task %s", ErrCountAssignee, id.Hex())
+	}
+	return task, nil
+}
+
+// isBin tells whether a barcode is a bin of a task: one of its bins or,
+// for a zone task, any bin within its location
+func isBin(task *models.CountTask, barcode string) bool {
+	if containsString(task.Bins, barcode) {
+		return true
+	}
+	if task.Method != models.CountByZone {
+		return false
+	}
+	location, err := ParseLocation(barcode)
+	if err != nil || location.Level != models.LevelBin {
+		return false
+	}
+	return strings.HasPrefix(barcode, task.Scope+models.LocationSeparator)
+}
+
+// Scan records a scan of a task's operator. A bin barcode starts counting
+// that bin; an item barcode or ID then adds a quantity, 1 when zero, to
+// the count of the item in it. Items not expected in the bin get a line of
+// their own.
+func (s *Counts) Scan(ctx context.Context, id primitive.ObjectID, userID, barcode string, quantity int) (*CountScan, error) {
+	if barcode == "" {
+		return nil, fmt.Errorf("%w: barcode is required", ErrInvalidCount)
+	}
+	if quantity == 0 {
+		quantity = 1
+	}
+	if quantity < 0 {
+		return nil, fmt.Errorf("%w: scanned quantity must be positive, recount to correct", ErrInvalidCount)
+	}
+
+	task, err := s.scannable(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if isBin(task, barcode) {
+		task, err = s.update(ctx, bson.M{"_id": id, "status": bson.M{"$in": scanning}, "assignedTo": userID}, bson.M{
+			"$set":      bson.M{"currentBin": barcode, "status": models.CountInProgress, "updatedAt": now},
+			"$addToSet": bson.M{"bins": barcode, "counted": barcode},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &CountScan{Task: task, Bin: barcode}, nil
+	}
+
+	if task.CurrentBin == "" {
+		return nil, fmt.Errorf("%w: scan a bin before its items", ErrInvalidCount)
+	}
+	var item models.Item
+	err = s.items.FindOne(ctx, bson.M{"$or": bson.A{bson.M{"barcode": barcode}, bson.M{"itemId": barcode}}}).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBarcode, barcode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find item: %w", err)
+	}
+	if item.Serialized {
+		return nil, invalid("%s is serialized, its units are counted by serial number", item.ItemID)
+	}
+
+	bin := task.CurrentBin
+	line := bson.M{"itemId": item.ItemID, "location": bin}
+	filter := bson.M{"_id": id, "status": models.CountInProgress, "assignedTo": userID, "currentBin": bin}
+	var update bson.M
+	var opts *options.FindOneAndUpdateOptions
+	if containsLine(task.Lines, item.ItemID, bin) {
+		filter["lines"] = bson.M{"$elemMatch": line}
+		update = bson.M{
+			"$inc": bson.M{"lines.$[line].counted": quantity},
+			"$set": bson.M{"updatedAt": now},
+		}
+		opts = options.FindOneAndUpdate().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"line.itemId": item.ItemID, "line.location": bin}},
+		})
+	} else {
+		filter["lines"] = bson.M{"$not": bson.M{"$elemMatch": line}}
+		update = bson.M{
+			"$push": bson.M{"lines": models.CountLine{ItemID: item.ItemID, Name: item.Name, Location: bin, Counted: &quantity}},
+			"$set":  bson.M{"updatedAt": now},
+		}
+		opts = options.FindOneAndUpdate()
+	}
+
+	var updated models.CountTask
+	err = s.tasks.FindOneAndUpdate(ctx, filter, update, opts.SetReturnDocument(options.After)).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: task %s changed while scanning, scan again", ErrCountStatus, id.Hex())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record count: %w", err)
+	}
+	return &CountScan{Task: &updated, Bin: bin, Line: findLine(updated.Lines, item.ItemID, bin)}, nil
+}
+
+// Recount sets the counted quantity of an item in a bin that was counted,
+// correcting its scans
+func (s *Counts) Recount(ctx context.Context, id primitive.ObjectID, userID, itemID, location string, counted int) (*models.CountTask, error) {
+	if counted < 0 {
+		return nil, fmt.Errorf("%w: counted quantity must not be negative", ErrInvalidCount)
+	}
+	task, err := s.scannable(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsLine(task.Lines, itemID, location) {
+		return nil, fmt.Errorf("%w: %s is not counted in %s", ErrInvalidCount, itemID, location)
+	}
+	if !containsString(task.Counted, location) {
+		return nil, fmt.Errorf("%w: scan bin %s before recounting it", ErrInvalidCount, location)
+	}
+
+	var updated models.CountTask
+	err = s.tasks.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.CountInProgress, "assignedTo": userID},
+		bson.M{"$set": bson.M{"lines.$[line].counted": counted, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().
+			SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"line.itemId": itemID, "line.location": location}}}).
+			SetReturnDocument(options.After)).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: task %s changed while recounting", ErrCountStatus, id.Hex())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record count: %w", err)
+	}
+	return &updated, nil
+}
+
+// containsLine tells whether a task has a line of an item in a bin
+func containsLine(lines []models.CountLine, itemID, location string) bool {
+	return findLine(lines, itemID, location) != nil
+}
+
+// findLine returns the line of an item in a bin, nil without one
+func findLine(lines []models.CountLine, itemID, location string) *models.CountLine {
+	for i := range lines {
+		if lines[i].ItemID == itemID && lines[i].Location == location {
+			return &lines[i]
+		}
+	}
+	return nil
+}
+
+// Submit closes the count of a task once all of its bins are counted. The
+// items of a counted bin that were not scanned count as zero. Variances
+// are taken against what the bins hold now; those within the threshold
+// are posted as adjustments under the task ID, the others wait for
+// approval.
+func (s *Counts) Submit(ctx context.Context, id primitive.ObjectID, userID string) (*models.CountTask, error) {
+	var task *models.CountTask
+	var posted []adjusted
+	err := transaction(ctx, s.client, func(sc mongo.SessionContext) error {
+		var err error
+		task, posted, err = s.submit(sc, id, userID, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publish(ctx, posted)
+	return task, nil
+}
+
+// submit computes the variances of a task and posts those within the
+// threshold
+func (s *Counts) submit(ctx context.Context, id primitive.ObjectID, userID string, now time.Time) (*models.CountTask, []adjusted, error) {
+	task, err := s.scannable(ctx, id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if task.Status != models.CountInProgress {
+		return nil, nil, fmt.Errorf("%w: task %s has no counts", ErrCountStatus, id.Hex())
+	}
+	var left []string
+	for _, bin := range task.Bins {
+		if !containsString(task.Counted, bin) {
+			left = append(left, bin)
+		}
+	}
+	if len(left) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCountIncomplete, strings.Join(left, ", "))
+	}
+
+	itemIDs := make([]string, 0, len(task.Lines))
+	for i := range task.Lines {
+		if !containsString(itemIDs, task.Lines[i].ItemID) {
+			itemIDs = append(itemIDs, task.Lines[i].ItemID)
+		}
+	}
+	stock, err := s.stock(ctx, bson.M{"itemId": bson.M{"$in": itemIDs}, "location": bson.M{"$in": task.Counted}})
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := s.itemsByID(ctx, itemIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	task.Variances = variances(task.Lines, stock, items, s.threshold)
+
+	var posted []adjusted
+	status := models.CountPosted
+	for i := range task.Lines {
+		line := &task.Lines[i]
+		switch line.Adjustment {
+		case models.AdjustmentPending:
+			status = models.CountPendingApproval
+		case models.AdjustmentPosted:
+			done, err := s.post(ctx, task, line, userID, now)
+			if err != nil {
+				return nil, nil, err
+			}
+			posted = append(posted, *done)
+		}
+	}
+
+	task.Status = status
+	task.CurrentBin = ""
+	task.SubmittedAt = &now
+	task.UpdatedAt = now
+	result, err := s.tasks.ReplaceOne(ctx, bson.M{"_id": id, "status": models.CountInProgress}, task)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to submit count task: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, nil, fmt.Errorf("%w: task %s changed while submitting", ErrCountStatus, id.Hex())
+	}
+	return task, posted, nil
+}
+
+// variances sets the expected stock, variance and adjustment of count
+// lines and sums them up per item against its stock level. Adjustments
+// within the threshold are marked posted, the others pending.
+func variances(lines []models.CountLine, stock map[string]map[string]int, items map[string]models.Item, threshold CountThreshold) []models.CountVariance {
+	var sums []models.CountVariance
+	byItem := map[string]int{}
+	for i := range lines {
+		line := &lines[i]
+		if line.Counted == nil {
+			zero := 0
+			line.Counted = &zero
+		}
+		item := items[line.ItemID]
+		line.Expected = stock[line.ItemID][line.Location]
+		line.Variance = *line.Counted - line.Expected
+		line.VarianceValue = math.Round(float64(line.Variance)*item.CostPrice*100) / 100
+		switch {
+		case line.Variance == 0:
+			line.Adjustment = ""
+		case threshold.exceeds(line):
+			line.Adjustment = models.AdjustmentPending
+		default:
+			line.Adjustment = models.AdjustmentPosted
+		}
+
+		index, ok := byItem[line.ItemID]
+		if !ok {
+			index = len(sums)
+			byItem[line.ItemID] = index
+			sums = append(sums, models.CountVariance{ItemID: line.ItemID, StockLevel: item.StockLevel})
+		}
+		sums[index].Variance += line.Variance
+		sums[index].Value += line.VarianceValue
+	}
+	for i := range sums {
+		sums[i].Counted = sums[i].StockLevel + sums[i].Variance
+		sums[i].Value = math.Round(sums[i].Value*100) / 100
+	}
+	return sums
+}
+
+// post records the adjustment of a count line in the stock ledger
+func (s *Counts) post(ctx context.Context, task *models.CountTask, line *models.CountLine, userID string, now time.Time) (*adjusted, error) {
+	m := Movement{
+		ItemID:    line.ItemID,
+		Type:      models.MovementAdjustment,
+		Quantity:  line.Variance,
+		Location:  line.Location,
+		Reason:    CountReason,
+		Reference: task.ID.Hex(),
+		UserID:    userID,
+		Recount:   true,
+	}
+	legs, err := m.legs()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.ledger.apply(ctx, &m, legs, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, movement := range entry.Movements {
+		line.MovementIDs = append(line.MovementIDs, movement.ID)
+	}
+	line.Adjustment = models.AdjustmentPosted
+	return &adjusted{movement: m, entry: entry}, nil
+}
+
+// Review approves or rejects the adjustments of a task waiting for
+// approval. Approved adjustments are posted by the reviewer; rejected
+// ones leave the stock as it is.
+func (s *Counts) Review(ctx context.Context, id primitive.ObjectID, userID string, approve bool) (*models.CountTask, error) {
+	var task *models.CountTask
+	var posted []adjusted
+	err := transaction(ctx, s.client, func(sc mongo.SessionContext) error {
+		var err error
+		task, posted, err = s.review(sc, id, userID, approve, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publish(ctx, posted)
+	return task, nil
+}
+
+// review posts or rejects the pending adjustments of a task
+func (s *Counts) review(ctx context.Context, id primitive.ObjectID, userID string, approve bool, now time.Time) (*models.CountTask, []adjusted, error) {
+	task, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if task.Status != models.CountPendingApproval {
+		return nil, nil, fmt.Errorf("%w: task %s is %s", ErrCountStatus, id.Hex(), task.Status)
+	}
+
+	var posted []adjusted
+	for i := range task.Lines {
+		line := &task.Lines[i]
+		if line.Adjustment != models.AdjustmentPending {
+			continue
+		}
+		if !approve {
+			line.Adjustment = models.AdjustmentRejected
+			continue
+		}
+		done, err := s.post(ctx, task, line, userID, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		posted = append(posted, *done)
+	}
+
+	task.Status = models.CountPosted
+	task.ReviewedBy = userID
+	task.ReviewedAt = &now
+	task.UpdatedAt = now
+	result, err := s.tasks.ReplaceOne(ctx, bson.M{"_id": id, "status": models.CountPendingApproval}, task)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to review count task: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, nil, fmt.Errorf("%w: task %s changed while reviewing", ErrCountStatus, id.Hex())
+	}
+	return task, posted, nil
+}
+
+// publish publishes the stock updates of committed adjustments
+func (s *Counts) publish(ctx context.Context, posted []adjusted) {
+	for i := range posted {
+		s.ledger.publish(ctx, &posted[i].movement, posted[i].entry)
+	}
+}
@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/models"
+)
+
+func TestNewCountTaskValidate(t *testing.T) {
+	zone := NewCountTask{Method: models.CountByZone, Location: "JKT-A", AssignedTo: "user-2"}
+	require.NoError(t, zone.validate())
+
+	class := NewCountTask{Method: models.CountByClass, Class: models.ClassA, AssignedTo: "user-2"}
+	require.NoError(t, class.validate())
+	assert.Equal(t, DefaultClassDays, class.Days)
+
+	sample := NewCountTask{Method: models.CountAtRandom, AssignedTo: "user-2"}
+	require.NoError(t, sample.validate())
+	assert.Equal(t, DefaultSampleSize, sample.Size)
+
+	for name, n := range map[string]NewCountTask{
+		"unknown method":  {Method: "weekly", AssignedTo: "user-2"},
+		"no zone":         {Method: models.CountByZone, AssignedTo: "user-2"},
+		"bad zone":        {Method: models.CountByZone, Location: "Zone A", AssignedTo: "user-2"},
+		"unknown class":   {Method: models.CountByClass, Class: "D", AssignedTo: "user-2"},
+		"too many days":   {Method: models.CountByClass, Class: models.ClassB, Days: 400, AssignedTo: "user-2"},
+		"sample too big":  {Method: models.CountAtRandom, Size: 500, AssignedTo: "user-2"},
+		"nobody assigned": {Method: models.CountByZone, Location: "JKT-A"},
+	} {
+		assert.ErrorIs(t, n.validate(), ErrInvalidCount, name)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	classes := classify(
+		[]string{"ITM-2024-001", "ITM-2024-002", "ITM-2024-003", "ITM-2024-004", "ITM-2024-005"},
+		map[string]float64{"ITM-2024-001": 600, "ITM-2024-002": 250, "ITM-2024-003": 110, "ITM-2024-004": 40})
+
+	assert.Equal(t, map[string]string{
+		"ITM-2024-001": models.ClassA,
+		"ITM-2024-002": models.ClassA,
+		"ITM-2024-003": models.ClassB,
+		"ITM-2024-004": models.ClassC,
+		"ITM-2024-005": models.ClassC,
+	}, classes, "items without issues are C items")
+
+	assert.Equal(t, models.ClassA, classify([]string{"ITM-2024-001"}, map[string]float64{"ITM-2024-001": 10})["ITM-2024-001"],
+		"the most valuable item is always an A item")
+}
+
+func TestCountLines(t *testing.T) {
+	stock := map[string]map[string]int{
+		"ITM-2024-001": {"JKT-A-01-R1-B02": 30, "JKT-A-01-R1-B01": 20},
+		"ITM-2024-002": {"JKT-A-01-R1-B01": 5},
+		"ITM-2024-003": {"JKT-A-01-R1-B01": 2},
+	}
+	items := map[string]models.Item{
+		"ITM-2024-001": {ItemID: "ITM-2024-001", Name: "Scanner"},
+		"ITM-2024-002": {ItemID: "ITM-2024-002", Name: "Labels"},
+		"ITM-2024-003": {ItemID: "ITM-2024-003", Name: "Tablet", Serialized: true},
+	}
+
+	lines := countLines(stock, items)
+	assert.Equal(t, []models.CountLine{
+		{ItemID: "ITM-2024-001", Name: "Scanner", Location: "JKT-A-01-R1-B01", Expected: 20},
+		{ItemID: "ITM-2024-002", Name: "Labels", Location: "JKT-A-01-R1-B01", Expected: 5},
+		{ItemID: "ITM-2024-001", Name: "Scanner", Location: "JKT-A-01-R1-B02", Expected: 30},
+	}, lines, "serialized items are counted by their units")
+	assert.Equal(t, []string{"JKT-A-01-R1-B01", "JKT-A-01-R1-B02"}, binsOf(lines))
+}
+
+func TestIsBin(t *testing.T) {
+	task := &models.CountTask{Method: models.CountByZone, Scope: "JKT-A", Bins: []string{"JKT-A-01-R1-B01"}}
+	assert.True(t, isBin(task, "JKT-A-01-R1-B01"))
+	assert.True(t, isBin(task, "JKT-A-02-R1-B03"), "any bin of the zone can be counted")
+	assert.False(t, isBin(task, "JKT-B-01-R1-B01"))
+	assert.False(t, isBin(task, "JKT-A-01"), "aisles are not bins")
+	assert.False(t, isBin(task, "ITM-2024-001"))
+	assert.False(t, isBin(task, "8901234567890"))
+
+	task.Method = models.CountAtRandom
+	assert.False(t, isBin(task, "JKT-A-02-R1-B03"))
+}
+
+func TestVariances(t *testing.T) {
+	counted := func(n int) *int { return &n }
+	lines := []models.CountLine{
+		{ItemID: "ITM-2024-001", Location: "JKT-A-01-R1-B01", Counted: counted(18)},
+		{ItemID: "ITM-2024-001", Location: "JKT-A-01-R1-B02", Counted: counted(30)},
+		{ItemID: "ITM-2024-002", Location: "JKT-A-01-R1-B01"},
+		{ItemID: "ITM-2024-004", Location: "JKT-A-01-R1-B01", Counted: counted(3)},
+	}
+	stock := map[string]map[string]int{
+		"ITM-2024-001": {"JKT-A-01-R1-B01": 20, "JKT-A-01-R1-B02": 30},
+		"ITM-2024-002": {"JKT-A-01-R1-B01": 40},
+	}
+	items := map[string]models.Item{
+		"ITM-2024-001": {ItemID: "ITM-2024-001", StockLevel: 65, CostPrice: 45.5},
+		"ITM-2024-002": {ItemID: "ITM-2024-002", StockLevel: 40, CostPrice: 2.25},
+		"ITM-2024-004": {ItemID: "ITM-2024-004", StockLevel: 0, CostPrice: 10},
+	}
+
+	sums := variances(lines, stock, items, CountThreshold{Units: 10, Value: 500})
+
+	require.NotNil(t, lines[2].Counted, "items of a counted bin that were not scanned count as zero")
+	assert.Equal(t, 0, *lines[2].Counted)
+	assert.Equal(t, -2, lines[0].Variance)
+	assert.Equal(t, -91.0, lines[0].VarianceValue)
+	assert.Equal(t, models.AdjustmentPosted, lines[0].Adjustment)
+	assert.Equal(t, "", lines[1].Adjustment, "lines without variance are not adjusted")
+	assert.Equal(t, -40, lines[2].Variance)
+	assert.Equal(t, models.AdjustmentPending, lines[2].Adjustment, "40 units is above the threshold")
+	assert.Equal(t, 3, lines[3].Variance, "found stock is a positive variance")
+	assert.Equal(t, models.AdjustmentPosted, lines[3].Adjustment)
+
+	assert.Equal(t, []models.CountVariance{
+		{ItemID: "ITM-2024-001", StockLevel: 65, Counted: 63, Variance: -2, Value: -91},
+		{ItemID: "ITM-2024-002", StockLevel: 40, Counted: 0, Variance: -40, Value: -90},
+		{ItemID: "ITM-2024-004", StockLevel: 0, Counted: 3, Variance: 3, Value: 30},
+	}, sums, "variances are taken against the stock level")
+}
+
+func TestCountThreshold(t *testing.T) {
+	threshold := CountThreshold{Units: 10, Value: 500}
+	assert.False(t, threshold.exceeds(&models.CountLine{Variance: -10, VarianceValue: -100}))
+	assert.True(t, threshold.exceeds(&models.CountLine{Variance: -11, VarianceValue: -100}))
+	assert.True(t, threshold.exceeds(&models.CountLine{Variance: 2, VarianceValue: 900}), "few units of a costly item")
+	assert.False(t, CountThreshold{}.exceeds(&models.CountLine{Variance: 1000, VarianceValue: 1e6}), "zero means no limit")
+}
@@ -0,0 +1,925 @@
+// Package inventory keeps the stock of items as a ledger of stock
+// movements. Item.StockLevel, the stock value and cost layers of the item
+// and the stock of the bins, lots and serialized units involved are only
+// changed together with the movement that explains them, in one
+// MongoDB transaction, so MongoDB must run as a replica set (a single-node
+// one is enough).
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// Errors returned when a movement cannot be recorded
+var (
+	ErrInvalidMovement   = errors.New("invalid stock movement")
+	ErrItemNotFound      = errors.New("item not found")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrCapacityExceeded  = errors.New("location capacity exceeded")
+)
+
+// Movement is a stock movement to record. Quantity is the number of units
+// moved and is always positive, except for adjustments where its sign
+// tells whether stock is added or removed.
+type Movement struct {
+	ItemID     string
+	Type       string
+	Quantity   int
+	Location   string   // bin code, defaults to the item's location; the source of a transfer
+	ToLocation string   // destination of a transfer
+	Lot        string   // picked first expired first out when stock leaves without one
+	Serials    []string // one per unit, required for serialized items
+	Reserved   int      // units of an issue taken from the stock reserved for its reference
+	Recount    bool     // a cycle count correction, which may take stock reserved for shipments
+	UnitCost   float64  // purchase cost of a receipt, defaults to the item's cost price
+	Reason     string
+	Reference  string
+	UserID     string
+
+	// Dates of a lot received for the first time
+	ManufacturedAt *time.Time
+	ExpiresAt      *time.Time
+}
+
+// Entry is the outcome of a recorded movement
+type Entry struct {
+	Item          models.Item            `json:"item"`
+	PreviousLevel int                    `json:"previousStockLevel"`
+	Movements     []models.StockMovement `json:"movements"` // two legs for a transfer
+}
+
+// leg is one signed quantity at one location of a movement
+type leg struct {
+	quantity int
+	location string
+	lot      string
+}
+
+// legs validates a movement and returns its signed quantities. A transfer
+// is an issue from its location and a receipt at its destination.
+func (m *Movement) legs() ([]leg, error) {
+	if m.ItemID == "" {
+		return nil, invalid("itemId is required")
+	}
+	if err := m.validateLot(); err != nil {
+		return nil, err
+	}
+	if err := m.validateSerials(); err != nil {
+		return nil, err
+	}
+	if m.Reserved != 0 && (m.Type != models.MovementIssue || m.Reserved < 0 || m.Reserved > m.Quantity) {
+		return nil, invalid("only issues take reserved stock, at most their quantity")
+	}
+	if m.Recount && m.Type != models.MovementAdjustment {
+		return nil, invalid("only adjustments correct a count")
+	}
+	if m.UnitCost != 0 && (m.Type != models.MovementReceipt || m.UnitCost < 0) {
+		return nil, invalid("only receipts have a unit cost, which must not be negative")
+	}
+	if m.Type == models.MovementAdjustment {
+		if m.Quantity == 0 {
+			return nil, invalid("adjustment quantity must not be zero")
+		}
+		if m.Reason == "" {
+			return nil, invalid("adjustments need a reason")
+		}
+		return []leg{{m.Quantity, m.Location, m.Lot}}, nil
+	}
+
+	if m.Quantity <= 0 {
+		return nil, invalid("quantity must be positive")
+	}
+	switch m.Type {
+	case models.MovementReceipt, models.MovementReturn:
+		return []leg{{m.Quantity, m.Location, m.Lot}}, nil
+	case models.MovementIssue:
+		return []leg{{-m.Quantity, m.Location, m.Lot}}, nil
+	case models.MovementTransfer:
+		if m.ToLocation == "" {
+			return nil, invalid("transfers need a destination location")
+		}
+		if m.ToLocation == m.Location {
+			return nil, invalid("transfer destination must differ from its source")
+		}
+		return []leg{{-m.Quantity, m.Location, m.Lot}, {m.Quantity, m.ToLocation, m.Lot}}, nil
+	}
+	return nil, invalid("unknown movement type %q", m.Type)
+}
+
+// validateLot checks the lot dates of a movement. Dates are only given
+// for a lot coming in.
+func (m *Movement) validateLot() error {
+	if m.ManufacturedAt == nil && m.ExpiresAt == nil {
+		return nil
+	}
+	if m.Lot == "" {
+		return invalid("lot dates need a lot")
+	}
+	if m.Type == models.MovementIssue || m.Type == models.MovementTransfer || m.Quantity < 0 {
+		return invalid("lot dates are only given when stock comes in")
+	}
+	if m.ManufacturedAt != nil && m.ExpiresAt != nil && !m.ManufacturedAt.Before(*m.ExpiresAt) {
+		return invalid("lot %s must be manufactured before it expires", m.Lot)
+	}
+	return nil
+}
+
+// validateSerials checks that a movement naming serial numbers names each
+// of its units once
+func (m *Movement) validateSerials() error {
+	if len(m.Serials) == 0 {
+		return nil
+	}
+	quantity := m.Quantity
+	if quantity < 0 {
+		quantity = -quantity
+	}
+	if len(m.Serials) != quantity {
+		return invalid("%d serial numbers given for %d units", len(m.Serials), quantity)
+	}
+	seen := make(map[string]bool, len(m.Serials))
+	for _, number := range m.Serials {
+		if number == "" {
+			return invalid("serial numbers must not be empty")
+		}
+		if seen[number] {
+			return invalid("serial number %s is given twice", number)
+		}
+		seen[number] = true
+	}
+	return nil
+}
+
+// required returns the stock the item must hold for the legs to apply:
+// the largest quantity taken out by a leg
+func required(legs []leg) int {
+	need := 0
+	for _, part := range legs {
+		if -part.quantity > need {
+			need = -part.quantity
+		}
+	}
+	return need
+}
+
+// Ledger records stock movements and keeps the stock level of items and
+// the stock of bins in step with them
+type Ledger struct {
+	client    *mongo.Client
+	items     *mongo.Collection
+	movements *mongo.Collection
+	locations *mongo.Collection
+	bins      *mongo.Collection
+	lots      *mongo.Collection
+	serials   *mongo.Collection
+	layers    *mongo.Collection
+	policies  *mongo.Collection
+	events    kafka.EventBus
+}
+
+// NewLedger creates a new stock ledger publishing to an event bus
+func NewLedger(db *database.MongoDB, events kafka.EventBus) *Ledger {
+	return &Ledger{
+		client:    db.Client,
+		items:     db.GetCollection(database.ItemsCollection),
+		movements: db.GetCollection(database.StockMovementsCollection),
+		locations: db.GetCollection(database.LocationsCollection),
+		bins:      db.GetCollection(database.BinStockCollection),
+		lots:      db.GetCollection(database.LotsCollection),
+		serials:   db.GetCollection(database.SerialsCollection),
+		layers:    db.GetCollection(database.CostLayersCollection),
+		policies:  db.GetCollection(database.ValuationPoliciesCollection),
+		events:    events,
+	}
+}
+
+// EnsureIndexes creates the indexes of the per-item ledger queries
+func (l *Ledger) EnsureIndexes(ctx context.Context) error {
+	_, err := l.movements.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "reference", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stock movement indexes: %w", err)
+	}
+	return nil
+}
+
+// Record applies a movement to the stock of its item, bins, lots and units
+// and appends it to the ledger in one transaction. Stock never goes negative: a
+// movement taking out more than the item or bin holds fails with
+// ErrInsufficientStock, and so does any movement of stock reserved for
+// shipments but a cycle count correction. Once committed, the movement is
+// published as an EventStockUpdated.
+func (l *Ledger) Record(ctx context.Context, m Movement) (*Entry, error) {
+	legs, err := m.legs()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := l.client.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	var entry *Entry
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var err error
+		entry, err = l.apply(sc, &m, legs, time.Now())
+		return nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l.publish(ctx, &m, entry)
+	return entry, nil
+}
+
+// apply updates the stock level and bins and inserts the movements of the
+// legs. The updates only match while the item and bins hold the required
+// stock, which is what keeps concurrent issues from overdrawing them.
+// Movements taking stock out only match while the stock not reserved for
+// shipments, plus the reserved units an issue takes, covers them; only
+// cycle count corrections may take reserved stock.
+func (l *Ledger) apply(ctx context.Context, m *Movement, legs []leg, now time.Time) (*Entry, error) {
+	net := 0
+	for _, part := range legs {
+		net += part.quantity
+	}
+
+	filter := bson.M{"itemId": m.ItemID}
+	if need := required(legs); need > 0 {
+		filter["stockLevel"] = bson.M{"$gte": need}
+		if !m.Recount {
+			filter["$expr"] = availableAtLeast(need - m.Reserved)
+		}
+	}
+	inc := bson.M{"stockLevel": net}
+	if m.Reserved > 0 {
+		inc["reserved"] = -m.Reserved
+	}
+	update := bson.M{
+		"$inc": inc,
+		"$set": bson.M{"updatedAt": now},
+	}
+
+	var item models.Item
+	err := l.items.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, countErr := l.items.CountDocuments(ctx, bson.M{"itemId": m.ItemID})
+		if countErr != nil {
+			return nil, fmt.Errorf("failed to find item: %w", countErr)
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrItemNotFound, m.ItemID)
+		}
+		if !m.Recount {
+			return nil, fmt.Errorf("%w: %s has less than %d units available", ErrInsufficientStock, m.ItemID, required(legs)-m.Reserved)
+		}
+		return nil, fmt.Errorf("%w: %s holds less than %d units", ErrInsufficientStock, m.ItemID, required(legs))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update stock level: %w", err)
+	}
+
+	if item.Serialized && len(m.Serials) == 0 {
+		return nil, invalid("%s is serialized, movements need the serial numbers of its units", m.ItemID)
+	}
+	if !item.Serialized && len(m.Serials) > 0 {
+		return nil, invalid("%s is not serialized", m.ItemID)
+	}
+
+	entry := &Entry{Item: item, PreviousLevel: item.StockLevel - net}
+	legs, units, err := l.pick(ctx, m, legs, item.WarehouseLocation, now)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := l.openValue(ctx, &item, entry.PreviousLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]interface{}, len(legs))
+	for i, part := range legs {
+		expiresAt, err := l.moveLot(ctx, m, part, now)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.moveBin(ctx, m.ItemID, part, expiresAt, now); err != nil {
+			return nil, err
+		}
+
+		movement := models.StockMovement{
+			ID:                primitive.NewObjectID(),
+			ItemID:            m.ItemID,
+			Type:              m.Type,
+			Quantity:          part.quantity,
+			UnitCost:          item.CostPrice,
+			UnitPrice:         item.SellingPrice,
+			WarehouseLocation: part.location,
+			Lot:               part.lot,
+			Serials:           units[part.lot],
+			Reason:            m.Reason,
+			Reference:         m.Reference,
+			UserID:            m.UserID,
+			CreatedAt:         now,
+		}
+		if err := l.moveSerials(ctx, m, part, movement.Serials, movement.ID, now); err != nil {
+			return nil, err
+		}
+		if err := l.value(ctx, m, part, stock, &movement, now); err != nil {
+			return nil, err
+		}
+		entry.Movements = append(entry.Movements, movement)
+		docs[i] = movement
+	}
+	if err := l.setValue(ctx, &entry.Item, stock); err != nil {
+		return nil, err
+	}
+
+	if _, err := l.movements.InsertMany(ctx, docs); err != nil {
+		return nil, fmt.Errorf("failed to record stock movement: %w", err)
+	}
+	return entry, nil
+}
+
+// pick defaults the locations of the legs to the item's location and, when
+// stock leaves without a lot, splits it over the lots of its bin first
+// expired first out. The destination of a transfer gets the same lots.
+// Units named by serial number are moved from the lots they are of, which
+// pick returns the serial numbers of.
+func (l *Ledger) pick(ctx context.Context, m *Movement, legs []leg, fallback string, now time.Time) ([]leg, map[string][]string, error) {
+	for i := range legs {
+		if legs[i].location == "" {
+			legs[i].location = fallback
+		}
+		if _, err := ParseLocation(legs[i].location); err != nil {
+			return nil, nil, invalid("%s is not a location code", legs[i].location)
+		}
+	}
+	if len(m.Serials) > 0 {
+		return l.pickSerials(ctx, m, legs)
+	}
+
+	out := legs[0]
+	if out.quantity >= 0 || out.lot != "" {
+		return legs, nil, nil
+	}
+
+	cursor, err := l.bins.Find(ctx, bson.M{"itemId": m.ItemID, "location": out.location, "quantity": bson.M{"$gt": 0}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find bin stock: %w", err)
+	}
+	var bins []models.BinStock
+	if err := cursor.All(ctx, &bins); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode bin stock: %w", err)
+	}
+
+	picks, short := fefo(bins, -out.quantity, now)
+	if short > 0 {
+		return nil, nil, fmt.Errorf("%w: %s holds %d units of %s that have not expired", ErrInsufficientStock,
+			out.location, -out.quantity-short, m.ItemID)
+	}
+
+	parts := make([]leg, 0, len(picks)*len(legs))
+	for _, picked := range picks {
+		parts = append(parts, leg{-picked.Quantity, out.location, picked.Lot})
+		if len(legs) > 1 {
+			parts = append(parts, leg{picked.Quantity, legs[1].location, picked.Lot})
+		}
+	}
+	return parts, nil, nil
+}
+
+// pickSerials splits the legs of a movement naming serial numbers by the
+// lot of its units and returns the serial numbers per lot. Received units
+// are new and of the lot received. Other units must be of the item: held
+// in the bin they leave, or shipped when they are returned. A unit
+// reserved for a reference is only issued or written off under it.
+func (l *Ledger) pickSerials(ctx context.Context, m *Movement, legs []leg) ([]leg, map[string][]string, error) {
+	out := legs[0]
+	if m.Type == models.MovementReceipt || (m.Type == models.MovementAdjustment && out.quantity > 0) {
+		return legs, map[string][]string{out.lot: m.Serials}, nil
+	}
+
+	cursor, err := l.serials.Find(ctx, bson.M{"serialNumber": bson.M{"$in": m.Serials}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find serials: %w", err)
+	}
+	var found []models.Serial
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode serials: %w", err)
+	}
+	byNumber := make(map[string]*models.Serial, len(found))
+	for i := range found {
+		byNumber[found[i].SerialNumber] = &found[i]
+	}
+
+	units := map[string][]string{}
+	var lots []string
+	for _, number := range m.Serials {
+		unit, ok := byNumber[number]
+		if !ok || unit.ItemID != m.ItemID {
+			return nil, nil, invalid("%s is not a unit of %s", number, m.ItemID)
+		}
+		if err := canMove(m, out, unit); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := units[unit.Lot]; !ok {
+			lots = append(lots, unit.Lot)
+		}
+		units[unit.Lot] = append(units[unit.Lot], number)
+	}
+
+	parts := make([]leg, 0, len(lots)*len(legs))
+	for _, lot := range lots {
+		n := len(units[lot])
+		if m.Type == models.MovementReturn {
+			parts = append(parts, leg{n, out.location, lot})
+			continue
+		}
+		parts = append(parts, leg{-n, out.location, lot})
+		if len(legs) > 1 {
+			parts = append(parts, leg{n, legs[1].location, lot})
+		}
+	}
+	return parts, units, nil
+}
+
+// canMove checks that a registered unit can take part in the first leg of
+// a movement
+func canMove(m *Movement, out leg, unit *models.Serial) error {
+	if out.lot != "" && unit.Lot != out.lot {
+		return invalid("unit %s is not of lot %s", unit.SerialNumber, out.lot)
+	}
+	if m.Type == models.MovementReturn {
+		if unit.Status != models.SerialShipped {
+			return invalid("unit %s is %s, only shipped units are returned", unit.SerialNumber, unit.Status)
+		}
+		return nil
+	}
+	if !unit.Held() {
+		return invalid("unit %s is %s", unit.SerialNumber, unit.Status)
+	}
+	if unit.Location != out.location {
+		return invalid("unit %s is in %s, not %s", unit.SerialNumber, unit.Location, out.location)
+	}
+	if unit.Status == models.SerialReserved && m.Type != models.MovementTransfer && unit.ReservedFor != m.Reference {
+		return fmt.Errorf("%w: unit %s is reserved for %s", ErrInsufficientStock, unit.SerialNumber, unit.ReservedFor)
+	}
+	return nil
+}
+
+// fefo picks a quantity from the stock of a bin, first expired first out:
+// lots by expiry date, then lots that do not expire and stock without a
+// lot. Expired lots are never picked; they leave by an adjustment naming
+// the lot. It returns the quantity per lot and how many units were short.
+func fefo(bins []models.BinStock, quantity int, now time.Time) ([]models.BinStock, int) {
+	rank := func(bin models.BinStock) int {
+		switch {
+		case bin.ExpiresAt != nil:
+			return 0
+		case bin.Lot != "":
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(bins, func(i, j int) bool {
+		a, b := bins[i], bins[j]
+		if rank(a) != rank(b) {
+			return rank(a) < rank(b)
+		}
+		return rank(a) == 0 && a.ExpiresAt.Before(*b.ExpiresAt)
+	})
+
+	var picks []models.BinStock
+	for _, bin := range bins {
+		if quantity == 0 {
+			break
+		}
+		if bin.ExpiresAt != nil && !now.Before(*bin.ExpiresAt) {
+			continue
+		}
+		take := bin.Quantity
+		if take > quantity {
+			take = quantity
+		}
+		picks = append(picks, models.BinStock{Lot: bin.Lot, ExpiresAt: bin.ExpiresAt, Quantity: take})
+		quantity -= take
+	}
+	return picks, quantity
+}
+
+// moveLot applies a leg to the quantity of its lot and returns the expiry
+// date of the lot. A lot is created by the first movement bringing it in.
+// Expired lots cannot be issued.
+func (l *Ledger) moveLot(ctx context.Context, m *Movement, part leg, now time.Time) (*time.Time, error) {
+	if part.lot == "" {
+		return nil, nil
+	}
+
+	var lot models.Lot
+	err := l.lots.FindOne(ctx, bson.M{"itemId": m.ItemID, "lotNumber": part.lot}).Decode(&lot)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if part.quantity < 0 {
+			return nil, fmt.Errorf("%w: %s has no lot %s", ErrInsufficientStock, m.ItemID, part.lot)
+		}
+		lot = models.Lot{
+			ID:             primitive.NewObjectID(),
+			ItemID:         m.ItemID,
+			LotNumber:      part.lot,
+			ManufacturedAt: m.ManufacturedAt,
+			ExpiresAt:      m.ExpiresAt,
+			Quantity:       part.quantity,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if _, err := l.lots.InsertOne(ctx, lot); err != nil {
+			return nil, fmt.Errorf("failed to create lot: %w", err)
+		}
+		return lot.ExpiresAt, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find lot: %w", err)
+	}
+
+	if m.ExpiresAt != nil && (lot.ExpiresAt == nil || !lot.ExpiresAt.Equal(*m.ExpiresAt)) {
+		return nil, invalid("lot %s already exists with another expiry date", part.lot)
+	}
+	if m.Type == models.MovementIssue && lot.Expired(now) {
+		return nil, invalid("lot %s expired on %s", part.lot, lot.ExpiresAt.Format("2006-01-02"))
+	}
+	if _, err := l.lots.UpdateOne(ctx, bson.M{"_id": lot.ID}, bson.M{
+		"$inc": bson.M{"quantity": part.quantity},
+		"$set": bson.M{"updatedAt": now},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update lot quantity: %w", err)
+	}
+	return lot.ExpiresAt, nil
+}
+
+// moveBin applies a leg to the stock of an item in a bin and to the
+// occupancy of the bin. Stock can only be put in active bins with room for
+// it. Codes that are not registered locations are accepted, so that stock
+// can be booked before its bins are set up.
+func (l *Ledger) moveBin(ctx context.Context, itemID string, part leg, expiresAt *time.Time, now time.Time) error {
+	var location models.Location
+	err := l.locations.FindOne(ctx, bson.M{"code": part.location}).Decode(&location)
+	registered := err == nil
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("failed to find location: %w", err)
+	}
+	if registered && part.quantity > 0 {
+		if err := canHold(&location, part.quantity); err != nil {
+			return err
+		}
+	}
+
+	filter := bson.M{"itemId": itemID, "location": part.location, "lot": part.lot}
+	update := bson.M{
+		"$inc": bson.M{"quantity": part.quantity},
+		"$set": bson.M{"updatedAt": now},
+	}
+	opts := options.Update()
+	if part.quantity < 0 {
+		filter["quantity"] = bson.M{"$gte": -part.quantity}
+	} else {
+		onInsert := bson.M{"warehouse": warehouseOf(part.location)}
+		if expiresAt != nil {
+			onInsert["expiresAt"] = *expiresAt
+		}
+		update["$setOnInsert"] = onInsert
+		opts.SetUpsert(true)
+	}
+
+	result, err := l.bins.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return fmt.Errorf("failed to update bin stock: %w", err)
+	}
+	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+		if part.lot != "" {
+			return fmt.Errorf("%w: %s holds less than %d units of lot %s of %s", ErrInsufficientStock,
+				part.location, -part.quantity, part.lot, itemID)
+		}
+		return fmt.Errorf("%w: %s holds less than %d units of %s", ErrInsufficientStock, part.location, -part.quantity, itemID)
+	}
+
+	if registered {
+		if _, err := l.locations.UpdateOne(ctx, bson.M{"_id": location.ID}, bson.M{
+			"$inc": bson.M{"occupied": part.quantity},
+			"$set": bson.M{"updatedAt": now},
+		}); err != nil {
+			return fmt.Errorf("failed to update location occupancy: %w", err)
+		}
+	}
+	return nil
+}
+
+// moveSerials applies a leg to the units it names. Receipts and adjustments
+// adding stock register new units; returns bring shipped units back.
+// Issues ship units, linking them to the shipment they are issued for, and
+// adjustments taking stock out write them off. A transfer moves its units
+// with the leg leaving the source bin.
+func (l *Ledger) moveSerials(ctx context.Context, m *Movement, part leg, numbers []string, movementID primitive.ObjectID, now time.Time) error {
+	if len(numbers) == 0 {
+		return nil
+	}
+
+	event := models.SerialEvent{
+		Action:     m.Type,
+		Location:   part.location,
+		Reference:  m.Reference,
+		MovementID: &movementID,
+		UserID:     m.UserID,
+		At:         now,
+	}
+	if part.quantity > 0 && m.Type != models.MovementReturn {
+		if m.Type == models.MovementTransfer {
+			return nil
+		}
+		event.Status = models.SerialInStock
+		docs := make([]interface{}, len(numbers))
+		for i, number := range numbers {
+			docs[i] = models.Serial{
+				ID:           primitive.NewObjectID(),
+				SerialNumber: number,
+				ItemID:       m.ItemID,
+				Status:       models.SerialInStock,
+				Location:     part.location,
+				Lot:          part.lot,
+				History:      []models.SerialEvent{event},
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+		}
+		if _, err := l.serials.InsertMany(ctx, docs); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return invalid("a unit with one of the serial numbers %v is already registered", numbers)
+			}
+			return fmt.Errorf("failed to register serials: %w", err)
+		}
+		return nil
+	}
+
+	filter := bson.M{"serialNumber": bson.M{"$in": numbers}, "itemId": m.ItemID}
+	set := bson.M{"updatedAt": now}
+	update := bson.M{"$set": set}
+	switch m.Type {
+	case models.MovementReturn:
+		filter["status"] = models.SerialShipped
+		event.Status = models.SerialReturned
+		set["location"] = part.location
+	case models.MovementTransfer:
+		filter["status"] = bson.M{"$in": models.SerialsHeld}
+		filter["location"] = part.location
+		event.Location = m.ToLocation
+		set["location"] = m.ToLocation
+	case models.MovementIssue:
+		filter["status"] = bson.M{"$in": models.SerialsHeld}
+		filter["location"] = part.location
+		event.Status = models.SerialShipped
+		if shipmentID.MatchString(m.Reference) {
+			set["shipmentId"] = m.Reference
+		}
+		update["$unset"] = bson.M{"reservedFor": ""}
+	default:
+		filter["status"] = bson.M{"$in": models.SerialsHeld}
+		filter["location"] = part.location
+		event.Status = models.SerialRemoved
+		update["$unset"] = bson.M{"reservedFor": ""}
+	}
+	if event.Status != "" {
+		set["status"] = event.Status
+	}
+	update["$push"] = bson.M{"history": event}
+
+	result, err := l.serials.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update serials: %w", err)
+	}
+	if result.ModifiedCount != int64(len(numbers)) {
+		return invalid("units %v changed while they were moved", numbers)
+	}
+	return nil
+}
+
+// availableAtLeast is the expression matching items with at least a
+// quantity of stock not reserved for shipments
+func availableAtLeast(quantity int) bson.M {
+	return bson.M{"$gte": bson.A{
+		bson.M{"$subtract": bson.A{"$stockLevel", bson.M{"$ifNull": bson.A{"$reserved", 0}}}},
+		quantity,
+	}}
+}
+
+// canHold checks that a location can take in more units of stock
+func canHold(location *models.Location, quantity int) error {
+	if location.Level != models.LevelBin {
+		return invalid("stock is held in bins, %s is a %s", location.Code, location.Level)
+	}
+	if !location.Active {
+		return invalid("bin %s is inactive", location.Code)
+	}
+	if max := location.Capacity.MaxUnits; max > 0 && location.Occupied+quantity > max {
+		return fmt.Errorf("%w: %s has room for %d more units", ErrCapacityExceeded, location.Code, max-location.Occupied)
+	}
+	return nil
+}
+
+// publish sends the stock update event and the latest stock level of a
+// recorded movement. The movement is already committed, so failures are
+// only logged; the stock level topic catches up with the next movement.
+func (l *Ledger) publish(ctx context.Context, m *Movement, entry *Entry) {
+	if l.events == nil {
+		return
+	}
+
+	event := models.NewEventMessage(models.EventStockUpdated, stockEvent(m, entry))
+	if err := l.events.Publish(ctx, models.TopicInventoryEvents, m.ItemID, event); err != nil {
+		log.Printf("Error publishing stock update of %s: %v", m.ItemID, err)
+	}
+
+	level := models.NewEventMessage(models.EventStockUpdated, models.StockLevel{
+		ItemID:            entry.Item.ItemID,
+		StockLevel:        entry.Item.StockLevel,
+		WarehouseLocation: entry.Item.WarehouseLocation,
+		MovementType:      m.Type,
+		UpdatedAt:         entry.Item.UpdatedAt,
+	})
+	if err := l.events.Publish(ctx, models.TopicStockLevels, m.ItemID, level); err != nil {
+		log.Printf("Error publishing stock level of %s: %v", m.ItemID, err)
+	}
+}
+
+// stockEvent is the inventory event of a recorded movement
+func stockEvent(m *Movement, entry *Entry) models.InventoryEvent {
+	ids := make([]string, len(entry.Movements))
+	quantity := 0
+	var lots []string
+	for i, movement := range entry.Movements {
+		ids[i] = movement.ID.Hex()
+		quantity += movement.Quantity
+		if movement.Lot != "" && !containsString(lots, movement.Lot) {
+			lots = append(lots, movement.Lot)
+		}
+	}
+
+	changes := map[string]interface{}{
+		"movementType":       m.Type,
+		"movementIds":        ids,
+		"quantity":           quantity,
+		"previousStockLevel": entry.PreviousLevel,
+		"stockLevel":         entry.Item.StockLevel,
+		"warehouseLocation":  entry.Movements[0].WarehouseLocation,
+		"warehouse":          warehouseOf(entry.Movements[0].WarehouseLocation),
+	}
+	if m.Type == models.MovementTransfer {
+		changes["toLocation"] = entry.Movements[1].WarehouseLocation
+	}
+	if len(lots) > 0 {
+		changes["lots"] = lots
+	}
+	if len(m.Serials) > 0 {
+		changes["serials"] = m.Serials
+	}
+	if m.Reason != "" {
+		changes["reason"] = m.Reason
+	}
+	if m.Reference != "" {
+		changes["reference"] = m.Reference
+	}
+
+	return models.InventoryEvent{
+		ItemID:  m.ItemID,
+		Action:  models.EventStockUpdated,
+		Changes: changes,
+		UserID:  m.UserID,
+	}
+}
+
+// MovementFilter selects the movements of the ledger queries
+type MovementFilter struct {
+	ItemID    string
+	Type      string
+	Reference string
+	Since     *time.Time
+	Until     *time.Time
+}
+
+// query builds the MongoDB filter of a movement filter
+func (f MovementFilter) query() bson.M {
+	query := bson.M{}
+	if f.ItemID != "" {
+		query["itemId"] = f.ItemID
+	}
+	if f.Type != "" {
+		query["type"] = f.Type
+	}
+	if f.Reference != "" {
+		query["reference"] = f.Reference
+	}
+	if f.Since != nil || f.Until != nil {
+		createdAt := bson.M{}
+		if f.Since != nil {
+			createdAt["$gte"] = *f.Since
+		}
+		if f.Until != nil {
+			createdAt["$lt"] = *f.Until
+		}
+		query["createdAt"] = createdAt
+	}
+	return query
+}
+
+// ListMovements returns a page of movements, newest first, and the total
+// number of matching movements
+func (l *Ledger) ListMovements(ctx context.Context, filter MovementFilter, offset, limit int) ([]models.StockMovement, int64, error) {
+	query := filter.query()
+	total, err := l.movements.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count stock movements: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := l.movements.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list stock movements: %w", err)
+	}
+
+	movements := []models.StockMovement{}
+	if err := cursor.All(ctx, &movements); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode stock movements: %w", err)
+	}
+	return movements, total, nil
+}
+
+// MovementCursor opens a cursor over every matching movement, oldest
+// first, for exports
+func (l *Ledger) MovementCursor(ctx context.Context, filter MovementFilter) (*mongo.Cursor, error) {
+	cursor, err := l.movements.Find(ctx, filter.query(),
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stock movements: %w", err)
+	}
+	return cursor, nil
+}
+
+// Balance returns the stock of an item according to the ledger, the sum
+// of its movements. It matches Item.StockLevel unless the stock level was
+// written around the ledger.
+func (l *Ledger) Balance(ctx context.Context, itemID string) (int, error) {
+	cursor, err := l.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"itemId": itemID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "balance": bson.M{"$sum": "$quantity"}}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute stock balance: %w", err)
+	}
+
+	var results []struct {
+		Balance int `bson:"balance"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, fmt.Errorf("failed to decode stock balance: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].Balance, nil
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// invalid returns an ErrInvalidMovement with a reason
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidMovement, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,287 @@
+package inventory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"warehouse-shared/database"
+	"warehouse-shared/database/mongotest"
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+func TestMovementLegs(t *testing.T) {
+	expiry := time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC)
+	made := expiry.AddDate(0, -6, 0)
+
+	for _, tc := range []struct {
+		movement Movement
+		legs     []leg
+		required int
+	}{
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 5}, []leg{{5, "", ""}}, 0},
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementReturn, Quantity: 2, Location: "A1"}, []leg{{2, "A1", ""}}, 0},
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: 3}, []leg{{-3, "", ""}}, 3},
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementAdjustment, Quantity: -4, Reason: "damaged"}, []leg{{-4, "", ""}}, 4},
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementAdjustment, Quantity: 1, Reason: "found"}, []leg{{1, "", ""}}, 0},
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementTransfer, Quantity: 6, Location: "A1", ToLocation: "B2"}, []leg{{-6, "A1", ""}, {6, "B2", ""}}, 6},
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 5, Lot: "L1", ManufacturedAt: &made, ExpiresAt: &expiry}, []leg{{5, "", "L1"}}, 0},
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementTransfer, Quantity: 2, Location: "A1", ToLocation: "B2", Lot: "L1"}, []leg{{-2, "A1", "L1"}, {2, "B2", "L1"}}, 2},
+		{Movement{ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 4, UnitCost: 12.5}, []leg{{4, "", ""}}, 0},
+	} {
+		legs, err := tc.movement.legs()
+		require.NoError(t, err, tc.movement.Type)
+		assert.Equal(t, tc.legs, legs, tc.movement.Type)
+		assert.Equal(t, tc.required, required(legs), tc.movement.Type)
+	}
+
+	for name, movement := range map[string]Movement{
+		"no item":            {Type: models.MovementReceipt, Quantity: 1},
+		"unknown type":       {ItemID: "ITM-2024-001", Type: "theft", Quantity: 1},
+		"negative issue":     {ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: -1},
+		"zero receipt":       {ItemID: "ITM-2024-001", Type: models.MovementReceipt},
+		"zero adjustment":    {ItemID: "ITM-2024-001", Type: models.MovementAdjustment, Reason: "count"},
+		"unexplained adjust": {ItemID: "ITM-2024-001", Type: models.MovementAdjustment, Quantity: 2},
+		"transfer nowhere":   {ItemID: "ITM-2024-001", Type: models.MovementTransfer, Quantity: 1, Location: "A1"},
+		"transfer in place":  {ItemID: "ITM-2024-001", Type: models.MovementTransfer, Quantity: 1, Location: "A1", ToLocation: "A1"},
+		"dates without lot":  {ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 1, ExpiresAt: &expiry},
+		"dates on issue":     {ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: 1, Lot: "L1", ExpiresAt: &expiry},
+		"expires when made":  {ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 1, Lot: "L1", ManufacturedAt: &expiry, ExpiresAt: &expiry},
+		"serials short":      {ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 2, Serials: []string{"SN1"}},
+		"serial twice":       {ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: 2, Serials: []string{"SN1", "SN1"}},
+		"empty serial":       {ItemID: "ITM-2024-001", Type: models.MovementAdjustment, Quantity: -1, Reason: "lost", Serials: []string{""}},
+		"reserved receipt":   {ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 2, Reserved: 2},
+		"reserved too many":  {ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: 2, Reserved: 3},
+		"cost on issue":      {ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: 2, UnitCost: 10},
+		"recounted receipt":  {ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 2, Recount: true},
+		"negative cost":      {ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 2, UnitCost: -1},
+	} {
+		_, err := movement.legs()
+		assert.ErrorIs(t, err, ErrInvalidMovement, name)
+	}
+}
+
+func TestCanMove(t *testing.T) {
+	unit := &models.Serial{SerialNumber: "SN1", ItemID: "ITM-2024-001", Status: models.SerialInStock,
+		Location: "JKT-A-01-R1-B01", Lot: "L1"}
+	out := leg{-1, "JKT-A-01-R1-B01", ""}
+	issue := &Movement{Type: models.MovementIssue, Reference: "SHP-2024-001"}
+	assert.NoError(t, canMove(issue, out, unit))
+	assert.NoError(t, canMove(issue, leg{-1, "JKT-A-01-R1-B01", "L1"}, unit))
+	assert.ErrorIs(t, canMove(issue, leg{-1, "JKT-A-01-R1-B01", "L2"}, unit), ErrInvalidMovement)
+	assert.ErrorIs(t, canMove(issue, leg{-1, "JKT-B-02-R1-B01", ""}, unit), ErrInvalidMovement)
+	assert.ErrorIs(t, canMove(&Movement{Type: models.MovementReturn}, leg{1, "JKT-A-01-R1-B01", ""}, unit), ErrInvalidMovement,
+		"only shipped units are returned")
+
+	reserved := *unit
+	reserved.Status = models.SerialReserved
+	reserved.ReservedFor = "SHP-2024-001"
+	assert.NoError(t, canMove(issue, out, &reserved))
+	assert.NoError(t, canMove(&Movement{Type: models.MovementTransfer}, out, &reserved))
+	assert.ErrorIs(t, canMove(&Movement{Type: models.MovementIssue, Reference: "SHP-2024-002"}, out, &reserved), ErrInsufficientStock)
+
+	shipped := *unit
+	shipped.Status = models.SerialShipped
+	assert.ErrorIs(t, canMove(issue, out, &shipped), ErrInvalidMovement)
+	assert.NoError(t, canMove(&Movement{Type: models.MovementReturn}, leg{1, "JKT-B-02-R1-B01", ""}, &shipped))
+}
+
+func TestFEFO(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	date := func(month time.Month) *time.Time {
+		d := time.Date(2024, month, 1, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	bins := []models.BinStock{
+		{Lot: "", Quantity: 10},
+		{Lot: "L-JUN", ExpiresAt: date(time.June), Quantity: 5},
+		{Lot: "L-NOEXP", Quantity: 3},
+		{Lot: "L-FEB", ExpiresAt: date(time.February), Quantity: 20},
+		{Lot: "L-APR", ExpiresAt: date(time.April), Quantity: 4},
+	}
+
+	picks, short := fefo(bins, 7, now)
+	assert.Zero(t, short)
+	assert.Equal(t, []models.BinStock{
+		{Lot: "L-APR", ExpiresAt: date(time.April), Quantity: 4},
+		{Lot: "L-JUN", ExpiresAt: date(time.June), Quantity: 3},
+	}, picks, "the expired February lot is skipped")
+
+	picks, short = fefo(bins, 15, now)
+	assert.Zero(t, short)
+	assert.Len(t, picks, 4)
+	assert.Equal(t, 15, picks[0].Quantity+picks[1].Quantity+picks[2].Quantity+picks[3].Quantity)
+	assert.Equal(t, "", picks[3].Lot, "stock without a lot goes last")
+
+	_, short = fefo(bins, 30, now)
+	assert.Equal(t, 8, short, "only 22 units have not expired")
+}
+
+// transferEntry is a recorded transfer of 6 units from A1 to B2
+func transferEntry() (*Movement, *Entry) {
+	m := &Movement{ItemID: "ITM-2024-001", Type: models.MovementTransfer, Quantity: 6, Location: "A1", ToLocation: "B2",
+		Reference: "TRF-7", UserID: "USR-2024-002"}
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	return m, &Entry{
+		Item:          models.Item{ItemID: "ITM-2024-001", StockLevel: 40, WarehouseLocation: "A1", UpdatedAt: now},
+		PreviousLevel: 40,
+		Movements: []models.StockMovement{
+			{ID: primitive.NewObjectID(), ItemID: "ITM-2024-001", Quantity: -6, WarehouseLocation: "A1"},
+			{ID: primitive.NewObjectID(), ItemID: "ITM-2024-001", Quantity: 6, WarehouseLocation: "B2"},
+		},
+	}
+}
+
+func TestStockEvent(t *testing.T) {
+	m, entry := transferEntry()
+	event := stockEvent(m, entry)
+
+	assert.Equal(t, "ITM-2024-001", event.ItemID)
+	assert.Equal(t, "USR-2024-002", event.UserID)
+	assert.Equal(t, map[string]interface{}{
+		"movementType":       models.MovementTransfer,
+		"movementIds":        []string{entry.Movements[0].ID.Hex(), entry.Movements[1].ID.Hex()},
+		"quantity":           0,
+		"previousStockLevel": 40,
+		"stockLevel":         40,
+		"warehouseLocation":  "A1",
+		"warehouse":          "A1",
+		"toLocation":         "B2",
+		"reference":          "TRF-7",
+	}, event.Changes)
+}
+
+func TestPublish(t *testing.T) {
+	bus := kafka.NewMemoryBus()
+	defer bus.Close()
+
+	ledger := &Ledger{events: bus}
+	m, entry := transferEntry()
+	ledger.publish(context.Background(), m, entry)
+
+	received := make(chan *models.EventMessage, 2)
+	for _, topic := range []string{models.TopicInventoryEvents, models.TopicStockLevels} {
+		sub, err := bus.Subscribe(topic, "test", func(ctx context.Context, event *models.EventMessage) error {
+			received <- event
+			return nil
+		})
+		require.NoError(t, err)
+		defer sub.Close()
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-received:
+			assert.Equal(t, models.EventStockUpdated, event.EventType)
+			assert.Equal(t, "ITM-2024-001", event.Subject)
+		case <-time.After(2 * time.Second):
+			t.Fatal("stock events not published")
+		}
+	}
+}
+
+func TestMovementFilterQuery(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, bson.M{
+		"itemId":    "ITM-2024-001",
+		"type":      models.MovementIssue,
+		"createdAt": bson.M{"$gte": since},
+	}, MovementFilter{ItemID: "ITM-2024-001", Type: models.MovementIssue, Since: &since}.query())
+	assert.Equal(t, bson.M{}, MovementFilter{}.query())
+}
+
+// newTestLedger returns a ledger on a test database holding one item with
+// stock received in its bin
+func newTestLedger(t *testing.T, stock int) (*database.MongoDB, *Ledger) {
+	db := mongotest.Connect(t)
+	ctx := context.Background()
+	ledger := NewLedger(db, kafka.NewMemoryBus())
+	require.NoError(t, ledger.EnsureIndexes(ctx))
+
+	_, err := db.GetCollection(database.ItemsCollection).InsertOne(ctx, models.Item{
+		ItemID: "ITM-2024-001", Name: "Headphones", Category: "Electronics",
+		CostPrice: 50, SellingPrice: 89.99, WarehouseLocation: "JKT-A-01-R2-B04",
+	})
+	require.NoError(t, err)
+	_, err = ledger.Record(ctx, Movement{ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: stock, UserID: "user-1"})
+	require.NoError(t, err)
+	return db, ledger
+}
+
+// stockOf returns the stock level and reserved units of the test item
+func stockOf(t *testing.T, db *database.MongoDB) (int, int) {
+	var item models.Item
+	require.NoError(t, db.GetCollection(database.ItemsCollection).FindOne(context.Background(), bson.M{"itemId": "ITM-2024-001"}).Decode(&item))
+	return item.StockLevel, item.Reserved
+}
+
+func TestRecordDoesNotOverdraw(t *testing.T) {
+	db, ledger := newTestLedger(t, 5)
+	ctx := context.Background()
+
+	_, err := ledger.Record(ctx, Movement{ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: 6, UserID: "user-1"})
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	issued := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ledger.Record(ctx, Movement{ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: 1, UserID: "user-1"})
+			if err != nil {
+				assert.ErrorIs(t, err, ErrInsufficientStock)
+				return
+			}
+			mu.Lock()
+			issued++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, issued, "concurrent issues take no more than the stock")
+
+	level, _ := stockOf(t, db)
+	assert.Equal(t, 0, level)
+	balance, err := ledger.Balance(ctx, "ITM-2024-001")
+	require.NoError(t, err)
+	assert.Equal(t, level, balance, "failed issues leave no movement behind")
+
+	var bin models.BinStock
+	require.NoError(t, db.GetCollection(database.BinStockCollection).FindOne(ctx, bson.M{"itemId": "ITM-2024-001"}).Decode(&bin))
+	assert.Equal(t, 0, bin.Quantity)
+}
+
+func TestRecordKeepsReservedStock(t *testing.T) {
+	db, ledger := newTestLedger(t, 5)
+	ctx := context.Background()
+	_, err := db.GetCollection(database.ItemsCollection).UpdateOne(ctx, bson.M{"itemId": "ITM-2024-001"}, bson.M{"$set": bson.M{"reserved": 3}})
+	require.NoError(t, err)
+
+	for name, m := range map[string]Movement{
+		"issue":      {Type: models.MovementIssue, Quantity: 3},
+		"adjustment": {Type: models.MovementAdjustment, Quantity: -3, Reason: "damaged"},
+		"transfer":   {Type: models.MovementTransfer, Quantity: 3, ToLocation: "JKT-A-01-R2-B05"},
+	} {
+		m.ItemID, m.UserID = "ITM-2024-001", "user-1"
+		_, err := ledger.Record(ctx, m)
+		assert.ErrorIs(t, err, ErrInsufficientStock, name)
+	}
+
+	_, err = ledger.Record(ctx, Movement{ItemID: "ITM-2024-001", Type: models.MovementAdjustment, Quantity: -2, Reason: "damaged", UserID: "user-1"})
+	require.NoError(t, err, "unreserved stock can be adjusted")
+	_, err = ledger.Record(ctx, Movement{ItemID: "ITM-2024-001", Type: models.MovementAdjustment, Quantity: -1, Reason: CountReason, Recount: true, UserID: "user-1"})
+	require.NoError(t, err, "a count may find reserved stock missing")
+
+	level, reserved := stockOf(t, db)
+	assert.Equal(t, 2, level)
+	assert.Equal(t, 3, reserved)
+}
@@ -0,0 +1,302 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// Errors returned by the location store
+var (
+	ErrInvalidLocation  = errors.New("invalid location")
+	ErrLocationNotFound = errors.New("location not found")
+	ErrLocationExists   = errors.New("location already exists")
+)
+
+// locationPart is one part of a location code
+var locationPart = regexp.MustCompile(`^[A-Za-z0-9_.]{1,20}$`)
+
+// ParseLocation splits a location code into its hierarchy. The number of
+// parts of the code gives the level: JKT is a warehouse, JKT-A a zone of it
+// and JKT-A-01-R2-B04 a bin.
+func ParseLocation(code string) (*models.Location, error) {
+	parts := strings.Split(code, models.LocationSeparator)
+	if len(parts) > len(models.LocationLevels) {
+		return nil, fmt.Errorf("%w: %q has more than %d parts", ErrInvalidLocation, code, len(models.LocationLevels))
+	}
+
+	location := &models.Location{Code: code, Level: models.LocationLevels[len(parts)-1]}
+	fields := []*string{&location.Warehouse, &location.Zone, &location.Aisle, &location.Rack, &location.Bin}
+	for i, part := range parts {
+		if !locationPart.MatchString(part) {
+			return nil, fmt.Errorf("%w: %q is not a location code", ErrInvalidLocation, code)
+		}
+		*fields[i] = part
+	}
+	if len(parts) > 1 {
+		location.Parent = strings.Join(parts[:len(parts)-1], models.LocationSeparator)
+	}
+	return location, nil
+}
+
+// warehouseOf returns the warehouse part of a location code
+func warehouseOf(code string) string {
+	return strings.SplitN(code, models.LocationSeparator, 2)[0]
+}
+
+// Within matches a location code and the codes of every location inside
+// it, so that filtering by JKT or JKT-A also finds the bins JKT-A-01-R1-B01
+func Within(code string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(code) + "(" + models.LocationSeparator + "|$)"}
+}
+
+// Locations stores the location hierarchy and answers where items are
+type Locations struct {
+	locations *mongo.Collection
+	bins      *mongo.Collection
+}
+
+// NewLocations creates a new location store
+func NewLocations(db *database.MongoDB) *Locations {
+	return &Locations{
+		locations: db.GetCollection(database.LocationsCollection),
+		bins:      db.GetCollection(database.BinStockCollection),
+	}
+}
+
+// EnsureIndexes creates the indexes of the location and bin stock queries
+func (s *Locations) EnsureIndexes(ctx context.Context) error {
+	_, err := s.locations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "parent", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create location indexes: %w", err)
+	}
+
+	_, err = s.bins.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "location", Value: 1}, {Key: "lot", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "location", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create bin stock indexes: %w", err)
+	}
+	return nil
+}
+
+// Create adds a location under an existing parent. The hierarchy fields
+// are derived from the code; name, capacity and active are kept.
+func (s *Locations) Create(ctx context.Context, location *models.Location) error {
+	parsed, err := ParseLocation(location.Code)
+	if err != nil {
+		return err
+	}
+	if parsed.Parent != "" {
+		count, err := s.locations.CountDocuments(ctx, bson.M{"code": parsed.Parent})
+		if err != nil {
+			return fmt.Errorf("failed to find parent location: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: parent %s does not exist", ErrInvalidLocation, parsed.Parent)
+		}
+	}
+
+	now := time.Now()
+	parsed.ID = primitive.NewObjectID()
+	parsed.Name = location.Name
+	parsed.Capacity = location.Capacity
+	parsed.Active = location.Active
+	parsed.CreatedAt = now
+	parsed.UpdatedAt = now
+
+	if _, err := s.locations.InsertOne(ctx, parsed); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%w: %s", ErrLocationExists, parsed.Code)
+		}
+		return fmt.Errorf("failed to create location: %w", err)
+	}
+	*location = *parsed
+	return nil
+}
+
+// Get returns a location by code
+func (s *Locations) Get(ctx context.Context, code string) (*models.Location, error) {
+	var location models.Location
+	err := s.locations.FindOne(ctx, bson.M{"code": code}).Decode(&location)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrLocationNotFound, code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location: %w", err)
+	}
+	return &location, nil
+}
+
+// Update changes the name, capacity and active flag of a location.
+// Lowering the capacity below what a bin holds only blocks new stock.
+func (s *Locations) Update(ctx context.Context, code, name string, capacity models.Capacity, active bool) (*models.Location, error) {
+	var location models.Location
+	err := s.locations.FindOneAndUpdate(ctx, bson.M{"code": code}, bson.M{"$set": bson.M{
+		"name":      name,
+		"capacity":  capacity,
+		"active":    active,
+		"updatedAt": time.Now(),
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&location)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrLocationNotFound, code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update location: %w", err)
+	}
+	return &location, nil
+}
+
+// LocationFilter selects the locations of List
+type LocationFilter struct {
+	Within string // a location code; matches it and everything inside it
+	Level  string
+}
+
+// query builds the MongoDB filter of a location filter
+func (f LocationFilter) query() bson.M {
+	query := bson.M{}
+	if f.Within != "" {
+		query["code"] = Within(f.Within)
+	}
+	if f.Level != "" {
+		query["level"] = f.Level
+	}
+	return query
+}
+
+// List returns a page of locations ordered by code, so that every
+// location comes right after its parent, and the total number of matches
+func (s *Locations) List(ctx context.Context, filter LocationFilter, offset, limit int) ([]models.Location, int64, error) {
+	query := filter.query()
+	total, err := s.locations.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count locations: %w", err)
+	}
+
+	cursor, err := s.locations.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "code", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list locations: %w", err)
+	}
+
+	locations := []models.Location{}
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode locations: %w", err)
+	}
+	return locations, total, nil
+}
+
+// Cursor opens a cursor over every matching location, ordered by code, for
+// exports
+func (s *Locations) Cursor(ctx context.Context, filter LocationFilter) (*mongo.Cursor, error) {
+	cursor, err := s.locations.Find(ctx, filter.query(), options.Find().SetSort(bson.D{{Key: "code", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locations: %w", err)
+	}
+	return cursor, nil
+}
+
+// WarehouseStock is the quantity of an item in one warehouse
+type WarehouseStock struct {
+	Warehouse string `json:"warehouse"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Availability tells where an item is held. Stock of expired lots is not
+// available and is listed apart.
+type Availability struct {
+	ItemID     string            `json:"itemId"`
+	Location   string            `json:"location,omitempty"`
+	Lot        string            `json:"lot,omitempty"`
+	Total      int               `json:"total"`
+	Warehouses []WarehouseStock  `json:"warehouses"`
+	Bins       []models.BinStock `json:"bins"`
+	Expired    []models.BinStock `json:"expired"`
+}
+
+// Holds reports whether any bin holds available stock of the item.
+// Scanners validate an item scanned at a location, with the lot of its
+// barcode, with the availability of the item within it, so expired lots
+// are rejected.
+func (a *Availability) Holds() bool {
+	return a.Total > 0
+}
+
+// Availability returns the bins holding an item, optionally only those
+// within a location and of one lot, with the quantity per warehouse
+func (s *Locations) Availability(ctx context.Context, itemID, location, lot string) (*Availability, error) {
+	query := bson.M{"itemId": itemID, "quantity": bson.M{"$gt": 0}}
+	if location != "" {
+		query["location"] = Within(location)
+	}
+	if lot != "" {
+		query["lot"] = lot
+	}
+
+	bins, err := s.find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	a := availability(itemID, location, bins, time.Now())
+	a.Lot = lot
+	return a, nil
+}
+
+// availability totals the available bins of an item per warehouse. The
+// bins are ordered by location, which keeps the warehouses together.
+func availability(itemID, location string, bins []models.BinStock, now time.Time) *Availability {
+	a := &Availability{ItemID: itemID, Location: location, Warehouses: []WarehouseStock{},
+		Bins: []models.BinStock{}, Expired: []models.BinStock{}}
+	for _, bin := range bins {
+		if bin.ExpiresAt != nil && !now.Before(*bin.ExpiresAt) {
+			a.Expired = append(a.Expired, bin)
+			continue
+		}
+		a.Bins = append(a.Bins, bin)
+		a.Total += bin.Quantity
+		if n := len(a.Warehouses); n > 0 && a.Warehouses[n-1].Warehouse == bin.Warehouse {
+			a.Warehouses[n-1].Quantity += bin.Quantity
+			continue
+		}
+		a.Warehouses = append(a.Warehouses, WarehouseStock{Warehouse: bin.Warehouse, Quantity: bin.Quantity})
+	}
+	return a
+}
+
+// Contents returns the stock held within a location, by bin and item
+func (s *Locations) Contents(ctx context.Context, code string) ([]models.BinStock, error) {
+	return s.find(ctx, bson.M{"location": Within(code), "quantity": bson.M{"$gt": 0}})
+}
+
+// find returns the bin stock matching a query, ordered by location
+func (s *Locations) find(ctx context.Context, query bson.M) ([]models.BinStock, error) {
+	cursor, err := s.bins.Find(ctx, query,
+		options.Find().SetSort(bson.D{{Key: "location", Value: 1}, {Key: "itemId", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find bin stock: %w", err)
+	}
+
+	bins := []models.BinStock{}
+	if err := cursor.All(ctx, &bins); err != nil {
+		return nil, fmt.Errorf("failed to decode bin stock: %w", err)
+	}
+	return bins, nil
+}
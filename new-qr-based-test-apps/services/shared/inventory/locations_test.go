@@ -0,0 +1,105 @@
+package inventory
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"warehouse-shared/models"
+)
+
+func TestParseLocation(t *testing.T) {
+	bin, err := ParseLocation("JKT-A-01-R2-B04")
+	require.NoError(t, err)
+	assert.Equal(t, &models.Location{
+		Code:      "JKT-A-01-R2-B04",
+		Level:     models.LevelBin,
+		Parent:    "JKT-A-01-R2",
+		Warehouse: "JKT",
+		Zone:      "A",
+		Aisle:     "01",
+		Rack:      "R2",
+		Bin:       "B04",
+	}, bin)
+
+	warehouse, err := ParseLocation("JKT")
+	require.NoError(t, err)
+	assert.Equal(t, models.LevelWarehouse, warehouse.Level)
+	assert.Empty(t, warehouse.Parent)
+
+	zone, err := ParseLocation("JKT-A")
+	require.NoError(t, err)
+	assert.Equal(t, models.LevelZone, zone.Level)
+	assert.Equal(t, "JKT", zone.Parent)
+
+	for _, code := range []string{"", "JKT-", "JKT--01", "JKT-A-01-R2-B04-X", "Mobile Scanner"} {
+		_, err := ParseLocation(code)
+		assert.ErrorIs(t, err, ErrInvalidLocation, code)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	pattern := regexp.MustCompile(Within("JKT-A-01")["$regex"].(string))
+	for code, match := range map[string]bool{
+		"JKT-A-01":        true,
+		"JKT-A-01-R2-B04": true,
+		"JKT-A-010":       false,
+		"JKT-A":           false,
+		"SBY-A-01":        false,
+	} {
+		assert.Equal(t, match, pattern.MatchString(code), code)
+	}
+}
+
+func TestLocationFilterQuery(t *testing.T) {
+	assert.Equal(t, bson.M{"code": Within("JKT"), "level": models.LevelBin},
+		LocationFilter{Within: "JKT", Level: models.LevelBin}.query())
+	assert.Equal(t, bson.M{}, LocationFilter{}.query())
+}
+
+func TestAvailability(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	a := availability("ITM-2024-001", "", []models.BinStock{
+		{Location: "JKT-A-01-R1-B01", Warehouse: "JKT", Quantity: 60},
+		{Location: "JKT-B-02-R1-B03", Warehouse: "JKT", Quantity: 40},
+		{Location: "SBY-A-01-R1-B01", Warehouse: "SBY", Lot: "L1", ExpiresAt: &yesterday, Quantity: 30},
+		{Location: "SBY-A-01-R1-B01", Warehouse: "SBY", Quantity: 50},
+	}, now)
+	assert.True(t, a.Holds())
+	assert.Equal(t, 150, a.Total)
+	assert.Equal(t, []WarehouseStock{{"JKT", 100}, {"SBY", 50}}, a.Warehouses)
+	assert.Len(t, a.Bins, 3)
+	assert.Len(t, a.Expired, 1)
+
+	empty := availability("ITM-2024-001", "SBY-B", []models.BinStock{}, now)
+	assert.False(t, empty.Holds(), "a scan in a location without the item is invalid")
+	assert.Equal(t, []WarehouseStock{}, empty.Warehouses)
+
+	expired := availability("ITM-2024-001", "SBY", []models.BinStock{
+		{Location: "SBY-A-01-R1-B01", Warehouse: "SBY", Lot: "L1", ExpiresAt: &yesterday, Quantity: 30},
+	}, now)
+	assert.False(t, expired.Holds(), "a scan of an expired lot is invalid")
+}
+
+func TestCanHold(t *testing.T) {
+	bin := &models.Location{Code: "JKT-A-01-R1-B01", Level: models.LevelBin, Active: true,
+		Capacity: models.Capacity{MaxUnits: 100}, Occupied: 80}
+	assert.NoError(t, canHold(bin, 20))
+	assert.ErrorIs(t, canHold(bin, 21), ErrCapacityExceeded)
+
+	unlimited := *bin
+	unlimited.Capacity = models.Capacity{}
+	assert.NoError(t, canHold(&unlimited, 1000))
+
+	inactive := *bin
+	inactive.Active = false
+	assert.ErrorIs(t, canHold(&inactive, 1), ErrInvalidMovement)
+
+	rack := &models.Location{Code: "JKT-A-01-R1", Level: models.LevelRack, Active: true}
+	assert.ErrorIs(t, canHold(rack, 1), ErrInvalidMovement)
+}
@@ -0,0 +1,243 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// ErrLotNotFound is returned when an item has no lot with a lot number
+var ErrLotNotFound = errors.New("lot not found")
+
+// Lots reads the lots of items. Lots are created and their quantities
+// changed by the stock ledger.
+type Lots struct {
+	lots *mongo.Collection
+}
+
+// NewLots creates a new lot store
+func NewLots(db *database.MongoDB) *Lots {
+	return &Lots{lots: db.GetCollection(database.LotsCollection)}
+}
+
+// EnsureIndexes creates the unique lot number index and the expiry index
+// of the near-expiry report and alerts
+func (s *Lots) EnsureIndexes(ctx context.Context) error {
+	_, err := s.lots.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "lotNumber", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create lot indexes: %w", err)
+	}
+	return nil
+}
+
+// List returns the lots of an item, lots without an expiry date first and
+// then by expiry date
+func (s *Lots) List(ctx context.Context, itemID string) ([]models.Lot, error) {
+	cursor, err := s.lots.Find(ctx, bson.M{"itemId": itemID},
+		options.Find().SetSort(bson.D{{Key: "expiresAt", Value: 1}, {Key: "lotNumber", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lots: %w", err)
+	}
+
+	lots := []models.Lot{}
+	if err := cursor.All(ctx, &lots); err != nil {
+		return nil, fmt.Errorf("failed to decode lots: %w", err)
+	}
+	return lots, nil
+}
+
+// Get returns a lot of an item
+func (s *Lots) Get(ctx context.Context, itemID, lotNumber string) (*models.Lot, error) {
+	var lot models.Lot
+	err := s.lots.FindOne(ctx, bson.M{"itemId": itemID, "lotNumber": lotNumber}).Decode(&lot)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s of %s", ErrLotNotFound, lotNumber, itemID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lot: %w", err)
+	}
+	return &lot, nil
+}
+
+// ExpiringLot is a lot of the near-expiry report with the item it is of
+type ExpiringLot struct {
+	models.Lot `bson:",inline"`
+	Name       string  `bson:"name" json:"name"`
+	Category   string  `bson:"category" json:"category"`
+	UnitCost   float64 `bson:"unitCost" json:"unitCost"`
+}
+
+// NearExpiry returns the lots in stock that expire before until, already
+// expired ones included, soonest first. A category limits the report to
+// the items of that category.
+func (s *Lots) NearExpiry(ctx context.Context, until time.Time, category string) ([]ExpiringLot, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"quantity": bson.M{"$gt": 0}, "expiresAt": bson.M{"$lte": until}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "expiresAt", Value: 1}, {Key: "itemId", Value: 1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         database.ItemsCollection,
+			"localField":   "itemId",
+			"foreignField": "itemId",
+			"as":           "item",
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"name":     bson.M{"$first": "$item.name"},
+			"category": bson.M{"$first": "$item.category"},
+			"unitCost": bson.M{"$first": "$item.costPrice"},
+		}}},
+		{{Key: "$unset", Value: "item"}},
+	}
+	if category != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"category": category}}})
+	}
+
+	cursor, err := s.lots.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expiring lots: %w", err)
+	}
+	lots := []ExpiringLot{}
+	if err := cursor.All(ctx, &lots); err != nil {
+		return nil, fmt.Errorf("failed to decode expiring lots: %w", err)
+	}
+	return lots, nil
+}
+
+// DaysLeft returns the number of days until a lot expires, rounded up;
+// zero or less once it has expired
+func DaysLeft(lot *models.Lot, now time.Time) int {
+	if lot.ExpiresAt == nil {
+		return math.MaxInt32
+	}
+	return int(math.Ceil(lot.ExpiresAt.Sub(now).Hours() / 24))
+}
+
+// ExpiryMonitor publishes an EventLotExpiring once for every lot in stock
+// within the warning period of its expiry date, and an EventLotExpired
+// once it has expired. Several instances can run a monitor: each alert is
+// claimed by one of them.
+type ExpiryMonitor struct {
+	lots     *mongo.Collection
+	events   kafka.EventBus
+	warning  time.Duration
+	interval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewExpiryMonitor creates a new expiry monitor checking lots every interval
+func NewExpiryMonitor(db *database.MongoDB, events kafka.EventBus, warning, interval time.Duration) *ExpiryMonitor {
+	return &ExpiryMonitor{
+		lots:     db.GetCollection(database.LotsCollection),
+		events:   events,
+		warning:  warning,
+		interval: interval,
+	}
+}
+
+// Start checks lot expiry dates every interval
+func (e *ExpiryMonitor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.wg.Add(1)
+	go e.run(ctx)
+
+	log.Printf("Lot expiry monitor started, warning %s ahead", e.warning)
+}
+
+// Stop stops the monitor
+func (e *ExpiryMonitor) Stop() {
+	if e.cancel != nil {
+		e.cancel()
+		e.wg.Wait()
+	}
+}
+
+// run checks lots until the monitor is stopped
+func (e *ExpiryMonitor) run(ctx context.Context) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		e.alert(ctx, models.EventLotExpired, "expiredAlertAt", bson.M{"$lte": now}, now)
+		e.alert(ctx, models.EventLotExpiring, "expiringAlertAt", bson.M{"$gt": now, "$lte": now.Add(e.warning)}, now)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// alert publishes an event for every lot in stock with an expiry date in
+// range that has not had it yet. The alert field records the alert.
+func (e *ExpiryMonitor) alert(ctx context.Context, eventType, field string, expiresAt bson.M, now time.Time) {
+	unalerted := bson.M{"$exists": false}
+	cursor, err := e.lots.Find(ctx, bson.M{
+		"quantity":  bson.M{"$gt": 0},
+		"expiresAt": expiresAt,
+		field:       unalerted,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error finding lots to alert: %v", err)
+		}
+		return
+	}
+
+	var lots []models.Lot
+	if err := cursor.All(ctx, &lots); err != nil {
+		log.Printf("Error decoding lots to alert: %v", err)
+		return
+	}
+
+	for i := range lots {
+		lot := &lots[i]
+		claim := bson.M{"_id": lot.ID, field: unalerted}
+		result, err := e.lots.UpdateOne(ctx, claim, bson.M{"$set": bson.M{field: now}})
+		if err != nil {
+			log.Printf("Error claiming %s alert of lot %s: %v", eventType, lot.LotNumber, err)
+			continue
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		if err := e.events.Publish(ctx, models.TopicInventoryEvents, lot.ItemID, lotEvent(eventType, lot, now)); err != nil {
+			log.Printf("Error publishing %s alert of lot %s: %v", eventType, lot.LotNumber, err)
+		}
+	}
+}
+
+// lotEvent is the inventory event of a lot expiry alert
+func lotEvent(eventType string, lot *models.Lot, now time.Time) *models.EventMessage {
+	return models.NewEventMessage(eventType, models.InventoryEvent{
+		ItemID: lot.ItemID,
+		Action: eventType,
+		Changes: map[string]interface{}{
+			"lotNumber": lot.LotNumber,
+			"expiresAt": lot.ExpiresAt,
+			"quantity":  lot.Quantity,
+			"daysLeft":  DaysLeft(lot, now),
+		},
+	})
+}
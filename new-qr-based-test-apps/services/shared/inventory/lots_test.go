@@ -0,0 +1,46 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/models"
+)
+
+func TestDaysLeft(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	expiry := func(d time.Duration) *models.Lot {
+		at := now.Add(d)
+		return &models.Lot{ExpiresAt: &at}
+	}
+
+	assert.Equal(t, 1, DaysLeft(expiry(2*time.Hour), now))
+	assert.Equal(t, 30, DaysLeft(expiry(30*24*time.Hour), now))
+	assert.Equal(t, 0, DaysLeft(expiry(0), now))
+	assert.Equal(t, -2, DaysLeft(expiry(-50*time.Hour), now))
+
+	lot := expiry(-time.Second)
+	assert.True(t, lot.Expired(now))
+	assert.False(t, (&models.Lot{}).Expired(now), "lots without an expiry date never expire")
+}
+
+func TestLotEvent(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.AddDate(0, 0, 10)
+	lot := &models.Lot{ItemID: "ITM-2024-004", LotNumber: "B240301", ExpiresAt: &expiresAt, Quantity: 24}
+
+	event := lotEvent(models.EventLotExpiring, lot, now)
+	assert.Equal(t, models.EventLotExpiring, event.EventType)
+	assert.Equal(t, "ITM-2024-004", event.Subject)
+
+	data := event.Data.(models.InventoryEvent)
+	assert.Equal(t, models.EventLotExpiring, data.Action)
+	assert.Equal(t, map[string]interface{}{
+		"lotNumber": "B240301",
+		"expiresAt": &expiresAt,
+		"quantity":  24,
+		"daysLeft":  10,
+	}, data.Changes)
+}
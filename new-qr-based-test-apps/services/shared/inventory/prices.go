@@ -0,0 +1,493 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// Price change errors
+var (
+	ErrInvalidPrice        = errors.New("invalid price change")
+	ErrPriceChangeNotFound = errors.New("price change not found")
+	ErrPriceChangeStatus   = errors.New("price change is not scheduled")
+)
+
+// NewPriceChange is a change of the prices of an item, effective now or
+// from a future date
+type NewPriceChange struct {
+	ItemID        string
+	CostPrice     float64
+	SellingPrice  float64
+	EffectiveFrom time.Time // now when zero
+	Reason        string
+	UserID        string
+}
+
+// validate checks the change, defaulting its effective date to now.
+// History is not rewritten, so the date cannot be in the past.
+func (n *NewPriceChange) validate(now time.Time) error {
+	if n.ItemID == "" {
+		return fmt.Errorf("%w: item ID is required", ErrInvalidPrice)
+	}
+	if n.CostPrice <= 0 || n.SellingPrice <= 0 {
+		return fmt.Errorf("%w: cost and selling price must be positive", ErrInvalidPrice)
+	}
+	if len(n.Reason) > 200 {
+		return fmt.Errorf("%w: reason is longer than 200 characters", ErrInvalidPrice)
+	}
+	if n.EffectiveFrom.IsZero() {
+		n.EffectiveFrom = now
+	}
+	if n.EffectiveFrom.Before(now.Add(-time.Minute)) {
+		return fmt.Errorf("%w: effective date must not be in the past", ErrInvalidPrice)
+	}
+	return nil
+}
+
+// Prices keeps the price history of items. Every change is recorded with
+// the dates it is effective between and the user who made it; changes
+// dated in the future are applied by a PriceScheduler.
+type Prices struct {
+	client  *mongo.Client
+	changes *mongo.Collection
+	items   *mongo.Collection
+	events  kafka.EventBus
+}
+
+// NewPrices creates a new price history store
+func NewPrices(db *database.MongoDB, events kafka.EventBus) *Prices {
+	return &Prices{
+		client:  db.Client,
+		changes: db.GetCollection(database.PriceHistoryCollection),
+		items:   db.GetCollection(database.ItemsCollection),
+		events:  events,
+	}
+}
+
+// EnsureIndexes creates the indexes of the price history of an item and of
+// the changes due
+func (s *Prices) EnsureIndexes(ctx context.Context) error {
+	_, err := s.changes.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "effectiveFrom", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "effectiveFrom", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create price history indexes: %w", err)
+	}
+	return nil
+}
+
+// Change records a price change of an item. A change effective now is
+// applied at once, after any change of the item that is due; a later one
+// is scheduled.
+func (s *Prices) Change(ctx context.Context, n NewPriceChange) (*models.PriceChange, error) {
+	now := time.Now()
+	if err := n.validate(now); err != nil {
+		return nil, err
+	}
+
+	count, err := s.items.CountDocuments(ctx, bson.M{"itemId": n.ItemID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find item: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrItemNotFound, n.ItemID)
+	}
+
+	change := models.PriceChange{
+		ID:            primitive.NewObjectID(),
+		ItemID:        n.ItemID,
+		CostPrice:     n.CostPrice,
+		SellingPrice:  n.SellingPrice,
+		ProfitMargin:  models.ProfitMargin(n.CostPrice, n.SellingPrice),
+		EffectiveFrom: n.EffectiveFrom,
+		Status:        models.PriceScheduled,
+		Reason:        n.Reason,
+		ChangedBy:     n.UserID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := s.changes.InsertOne(ctx, change); err != nil {
+		return nil, fmt.Errorf("failed to record price change: %w", err)
+	}
+	if change.EffectiveFrom.After(now) {
+		return &change, nil
+	}
+
+	if _, err := s.applyDue(ctx, bson.M{"itemId": n.ItemID, "_id": bson.M{"$ne": change.ID}}, now); err != nil {
+		return nil, err
+	}
+	return s.apply(ctx, change.ID, now)
+}
+
+// ApplyDue applies the scheduled changes effective by now, in the order of
+// their effective dates, and returns how many it applied
+func (s *Prices) ApplyDue(ctx context.Context, now time.Time) (int, error) {
+	return s.applyDue(ctx, bson.M{}, now)
+}
+
+// applyDue applies the scheduled changes matching query effective by now.
+// Changes another instance applied or cancelled meanwhile are skipped.
+func (s *Prices) applyDue(ctx context.Context, query bson.M, now time.Time) (int, error) {
+	query["status"] = models.PriceScheduled
+	query["effectiveFrom"] = bson.M{"$lte": now}
+	cursor, err := s.changes.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "effectiveFrom", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find price changes due: %w", err)
+	}
+	var due []models.PriceChange
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, fmt.Errorf("failed to decode price changes: %w", err)
+	}
+
+	applied := 0
+	for _, change := range due {
+		_, err := s.apply(ctx, change.ID, now)
+		if errors.Is(err, ErrPriceChangeStatus) {
+			continue
+		}
+		if err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// apply sets the prices of a scheduled change on its item in one
+// transaction, ending the change in effect until then at its effective
+// date
+func (s *Prices) apply(ctx context.Context, id primitive.ObjectID, now time.Time) (*models.PriceChange, error) {
+	var change models.PriceChange
+	err := transaction(ctx, s.client, func(sc mongo.SessionContext) error {
+		err := s.changes.FindOneAndUpdate(sc,
+			bson.M{"_id": id, "status": models.PriceScheduled},
+			bson.M{"$set": bson.M{"status": models.PriceApplied, "appliedAt": now, "updatedAt": now}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&change)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("%w: %s", ErrPriceChangeStatus, id.Hex())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply price change: %w", err)
+		}
+
+		var item models.Item
+		err = s.items.FindOneAndUpdate(sc, bson.M{"itemId": change.ItemID}, bson.M{"$set": bson.M{
+			"costPrice":    change.CostPrice,
+			"sellingPrice": change.SellingPrice,
+			"profitMargin": change.ProfitMargin,
+			"updatedAt":    now,
+		}}).Decode(&item)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("%w: %s", ErrItemNotFound, change.ItemID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update item prices: %w", err)
+		}
+
+		change.PreviousCostPrice = item.CostPrice
+		change.PreviousSellingPrice = item.SellingPrice
+		if _, err := s.changes.UpdateOne(sc, bson.M{"_id": id}, bson.M{"$set": bson.M{
+			"previousCostPrice":    item.CostPrice,
+			"previousSellingPrice": item.SellingPrice,
+		}}); err != nil {
+			return fmt.Errorf("failed to record previous prices: %w", err)
+		}
+
+		if _, err := s.changes.UpdateMany(sc, bson.M{
+			"itemId":      change.ItemID,
+			"status":      models.PriceApplied,
+			"effectiveTo": bson.M{"$exists": false},
+			"_id":         bson.M{"$ne": id},
+		}, bson.M{"$set": bson.M{"effectiveTo": change.EffectiveFrom, "updatedAt": now}}); err != nil {
+			return fmt.Errorf("failed to end previous prices: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(ctx, &change)
+	return &change, nil
+}
+
+// publish sends the item update of an applied change. The change is
+// already committed, so failures are only logged.
+func (s *Prices) publish(ctx context.Context, change *models.PriceChange) {
+	if s.events == nil {
+		return
+	}
+	event := models.NewEventMessage(models.EventItemUpdated, models.InventoryEvent{
+		ItemID: change.ItemID,
+		Action: "update",
+		Changes: map[string]interface{}{
+			"costPrice":            change.CostPrice,
+			"sellingPrice":         change.SellingPrice,
+			"profitMargin":         change.ProfitMargin,
+			"previousCostPrice":    change.PreviousCostPrice,
+			"previousSellingPrice": change.PreviousSellingPrice,
+			"effectiveFrom":        change.EffectiveFrom,
+			"priceChangeId":        change.ID.Hex(),
+		},
+		UserID: change.ChangedBy,
+	})
+	if err := s.events.Publish(ctx, models.TopicInventoryEvents, change.ItemID, event); err != nil {
+		log.Printf("Error publishing price change of %s: %v", change.ItemID, err)
+	}
+}
+
+// Get returns a price change by ID
+func (s *Prices) Get(ctx context.Context, id primitive.ObjectID) (*models.PriceChange, error) {
+	var change models.PriceChange
+	err := s.changes.FindOne(ctx, bson.M{"_id": id}).Decode(&change)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrPriceChangeNotFound, id.Hex())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find price change: %w", err)
+	}
+	return &change, nil
+}
+
+// Cancel withdraws a scheduled price change
+func (s *Prices) Cancel(ctx context.Context, id primitive.ObjectID, userID string) (*models.PriceChange, error) {
+	var change models.PriceChange
+	err := s.changes.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.PriceScheduled},
+		bson.M{"$set": bson.M{"status": models.PriceCancelled, "cancelledBy": userID, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&change)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := s.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPriceChangeStatus, id.Hex())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel price change: %w", err)
+	}
+	return &change, nil
+}
+
+// PriceFilter selects price changes by item and status
+type PriceFilter struct {
+	ItemID string
+	Status string
+}
+
+// query builds the MongoDB filter of a price filter
+func (f PriceFilter) query() bson.M {
+	query := bson.M{}
+	if f.ItemID != "" {
+		query["itemId"] = f.ItemID
+	}
+	if f.Status != "" {
+		query["status"] = f.Status
+	}
+	return query
+}
+
+// List returns a page of price changes, latest effective first, and the
+// total number of matches
+func (s *Prices) List(ctx context.Context, filter PriceFilter, offset, limit int) ([]models.PriceChange, int64, error) {
+	query := filter.query()
+	total, err := s.changes.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count price changes: %w", err)
+	}
+
+	cursor, err := s.changes.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "effectiveFrom", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list price changes: %w", err)
+	}
+
+	changes := []models.PriceChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode price changes: %w", err)
+	}
+	return changes, total, nil
+}
+
+// Cursor opens a cursor over every matching price change, latest effective
+// first, for exports
+func (s *Prices) Cursor(ctx context.Context, filter PriceFilter) (*mongo.Cursor, error) {
+	cursor, err := s.changes.Find(ctx, filter.query(), options.Find().
+		SetSort(bson.D{{Key: "effectiveFrom", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list price changes: %w", err)
+	}
+	return cursor, nil
+}
+
+// ItemMargin is the prices and profit margin of an item at a date
+type ItemMargin struct {
+	ItemID       string     `json:"itemId"`
+	Name         string     `json:"name"`
+	Category     string     `json:"category"`
+	CostPrice    float64    `json:"costPrice"`
+	SellingPrice float64    `json:"sellingPrice"`
+	ProfitMargin float64    `json:"profitMargin"`
+	PricedSince  *time.Time `json:"pricedSince,omitempty"` // effective date of the prices, unknown before the first change
+}
+
+// MarginReport is the profit margin of the items at a date
+type MarginReport struct {
+	At            time.Time    `json:"at"`
+	AverageMargin float64      `json:"averageMargin"`
+	Items         []ItemMargin `json:"items"`
+}
+
+// Margins returns the prices and profit margin of the items, of one
+// category with category, as they were at a date
+func (s *Prices) Margins(ctx context.Context, at time.Time, category string) (*MarginReport, error) {
+	query := bson.M{}
+	if category != "" {
+		query["category"] = category
+	}
+	cursor, err := s.items.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "itemId", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find items: %w", err)
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+	itemIDs := make([]string, len(items))
+	for i := range items {
+		itemIDs[i] = items[i].ItemID
+	}
+
+	cursor, err = s.changes.Find(ctx, bson.M{
+		"itemId": bson.M{"$in": itemIDs},
+		"status": models.PriceApplied,
+	}, options.Find().SetSort(bson.D{{Key: "effectiveFrom", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find price history: %w", err)
+	}
+	var changes []models.PriceChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, fmt.Errorf("failed to decode price history: %w", err)
+	}
+
+	return marginsAt(items, changes, at), nil
+}
+
+// marginsAt prices the items at a date from their applied changes, oldest
+// first: the last change effective by then, or the prices the first one
+// replaced when it is later. Items never changed have their prices now.
+func marginsAt(items []models.Item, changes []models.PriceChange, at time.Time) *MarginReport {
+	history := map[string][]models.PriceChange{}
+	for _, change := range changes {
+		history[change.ItemID] = append(history[change.ItemID], change)
+	}
+
+	report := &MarginReport{At: at, Items: make([]ItemMargin, 0, len(items))}
+	total := 0.0
+	for i := range items {
+		item := &items[i]
+		margin := ItemMargin{
+			ItemID:       item.ItemID,
+			Name:         item.Name,
+			Category:     item.Category,
+			CostPrice:    item.CostPrice,
+			SellingPrice: item.SellingPrice,
+		}
+
+		changes := history[item.ItemID]
+		n := sort.Search(len(changes), func(i int) bool { return changes[i].EffectiveFrom.After(at) })
+		switch {
+		case n > 0:
+			effective := changes[n-1].EffectiveFrom
+			margin.CostPrice, margin.SellingPrice = changes[n-1].CostPrice, changes[n-1].SellingPrice
+			margin.PricedSince = &effective
+		case len(changes) > 0:
+			margin.CostPrice, margin.SellingPrice = changes[0].PreviousCostPrice, changes[0].PreviousSellingPrice
+		}
+		margin.ProfitMargin = models.ProfitMargin(margin.CostPrice, margin.SellingPrice)
+
+		report.Items = append(report.Items, margin)
+		total += margin.ProfitMargin
+	}
+	if len(report.Items) > 0 {
+		report.AverageMargin = roundCents(total / float64(len(report.Items)))
+	}
+	return report
+}
+
+// PriceScheduler applies scheduled price changes once they are effective.
+// Several instances can run a scheduler: each change is applied by one of
+// them.
+type PriceScheduler struct {
+	prices   *Prices
+	interval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPriceScheduler creates a new scheduler checking for changes due every
+// interval
+func NewPriceScheduler(prices *Prices, interval time.Duration) *PriceScheduler {
+	return &PriceScheduler{prices: prices, interval: interval}
+}
+
+// Start applies the changes due every interval
+func (p *PriceScheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.wg.Add(1)
+	go p.run(ctx)
+
+	log.Printf("Price scheduler started, checking every %s", p.interval)
+}
+
+// Stop stops the scheduler
+func (p *PriceScheduler) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+		p.wg.Wait()
+	}
+}
+
+// run applies changes until the scheduler is stopped
+func (p *PriceScheduler) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		applied, err := p.prices.ApplyDue(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error applying scheduled price changes: %v", err)
+		}
+		if applied > 0 {
+			log.Printf("Applied %d scheduled price changes", applied)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"warehouse-shared/models"
+)
+
+func TestNewPriceChangeValidate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	change := NewPriceChange{ItemID: "ITM-2024-001", CostPrice: 50, SellingPrice: 89.99}
+	require.NoError(t, change.validate(now))
+	assert.Equal(t, now, change.EffectiveFrom, "changes without a date are effective now")
+
+	scheduled := NewPriceChange{ItemID: "ITM-2024-001", CostPrice: 52, SellingPrice: 94.99, EffectiveFrom: now.AddDate(0, 1, 0)}
+	require.NoError(t, scheduled.validate(now))
+
+	for name, n := range map[string]NewPriceChange{
+		"no item":       {CostPrice: 50, SellingPrice: 89.99},
+		"free":          {ItemID: "ITM-2024-001", CostPrice: 50},
+		"no cost":       {ItemID: "ITM-2024-001", SellingPrice: 89.99},
+		"negative cost": {ItemID: "ITM-2024-001", CostPrice: -1, SellingPrice: 89.99},
+		"backdated":     {ItemID: "ITM-2024-001", CostPrice: 50, SellingPrice: 89.99, EffectiveFrom: now.AddDate(0, 0, -1)},
+	} {
+		assert.ErrorIs(t, n.validate(now), ErrInvalidPrice, name)
+	}
+}
+
+func TestProfitMargin(t *testing.T) {
+	assert.Equal(t, 44.44, models.ProfitMargin(50, 89.99))
+	assert.Equal(t, -25.0, models.ProfitMargin(10, 8), "selling at a loss")
+	assert.Zero(t, models.ProfitMargin(10, 0))
+}
+
+func TestPriceFilterQuery(t *testing.T) {
+	assert.Equal(t, bson.M{}, PriceFilter{}.query())
+	assert.Equal(t, bson.M{"itemId": "ITM-2024-001", "status": models.PriceScheduled},
+		PriceFilter{ItemID: "ITM-2024-001", Status: models.PriceScheduled}.query())
+}
+
+func TestMarginsAt(t *testing.T) {
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	items := []models.Item{
+		{ItemID: "ITM-2024-001", Name: "Headphones", Category: "Electronics", CostPrice: 55, SellingPrice: 99.99},
+		{ItemID: "ITM-2024-002", Name: "T-Shirt", Category: "Clothing", CostPrice: 12, SellingPrice: 24},
+	}
+	changes := []models.PriceChange{
+		{ItemID: "ITM-2024-001", CostPrice: 50, SellingPrice: 89.99, PreviousCostPrice: 48, PreviousSellingPrice: 80, EffectiveFrom: march},
+		{ItemID: "ITM-2024-001", CostPrice: 55, SellingPrice: 99.99, PreviousCostPrice: 50, PreviousSellingPrice: 89.99, EffectiveFrom: may},
+	}
+
+	report := marginsAt(items, changes, march.AddDate(0, 0, -1))
+	assert.Equal(t, 48.0, report.Items[0].CostPrice, "before the first change, the prices it replaced")
+	assert.Equal(t, 40.0, report.Items[0].ProfitMargin)
+	assert.Nil(t, report.Items[0].PricedSince)
+
+	report = marginsAt(items, changes, may.AddDate(0, 0, -1))
+	assert.Equal(t, 89.99, report.Items[0].SellingPrice)
+	assert.Equal(t, &march, report.Items[0].PricedSince)
+
+	report = marginsAt(items, changes, may)
+	assert.Equal(t, 99.99, report.Items[0].SellingPrice, "a change is effective from its date")
+	assert.Equal(t, 44.99, report.Items[0].ProfitMargin)
+	assert.Equal(t, 50.0, report.Items[1].ProfitMargin, "items never changed have their prices now")
+	assert.InDelta(t, 47.5, report.AverageMargin, 0.01)
+}
@@ -0,0 +1,677 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// Errors returned by the reorder store
+var (
+	ErrInvalidPolicy  = errors.New("invalid reorder policy")
+	ErrPolicyNotFound = errors.New("reorder policy not found")
+	ErrAlertNotFound  = errors.New("stock alert not found")
+	ErrAlertResolved  = errors.New("stock alert already resolved")
+)
+
+// ReorderConsumerGroup is the Kafka consumer group of the reorder evaluator
+const ReorderConsumerGroup = "reorder-evaluator"
+
+// unresolved matches the alerts that are still open or acknowledged
+var unresolved = bson.M{"$ne": models.AlertResolved}
+
+// Reorder keeps the reorder policies of items, raises stock alerts when
+// their stock falls to a reorder point and suggests what to reorder
+type Reorder struct {
+	policies  *mongo.Collection
+	alerts    *mongo.Collection
+	items     *mongo.Collection
+	bins      *mongo.Collection
+	movements *mongo.Collection
+	events    kafka.EventBus
+}
+
+// NewReorder creates a new reorder store publishing alerts to an event bus
+func NewReorder(db *database.MongoDB, events kafka.EventBus) *Reorder {
+	return &Reorder{
+		policies:  db.GetCollection(database.ReorderPoliciesCollection),
+		alerts:    db.GetCollection(database.StockAlertsCollection),
+		items:     db.GetCollection(database.ItemsCollection),
+		bins:      db.GetCollection(database.BinStockCollection),
+		movements: db.GetCollection(database.StockMovementsCollection),
+		events:    events,
+	}
+}
+
+// EnsureIndexes creates the unique policy index and the alert indexes, of
+// which one keeps a single unresolved alert per item and location
+func (r *Reorder) EnsureIndexes(ctx context.Context) error {
+	_, err := r.policies.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "itemId", Value: 1}, {Key: "location", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create reorder policy indexes: %w", err)
+	}
+
+	_, err = r.alerts.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "location", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "raisedAt", Value: -1}}},
+		{
+			// One unresolved alert per item and location, however many
+			// movements evaluate the stock at once
+			Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "location", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": bson.M{"$in": bson.A{models.AlertOpen, models.AlertAcknowledged}}}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stock alert indexes: %w", err)
+	}
+	return nil
+}
+
+// validatePolicy checks the levels and location of a reorder policy
+func validatePolicy(policy *models.ReorderPolicy) error {
+	if policy.ReorderPoint < 0 || policy.SafetyStock < 0 {
+		return fmt.Errorf("%w: reorder point and safety stock must not be negative", ErrInvalidPolicy)
+	}
+	if policy.SafetyStock > policy.ReorderPoint {
+		return fmt.Errorf("%w: safety stock must not exceed the reorder point", ErrInvalidPolicy)
+	}
+	if policy.ReorderQuantity <= 0 {
+		return fmt.Errorf("%w: reorder quantity must be positive", ErrInvalidPolicy)
+	}
+	if policy.Location != "" {
+		if _, err := ParseLocation(policy.Location); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+		}
+	}
+	return nil
+}
+
+// SetPolicy creates or replaces the policy of an item and location and
+// evaluates the stock of the item against it
+func (r *Reorder) SetPolicy(ctx context.Context, policy *models.ReorderPolicy) error {
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+	count, err := r.items.CountDocuments(ctx, bson.M{"itemId": policy.ItemID})
+	if err != nil {
+		return fmt.Errorf("failed to find item: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s", ErrItemNotFound, policy.ItemID)
+	}
+
+	now := time.Now()
+	err = r.policies.FindOneAndUpdate(ctx,
+		bson.M{"itemId": policy.ItemID, "location": policy.Location},
+		bson.M{
+			"$set": bson.M{
+				"reorderPoint":    policy.ReorderPoint,
+				"safetyStock":     policy.SafetyStock,
+				"reorderQuantity": policy.ReorderQuantity,
+				"updatedBy":       policy.UpdatedBy,
+				"updatedAt":       now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(policy)
+	if err != nil {
+		return fmt.Errorf("failed to save reorder policy: %w", err)
+	}
+	return r.Evaluate(ctx, policy.ItemID)
+}
+
+// DeletePolicy removes the policy of an item and location and resolves
+// its alert
+func (r *Reorder) DeletePolicy(ctx context.Context, itemID, location string) error {
+	result, err := r.policies.DeleteOne(ctx, bson.M{"itemId": itemID, "location": location})
+	if err != nil {
+		return fmt.Errorf("failed to delete reorder policy: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s %s", ErrPolicyNotFound, itemID, location)
+	}
+
+	now := time.Now()
+	if _, err := r.alerts.UpdateMany(ctx,
+		bson.M{"itemId": itemID, "location": location, "status": unresolved},
+		bson.M{"$set": bson.M{"status": models.AlertResolved, "resolvedAt": now, "updatedAt": now}}); err != nil {
+		return fmt.Errorf("failed to resolve stock alerts: %w", err)
+	}
+	return nil
+}
+
+// Policies returns the reorder policies of an item, or of every item
+// without one, ordered by item and location
+func (r *Reorder) Policies(ctx context.Context, itemID string) ([]models.ReorderPolicy, error) {
+	query := bson.M{}
+	if itemID != "" {
+		query["itemId"] = itemID
+	}
+	cursor, err := r.policies.Find(ctx, query,
+		options.Find().SetSort(bson.D{{Key: "itemId", Value: 1}, {Key: "location", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reorder policies: %w", err)
+	}
+
+	policies := []models.ReorderPolicy{}
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, fmt.Errorf("failed to decode reorder policies: %w", err)
+	}
+	return policies, nil
+}
+
+// AlertFilter selects the stock alerts of Alerts
+type AlertFilter struct {
+	ItemID   string
+	Status   string // empty for the unresolved alerts
+	Severity string
+}
+
+// query builds the MongoDB filter of an alert filter
+func (f AlertFilter) query() bson.M {
+	query := bson.M{"status": unresolved}
+	if f.Status != "" {
+		query["status"] = f.Status
+	}
+	if f.ItemID != "" {
+		query["itemId"] = f.ItemID
+	}
+	if f.Severity != "" {
+		query["severity"] = f.Severity
+	}
+	return query
+}
+
+// Alerts returns a page of stock alerts, newest first, and the total
+// number of matches
+func (r *Reorder) Alerts(ctx context.Context, filter AlertFilter, offset, limit int) ([]models.StockAlert, int64, error) {
+	query := filter.query()
+	total, err := r.alerts.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count stock alerts: %w", err)
+	}
+
+	cursor, err := r.alerts.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "raisedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list stock alerts: %w", err)
+	}
+
+	alerts := []models.StockAlert{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode stock alerts: %w", err)
+	}
+	return alerts, total, nil
+}
+
+// AlertCursor opens a cursor over every matching stock alert, newest
+// first, for exports
+func (r *Reorder) AlertCursor(ctx context.Context, filter AlertFilter) (*mongo.Cursor, error) {
+	cursor, err := r.alerts.Find(ctx, filter.query(), options.Find().
+		SetSort(bson.D{{Key: "raisedAt", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stock alerts: %w", err)
+	}
+	return cursor, nil
+}
+
+// Acknowledge marks an unresolved alert as seen. It stays acknowledged
+// until the stock recovers, or becomes critical and opens again.
+func (r *Reorder) Acknowledge(ctx context.Context, id primitive.ObjectID, userID string) (*models.StockAlert, error) {
+	var alert models.StockAlert
+	err := r.alerts.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": unresolved},
+		bson.M{"$set": bson.M{"status": models.AlertAcknowledged, "acknowledgedBy": userID, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&alert)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, countErr := r.alerts.CountDocuments(ctx, bson.M{"_id": id})
+		if countErr != nil {
+			return nil, fmt.Errorf("failed to find stock alert: %w", countErr)
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrAlertNotFound, id.Hex())
+		}
+		return nil, fmt.Errorf("%w: %s", ErrAlertResolved, id.Hex())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to acknowledge stock alert: %w", err)
+	}
+	return &alert, nil
+}
+
+// Evaluate checks the stock of an item against its reorder policies and
+// raises, escalates or resolves their alerts
+func (r *Reorder) Evaluate(ctx context.Context, itemID string) error {
+	policies, err := r.Policies(ctx, itemID)
+	if err != nil || len(policies) == 0 {
+		return err
+	}
+
+	var item models.Item
+	if err := r.items.FindOne(ctx, bson.M{"itemId": itemID}).Decode(&item); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return fmt.Errorf("failed to get item: %w", err)
+	}
+	bins, err := r.binStock(ctx, bson.M{"itemId": itemID})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range policies {
+		policy := &policies[i]
+		onHand := onHandOf(policy, item.StockLevel, bins[itemID])
+		if err := r.raise(ctx, policy, severity(policy, onHand), onHand, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// severity returns the alert severity of the stock of a policy, empty when
+// it is above the reorder point
+func severity(policy *models.ReorderPolicy, onHand int) string {
+	switch {
+	case onHand <= policy.SafetyStock:
+		return models.AlertCritical
+	case onHand <= policy.ReorderPoint:
+		return models.AlertLow
+	}
+	return ""
+}
+
+// onHandOf returns the stock a policy watches: the stock level of the item,
+// or what its bins within the policy's location hold
+func onHandOf(policy *models.ReorderPolicy, stockLevel int, bins map[string]int) int {
+	if policy.Location == "" {
+		return stockLevel
+	}
+	return sumWithin(bins, policy.Location)
+}
+
+// sumWithin adds up quantities per location code over the codes within a
+// location, or over all of them without one
+func sumWithin(quantities map[string]int, location string) int {
+	sum := 0
+	for code, quantity := range quantities {
+		if location == "" || code == location || strings.HasPrefix(code, location+models.LocationSeparator) {
+			sum += quantity
+		}
+	}
+	return sum
+}
+
+// raise brings the alert of a policy in line with the severity of its
+// stock. A new alert and an alert becoming critical are published as an
+// EventLowStock; an alert whose stock recovered is resolved. New alerts are
+// upserted, so that concurrent evaluations raise and publish one alert.
+func (r *Reorder) raise(ctx context.Context, policy *models.ReorderPolicy, level string, onHand int, now time.Time) error {
+	var alert models.StockAlert
+	err := r.alerts.FindOne(ctx, bson.M{"itemId": policy.ItemID, "location": policy.Location, "status": unresolved}).Decode(&alert)
+	found := err == nil
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("failed to find stock alert: %w", err)
+	}
+
+	if !found {
+		if level == "" {
+			return nil
+		}
+		alert = models.StockAlert{
+			ID:              primitive.NewObjectID(),
+			ItemID:          policy.ItemID,
+			Location:        policy.Location,
+			Severity:        level,
+			Status:          models.AlertOpen,
+			OnHand:          onHand,
+			ReorderPoint:    policy.ReorderPoint,
+			SafetyStock:     policy.SafetyStock,
+			ReorderQuantity: policy.ReorderQuantity,
+			RaisedAt:        now,
+			UpdatedAt:       now,
+		}
+		result, err := r.alerts.UpdateOne(ctx,
+			bson.M{"itemId": policy.ItemID, "location": policy.Location, "status": unresolved},
+			bson.M{"$setOnInsert": alert}, options.Update().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			// Raised concurrently by another evaluation of the stock
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to raise stock alert: %w", err)
+		}
+		if result.UpsertedCount > 0 {
+			r.publish(ctx, &alert)
+		}
+		return nil
+	}
+
+	set := bson.M{
+		"onHand":          onHand,
+		"reorderPoint":    policy.ReorderPoint,
+		"safetyStock":     policy.SafetyStock,
+		"reorderQuantity": policy.ReorderQuantity,
+		"updatedAt":       now,
+	}
+	escalated := level == models.AlertCritical && alert.Severity != models.AlertCritical
+	switch {
+	case level == "":
+		set["status"] = models.AlertResolved
+		set["resolvedAt"] = now
+	case escalated:
+		set["severity"] = level
+		set["status"] = models.AlertOpen
+	default:
+		set["severity"] = level
+	}
+	if err := r.alerts.FindOneAndUpdate(ctx, bson.M{"_id": alert.ID}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&alert); err != nil {
+		return fmt.Errorf("failed to update stock alert: %w", err)
+	}
+	if escalated {
+		r.publish(ctx, &alert)
+	}
+	return nil
+}
+
+// publish sends the low stock event of an alert. The alert is already
+// recorded, so failures are only logged.
+func (r *Reorder) publish(ctx context.Context, alert *models.StockAlert) {
+	if r.events == nil {
+		return
+	}
+	if err := r.events.Publish(ctx, models.TopicInventoryEvents, alert.ItemID, lowStockEvent(alert)); err != nil {
+		log.Printf("Error publishing low stock alert of %s: %v", alert.ItemID, err)
+	}
+}
+
+// lowStockEvent is the inventory event of a stock alert
+func lowStockEvent(alert *models.StockAlert) *models.EventMessage {
+	changes := map[string]interface{}{
+		"alertId":         alert.ID.Hex(),
+		"severity":        alert.Severity,
+		"onHand":          alert.OnHand,
+		"reorderPoint":    alert.ReorderPoint,
+		"safetyStock":     alert.SafetyStock,
+		"reorderQuantity": alert.ReorderQuantity,
+	}
+	if alert.Location != "" {
+		changes["warehouseLocation"] = alert.Location
+		changes["warehouse"] = warehouseOf(alert.Location)
+	}
+	return models.NewEventMessage(models.EventLowStock, models.InventoryEvent{
+		ItemID:  alert.ItemID,
+		Action:  models.EventLowStock,
+		Changes: changes,
+	})
+}
+
+// binStock returns the quantity per item and bin of the matching bin stock
+func (r *Reorder) binStock(ctx context.Context, match bson.M) (map[string]map[string]int, error) {
+	match["quantity"] = bson.M{"$gt": 0}
+	cursor, err := r.bins.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"itemId": "$itemId", "location": "$location"},
+			"quantity": bson.M{"$sum": "$quantity"},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum bin stock: %w", err)
+	}
+	var rows []struct {
+		ID struct {
+			ItemID   string `bson:"itemId"`
+			Location string `bson:"location"`
+		} `bson:"_id"`
+		Quantity int `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode bin stock: %w", err)
+	}
+
+	stock := map[string]map[string]int{}
+	for _, row := range rows {
+		if stock[row.ID.ItemID] == nil {
+			stock[row.ID.ItemID] = map[string]int{}
+		}
+		stock[row.ID.ItemID][row.ID.Location] = row.Quantity
+	}
+	return stock, nil
+}
+
+// ReorderEvaluator evaluates the reorder policies of an item after every
+// change to its stock
+type ReorderEvaluator struct {
+	reorder      *Reorder
+	bus          kafka.EventBus
+	subscription kafka.Subscription
+}
+
+// NewReorderEvaluator creates a new reorder evaluator
+func NewReorderEvaluator(reorder *Reorder, bus kafka.EventBus) *ReorderEvaluator {
+	return &ReorderEvaluator{reorder: reorder, bus: bus}
+}
+
+// Start subscribes to the inventory events
+func (e *ReorderEvaluator) Start() error {
+	sub, err := e.bus.Subscribe(models.TopicInventoryEvents, ReorderConsumerGroup, e.handleEvent)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", models.TopicInventoryEvents, err)
+	}
+	e.subscription = sub
+
+	log.Printf("Reorder evaluator started")
+	return nil
+}
+
+// Stop stops consuming events
+func (e *ReorderEvaluator) Stop() {
+	if e.subscription == nil {
+		return
+	}
+	if err := e.subscription.Close(); err != nil {
+		log.Printf("Error closing reorder subscription: %v", err)
+	}
+	e.subscription = nil
+}
+
+// handleEvent evaluates the item of a stock update. Failures are returned
+// so that the event is retried.
+func (e *ReorderEvaluator) handleEvent(ctx context.Context, event *models.EventMessage) error {
+	if event.EventType != models.EventStockUpdated {
+		return nil
+	}
+	var data models.InventoryEvent
+	if err := event.DecodeData(&data); err != nil {
+		log.Printf("Skipping stock update %s: %v", event.EventID, err)
+		return nil
+	}
+	if data.ItemID == "" {
+		return nil
+	}
+	return e.reorder.Evaluate(ctx, data.ItemID)
+}
+
+// ReorderSuggestion is a proposed reorder of an item for one of its
+// policies, sized from the recent demand
+type ReorderSuggestion struct {
+	ItemID          string   `json:"itemId"`
+	Name            string   `json:"name"`
+	Category        string   `json:"category"`
+	Location        string   `json:"location"`
+	Severity        string   `json:"severity"`
+	OnHand          int      `json:"onHand"`
+	ReorderPoint    int      `json:"reorderPoint"`
+	SafetyStock     int      `json:"safetyStock"`
+	ReorderQuantity int      `json:"reorderQuantity"`
+	Demand          int      `json:"demand"` // units issued over the demand window
+	DailyDemand     float64  `json:"dailyDemand"`
+	DaysOfCover     *float64 `json:"daysOfCover"` // nil without demand
+	Quantity        int      `json:"quantity"`
+	UnitCost        float64  `json:"unitCost"`
+	Value           float64  `json:"value"`
+}
+
+// Suggestions proposes a reorder for every policy whose stock is at its
+// reorder point. The quantity covers the average daily demand of the past
+// days for cover days on top of the safety stock, and is at least the
+// reorder quantity of the policy. Critical suggestions come first.
+func (r *Reorder) Suggestions(ctx context.Context, days, cover int, now time.Time) ([]ReorderSuggestion, error) {
+	policies, err := r.Policies(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	suggestions := []ReorderSuggestion{}
+	if len(policies) == 0 {
+		return suggestions, nil
+	}
+
+	var itemIDs []string
+	for _, policy := range policies {
+		if !containsString(itemIDs, policy.ItemID) {
+			itemIDs = append(itemIDs, policy.ItemID)
+		}
+	}
+	items, err := r.itemsByID(ctx, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+	bins, err := r.binStock(ctx, bson.M{"itemId": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return nil, err
+	}
+	demand, err := r.demand(ctx, itemIDs, now.AddDate(0, 0, -days))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range policies {
+		policy := &policies[i]
+		item, ok := items[policy.ItemID]
+		if !ok {
+			continue
+		}
+		onHand := onHandOf(policy, item.StockLevel, bins[policy.ItemID])
+		level := severity(policy, onHand)
+		if level == "" {
+			continue
+		}
+		suggestion := suggest(policy, onHand, sumWithin(demand[policy.ItemID], policy.Location), days, cover)
+		suggestion.Name = item.Name
+		suggestion.Category = item.Category
+		suggestion.Severity = level
+		suggestion.UnitCost = item.CostPrice
+		suggestion.Value = float64(suggestion.Quantity) * item.CostPrice
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Severity == models.AlertCritical && suggestions[j].Severity != models.AlertCritical
+	})
+	return suggestions, nil
+}
+
+// suggest sizes the reorder of a policy from the units issued over days
+func suggest(policy *models.ReorderPolicy, onHand, issued, days, cover int) ReorderSuggestion {
+	daily := float64(issued) / float64(days)
+	quantity := int(math.Ceil(daily*float64(cover))) + policy.SafetyStock - onHand
+	if quantity < policy.ReorderQuantity {
+		quantity = policy.ReorderQuantity
+	}
+
+	suggestion := ReorderSuggestion{
+		ItemID:          policy.ItemID,
+		Location:        policy.Location,
+		OnHand:          onHand,
+		ReorderPoint:    policy.ReorderPoint,
+		SafetyStock:     policy.SafetyStock,
+		ReorderQuantity: policy.ReorderQuantity,
+		Demand:          issued,
+		DailyDemand:     math.Round(daily*100) / 100,
+		Quantity:        quantity,
+	}
+	if daily > 0 {
+		cover := math.Round(float64(onHand)/daily*10) / 10
+		suggestion.DaysOfCover = &cover
+	}
+	return suggestion
+}
+
+// itemsByID returns items by item ID
+func (r *Reorder) itemsByID(ctx context.Context, itemIDs []string) (map[string]models.Item, error) {
+	cursor, err := r.items.Find(ctx, bson.M{"itemId": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find items: %w", err)
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+
+	byID := make(map[string]models.Item, len(items))
+	for _, item := range items {
+		byID[item.ItemID] = item
+	}
+	return byID, nil
+}
+
+// demand returns the units issued per item and bin since a time
+func (r *Reorder) demand(ctx context.Context, itemIDs []string, since time.Time) (map[string]map[string]int, error) {
+	cursor, err := r.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"itemId":    bson.M{"$in": itemIDs},
+			"type":      models.MovementIssue,
+			"createdAt": bson.M{"$gte": since},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"itemId": "$itemId", "location": "$warehouseLocation"},
+			"units": bson.M{"$sum": bson.M{"$multiply": bson.A{-1, "$quantity"}}},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute demand: %w", err)
+	}
+	var rows []struct {
+		ID struct {
+			ItemID   string `bson:"itemId"`
+			Location string `bson:"location"`
+		} `bson:"_id"`
+		Units int `bson:"units"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode demand: %w", err)
+	}
+
+	demand := map[string]map[string]int{}
+	for _, row := range rows {
+		if demand[row.ID.ItemID] == nil {
+			demand[row.ID.ItemID] = map[string]int{}
+		}
+		demand[row.ID.ItemID][row.ID.Location] += row.Units
+	}
+	return demand, nil
+}
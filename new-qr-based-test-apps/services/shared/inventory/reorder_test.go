@@ -0,0 +1,123 @@
+package inventory
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"warehouse-shared/database"
+	"warehouse-shared/database/mongotest"
+	"warehouse-shared/models"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	valid := models.ReorderPolicy{ItemID: "ITM-2024-001", ReorderPoint: 40, SafetyStock: 10, ReorderQuantity: 100}
+	assert.NoError(t, validatePolicy(&valid))
+
+	located := valid
+	located.Location = "JKT-A"
+	assert.NoError(t, validatePolicy(&located))
+
+	for name, change := range map[string]func(p *models.ReorderPolicy){
+		"negative point":     func(p *models.ReorderPolicy) { p.ReorderPoint = -1 },
+		"safety above point": func(p *models.ReorderPolicy) { p.SafetyStock = 50 },
+		"no quantity":        func(p *models.ReorderPolicy) { p.ReorderQuantity = 0 },
+		"bad location":       func(p *models.ReorderPolicy) { p.Location = "Mobile Scanner" },
+	} {
+		policy := valid
+		change(&policy)
+		assert.ErrorIs(t, validatePolicy(&policy), ErrInvalidPolicy, name)
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	policy := &models.ReorderPolicy{ReorderPoint: 40, SafetyStock: 10, ReorderQuantity: 100}
+	assert.Equal(t, "", severity(policy, 41))
+	assert.Equal(t, models.AlertLow, severity(policy, 40))
+	assert.Equal(t, models.AlertLow, severity(policy, 11))
+	assert.Equal(t, models.AlertCritical, severity(policy, 10))
+	assert.Equal(t, models.AlertCritical, severity(&models.ReorderPolicy{ReorderPoint: 5}, 0), "out of stock is critical")
+}
+
+func TestOnHandOf(t *testing.T) {
+	bins := map[string]int{"JKT-A-01-R1-B01": 30, "JKT-A-02-R1-B01": 20, "JKT-AB-01-R1-B01": 5, "SBY-A-01-R1-B01": 50}
+	assert.Equal(t, 150, onHandOf(&models.ReorderPolicy{}, 150, bins), "item policies watch the stock level")
+	assert.Equal(t, 50, onHandOf(&models.ReorderPolicy{Location: "JKT-A"}, 150, bins))
+	assert.Equal(t, 55, onHandOf(&models.ReorderPolicy{Location: "JKT"}, 150, bins))
+	assert.Equal(t, 105, sumWithin(bins, ""))
+}
+
+func TestSuggest(t *testing.T) {
+	policy := &models.ReorderPolicy{ItemID: "ITM-2024-001", ReorderPoint: 40, SafetyStock: 10, ReorderQuantity: 50}
+
+	// 90 units over 30 days is 3 a day, 90 for 30 days of cover
+	s := suggest(policy, 20, 90, 30, 30)
+	assert.Equal(t, 80, s.Quantity, "cover plus safety stock minus what is on hand")
+	assert.Equal(t, 3.0, s.DailyDemand)
+	require.NotNil(t, s.DaysOfCover)
+	assert.InDelta(t, 6.7, *s.DaysOfCover, 0.01)
+
+	s = suggest(policy, 20, 0, 30, 30)
+	assert.Equal(t, 50, s.Quantity, "at least the reorder quantity")
+	assert.Nil(t, s.DaysOfCover)
+}
+
+func TestLowStockEvent(t *testing.T) {
+	alert := &models.StockAlert{ID: primitive.NewObjectID(), ItemID: "ITM-2024-001", Location: "JKT-A",
+		Severity: models.AlertCritical, OnHand: 8, ReorderPoint: 40, SafetyStock: 10, ReorderQuantity: 100}
+	event := lowStockEvent(alert)
+	assert.Equal(t, models.EventLowStock, event.EventType)
+	assert.Equal(t, "ITM-2024-001", event.Subject)
+
+	var data models.InventoryEvent
+	require.NoError(t, event.DecodeData(&data))
+	assert.Equal(t, models.EventLowStock, data.Action)
+	assert.Equal(t, "critical", data.Changes["severity"])
+	assert.Equal(t, "JKT", data.Changes["warehouse"])
+	assert.EqualValues(t, 8, data.Changes["onHand"])
+}
+
+func TestAlertFilterQuery(t *testing.T) {
+	assert.Equal(t, bson.M{"status": unresolved}, AlertFilter{}.query())
+	assert.Equal(t, bson.M{"status": models.AlertResolved, "itemId": "ITM-2024-001", "severity": models.AlertLow},
+		AlertFilter{ItemID: "ITM-2024-001", Status: models.AlertResolved, Severity: models.AlertLow}.query())
+}
+
+func TestReorderEvaluatorSkipsOtherEvents(t *testing.T) {
+	evaluator := NewReorderEvaluator(nil, nil)
+	event := models.NewEventMessage(models.EventLowStock, models.InventoryEvent{ItemID: "ITM-2024-001"})
+	assert.NoError(t, evaluator.handleEvent(context.Background(), event), "its own alerts are not evaluated")
+}
+
+func TestEvaluateRaisesOneAlert(t *testing.T) {
+	db := mongotest.Connect(t)
+	ctx := context.Background()
+	reorder := NewReorder(db, nil)
+	require.NoError(t, reorder.EnsureIndexes(ctx))
+
+	_, err := db.GetCollection(database.ItemsCollection).InsertOne(ctx, models.Item{ItemID: "ITM-2024-001", StockLevel: 3})
+	require.NoError(t, err)
+	require.NoError(t, reorder.SetPolicy(ctx, &models.ReorderPolicy{
+		ItemID: "ITM-2024-001", ReorderPoint: 40, SafetyStock: 10, ReorderQuantity: 100,
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, reorder.Evaluate(ctx, "ITM-2024-001"))
+		}()
+	}
+	wg.Wait()
+
+	alerts, total, err := reorder.Alerts(ctx, AlertFilter{ItemID: "ITM-2024-001"}, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total, "concurrent evaluations raise one alert")
+	assert.Equal(t, models.AlertCritical, alerts[0].Severity)
+}
@@ -0,0 +1,239 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// Errors returned by the serial store
+var (
+	ErrSerialNotFound    = errors.New("serial number not found")
+	ErrSerialUnavailable = errors.New("unit not available")
+	ErrItemHoldsStock    = errors.New("item holds stock")
+)
+
+// Serial history actions besides movement types
+const (
+	SerialActionReserved = "reserved"
+	SerialActionReleased = "released"
+)
+
+// shipmentID matches the references of issues that ship to a shipment
+var shipmentID = regexp.MustCompile(`^SHP-[0-9]{4}-[0-9]{3}$`)
+
+// Serials looks up serialized units and reserves them. Units are
+// registered and moved by the stock ledger.
+type Serials struct {
+	serials   *mongo.Collection
+	items     *mongo.Collection
+	shipments *mongo.Collection
+}
+
+// NewSerials creates a new serial store
+func NewSerials(db *database.MongoDB) *Serials {
+	return &Serials{
+		serials:   db.GetCollection(database.SerialsCollection),
+		items:     db.GetCollection(database.ItemsCollection),
+		shipments: db.GetCollection(database.ShipmentsCollection),
+	}
+}
+
+// EnsureIndexes creates the unique serial number index and the indexes of
+// the unit lists
+func (s *Serials) EnsureIndexes(ctx context.Context) error {
+	_, err := s.serials.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "serialNumber", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "shipmentId", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create serial indexes: %w", err)
+	}
+	return nil
+}
+
+// SetSerialized switches the serialization of an item. It can only be
+// switched while the item holds no stock, so that every unit of a
+// serialized item is registered.
+func (s *Serials) SetSerialized(ctx context.Context, itemID string, serialized bool) error {
+	result, err := s.items.UpdateOne(ctx, bson.M{"itemId": itemID, "stockLevel": 0}, bson.M{"$set": bson.M{
+		"serialized": serialized,
+		"updatedAt":  time.Now(),
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to update item serialization: %w", err)
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	count, err := s.items.CountDocuments(ctx, bson.M{"itemId": itemID})
+	if err != nil {
+		return fmt.Errorf("failed to find item: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s", ErrItemNotFound, itemID)
+	}
+	return fmt.Errorf("%w: serialization of %s changes only without stock", ErrItemHoldsStock, itemID)
+}
+
+// Get returns a unit by serial number
+func (s *Serials) Get(ctx context.Context, serialNumber string) (*models.Serial, error) {
+	var serial models.Serial
+	err := s.serials.FindOne(ctx, bson.M{"serialNumber": serialNumber}).Decode(&serial)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrSerialNotFound, serialNumber)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get serial: %w", err)
+	}
+	return &serial, nil
+}
+
+// SerialTrace is the life of a unit: its history from receipt and the
+// shipment it went out with, whose status tells whether it was delivered
+type SerialTrace struct {
+	models.Serial `bson:",inline"`
+	Shipment      *models.Shipment `json:"shipment,omitempty"`
+}
+
+// Trace returns a unit by serial number with its last shipment
+func (s *Serials) Trace(ctx context.Context, serialNumber string) (*SerialTrace, error) {
+	serial, err := s.Get(ctx, serialNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := &SerialTrace{Serial: *serial}
+	if serial.ShipmentID == "" {
+		return trace, nil
+	}
+	var shipment models.Shipment
+	err = s.shipments.FindOne(ctx, bson.M{"shipmentId": serial.ShipmentID}).Decode(&shipment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return trace, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipment of serial: %w", err)
+	}
+	shipment.CalculateRemainingTime()
+	trace.Shipment = &shipment
+	return trace, nil
+}
+
+// SerialFilter selects the units of List
+type SerialFilter struct {
+	ItemID     string
+	Status     string
+	Within     string // a location code; matches units held in it or in anything inside it
+	ShipmentID string
+}
+
+// query builds the MongoDB filter of a serial filter
+func (f SerialFilter) query() bson.M {
+	query := bson.M{}
+	if f.ItemID != "" {
+		query["itemId"] = f.ItemID
+	}
+	if f.Status != "" {
+		query["status"] = f.Status
+	}
+	if f.Within != "" {
+		query["location"] = Within(f.Within)
+		if f.Status == "" {
+			query["status"] = bson.M{"$in": models.SerialsHeld}
+		}
+	}
+	if f.ShipmentID != "" {
+		query["shipmentId"] = f.ShipmentID
+	}
+	return query
+}
+
+// List returns a page of units ordered by serial number and the total
+// number of matches
+func (s *Serials) List(ctx context.Context, filter SerialFilter, offset, limit int) ([]models.Serial, int64, error) {
+	query := filter.query()
+	total, err := s.serials.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count serials: %w", err)
+	}
+
+	cursor, err := s.serials.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "serialNumber", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list serials: %w", err)
+	}
+
+	serials := []models.Serial{}
+	if err := cursor.All(ctx, &serials); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode serials: %w", err)
+	}
+	return serials, total, nil
+}
+
+// Cursor opens a cursor over every matching unit, ordered by serial
+// number, for exports
+func (s *Serials) Cursor(ctx context.Context, filter SerialFilter) (*mongo.Cursor, error) {
+	cursor, err := s.serials.Find(ctx, filter.query(), options.Find().SetSort(bson.D{{Key: "serialNumber", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list serials: %w", err)
+	}
+	return cursor, nil
+}
+
+// Reserve sets a unit in stock aside for a reference, usually the shipment
+// it is going out with. Only an issue under that reference ships it.
+func (s *Serials) Reserve(ctx context.Context, serialNumber, reference, userID string) (*models.Serial, error) {
+	event := models.SerialEvent{Action: SerialActionReserved, Status: models.SerialReserved, Reference: reference, UserID: userID}
+	return s.change(ctx, serialNumber, []string{models.SerialInStock, models.SerialReturned}, event, bson.M{
+		"$set": bson.M{"status": models.SerialReserved, "reservedFor": reference},
+	})
+}
+
+// Release puts a reserved unit back in stock
+func (s *Serials) Release(ctx context.Context, serialNumber, userID string) (*models.Serial, error) {
+	event := models.SerialEvent{Action: SerialActionReleased, Status: models.SerialInStock, UserID: userID}
+	return s.change(ctx, serialNumber, []string{models.SerialReserved}, event, bson.M{
+		"$set":   bson.M{"status": models.SerialInStock},
+		"$unset": bson.M{"reservedFor": ""},
+	})
+}
+
+// change applies an update to a unit in one of the given statuses, adds
+// the event to its history and returns the unit after it
+func (s *Serials) change(ctx context.Context, serialNumber string, from []string, event models.SerialEvent, update bson.M) (*models.Serial, error) {
+	current, err := s.Get(ctx, serialNumber)
+	if err != nil {
+		return nil, err
+	}
+	event.Location = current.Location
+	event.At = time.Now()
+	update["$set"].(bson.M)["updatedAt"] = event.At
+	update["$push"] = bson.M{"history": event}
+
+	var serial models.Serial
+	err = s.serials.FindOneAndUpdate(ctx,
+		bson.M{"serialNumber": serialNumber, "status": bson.M{"$in": from}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&serial)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s is %s", ErrSerialUnavailable, serialNumber, current.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update serial: %w", err)
+	}
+	return &serial, nil
+}
@@ -0,0 +1,24 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"warehouse-shared/models"
+)
+
+func TestSerialFilterQuery(t *testing.T) {
+	assert.Equal(t, bson.M{"itemId": "ITM-2024-001", "status": models.SerialShipped, "shipmentId": "SHP-2024-001"},
+		SerialFilter{ItemID: "ITM-2024-001", Status: models.SerialShipped, ShipmentID: "SHP-2024-001"}.query())
+	assert.Equal(t, bson.M{"location": Within("JKT-A"), "status": bson.M{"$in": models.SerialsHeld}},
+		SerialFilter{Within: "JKT-A"}.query(), "units within a location are the ones held there")
+	assert.Equal(t, bson.M{}, SerialFilter{}.query())
+}
+
+func TestShipmentID(t *testing.T) {
+	assert.True(t, shipmentID.MatchString("SHP-2024-001"))
+	assert.False(t, shipmentID.MatchString("PO-2024-001"))
+	assert.False(t, shipmentID.MatchString("SHP-2024-001-B"))
+}
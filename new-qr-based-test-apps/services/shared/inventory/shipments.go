@@ -0,0 +1,1011 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// Errors returned by the shipment store
+var (
+	ErrInvalidShipment     = errors.New("invalid shipment")
+	ErrShipmentNotFound    = errors.New("shipment not found")
+	ErrShipmentExists      = errors.New("shipment already exists")
+	ErrInvalidStatusChange = errors.New("invalid shipment status change")
+)
+
+// BackorderConsumerGroup is the Kafka consumer group of the backorder allocator
+const BackorderConsumerGroup = "backorder-allocator"
+
+// transitions are the statuses a shipment goes to from each status.
+// Delivered and cancelled shipments are final.
+var transitions = map[string][]string{
+	models.ShipmentPending:   {models.ShipmentInTransit, models.ShipmentDelayed, models.ShipmentCancelled},
+	models.ShipmentDelayed:   {models.ShipmentInTransit, models.ShipmentDelivered, models.ShipmentCancelled},
+	models.ShipmentInTransit: {models.ShipmentDelivered, models.ShipmentDelayed},
+}
+
+// NewShipment is a shipment to create. Lines priced at zero take the
+// selling price of their item.
+type NewShipment struct {
+	ShipmentID        string
+	Destination       string
+	EstimatedDelivery *time.Time
+	TrackingNumber    string
+	Lines             []models.ShipmentLine
+	UserID            string
+}
+
+// validate checks a new shipment before anything is reserved for it
+func (n *NewShipment) validate() error {
+	if !shipmentID.MatchString(n.ShipmentID) {
+		return fmt.Errorf("%w: shipmentId must match SHP-YYYY-XXX", ErrInvalidShipment)
+	}
+	if len(n.Destination) < 2 {
+		return fmt.Errorf("%w: destination is required", ErrInvalidShipment)
+	}
+	if len(n.Lines) == 0 {
+		return fmt.Errorf("%w: a shipment needs at least one item", ErrInvalidShipment)
+	}
+	seen := make(map[string]bool, len(n.Lines))
+	for _, line := range n.Lines {
+		if line.ItemID == "" {
+			return fmt.Errorf("%w: itemId is required", ErrInvalidShipment)
+		}
+		if line.Quantity <= 0 {
+			return fmt.Errorf("%w: quantity of %s must be positive", ErrInvalidShipment, line.ItemID)
+		}
+		d := line.Dimensions
+		if line.UnitPrice < 0 || line.WeightKg < 0 || d.LengthCm < 0 || d.WidthCm < 0 || d.HeightCm < 0 {
+			return fmt.Errorf("%w: price, weight and dimensions of %s must not be negative", ErrInvalidShipment, line.ItemID)
+		}
+		if seen[line.ItemID] {
+			return fmt.Errorf("%w: %s is listed twice", ErrInvalidShipment, line.ItemID)
+		}
+		seen[line.ItemID] = true
+	}
+	return nil
+}
+
+// Allocation is a shipment with the stock reserved for it. What its items
+// did not have available is backordered.
+type Allocation struct {
+	Shipment     models.Shipment           `json:"shipment"`
+	Reservations []models.StockReservation `json:"reservations"`
+	Status       string                    `json:"allocation"` // allocated, partial or backordered over all items
+	Requested    int                       `json:"requested"`
+	Allocated    int                       `json:"allocated"`
+	Backordered  int                       `json:"backordered"`
+}
+
+// allocationOf sums up the reservations of a shipment
+func allocationOf(shipment models.Shipment, reservations []models.StockReservation) *Allocation {
+	allocation := &Allocation{Shipment: shipment, Reservations: reservations}
+	for i := range reservations {
+		allocation.Requested += reservations[i].Requested
+		allocation.Allocated += reservations[i].Allocated
+		allocation.Backordered += reservations[i].Backordered
+	}
+	switch {
+	case allocation.Backordered == 0:
+		allocation.Status = models.AllocationFull
+	case allocation.Allocated > 0:
+		allocation.Status = models.AllocationPartial
+	default:
+		allocation.Status = models.AllocationBackordered
+	}
+	return allocation
+}
+
+// Shipments creates shipments, reserving the stock of their items, and
+// moves them through their statuses: the reservations of a shipment become
+// stock issues when it goes in transit and are released when it is
+// cancelled. Reservations, issues and the shipment change together in one
+// transaction.
+type Shipments struct {
+	client       *mongo.Client
+	shipments    *mongo.Collection
+	reservations *mongo.Collection
+	items        *mongo.Collection
+	bins         *mongo.Collection
+	lots         *mongo.Collection
+	ledger       *Ledger
+	serials      *Serials
+	events       kafka.EventBus
+}
+
+// NewShipments creates a new shipment store issuing stock through a ledger
+func NewShipments(db *database.MongoDB, ledger *Ledger, events kafka.EventBus) *Shipments {
+	return &Shipments{
+		client:       db.Client,
+		shipments:    db.GetCollection(database.ShipmentsCollection),
+		reservations: db.GetCollection(database.ReservationsCollection),
+		items:        db.GetCollection(database.ItemsCollection),
+		bins:         db.GetCollection(database.BinStockCollection),
+		lots:         db.GetCollection(database.LotsCollection),
+		ledger:       ledger,
+		serials:      NewSerials(db),
+		events:       events,
+	}
+}
+
+// EnsureIndexes creates the indexes of the reservation lookups
+func (s *Shipments) EnsureIndexes(ctx context.Context) error {
+	_, err := s.reservations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "shipmentId", Value: 1}, {Key: "itemId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "backordered", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create reservation indexes: %w", err)
+	}
+	return nil
+}
+
+// Create creates a pending shipment and reserves the stock of its items:
+// as much of each quantity as the item has available, the stock not yet
+// reserved for other shipments. The rest is backordered.
+func (s *Shipments) Create(ctx context.Context, n NewShipment) (*Allocation, error) {
+	if err := n.validate(); err != nil {
+		return nil, err
+	}
+
+	var allocation *Allocation
+	err := s.transaction(ctx, func(sc mongo.SessionContext) error {
+		var err error
+		allocation, err = s.create(sc, &n, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	shipment := &allocation.Shipment
+	s.publish(ctx, models.EventShipmentCreated, "created", n.UserID, shipment.ShipmentID, map[string]interface{}{
+		"status":      shipment.Status,
+		"items":       shipment.ItemIDs(),
+		"units":       shipment.Totals.Units,
+		"value":       shipment.Totals.Value,
+		"allocation":  allocation.Status,
+		"requested":   allocation.Requested,
+		"allocated":   allocation.Allocated,
+		"backordered": allocation.Backordered,
+	})
+	return allocation, nil
+}
+
+// create inserts a shipment with its totals and its reservations
+func (s *Shipments) create(ctx context.Context, n *NewShipment, now time.Time) (*Allocation, error) {
+	shipment := models.Shipment{
+		ID:                primitive.NewObjectID(),
+		ShipmentID:        n.ShipmentID,
+		Lines:             make([]models.ShipmentLine, len(n.Lines)),
+		Destination:       n.Destination,
+		Status:            models.ShipmentPending,
+		EstimatedDelivery: n.EstimatedDelivery,
+		TrackingNumber:    n.TrackingNumber,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	reservations := make([]models.StockReservation, 0, len(n.Lines))
+	docs := make([]interface{}, 0, len(n.Lines))
+	for i, line := range n.Lines {
+		var item models.Item
+		err := s.items.FindOne(ctx, bson.M{"itemId": line.ItemID}).Decode(&item)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: %s", ErrItemNotFound, line.ItemID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find item: %w", err)
+		}
+		if line.UnitPrice == 0 {
+			line.UnitPrice = item.SellingPrice
+		}
+		shipment.Lines[i] = line
+
+		reservation, err := s.reserve(ctx, n, &item, line.Quantity, now)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, *reservation)
+		docs = append(docs, reservation)
+	}
+	shipment.CalculateTotals()
+
+	if _, err := s.shipments.InsertOne(ctx, shipment); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("%w: %s", ErrShipmentExists, n.ShipmentID)
+		}
+		return nil, fmt.Errorf("failed to create shipment: %w", err)
+	}
+	if _, err := s.reservations.InsertMany(ctx, docs); err != nil {
+		return nil, fmt.Errorf("failed to record reservations: %w", err)
+	}
+	return allocationOf(shipment, reservations), nil
+}
+
+// reserve sets aside the available stock of an item for a quantity of a
+// new shipment, naming the units of serialized items
+func (s *Shipments) reserve(ctx context.Context, n *NewShipment, item *models.Item, quantity int, now time.Time) (*models.StockReservation, error) {
+	reservation := &models.StockReservation{
+		ID:         primitive.NewObjectID(),
+		ShipmentID: n.ShipmentID,
+		ItemID:     item.ItemID,
+		Requested:  quantity,
+		Status:     models.ReservationActive,
+		CreatedBy:  n.UserID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	allocated, numbers, err := s.allocate(ctx, item, quantity, n.ShipmentID, n.UserID, now)
+	if err != nil {
+		return nil, err
+	}
+	reservation.Allocated = allocated
+	reservation.Backordered = quantity - allocated
+	reservation.Serials = numbers
+	return reservation, nil
+}
+
+// allocate reserves up to a quantity of the stock of an item for a
+// shipment and returns how much it reserved, naming the units of
+// serialized items. Only stock the shipment could be issued is reserved:
+// stock not reserved for other shipments, in bins and out of expired lots.
+func (s *Shipments) allocate(ctx context.Context, item *models.Item, quantity int, shipmentID, userID string, now time.Time) (int, []string, error) {
+	available, err := s.available(ctx, item, now)
+	if err != nil {
+		return 0, nil, err
+	}
+	allocated := quantity
+	if available < allocated {
+		allocated = available
+	}
+	var numbers []string
+	if item.Serialized && allocated > 0 {
+		numbers, err = s.reserveUnits(ctx, item.ItemID, allocated, shipmentID, userID, now)
+		if err != nil {
+			return 0, nil, err
+		}
+		allocated = len(numbers)
+	}
+	if allocated == 0 {
+		return 0, nil, nil
+	}
+
+	result, err := s.items.UpdateOne(ctx,
+		bson.M{"itemId": item.ItemID, "$expr": availableAtLeast(allocated)},
+		bson.M{"$inc": bson.M{"reserved": allocated}, "$set": bson.M{"updatedAt": now}})
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return 0, nil, fmt.Errorf("%w: %s has less than %d units available", ErrInsufficientStock, item.ItemID, allocated)
+	}
+	item.Reserved += allocated
+	return allocated, numbers, nil
+}
+
+// available returns the units of an item that can be reserved: its
+// available stock, but no more than its bins hold out of expired lots
+// beyond what is already reserved, which picks would refuse to issue
+func (s *Shipments) available(ctx context.Context, item *models.Item, now time.Time) (int, error) {
+	stock, err := s.binStock(ctx, item.ItemID, now)
+	if err != nil {
+		return 0, err
+	}
+	pickable := -item.Reserved
+	for _, bin := range stock {
+		pickable += bin.Quantity
+	}
+
+	available := item.Available()
+	if pickable < available {
+		available = pickable
+	}
+	if available < 0 {
+		return 0, nil
+	}
+	return available, nil
+}
+
+// reserveUnits reserves up to a quantity of the units in stock of an item,
+// in serial number order, and returns their serial numbers. Units without
+// a bin and units of expired lots are left, as the ledger would not issue
+// them.
+func (s *Shipments) reserveUnits(ctx context.Context, itemID string, quantity int, shipmentID, userID string, now time.Time) ([]string, error) {
+	expired, err := s.lots.Distinct(ctx, "lotNumber", bson.M{"itemId": itemID, "expiresAt": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired lots: %w", err)
+	}
+	filter := bson.M{
+		"itemId":   itemID,
+		"status":   bson.M{"$in": []string{models.SerialInStock, models.SerialReturned}},
+		"location": bson.M{"$ne": ""},
+	}
+	if len(expired) > 0 {
+		filter["lot"] = bson.M{"$nin": expired}
+	}
+	cursor, err := s.serials.serials.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "serialNumber", Value: 1}}).SetLimit(int64(quantity)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find units in stock: %w", err)
+	}
+	var units []models.Serial
+	if err := cursor.All(ctx, &units); err != nil {
+		return nil, fmt.Errorf("failed to decode units in stock: %w", err)
+	}
+
+	numbers := make([]string, len(units))
+	for i := range units {
+		if _, err := s.serials.Reserve(ctx, units[i].SerialNumber, shipmentID, userID); err != nil {
+			return nil, err
+		}
+		numbers[i] = units[i].SerialNumber
+	}
+	return numbers, nil
+}
+
+// StatusChange is the outcome of a shipment status change: the shipment,
+// its reservations and the stock issues they became
+type StatusChange struct {
+	Shipment       models.Shipment           `json:"shipment"`
+	PreviousStatus string                    `json:"previousStatus"`
+	Reservations   []models.StockReservation `json:"reservations"`
+	Movements      []models.StockMovement    `json:"movements"`
+}
+
+// issued is a stock issue of a reservation, published once committed
+type issued struct {
+	movement Movement
+	entry    *Entry
+}
+
+// SetStatus moves a shipment to a status. When it goes in transit, or is
+// delivered without having been in transit, the stock of its active
+// reservations is issued under the shipment ID; a shipment with units
+// still backordered does not ship. When it is cancelled its reservations
+// are released; a shipment whose stock left is not cancelled, its stock
+// comes back with returns.
+func (s *Shipments) SetStatus(ctx context.Context, shipmentID, status, userID string) (*StatusChange, error) {
+	var change *StatusChange
+	var issues []issued
+	err := s.transaction(ctx, func(sc mongo.SessionContext) error {
+		var err error
+		change, issues, err = s.setStatus(sc, shipmentID, status, userID, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range issues {
+		s.ledger.publish(ctx, &issues[i].movement, issues[i].entry)
+	}
+	changes := map[string]interface{}{
+		"previousStatus": change.PreviousStatus,
+		"status":         change.Shipment.Status,
+	}
+	if len(change.Movements) > 0 {
+		ids := make([]string, len(change.Movements))
+		for i := range change.Movements {
+			ids[i] = change.Movements[i].ID.Hex()
+		}
+		changes["movementIds"] = ids
+	}
+	s.publish(ctx, models.EventShipmentStatusChanged, "status_changed", userID, shipmentID, changes)
+	return change, nil
+}
+
+// setStatus applies a status change and what it does to the reservations
+func (s *Shipments) setStatus(ctx context.Context, shipmentID, status, userID string, now time.Time) (*StatusChange, []issued, error) {
+	shipment, err := s.get(ctx, shipmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !containsString(transitions[shipment.Status], status) {
+		return nil, nil, fmt.Errorf("%w: a %s shipment cannot become %s", ErrInvalidStatusChange, shipment.Status, status)
+	}
+
+	reservations, err := s.Reservations(ctx, shipmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	change := &StatusChange{PreviousStatus: shipment.Status, Reservations: reservations}
+
+	var issues []issued
+	for i := range reservations {
+		r := &reservations[i]
+		switch {
+		case status == models.ShipmentCancelled && r.Status == models.ReservationIssued:
+			return nil, nil, fmt.Errorf("%w: the stock of %s already left, it comes back with a return",
+				ErrInvalidStatusChange, shipmentID)
+		case status == models.ShipmentCancelled && r.Status == models.ReservationActive:
+			if err := s.release(ctx, r, userID, now); err != nil {
+				return nil, nil, err
+			}
+		case (status == models.ShipmentInTransit || status == models.ShipmentDelivered) && r.Status == models.ReservationActive:
+			if r.Backordered > 0 {
+				return nil, nil, fmt.Errorf("%w: %d units of %s are backordered, %s ships once they are allocated",
+					ErrInvalidStatusChange, r.Backordered, r.ItemID, shipmentID)
+			}
+			done, err := s.issue(ctx, r, userID, now)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, issue := range done {
+				change.Movements = append(change.Movements, issue.entry.Movements...)
+			}
+			issues = append(issues, done...)
+		}
+	}
+
+	set := bson.M{"status": status, "updatedAt": now}
+	if status == models.ShipmentDelivered {
+		set["actualDelivery"] = now
+	}
+	err = s.shipments.FindOneAndUpdate(ctx, bson.M{"shipmentId": shipmentID}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&change.Shipment)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update shipment status: %w", err)
+	}
+	change.Shipment.CalculateRemainingTime()
+	return change, issues, nil
+}
+
+// issue turns an active reservation into stock issues under its shipment:
+// one per location the reserved units of a serialized item are in, or one
+// per bin the reserved quantity is picked from
+func (s *Shipments) issue(ctx context.Context, r *models.StockReservation, userID string, now time.Time) ([]issued, error) {
+	var movements []Movement
+	if r.Allocated > 0 {
+		picks, err := s.picks(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		for _, pick := range picks {
+			movements = append(movements, Movement{
+				ItemID:    r.ItemID,
+				Type:      models.MovementIssue,
+				Quantity:  pick.Quantity,
+				Location:  pick.Location,
+				Serials:   pick.Serials,
+				Reserved:  pick.Quantity,
+				Reference: r.ShipmentID,
+				UserID:    userID,
+			})
+		}
+	}
+
+	issues := make([]issued, 0, len(movements))
+	for _, m := range movements {
+		legs, err := m.legs()
+		if err != nil {
+			return nil, err
+		}
+		entry, err := s.ledger.apply(ctx, &m, legs, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, movement := range entry.Movements {
+			r.MovementIDs = append(r.MovementIDs, movement.ID)
+		}
+		issues = append(issues, issued{movement: m, entry: entry})
+	}
+
+	r.Status = models.ReservationIssued
+	r.UpdatedAt = now
+	if _, err := s.reservations.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": bson.M{
+		"status":      r.Status,
+		"movementIds": r.MovementIDs,
+		"updatedAt":   now,
+	}}); err != nil {
+		return nil, fmt.Errorf("failed to update reservation: %w", err)
+	}
+	return issues, nil
+}
+
+// pick is a quantity of a reservation issued from one location
+type pick struct {
+	Location string
+	Quantity int
+	Serials  []string
+}
+
+// picks splits a reservation over the locations it is issued from. The
+// reserved units of a serialized item leave from where they are. Other
+// items are picked from their default bin first, then from the bins
+// holding most of them; expired lots are not picked.
+func (s *Shipments) picks(ctx context.Context, r *models.StockReservation) ([]pick, error) {
+	if len(r.Serials) > 0 {
+		cursor, err := s.serials.serials.Find(ctx, bson.M{"serialNumber": bson.M{"$in": r.Serials}},
+			options.Find().SetSort(bson.D{{Key: "serialNumber", Value: 1}}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find reserved units: %w", err)
+		}
+		var units []models.Serial
+		if err := cursor.All(ctx, &units); err != nil {
+			return nil, fmt.Errorf("failed to decode reserved units: %w", err)
+		}
+
+		var picks []pick
+		index := map[string]int{}
+		for _, unit := range units {
+			i, ok := index[unit.Location]
+			if !ok {
+				i = len(picks)
+				index[unit.Location] = i
+				picks = append(picks, pick{Location: unit.Location})
+			}
+			picks[i].Quantity++
+			picks[i].Serials = append(picks[i].Serials, unit.SerialNumber)
+		}
+		return picks, nil
+	}
+
+	var item models.Item
+	if err := s.items.FindOne(ctx, bson.M{"itemId": r.ItemID}).Decode(&item); err != nil {
+		return nil, fmt.Errorf("failed to find item: %w", err)
+	}
+	stock, err := s.binStock(ctx, r.ItemID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return pickBins(stock, item.WarehouseLocation, r)
+}
+
+// binStock returns the quantity of an item per location, leaving out
+// expired lots
+func (s *Shipments) binStock(ctx context.Context, itemID string, now time.Time) ([]pick, error) {
+	cursor, err := s.bins.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"itemId":   itemID,
+			"quantity": bson.M{"$gt": 0},
+			"$or":      bson.A{bson.M{"expiresAt": nil}, bson.M{"expiresAt": bson.M{"$gt": now}}},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$location", "quantity": bson.M{"$sum": "$quantity"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "quantity", Value: -1}, {Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate bin stock: %w", err)
+	}
+	var results []struct {
+		Location string `bson:"_id"`
+		Quantity int    `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode bin stock: %w", err)
+	}
+
+	stock := make([]pick, len(results))
+	for i, result := range results {
+		stock[i] = pick{Location: result.Location, Quantity: result.Quantity}
+	}
+	return stock, nil
+}
+
+// pickBins takes the quantity of a reservation from the stock per
+// location, from the default location first and then in the order given
+func pickBins(stock []pick, fallback string, r *models.StockReservation) ([]pick, error) {
+	ordered := make([]pick, 0, len(stock))
+	for _, bin := range stock {
+		if bin.Location == fallback {
+			ordered = append([]pick{bin}, ordered...)
+		} else {
+			ordered = append(ordered, bin)
+		}
+	}
+
+	var picks []pick
+	remaining := r.Allocated
+	for _, bin := range ordered {
+		if remaining == 0 {
+			break
+		}
+		take := bin.Quantity
+		if take > remaining {
+			take = remaining
+		}
+		picks = append(picks, pick{Location: bin.Location, Quantity: take})
+		remaining -= take
+	}
+	if remaining > 0 {
+		return nil, fmt.Errorf("%w: the bins hold %d of the %d units of %s reserved for %s", ErrInsufficientStock,
+			r.Allocated-remaining, r.Allocated, r.ItemID, r.ShipmentID)
+	}
+	return picks, nil
+}
+
+// release gives the stock of an active reservation back to its item and
+// puts its units still reserved for the shipment back in stock
+func (s *Shipments) release(ctx context.Context, r *models.StockReservation, userID string, now time.Time) error {
+	if r.Allocated > 0 {
+		if _, err := s.items.UpdateOne(ctx, bson.M{"itemId": r.ItemID}, bson.M{
+			"$inc": bson.M{"reserved": -r.Allocated},
+			"$set": bson.M{"updatedAt": now},
+		}); err != nil {
+			return fmt.Errorf("failed to release stock: %w", err)
+		}
+	}
+	for _, number := range r.Serials {
+		unit, err := s.serials.Get(ctx, number)
+		if err != nil {
+			return err
+		}
+		if unit.Status != models.SerialReserved || unit.ReservedFor != r.ShipmentID {
+			continue
+		}
+		if _, err := s.serials.Release(ctx, number, userID); err != nil {
+			return err
+		}
+	}
+
+	r.Status = models.ReservationReleased
+	r.UpdatedAt = now
+	if _, err := s.reservations.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": bson.M{
+		"status":    r.Status,
+		"updatedAt": now,
+	}}); err != nil {
+		return fmt.Errorf("failed to update reservation: %w", err)
+	}
+	return nil
+}
+
+// get returns a shipment by ID
+func (s *Shipments) get(ctx context.Context, shipmentID string) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := s.shipments.FindOne(ctx, bson.M{"shipmentId": shipmentID}).Decode(&shipment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrShipmentNotFound, shipmentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipment: %w", err)
+	}
+	return &shipment, nil
+}
+
+// Allocation returns a shipment with its reservations
+func (s *Shipments) Allocation(ctx context.Context, shipmentID string) (*Allocation, error) {
+	shipment, err := s.get(ctx, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := s.Reservations(ctx, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	shipment.CalculateRemainingTime()
+	return allocationOf(*shipment, reservations), nil
+}
+
+// Reservations returns the reservations of a shipment by item ID
+func (s *Shipments) Reservations(ctx context.Context, shipmentID string) ([]models.StockReservation, error) {
+	cursor, err := s.reservations.Find(ctx, bson.M{"shipmentId": shipmentID},
+		options.Find().SetSort(bson.D{{Key: "itemId", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reservations: %w", err)
+	}
+	reservations := []models.StockReservation{}
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return nil, fmt.Errorf("failed to decode reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+// Backorders returns a page of the reservations of shipments not yet
+// shipped that are short of stock, oldest first, of one item with an item
+// ID, and the total number of them
+func (s *Shipments) Backorders(ctx context.Context, itemID string, offset, limit int) ([]models.StockReservation, int64, error) {
+	query := backorderQuery(itemID)
+	total, err := s.reservations.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count backorders: %w", err)
+	}
+
+	cursor, err := s.reservations.Find(ctx, query, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list backorders: %w", err)
+	}
+	backorders := []models.StockReservation{}
+	if err := cursor.All(ctx, &backorders); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode backorders: %w", err)
+	}
+	return backorders, total, nil
+}
+
+// BackorderCursor opens a cursor over every backorder, oldest first, for
+// exports
+func (s *Shipments) BackorderCursor(ctx context.Context, itemID string) (*mongo.Cursor, error) {
+	cursor, err := s.reservations.Find(ctx, backorderQuery(itemID), options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backorders: %w", err)
+	}
+	return cursor, nil
+}
+
+// AllocateBackorders reserves the available stock of an item for its
+// backorders, oldest first, and returns the units allocated. It runs when
+// stock comes in.
+func (s *Shipments) AllocateBackorders(ctx context.Context, itemID string) (int, error) {
+	var allocated []models.StockReservation
+	units := 0
+	err := s.transaction(ctx, func(sc mongo.SessionContext) error {
+		var err error
+		allocated, units, err = s.allocateBackorders(sc, itemID, time.Now())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, r := range allocated {
+		s.publish(ctx, models.EventShipmentUpdated, "allocated", "", r.ShipmentID, map[string]interface{}{
+			"itemId":      r.ItemID,
+			"allocated":   r.Allocated,
+			"backordered": r.Backordered,
+			"allocation":  r.Allocation(),
+		})
+	}
+	return units, nil
+}
+
+// allocateBackorders allocates the backorders of an item until its stock
+// runs out and returns the reservations that changed and the units
+// allocated to them
+func (s *Shipments) allocateBackorders(ctx context.Context, itemID string, now time.Time) ([]models.StockReservation, int, error) {
+	var item models.Item
+	err := s.items.FindOne(ctx, bson.M{"itemId": itemID}).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrItemNotFound, itemID)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find item: %w", err)
+	}
+
+	cursor, err := s.reservations.Find(ctx, backorderQuery(itemID),
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list backorders: %w", err)
+	}
+	var backorders []models.StockReservation
+	if err := cursor.All(ctx, &backorders); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode backorders: %w", err)
+	}
+
+	var changed []models.StockReservation
+	total := 0
+	for i := range backorders {
+		r := &backorders[i]
+		units, numbers, err := s.allocate(ctx, &item, r.Backordered, r.ShipmentID, r.CreatedBy, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		if units == 0 {
+			break
+		}
+
+		update := bson.M{
+			"$inc": bson.M{"allocated": units, "backordered": -units},
+			"$set": bson.M{"updatedAt": now},
+		}
+		if len(numbers) > 0 {
+			update["$push"] = bson.M{"serials": bson.M{"$each": numbers}}
+		}
+		if _, err := s.reservations.UpdateOne(ctx, bson.M{"_id": r.ID}, update); err != nil {
+			return nil, 0, fmt.Errorf("failed to update reservation: %w", err)
+		}
+		r.Allocated += units
+		r.Backordered -= units
+		r.Serials = append(r.Serials, numbers...)
+		r.UpdatedAt = now
+		changed = append(changed, *r)
+		total += units
+	}
+	return changed, total, nil
+}
+
+// BackorderAllocator allocates the backorders of an item whenever its stock
+// goes up
+type BackorderAllocator struct {
+	shipments    *Shipments
+	bus          kafka.EventBus
+	subscription kafka.Subscription
+}
+
+// NewBackorderAllocator creates a new backorder allocator
+func NewBackorderAllocator(shipments *Shipments, bus kafka.EventBus) *BackorderAllocator {
+	return &BackorderAllocator{shipments: shipments, bus: bus}
+}
+
+// Start subscribes to the inventory events
+func (a *BackorderAllocator) Start() error {
+	sub, err := a.bus.Subscribe(models.TopicInventoryEvents, BackorderConsumerGroup, a.handleEvent)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", models.TopicInventoryEvents, err)
+	}
+	a.subscription = sub
+
+	log.Printf("Backorder allocator started")
+	return nil
+}
+
+// Stop stops consuming events
+func (a *BackorderAllocator) Stop() {
+	if a.subscription == nil {
+		return
+	}
+	if err := a.subscription.Close(); err != nil {
+		log.Printf("Error closing backorder subscription: %v", err)
+	}
+	a.subscription = nil
+}
+
+// handleEvent allocates the backorders of the item of a stock update
+// bringing stock in. Failures are returned so that the event is retried.
+func (a *BackorderAllocator) handleEvent(ctx context.Context, event *models.EventMessage) error {
+	if event.EventType != models.EventStockUpdated {
+		return nil
+	}
+	var data models.InventoryEvent
+	if err := event.DecodeData(&data); err != nil {
+		log.Printf("Skipping stock update %s: %v", event.EventID, err)
+		return nil
+	}
+	if quantity, _ := data.Changes["quantity"].(float64); data.ItemID == "" || quantity <= 0 {
+		return nil
+	}
+	_, err := a.shipments.AllocateBackorders(ctx, data.ItemID)
+	if errors.Is(err, ErrItemNotFound) {
+		return nil
+	}
+	return err
+}
+
+// backorderQuery matches the active reservations short of stock, of one
+// item with an item ID
+func backorderQuery(itemID string) bson.M {
+	query := bson.M{"status": models.ReservationActive, "backordered": bson.M{"$gt": 0}}
+	if itemID != "" {
+		query["itemId"] = itemID
+	}
+	return query
+}
+
+// MigrateLines finds the shipments created before shipment lines, which
+// list the IDs of their items in items, and returns their IDs. With apply
+// it turns their items into lines: the quantity is the one reserved for
+// the shipment, or the times the item is listed, and the unit price the
+// current selling price of the item. Weights and dimensions are unknown.
+func (s *Shipments) MigrateLines(ctx context.Context, apply bool) ([]string, error) {
+	cursor, err := s.shipments.Find(ctx, bson.M{"items": bson.M{"$exists": true}, "lines": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "shipmentId", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find shipments without lines: %w", err)
+	}
+	var legacy []struct {
+		ShipmentID string   `bson:"shipmentId"`
+		Items      []string `bson:"items"`
+	}
+	if err := cursor.All(ctx, &legacy); err != nil {
+		return nil, fmt.Errorf("failed to decode shipments without lines: %w", err)
+	}
+
+	ids := make([]string, len(legacy))
+	for i, shipment := range legacy {
+		ids[i] = shipment.ShipmentID
+		if !apply {
+			continue
+		}
+
+		requested := map[string]int{}
+		reservations, err := s.Reservations(ctx, shipment.ShipmentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range reservations {
+			requested[reservation.ItemID] = reservation.Requested
+		}
+		prices, err := s.sellingPrices(ctx, shipment.Items)
+		if err != nil {
+			return nil, err
+		}
+
+		migrated := models.Shipment{Lines: legacyLines(shipment.Items, requested, prices)}
+		migrated.CalculateTotals()
+		if _, err := s.shipments.UpdateOne(ctx, bson.M{"shipmentId": shipment.ShipmentID, "lines": bson.M{"$exists": false}}, bson.M{
+			"$set":   bson.M{"lines": migrated.Lines, "totals": migrated.Totals},
+			"$unset": bson.M{"items": ""},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to migrate shipment %s: %w", shipment.ShipmentID, err)
+		}
+	}
+	return ids, nil
+}
+
+// sellingPrices returns the selling price of items by item ID
+func (s *Shipments) sellingPrices(ctx context.Context, itemIDs []string) (map[string]float64, error) {
+	cursor, err := s.items.Find(ctx, bson.M{"itemId": bson.M{"$in": itemIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find items: %w", err)
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+	prices := make(map[string]float64, len(items))
+	for i := range items {
+		prices[items[i].ItemID] = items[i].SellingPrice
+	}
+	return prices, nil
+}
+
+// legacyLines turns the item IDs of a shipment into lines, one per item
+func legacyLines(itemIDs []string, requested map[string]int, prices map[string]float64) []models.ShipmentLine {
+	var lines []models.ShipmentLine
+	index := map[string]int{}
+	for _, id := range itemIDs {
+		if i, ok := index[id]; ok {
+			lines[i].Quantity++
+			continue
+		}
+		index[id] = len(lines)
+		lines = append(lines, models.ShipmentLine{ItemID: id, Quantity: 1, UnitPrice: prices[id]})
+	}
+	for i := range lines {
+		if quantity := requested[lines[i].ItemID]; quantity > 0 {
+			lines[i].Quantity = quantity
+		}
+	}
+	return lines
+}
+
+// transaction runs fn in a MongoDB transaction
+func (s *Shipments) transaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	return transaction(ctx, s.client, fn)
+}
+
+// transaction runs fn in a MongoDB transaction of a client
+func transaction(ctx context.Context, client *mongo.Client, fn func(sc mongo.SessionContext) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// publish sends a shipment event. The change is already committed, so
+// failures are only logged.
+func (s *Shipments) publish(ctx context.Context, eventType, action, userID, shipmentID string, changes map[string]interface{}) {
+	if s.events == nil {
+		return
+	}
+	event := models.NewEventMessage(eventType, models.ShipmentEvent{
+		ShipmentID: shipmentID,
+		Action:     action,
+		Changes:    changes,
+		UserID:     userID,
+	})
+	if err := s.events.Publish(ctx, models.TopicShipmentEvents, shipmentID, event); err != nil {
+		log.Printf("Error publishing %s of %s: %v", eventType, shipmentID, err)
+	}
+}
@@ -0,0 +1,222 @@
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+func TestNewShipmentValidate(t *testing.T) {
+	valid := NewShipment{
+		ShipmentID:  "SHP-2024-010",
+		Destination: "Jakarta",
+		Lines:       []models.ShipmentLine{{ItemID: "ITM-2024-001", Quantity: 5}, {ItemID: "ITM-2024-003", Quantity: 1}},
+	}
+	require.NoError(t, valid.validate())
+
+	for name, change := range map[string]func(n *NewShipment){
+		"bad id":         func(n *NewShipment) { n.ShipmentID = "SHIP-10" },
+		"no destination": func(n *NewShipment) { n.Destination = "" },
+		"no lines":       func(n *NewShipment) { n.Lines = nil },
+		"no item":        func(n *NewShipment) { n.Lines[0].ItemID = "" },
+		"zero quantity":  func(n *NewShipment) { n.Lines[1].Quantity = 0 },
+		"item twice":     func(n *NewShipment) { n.Lines[1].ItemID = "ITM-2024-001" },
+		"negative price": func(n *NewShipment) { n.Lines[0].UnitPrice = -1 },
+		"negative size":  func(n *NewShipment) { n.Lines[1].Dimensions.HeightCm = -10 },
+	} {
+		n := valid
+		n.Lines = append([]models.ShipmentLine(nil), valid.Lines...)
+		change(&n)
+		assert.ErrorIs(t, n.validate(), ErrInvalidShipment, name)
+	}
+}
+
+func TestAllocationOf(t *testing.T) {
+	full := models.StockReservation{ItemID: "ITM-2024-001", Requested: 5, Allocated: 5}
+	partial := models.StockReservation{ItemID: "ITM-2024-003", Requested: 10, Allocated: 4, Backordered: 6}
+	none := models.StockReservation{ItemID: "ITM-2024-004", Requested: 3, Backordered: 3}
+	assert.Equal(t, models.AllocationFull, full.Allocation())
+	assert.Equal(t, models.AllocationPartial, partial.Allocation())
+	assert.Equal(t, models.AllocationBackordered, none.Allocation())
+
+	allocation := allocationOf(models.Shipment{ShipmentID: "SHP-2024-010"}, []models.StockReservation{full, partial})
+	assert.Equal(t, models.AllocationPartial, allocation.Status)
+	assert.Equal(t, 15, allocation.Requested)
+	assert.Equal(t, 9, allocation.Allocated)
+	assert.Equal(t, 6, allocation.Backordered)
+
+	assert.Equal(t, models.AllocationFull, allocationOf(models.Shipment{}, []models.StockReservation{full}).Status)
+	assert.Equal(t, models.AllocationBackordered, allocationOf(models.Shipment{}, []models.StockReservation{none}).Status)
+}
+
+func TestPickBins(t *testing.T) {
+	stock := []pick{{Location: "JKT-A-01-01-01", Quantity: 8}, {Location: "JKT-A-01-01-02", Quantity: 5}, {Location: "JKT-B-02-01-01", Quantity: 3}}
+	reservation := &models.StockReservation{ItemID: "ITM-2024-001", ShipmentID: "SHP-2024-010", Allocated: 10}
+
+	picks, err := pickBins(stock, "JKT-A-01-01-02", reservation)
+	require.NoError(t, err)
+	assert.Equal(t, []pick{{Location: "JKT-A-01-01-02", Quantity: 5}, {Location: "JKT-A-01-01-01", Quantity: 5}}, picks,
+		"the default bin is picked first")
+
+	reservation.Allocated = 20
+	_, err = pickBins(stock, "JKT-A-01-01-02", reservation)
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+}
+
+func TestTransitions(t *testing.T) {
+	assert.Contains(t, transitions[models.ShipmentPending], models.ShipmentInTransit)
+	assert.Contains(t, transitions[models.ShipmentPending], models.ShipmentCancelled)
+	assert.NotContains(t, transitions[models.ShipmentInTransit], models.ShipmentCancelled, "shipped stock comes back with returns")
+	assert.Empty(t, transitions[models.ShipmentDelivered])
+	assert.Empty(t, transitions[models.ShipmentCancelled])
+}
+
+func TestShipmentTotals(t *testing.T) {
+	shipment := models.Shipment{Lines: []models.ShipmentLine{
+		{ItemID: "ITM-2024-001", Quantity: 20, UnitPrice: 89.99, WeightKg: 0.35,
+			Dimensions: models.Dimensions{LengthCm: 20, WidthCm: 18, HeightCm: 10}},
+		{ItemID: "ITM-2024-003", Quantity: 3, UnitPrice: 19.99, WeightKg: 0.4,
+			Dimensions: models.Dimensions{LengthCm: 30, WidthCm: 10, HeightCm: 10}},
+	}}
+	shipment.CalculateTotals()
+
+	assert.Equal(t, []string{"ITM-2024-001", "ITM-2024-003"}, shipment.ItemIDs())
+	assert.Equal(t, models.ShipmentTotals{
+		Units:              23,
+		Value:              1859.77,
+		GrossWeightKg:      8.2,
+		VolumetricWeightKg: 16.2,
+		ChargeableWeightKg: 16.2,
+	}, shipment.Totals, "light bulky packages are charged by volume")
+}
+
+func TestLegacyLines(t *testing.T) {
+	lines := legacyLines([]string{"ITM-2024-001", "ITM-2024-002", "ITM-2024-001"},
+		map[string]int{"ITM-2024-002": 12}, map[string]float64{"ITM-2024-001": 89.99})
+
+	assert.Equal(t, []models.ShipmentLine{
+		{ItemID: "ITM-2024-001", Quantity: 2, UnitPrice: 89.99},
+		{ItemID: "ITM-2024-002", Quantity: 12},
+	}, lines)
+}
+
+func TestShipmentReservesThenIssuesStock(t *testing.T) {
+	db, ledger := newTestLedger(t, 5)
+	ctx := context.Background()
+	shipments := NewShipments(db, ledger, kafka.NewMemoryBus())
+	require.NoError(t, shipments.EnsureIndexes(ctx))
+
+	allocation, err := shipments.Create(ctx, NewShipment{
+		ShipmentID:  "SHP-2024-010",
+		Destination: "Jakarta",
+		Lines:       []models.ShipmentLine{{ItemID: "ITM-2024-001", Quantity: 3}},
+		UserID:      "user-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.AllocationFull, allocation.Status)
+	assert.Equal(t, 89.99, allocation.Shipment.Lines[0].UnitPrice, "unpriced lines take the selling price")
+
+	level, reserved := stockOf(t, db)
+	assert.Equal(t, 5, level, "reserving moves no stock")
+	assert.Equal(t, 3, reserved)
+
+	_, err = ledger.Record(ctx, Movement{ItemID: "ITM-2024-001", Type: models.MovementIssue, Quantity: 3, UserID: "user-1"})
+	assert.ErrorIs(t, err, ErrInsufficientStock, "reserved stock is not issued to others")
+
+	change, err := shipments.SetStatus(ctx, "SHP-2024-010", models.ShipmentInTransit, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.ShipmentPending, change.PreviousStatus)
+	require.Len(t, change.Movements, 1)
+	assert.Equal(t, models.MovementIssue, change.Movements[0].Type)
+	assert.Equal(t, -3, change.Movements[0].Quantity)
+	assert.Equal(t, "SHP-2024-010", change.Movements[0].Reference)
+
+	reservations, err := shipments.Reservations(ctx, "SHP-2024-010")
+	require.NoError(t, err)
+	require.Len(t, reservations, 1)
+	assert.Equal(t, models.ReservationIssued, reservations[0].Status)
+	assert.Equal(t, []primitive.ObjectID{change.Movements[0].ID}, reservations[0].MovementIDs)
+
+	level, reserved = stockOf(t, db)
+	assert.Equal(t, 2, level)
+	assert.Equal(t, 0, reserved)
+	balance, err := ledger.Balance(ctx, "ITM-2024-001")
+	require.NoError(t, err)
+	assert.Equal(t, level, balance)
+
+	change, err = shipments.SetStatus(ctx, "SHP-2024-010", models.ShipmentDelivered, "user-1")
+	require.NoError(t, err)
+	assert.Empty(t, change.Movements, "issued reservations are not issued again")
+	_, err = shipments.SetStatus(ctx, "SHP-2024-010", models.ShipmentCancelled, "user-1")
+	assert.ErrorIs(t, err, ErrInvalidStatusChange)
+
+	level, _ = stockOf(t, db)
+	assert.Equal(t, 2, level)
+}
+
+func TestBackorderAllocatorSkipsOutgoingStock(t *testing.T) {
+	allocator := NewBackorderAllocator(nil, nil)
+	for _, event := range []*models.EventMessage{
+		models.NewEventMessage(models.EventLowStock, models.InventoryEvent{ItemID: "ITM-2024-001"}),
+		models.NewEventMessage(models.EventStockUpdated, models.InventoryEvent{ItemID: "ITM-2024-001", Changes: map[string]interface{}{"quantity": -3}}),
+		models.NewEventMessage(models.EventStockUpdated, models.InventoryEvent{ItemID: "ITM-2024-001", Changes: map[string]interface{}{"quantity": 0}}),
+	} {
+		assert.NoError(t, allocator.handleEvent(context.Background(), event), event.EventType)
+	}
+}
+
+func TestShipmentWaitsForBackorders(t *testing.T) {
+	db, ledger := newTestLedger(t, 5)
+	ctx := context.Background()
+	shipments := NewShipments(db, ledger, kafka.NewMemoryBus())
+	require.NoError(t, shipments.EnsureIndexes(ctx))
+
+	expired := time.Now().AddDate(0, 0, -1)
+	made := expired.AddDate(0, -6, 0)
+	_, err := ledger.Record(ctx, Movement{ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 2, Lot: "L1",
+		ManufacturedAt: &made, ExpiresAt: &expired, UserID: "user-1"})
+	require.NoError(t, err)
+
+	allocation, err := shipments.Create(ctx, NewShipment{
+		ShipmentID:  "SHP-2024-011",
+		Destination: "Jakarta",
+		Lines:       []models.ShipmentLine{{ItemID: "ITM-2024-001", Quantity: 8}},
+		UserID:      "user-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5, allocation.Allocated, "expired lots are not reserved")
+	assert.Equal(t, 3, allocation.Backordered)
+
+	_, err = shipments.SetStatus(ctx, "SHP-2024-011", models.ShipmentInTransit, "user-1")
+	assert.ErrorIs(t, err, ErrInvalidStatusChange, "backordered shipments do not ship")
+
+	_, err = ledger.Record(ctx, Movement{ItemID: "ITM-2024-001", Type: models.MovementReceipt, Quantity: 4, UserID: "user-1"})
+	require.NoError(t, err)
+	units, err := shipments.AllocateBackorders(ctx, "ITM-2024-001")
+	require.NoError(t, err)
+	assert.Equal(t, 3, units)
+
+	backorders, total, err := shipments.Backorders(ctx, "ITM-2024-001", 0, 10)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, backorders)
+
+	change, err := shipments.SetStatus(ctx, "SHP-2024-011", models.ShipmentInTransit, "user-1")
+	require.NoError(t, err)
+	issued := 0
+	for _, movement := range change.Movements {
+		issued -= movement.Quantity
+	}
+	assert.Equal(t, 8, issued)
+
+	level, reserved := stockOf(t, db)
+	assert.Equal(t, 3, level, "the expired lot stays")
+	assert.Equal(t, 0, reserved)
+}
@@ -0,0 +1,511 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// ErrInvalidValuation is returned for an unknown category or method
+var ErrInvalidValuation = errors.New("invalid valuation policy")
+
+// stockValue is the stock and value of an item while the legs of a
+// movement are valued
+type stockValue struct {
+	method   string
+	standard float64 // the item's cost price
+	level    int
+	value    float64
+	average  float64 // last value per unit, kept while out of stock
+}
+
+// unitCost returns the value per unit of the stock
+func (v *stockValue) unitCost() float64 {
+	switch {
+	case v.method == models.ValuationStandard:
+		return v.standard
+	case v.level > 0:
+		return v.value / float64(v.level)
+	case v.average > 0:
+		return v.average
+	}
+	return v.standard
+}
+
+// in adds units coming in at a unit cost. Standard cost values them at the
+// standard whatever they cost.
+func (v *stockValue) in(quantity int, unitCost float64) {
+	v.level += quantity
+	if v.method == models.ValuationStandard {
+		v.value = roundCents(float64(v.level) * v.standard)
+		return
+	}
+	v.value = roundCents(v.value + float64(quantity)*unitCost)
+	v.average = v.unitCost()
+}
+
+// out takes units out and returns what they cost: what they were drawn
+// from the cost layers at under FIFO, the moving average or the standard
+func (v *stockValue) out(quantity int, drawn float64) float64 {
+	var cost float64
+	switch v.method {
+	case models.ValuationFIFO:
+		cost = drawn
+	case models.ValuationStandard:
+		cost = float64(quantity) * v.standard
+	default:
+		cost = float64(quantity) * v.unitCost()
+	}
+	cost = roundCents(cost)
+
+	v.level -= quantity
+	switch {
+	case v.method == models.ValuationStandard:
+		v.value = roundCents(float64(v.level) * v.standard)
+	case v.level <= 0:
+		v.value = 0
+	default:
+		v.value = math.Max(0, roundCents(v.value-cost))
+		v.average = v.unitCost()
+	}
+	return cost
+}
+
+// openValue starts valuing a movement of an item from its stock before the
+// movement. Stock from before valuation was recorded is valued at the cost
+// price.
+func (l *Ledger) openValue(ctx context.Context, item *models.Item, previousLevel int) (*stockValue, error) {
+	method, err := l.method(ctx, item.Category)
+	if err != nil {
+		return nil, err
+	}
+	stock := &stockValue{
+		method:   method,
+		standard: item.CostPrice,
+		level:    previousLevel,
+		value:    item.StockValue,
+		average:  item.AverageCost,
+	}
+	if item.StockValue == 0 && item.AverageCost == 0 && previousLevel > 0 {
+		stock.value = roundCents(float64(previousLevel) * item.CostPrice)
+	}
+	return stock, nil
+}
+
+// method returns the valuation method of a category
+func (l *Ledger) method(ctx context.Context, category string) (string, error) {
+	var policy models.ValuationPolicy
+	err := l.policies.FindOne(ctx, bson.M{"category": category}).Decode(&policy)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.DefaultValuation, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find valuation policy: %w", err)
+	}
+	return policy.Method, nil
+}
+
+// value sets the unit cost, cost of goods sold and stock value of the
+// movement of a leg. Stock coming in opens a cost layer, at the unit cost
+// of a receipt or the value per unit of the stock; stock going out draws
+// the oldest layers first and is costed by the valuation method. Transfers
+// move stock without changing its value.
+func (l *Ledger) value(ctx context.Context, m *Movement, part leg, stock *stockValue, movement *models.StockMovement, now time.Time) error {
+	if m.Type == models.MovementTransfer {
+		movement.UnitCost = stock.unitCost()
+		movement.StockValue = stock.value
+		return nil
+	}
+
+	if part.quantity > 0 {
+		unitCost := stock.unitCost()
+		if m.Type == models.MovementReceipt {
+			unitCost = movement.UnitCost
+			if m.UnitCost > 0 {
+				unitCost = m.UnitCost
+			}
+		}
+		layer := models.CostLayer{
+			ID:         primitive.NewObjectID(),
+			ItemID:     m.ItemID,
+			MovementID: movement.ID,
+			Quantity:   part.quantity,
+			Remaining:  part.quantity,
+			UnitCost:   unitCost,
+			ReceivedAt: now,
+		}
+		if _, err := l.layers.InsertOne(ctx, layer); err != nil {
+			return fmt.Errorf("failed to open cost layer: %w", err)
+		}
+		stock.in(part.quantity, unitCost)
+		movement.UnitCost = unitCost
+		movement.StockValue = stock.value
+		return nil
+	}
+
+	quantity := -part.quantity
+	drawn, err := l.draw(ctx, m.ItemID, quantity, stock.unitCost())
+	if err != nil {
+		return err
+	}
+	cost := stock.out(quantity, drawn)
+	movement.UnitCost = cost / float64(quantity)
+	if m.Type == models.MovementIssue {
+		movement.COGS = cost
+	}
+	movement.StockValue = stock.value
+	return nil
+}
+
+// draw takes a quantity out of the oldest cost layers of an item and
+// returns what it cost. Units beyond the layers, stock from before they
+// were kept, cost the fallback.
+func (l *Ledger) draw(ctx context.Context, itemID string, quantity int, fallback float64) (float64, error) {
+	cursor, err := l.layers.Find(ctx, bson.M{"itemId": itemID, "remaining": bson.M{"$gt": 0}},
+		options.Find().SetSort(bson.D{{Key: "receivedAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find cost layers: %w", err)
+	}
+	var layers []models.CostLayer
+	if err := cursor.All(ctx, &layers); err != nil {
+		return 0, fmt.Errorf("failed to decode cost layers: %w", err)
+	}
+
+	draws, cost, short := drawLayers(layers, quantity)
+	for id, taken := range draws {
+		if _, err := l.layers.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"remaining": -taken}}); err != nil {
+			return 0, fmt.Errorf("failed to draw cost layer: %w", err)
+		}
+	}
+	return cost + float64(short)*fallback, nil
+}
+
+// drawLayers takes a quantity from layers in order and returns the units
+// taken per layer, their cost and the units the layers fell short of
+func drawLayers(layers []models.CostLayer, quantity int) (map[primitive.ObjectID]int, float64, int) {
+	draws := map[primitive.ObjectID]int{}
+	cost := 0.0
+	for i := range layers {
+		if quantity == 0 {
+			break
+		}
+		taken := layers[i].Remaining
+		if taken > quantity {
+			taken = quantity
+		}
+		draws[layers[i].ID] = taken
+		cost += float64(taken) * layers[i].UnitCost
+		quantity -= taken
+	}
+	return draws, cost, quantity
+}
+
+// setValue stores the stock value of an item once its movement is valued.
+// Out of stock, the average cost stays what the last units cost.
+func (l *Ledger) setValue(ctx context.Context, item *models.Item, stock *stockValue) error {
+	item.StockValue = stock.value
+	item.AverageCost = roundCents(stock.unitCost())
+	if _, err := l.items.UpdateOne(ctx, bson.M{"itemId": item.ItemID}, bson.M{"$set": bson.M{
+		"stockValue":  item.StockValue,
+		"averageCost": item.AverageCost,
+	}}); err != nil {
+		return fmt.Errorf("failed to update stock value: %w", err)
+	}
+	return nil
+}
+
+// roundCents rounds an amount to the cent
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Valuation keeps the valuation method of each item category and values
+// the stock at any date
+type Valuation struct {
+	policies  *mongo.Collection
+	layers    *mongo.Collection
+	items     *mongo.Collection
+	movements *mongo.Collection
+}
+
+// NewValuation creates a new valuation store
+func NewValuation(db *database.MongoDB) *Valuation {
+	return &Valuation{
+		policies:  db.GetCollection(database.ValuationPoliciesCollection),
+		layers:    db.GetCollection(database.CostLayersCollection),
+		items:     db.GetCollection(database.ItemsCollection),
+		movements: db.GetCollection(database.StockMovementsCollection),
+	}
+}
+
+// EnsureIndexes creates the unique category index and the cost layer
+// index drawn from
+func (s *Valuation) EnsureIndexes(ctx context.Context) error {
+	_, err := s.policies.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "category", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create valuation policy indexes: %w", err)
+	}
+
+	_, err = s.layers.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "remaining", Value: 1}, {Key: "receivedAt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create cost layer indexes: %w", err)
+	}
+	return nil
+}
+
+// Policies returns the valuation method of every category, the default
+// for categories without a policy
+func (s *Valuation) Policies(ctx context.Context) ([]models.ValuationPolicy, error) {
+	cursor, err := s.policies.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list valuation policies: %w", err)
+	}
+	var set []models.ValuationPolicy
+	if err := cursor.All(ctx, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode valuation policies: %w", err)
+	}
+
+	policies := make([]models.ValuationPolicy, len(models.Categories))
+	for i, category := range models.Categories {
+		policies[i] = models.ValuationPolicy{Category: category, Method: models.DefaultValuation}
+		for _, policy := range set {
+			if policy.Category == category {
+				policies[i] = policy
+			}
+		}
+	}
+	return policies, nil
+}
+
+// methods returns the valuation method per category
+func (s *Valuation) methods(ctx context.Context) (map[string]string, error) {
+	policies, err := s.Policies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	methods := make(map[string]string, len(policies))
+	for _, policy := range policies {
+		methods[policy.Category] = policy.Method
+	}
+	return methods, nil
+}
+
+// SetMethod sets the valuation method of a category. It applies from the
+// next movement of each of its items.
+func (s *Valuation) SetMethod(ctx context.Context, category, method, userID string) (*models.ValuationPolicy, error) {
+	if !containsString(models.Categories, category) {
+		return nil, fmt.Errorf("%w: unknown category %q", ErrInvalidValuation, category)
+	}
+	if !containsString(models.ValuationMethods, method) {
+		return nil, fmt.Errorf("%w: method must be fifo, average or standard", ErrInvalidValuation)
+	}
+
+	var policy models.ValuationPolicy
+	err := s.policies.FindOneAndUpdate(ctx,
+		bson.M{"category": category},
+		bson.M{"$set": bson.M{"method": method, "updatedBy": userID, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save valuation policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// Layers returns the cost layers of an item, oldest first, only those with
+// stock left when open
+func (s *Valuation) Layers(ctx context.Context, itemID string, open bool) ([]models.CostLayer, error) {
+	query := bson.M{"itemId": itemID}
+	if open {
+		query["remaining"] = bson.M{"$gt": 0}
+	}
+	cursor, err := s.layers.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "receivedAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cost layers: %w", err)
+	}
+
+	layers := []models.CostLayer{}
+	if err := cursor.All(ctx, &layers); err != nil {
+		return nil, fmt.Errorf("failed to decode cost layers: %w", err)
+	}
+	return layers, nil
+}
+
+// ItemValuation is the value of the stock of an item at a date
+type ItemValuation struct {
+	ItemID     string  `json:"itemId"`
+	Name       string  `json:"name"`
+	Category   string  `json:"category"`
+	Method     string  `json:"method"`
+	StockLevel int     `json:"stockLevel"`
+	UnitCost   float64 `json:"unitCost"`
+	Value      float64 `json:"value"`
+}
+
+// CategoryValuation is the value of the stock of a category at a date
+type CategoryValuation struct {
+	Category string  `json:"category"`
+	Method   string  `json:"method"`
+	Items    int     `json:"items"`
+	Units    int     `json:"units"`
+	Value    float64 `json:"value"`
+}
+
+// ValuationReport values the stock of the items at a date
+type ValuationReport struct {
+	At         time.Time           `json:"at"`
+	Units      int                 `json:"units"`
+	Value      float64             `json:"value"`
+	Categories []CategoryValuation `json:"categories"`
+	Items      []ItemValuation     `json:"items"`
+}
+
+// lastValue is the stock value recorded by the last movement of an item
+// before a date, nil when it was recorded before valuation
+type lastValue struct {
+	ItemID     string   `bson:"_id"`
+	StockValue *float64 `bson:"stockValue"`
+}
+
+// Report values the stock of the items, of one category with category, as
+// it was at a date. The stock level is the current one less the movements
+// since; the value is what the last movement before the date left, under
+// the method the item was valued by then.
+func (s *Valuation) Report(ctx context.Context, at time.Time, category string) (*ValuationReport, error) {
+	query := bson.M{}
+	if category != "" {
+		query["category"] = category
+	}
+	cursor, err := s.items.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "itemId", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find items: %w", err)
+	}
+	var items []models.Item
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode items: %w", err)
+	}
+	itemIDs := make([]string, len(items))
+	for i := range items {
+		itemIDs[i] = items[i].ItemID
+	}
+
+	cursor, err = s.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"itemId": bson.M{"$in": itemIDs}, "createdAt": bson.M{"$gte": at}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$itemId", "quantity": bson.M{"$sum": "$quantity"}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum movements since %s: %w", at.Format(time.RFC3339), err)
+	}
+	var since []struct {
+		ItemID   string `bson:"_id"`
+		Quantity int    `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &since); err != nil {
+		return nil, fmt.Errorf("failed to decode movements: %w", err)
+	}
+	after := make(map[string]int, len(since))
+	for _, row := range since {
+		after[row.ItemID] = row.Quantity
+	}
+
+	cursor, err = s.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"itemId": bson.M{"$in": itemIDs}, "createdAt": bson.M{"$lt": at}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "itemId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$itemId", "stockValue": bson.M{"$first": "$stockValue"}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stock values: %w", err)
+	}
+	var values []lastValue
+	if err := cursor.All(ctx, &values); err != nil {
+		return nil, fmt.Errorf("failed to decode stock values: %w", err)
+	}
+	last := make(map[string]lastValue, len(values))
+	for _, value := range values {
+		last[value.ItemID] = value
+	}
+
+	methods, err := s.methods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return valuate(items, after, last, methods, at), nil
+}
+
+// valuate values the stock of items at a date from the movements since and
+// the last stock value before it. Items without a recorded value are valued
+// at their value per unit, or their cost price.
+func valuate(items []models.Item, after map[string]int, last map[string]lastValue, methods map[string]string, at time.Time) *ValuationReport {
+	report := &ValuationReport{At: at, Categories: []CategoryValuation{}, Items: []ItemValuation{}}
+	categories := map[string]*CategoryValuation{}
+	for i := range items {
+		item := &items[i]
+		level := item.StockLevel - after[item.ItemID]
+		if level <= 0 {
+			continue
+		}
+
+		var value float64
+		previous, moved := last[item.ItemID]
+		switch {
+		case moved && previous.StockValue != nil:
+			value = *previous.StockValue
+		case !moved && after[item.ItemID] == 0 && item.StockValue > 0:
+			value = item.StockValue
+		case item.AverageCost > 0:
+			value = roundCents(float64(level) * item.AverageCost)
+		default:
+			value = roundCents(float64(level) * item.CostPrice)
+		}
+
+		method := methods[item.Category]
+		if method == "" {
+			method = models.DefaultValuation
+		}
+		report.Items = append(report.Items, ItemValuation{
+			ItemID:     item.ItemID,
+			Name:       item.Name,
+			Category:   item.Category,
+			Method:     method,
+			StockLevel: level,
+			UnitCost:   roundCents(value / float64(level)),
+			Value:      value,
+		})
+
+		category, ok := categories[item.Category]
+		if !ok {
+			category = &CategoryValuation{Category: item.Category, Method: method}
+			categories[item.Category] = category
+		}
+		category.Items++
+		category.Units += level
+		category.Value += value
+		report.Units += level
+		report.Value += value
+	}
+
+	for _, category := range categories {
+		category.Value = roundCents(category.Value)
+		report.Categories = append(report.Categories, *category)
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		return report.Categories[i].Category < report.Categories[j].Category
+	})
+	report.Value = roundCents(report.Value)
+	return report
+}
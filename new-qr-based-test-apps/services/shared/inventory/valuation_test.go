@@ -0,0 +1,87 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"warehouse-shared/models"
+)
+
+func TestStockValue(t *testing.T) {
+	// 10 units in at 5 and 10 at 8, then 15 out drawn from the layers at 90
+	for _, tc := range []struct {
+		method    string
+		cost      float64
+		remaining float64
+		unitCost  float64
+	}{
+		{models.ValuationFIFO, 90, 40, 8},
+		{models.ValuationAverage, 97.5, 32.5, 6.5},
+		{models.ValuationStandard, 90, 30, 6},
+	} {
+		stock := &stockValue{method: tc.method, standard: 6}
+		stock.in(10, 5)
+		stock.in(10, 8)
+		assert.Equal(t, tc.cost, stock.out(15, 90), tc.method)
+		assert.Equal(t, 5, stock.level, tc.method)
+		assert.Equal(t, tc.remaining, stock.value, tc.method)
+		assert.Equal(t, tc.unitCost, stock.unitCost(), tc.method)
+	}
+
+	stock := &stockValue{method: models.ValuationAverage, standard: 6}
+	stock.in(3, 7)
+	assert.Equal(t, 21.0, stock.out(3, 0))
+	assert.Equal(t, 0.0, stock.value)
+	assert.Equal(t, 7.0, stock.unitCost(), "out of stock, units cost what the last ones did")
+}
+
+func TestDrawLayers(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	layers := []models.CostLayer{
+		{ID: first, Remaining: 4, UnitCost: 5},
+		{ID: second, Remaining: 10, UnitCost: 8},
+	}
+
+	draws, cost, short := drawLayers(layers, 6)
+	assert.Equal(t, map[primitive.ObjectID]int{first: 4, second: 2}, draws)
+	assert.Equal(t, 36.0, cost)
+	assert.Zero(t, short)
+
+	draws, cost, short = drawLayers(layers, 20)
+	assert.Equal(t, map[primitive.ObjectID]int{first: 4, second: 10}, draws)
+	assert.Equal(t, 100.0, cost)
+	assert.Equal(t, 6, short, "units beyond the layers are left to the fallback cost")
+}
+
+func TestValuate(t *testing.T) {
+	at := time.Date(2024, 6, 30, 23, 59, 59, 0, time.UTC)
+	value := 120.0
+	items := []models.Item{
+		{ItemID: "ITM-2024-001", Name: "Scanner", Category: "Electronics", StockLevel: 12, StockValue: 150, CostPrice: 9},
+		{ItemID: "ITM-2024-002", Name: "Shirt", Category: "Clothing", StockLevel: 5, StockValue: 50, AverageCost: 10, CostPrice: 8},
+		{ItemID: "ITM-2024-003", Name: "Cable", Category: "Electronics", StockLevel: 4, CostPrice: 2.5},
+		{ItemID: "ITM-2024-004", Name: "Hammer", Category: "Tools", StockLevel: 3, CostPrice: 4},
+	}
+	after := map[string]int{"ITM-2024-001": 2, "ITM-2024-002": -3, "ITM-2024-004": 3}
+	last := map[string]lastValue{"ITM-2024-001": {ItemID: "ITM-2024-001", StockValue: &value}}
+	methods := map[string]string{"Electronics": models.ValuationFIFO}
+
+	report := valuate(items, after, last, methods, at)
+	require.Len(t, report.Items, 3, "items without stock at the date are left out")
+	assert.Equal(t, ItemValuation{ItemID: "ITM-2024-001", Name: "Scanner", Category: "Electronics",
+		Method: models.ValuationFIFO, StockLevel: 10, UnitCost: 12, Value: 120}, report.Items[0])
+	assert.Equal(t, 80.0, report.Items[1].Value, "valued at the average cost without an earlier movement")
+	assert.Equal(t, models.DefaultValuation, report.Items[1].Method)
+	assert.Equal(t, 10.0, report.Items[2].Value, "valued at the cost price without a value")
+
+	assert.Equal(t, 22, report.Units)
+	assert.Equal(t, 210.0, report.Value)
+	assert.Equal(t, []CategoryValuation{
+		{Category: "Clothing", Method: models.DefaultValuation, Items: 1, Units: 8, Value: 80},
+		{Category: "Electronics", Method: models.ValuationFIFO, Items: 2, Units: 14, Value: 130},
+	}, report.Categories)
+}
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"warehouse-shared/models"
+)
+
+// EventHandler processes an event delivered by an EventBus
+type EventHandler func(ctx context.Context, event *models.EventMessage) error
+
+// Subscription represents an active EventBus subscription
+type Subscription interface {
+	Close() error
+}
+
+// EventBus publishes and subscribes to events.
+//
+// All implementations share the same delivery semantics:
+//   - every consumer group receives every event published to a topic,
+//     subscribers in the same group share the events between them
+//   - a subscriber sees the events of a topic in publish order
+//   - a new group starts from the oldest retained event
+//   - delivery is at-least-once: a failing handler is retried
+//     maxDeliveryAttempts times before the message is moved to the
+//     topic's dead-letter topic (see DeadLetterTopic) and skipped;
+//     messages that cannot be decoded go there directly
+//
+// SubscribeLatest reads a topic without a consumer group instead: every
+// such subscriber receives the events published after it subscribed, once,
+// with nothing committed or dead-lettered.
+type EventBus interface {
+	Publish(ctx context.Context, topic, key string, event *models.EventMessage) error
+	Subscribe(topic, groupID string, handler EventHandler) (Subscription, error)
+	SubscribeLatest(topic string, handler EventHandler) (Subscription, error)
+	Close() error
+}
+
+// Compile-time checks that both implementations satisfy EventBus
+var (
+	_ EventBus = (*KafkaService)(nil)
+	_ EventBus = (*MemoryBus)(nil)
+)
+
+// Delivery settings shared by the EventBus implementations
+const (
+	maxDeliveryAttempts = 3
+	retryBackoff        = 200 * time.Millisecond
+)
+
+// Headers added to messages moved to a dead-letter topic
+const (
+	HeaderDeadLetterTopic     = "dlq_topic"
+	HeaderDeadLetterPartition = "dlq_partition"
+	HeaderDeadLetterOffset    = "dlq_offset"
+	HeaderDeadLetterGroup     = "dlq_group"
+	HeaderDeadLetterError     = "dlq_error"
+)
+
+// deadLetterMessage copies a message that could not be processed, adding
+// headers describing where it came from and why it failed
+func deadLetterMessage(message kafka.Message, groupID string, cause error) kafka.Message {
+	headers := make([]kafka.Header, 0, len(message.Headers)+5)
+	headers = append(headers, message.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDeadLetterTopic, Value: []byte(message.Topic)},
+		kafka.Header{Key: HeaderDeadLetterPartition, Value: []byte(strconv.Itoa(message.Partition))},
+		kafka.Header{Key: HeaderDeadLetterOffset, Value: []byte(strconv.FormatInt(message.Offset, 10))},
+		kafka.Header{Key: HeaderDeadLetterGroup, Value: []byte(groupID)},
+		kafka.Header{Key: HeaderDeadLetterError, Value: []byte(fmt.Sprint(cause))},
+	)
+
+	return kafka.Message{
+		Key:     message.Key,
+		Value:   message.Value,
+		Headers: headers,
+	}
+}
+
+// deliver runs a handler, retrying with a linear backoff when it fails
+func deliver(ctx context.Context, topic string, handler EventHandler, event *models.EventMessage) error {
+	var err error
+	for attempt := 1; attempt <= maxDeliveryAttempts; attempt++ {
+		if err = handler(ctx, event); err == nil {
+			return nil
+		}
+
+		log.Printf("Handler failed for event %s on topic %s (attempt %d/%d): %v",
+			event.EventID, topic, attempt, maxDeliveryAttempts, err)
+
+		if attempt < maxDeliveryAttempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * retryBackoff):
+			}
+		}
+	}
+	return err
+}
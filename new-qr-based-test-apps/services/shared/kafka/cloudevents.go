@@ -0,0 +1,204 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"warehouse-shared/models"
+)
+
+// EventMode selects how events are written to a topic
+type EventMode string
+
+// Event modes
+const (
+	// EventModeLegacy writes the plain EventMessage JSON used before CloudEvents
+	EventModeLegacy EventMode = "legacy"
+	// EventModeStructured writes the whole CloudEvent as the message value
+	EventModeStructured EventMode = "structured"
+	// EventModeBinary writes CloudEvents attributes as ce_ headers and the data as the value
+	EventModeBinary EventMode = "binary"
+)
+
+// CloudEvents Kafka protocol binding headers
+const (
+	HeaderContentType      = "content-type"
+	CloudEventsContentType = "application/cloudevents+json"
+
+	ceHeaderSpecVersion = "ce_specversion"
+	ceHeaderID          = "ce_id"
+	ceHeaderSource      = "ce_source"
+	ceHeaderType        = "ce_type"
+	ceHeaderTime        = "ce_time"
+	ceHeaderSubject     = "ce_subject"
+)
+
+// ParseEventMode parses an event mode name
+func ParseEventMode(mode string) (EventMode, error) {
+	switch EventMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", EventModeLegacy:
+		return EventModeLegacy, nil
+	case EventModeStructured:
+		return EventModeStructured, nil
+	case EventModeBinary:
+		return EventModeBinary, nil
+	default:
+		return "", fmt.Errorf("unknown event mode: %q", mode)
+	}
+}
+
+// ParseTopicEventModes parses a per-topic mode list such as
+// "inventory-events=binary,scan-events=structured"
+func ParseTopicEventModes(spec string) (map[string]EventMode, error) {
+	modes := make(map[string]EventMode)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid topic event mode %q, expected topic=mode", entry)
+		}
+
+		mode, err := ParseEventMode(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		modes[strings.TrimSpace(parts[0])] = mode
+	}
+	return modes, nil
+}
+
+// EncodeEvent builds a Kafka message for an event using the given mode
+func EncodeEvent(event *models.EventMessage, key []byte, mode EventMode) (kafka.Message, error) {
+	message := kafka.Message{Key: key}
+
+	switch mode {
+	case EventModeStructured:
+		ce, err := event.ToCloudEvent()
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		value, err := json.Marshal(ce)
+		if err != nil {
+			return kafka.Message{}, fmt.Errorf("failed to marshal CloudEvent: %w", err)
+		}
+		message.Value = value
+		message.Headers = []kafka.Header{{Key: HeaderContentType, Value: []byte(CloudEventsContentType)}}
+
+	case EventModeBinary:
+		ce, err := event.ToCloudEvent()
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		message.Value = ce.Data
+		if len(ce.DataBase64) > 0 {
+			message.Value = ce.DataBase64
+		}
+		message.Headers = []kafka.Header{
+			{Key: ceHeaderSpecVersion, Value: []byte(ce.SpecVersion)},
+			{Key: ceHeaderID, Value: []byte(ce.ID)},
+			{Key: ceHeaderSource, Value: []byte(ce.Source)},
+			{Key: ceHeaderType, Value: []byte(ce.Type)},
+			{Key: HeaderContentType, Value: []byte(ce.DataContentType)},
+		}
+		if ce.Time != nil {
+			message.Headers = append(message.Headers, kafka.Header{Key: ceHeaderTime, Value: []byte(ce.Time.Format(time.RFC3339Nano))})
+		}
+		if ce.Subject != "" {
+			message.Headers = append(message.Headers, kafka.Header{Key: ceHeaderSubject, Value: []byte(ce.Subject)})
+		}
+
+	case EventModeLegacy, "":
+		value, err := event.ToJSON()
+		if err != nil {
+			return kafka.Message{}, fmt.Errorf("failed to marshal event: %w", err)
+		}
+		message.Value = value
+
+	default:
+		return kafka.Message{}, fmt.Errorf("unknown event mode: %q", mode)
+	}
+
+	return message, nil
+}
+
+// DecodeEvent reads an event from a Kafka message. The mode is detected from
+// the message headers, so a consumer can read a topic while its producers
+// migrate between legacy, structured and binary mode.
+func DecodeEvent(message kafka.Message) (*models.EventMessage, error) {
+	if header(message, ceHeaderSpecVersion) != "" {
+		return decodeBinaryEvent(message)
+	}
+
+	contentType := header(message, HeaderContentType)
+	if strings.HasPrefix(contentType, CloudEventsContentType) {
+		var ce models.CloudEvent
+		if err := json.Unmarshal(message.Value, &ce); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal CloudEvent: %w", err)
+		}
+		if err := ce.Validate(); err != nil {
+			return nil, err
+		}
+		return ce.ToEventMessage(), nil
+	}
+
+	var legacy struct {
+		models.EventMessage
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message.Value, &legacy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+
+	event := legacy.EventMessage
+	event.Data = legacy.Data
+	return &event, nil
+}
+
+// decodeBinaryEvent reads a CloudEvent written in binary mode
+func decodeBinaryEvent(message kafka.Message) (*models.EventMessage, error) {
+	ce := models.CloudEvent{
+		SpecVersion:     header(message, ceHeaderSpecVersion),
+		ID:              header(message, ceHeaderID),
+		Source:          header(message, ceHeaderSource),
+		Type:            header(message, ceHeaderType),
+		Subject:         header(message, ceHeaderSubject),
+		DataContentType: header(message, HeaderContentType),
+	}
+	if err := ce.Validate(); err != nil {
+		return nil, err
+	}
+
+	if value := header(message, ceHeaderTime); value != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ce_time header: %w", err)
+		}
+		ce.Time = &timestamp
+	}
+
+	if models.IsJSONContentType(ce.DataContentType) {
+		ce.Data = message.Value
+	} else {
+		ce.DataBase64 = message.Value
+	}
+
+	return ce.ToEventMessage(), nil
+}
+
+// header returns the value of a message header, or "" if it is not set
+func header(message kafka.Message, key string) string {
+	for _, h := range message.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/models"
+)
+
+func TestEventRoundTrip(t *testing.T) {
+	for _, mode := range []EventMode{EventModeLegacy, EventModeStructured, EventModeBinary} {
+		t.Run(string(mode), func(t *testing.T) {
+			event := models.NewEventMessage(models.EventStockUpdated, models.InventoryEvent{
+				ItemID: "ITM-2024-001",
+				Action: "update",
+				UserID: "USR-2024-001",
+			}).WithSource("/services/dashboard-api")
+
+			message, err := EncodeEvent(event, []byte("ITM-2024-001"), mode)
+			require.NoError(t, err)
+
+			decoded, err := DecodeEvent(message)
+			require.NoError(t, err)
+
+			assert.Equal(t, event.EventID, decoded.EventID)
+			assert.Equal(t, models.EventStockUpdated, decoded.EventType)
+			assert.Equal(t, "/services/dashboard-api", decoded.Source)
+			assert.Equal(t, "ITM-2024-001", decoded.Subject)
+			assert.WithinDuration(t, event.Timestamp, decoded.Timestamp, time.Millisecond)
+
+			var data models.InventoryEvent
+			require.NoError(t, decoded.DecodeData(&data))
+			assert.Equal(t, "ITM-2024-001", data.ItemID)
+			assert.Equal(t, "USR-2024-001", data.UserID)
+		})
+	}
+}
+
+func TestBinaryModeHeaders(t *testing.T) {
+	event := models.NewEventMessage(models.EventBarcodeScanned, models.ScanEvent{ScanID: "SCN-2024-001"})
+
+	message, err := EncodeEvent(event, nil, EventModeBinary)
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.0", header(message, "ce_specversion"))
+	assert.Equal(t, "com.warehouse.barcode_scanned", header(message, "ce_type"))
+	assert.Equal(t, "SCN-2024-001", header(message, "ce_subject"))
+	assert.Equal(t, "application/json", header(message, HeaderContentType))
+	assert.JSONEq(t, `{"scanId":"SCN-2024-001","userId":"","scanType":"","result":"","location":"","deviceId":""}`, string(message.Value))
+}
+
+func TestParseTopicEventModes(t *testing.T) {
+	modes, err := ParseTopicEventModes("inventory-events=binary, scan-events=structured,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]EventMode{
+		models.TopicInventoryEvents: EventModeBinary,
+		models.TopicScanEvents:      EventModeStructured,
+	}, modes)
+
+	_, err = ParseTopicEventModes("inventory-events")
+	assert.Error(t, err)
+
+	_, err = ParseTopicEventModes("inventory-events=avro")
+	assert.Error(t, err)
+}
@@ -4,29 +4,40 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/segmentio/kafka-go"
+
+	"warehouse-shared/models"
 )
 
 // Producer represents a Kafka producer
 type Producer struct {
 	writer *kafka.Writer
+	mode   EventMode
 }
 
-// NewProducer creates a new Kafka producer
+// NewProducer creates a new Kafka producer with the default options
 func NewProducer(brokers []string, topic string) *Producer {
-	writer := &kafka.Writer{
-		Addr:     kafka.TCP(brokers...),
-		Topic:    topic,
-		Balancer: &kafka.LeastBytes{},
-	}
+	return NewProducerWithOptions(brokers, topic, DefaultProducerOptions())
+}
 
+// NewProducerWithOptions creates a new Kafka producer with tuned options
+func NewProducerWithOptions(brokers []string, topic string, options ProducerOptions) *Producer {
 	return &Producer{
-		writer: writer,
+		writer: options.writer(brokers, topic),
+		mode:   EventModeLegacy,
 	}
 }
 
-// SendMessage sends a message to Kafka
+// SetEventMode sets how PublishEvent encodes events
+func (p *Producer) SetEventMode(mode EventMode) {
+	p.mode = mode
+}
+
+// SendMessage sends a message to Kafka. In async mode it returns once the
+// message is buffered.
 func (p *Producer) SendMessage(ctx context.Context, key, value []byte) error {
 	message := kafka.Message{
 		Key:   key,
@@ -40,6 +51,25 @@ func (p *Producer) SendMessage(ctx context.Context, key, value []byte) error {
 	return nil
 }
 
+// PublishEvent sends an event to Kafka using the producer's event mode.
+// The event subject is used as the message key when key is empty.
+func (p *Producer) PublishEvent(ctx context.Context, key string, event *models.EventMessage) error {
+	if key == "" {
+		key = event.Subject
+	}
+
+	message, err := EncodeEvent(event, []byte(key), p.mode)
+	if err != nil {
+		return err
+	}
+
+	if err := p.writer.WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("failed to send event to Kafka: %w", err)
+	}
+
+	return nil
+}
+
 // Close closes the producer
 func (p *Producer) Close() error {
 	return p.writer.Close()
@@ -52,12 +82,18 @@ type Consumer struct {
 
 // NewConsumer creates a new Kafka consumer
 func NewConsumer(brokers []string, topic, groupID string) *Consumer {
+	return newConsumer(brokers, topic, groupID, nil)
+}
+
+// newConsumer creates a new Kafka consumer connecting with the given security settings
+func newConsumer(brokers []string, topic, groupID string, security *SecurityConfig) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  brokers,
 		Topic:    topic,
 		GroupID:  groupID,
 		MinBytes: 10e3, // 10KB
 		MaxBytes: 10e6, // 10MB
+		Dialer:   security.dialer(),
 	})
 
 	return &Consumer{
@@ -75,6 +111,31 @@ func (c *Consumer) ReadMessage(ctx context.Context) (kafka.Message, error) {
 	return message, nil
 }
 
+// ReadEvent reads a message from Kafka and decodes it as an event
+func (c *Consumer) ReadEvent(ctx context.Context) (*models.EventMessage, kafka.Message, error) {
+	message, err := c.ReadMessage(ctx)
+	if err != nil {
+		return nil, kafka.Message{}, err
+	}
+
+	event, err := DecodeEvent(message)
+	if err != nil {
+		return nil, message, err
+	}
+
+	return event, message, nil
+}
+
+// FetchMessage reads a message from Kafka without committing it
+func (c *Consumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	message, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("failed to fetch message from Kafka: %w", err)
+	}
+
+	return message, nil
+}
+
 // CommitMessages commits messages
 func (c *Consumer) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
 	return c.reader.CommitMessages(ctx, msgs...)
@@ -85,29 +146,124 @@ func (c *Consumer) Close() error {
 	return c.reader.Close()
 }
 
-// KafkaService manages multiple producers and consumers
+// KafkaService manages multiple producers and consumers. It is safe for
+// concurrent use and implements EventBus.
 type KafkaService struct {
-	brokers   []string
-	producers map[string]*Producer
-	consumers map[string]*Consumer
+	mu            sync.Mutex
+	brokers       []string
+	producers     map[string]*Producer
+	consumers     map[string]*Consumer
+	eventModes    map[string]EventMode
+	subscriptions map[Subscription]struct{}
+
+	security        *SecurityConfig
+	producerOptions ProducerOptions
+	topicOptions    map[string]ProducerOptions
+}
+
+// kafkaSubscription is an EventBus subscription backed by its own consumer
+type kafkaSubscription struct {
+	service  *KafkaService
+	consumer *Consumer
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// latestSubscription is an EventBus subscription reading every partition
+// of a topic without a consumer group
+type latestSubscription struct {
+	service *KafkaService
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
 }
 
 // NewKafkaService creates a new Kafka service
 func NewKafkaService(brokers []string) *KafkaService {
 	return &KafkaService{
-		brokers:   brokers,
-		producers: make(map[string]*Producer),
-		consumers: make(map[string]*Consumer),
+		brokers:       brokers,
+		producers:     make(map[string]*Producer),
+		consumers:     make(map[string]*Consumer),
+		eventModes:    make(map[string]EventMode),
+		subscriptions: make(map[Subscription]struct{}),
+
+		producerOptions: DefaultProducerOptions(),
+		topicOptions:    make(map[string]ProducerOptions),
 	}
 }
 
+// SetSecurity sets the TLS and SASL settings of producers and consumers
+// created afterwards
+func (k *KafkaService) SetSecurity(security *SecurityConfig) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.security = security
+}
+
+// SetProducerOptions sets the options of producers created afterwards.
+// Topic-specific options set with SetTopicProducerOptions take precedence.
+func (k *KafkaService) SetProducerOptions(options ProducerOptions) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.producerOptions = options
+}
+
+// SetTopicProducerOptions sets the options of the producer of a topic. It
+// has no effect once the producer has been created.
+func (k *KafkaService) SetTopicProducerOptions(topic string, options ProducerOptions) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.topicOptions[topic] = options
+}
+
+// SetEventMode sets the event mode used when publishing to a topic
+func (k *KafkaService) SetEventMode(topic string, mode EventMode) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.eventModes[topic] = mode
+	if producer, exists := k.producers[topic]; exists {
+		producer.SetEventMode(mode)
+	}
+}
+
+// EventMode returns the event mode configured for a topic
+func (k *KafkaService) EventMode(topic string) EventMode {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.eventMode(topic)
+}
+
+// eventMode returns the event mode for a topic. Callers hold k.mu.
+func (k *KafkaService) eventMode(topic string) EventMode {
+	if mode, exists := k.eventModes[topic]; exists {
+		return mode
+	}
+	return EventModeLegacy
+}
+
 // GetProducer gets or creates a producer for a topic
 func (k *KafkaService) GetProducer(topic string) *Producer {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
 	if producer, exists := k.producers[topic]; exists {
 		return producer
 	}
 
-	producer := NewProducer(k.brokers, topic)
+	options, exists := k.topicOptions[topic]
+	if !exists {
+		options = k.producerOptions
+	}
+	if options.Security == nil {
+		options.Security = k.security
+	}
+
+	producer := NewProducerWithOptions(k.brokers, topic, options)
+	producer.SetEventMode(k.eventMode(topic))
 	k.producers[topic] = producer
 	log.Printf("Created Kafka producer for topic: %s", topic)
 	return producer
@@ -115,19 +271,238 @@ func (k *KafkaService) GetProducer(topic string) *Producer {
 
 // GetConsumer gets or creates a consumer for a topic
 func (k *KafkaService) GetConsumer(topic, groupID string) *Consumer {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
 	key := fmt.Sprintf("%s-%s", topic, groupID)
 	if consumer, exists := k.consumers[key]; exists {
 		return consumer
 	}
 
-	consumer := NewConsumer(k.brokers, topic, groupID)
+	consumer := newConsumer(k.brokers, topic, groupID, k.security)
 	k.consumers[key] = consumer
 	log.Printf("Created Kafka consumer for topic: %s, group: %s", topic, groupID)
 	return consumer
 }
 
-// Close closes all producers and consumers
+// Publish sends an event to a topic using the topic's event mode. For
+// topics with an async producer it returns before the brokers acknowledge
+// the event.
+func (k *KafkaService) Publish(ctx context.Context, topic, key string, event *models.EventMessage) error {
+	return k.GetProducer(topic).PublishEvent(ctx, key, event)
+}
+
+// DeadLetter copies a message that groupID could not process to the
+// dead-letter topic of its topic, recording the cause in its headers
+func (k *KafkaService) DeadLetter(ctx context.Context, message kafka.Message, groupID string, cause error) error {
+	dlq := DeadLetterTopic(message.Topic)
+	if err := k.GetProducer(dlq).writer.WriteMessages(ctx, deadLetterMessage(message, groupID, cause)); err != nil {
+		return fmt.Errorf("failed to write message to dead-letter topic %s: %w", dlq, err)
+	}
+	return nil
+}
+
+// Subscribe starts a consumer in groupID that delivers the events of a
+// topic to handler. Offsets are committed once the handler has finished.
+func (k *KafkaService) Subscribe(topic, groupID string, handler EventHandler) (Subscription, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	k.mu.Lock()
+	sub := &kafkaSubscription{
+		service:  k,
+		consumer: newConsumer(k.brokers, topic, groupID, k.security),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	k.subscriptions[sub] = struct{}{}
+	k.mu.Unlock()
+
+	go sub.run(ctx, topic, groupID, handler)
+	log.Printf("Subscribed to Kafka topic: %s, group: %s", topic, groupID)
+	return sub, nil
+}
+
+// run consumes messages until the subscription is closed
+func (s *kafkaSubscription) run(ctx context.Context, topic, groupID string, handler EventHandler) {
+	defer close(s.done)
+
+	for {
+		message, err := s.consumer.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error reading topic %s: %v", topic, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryBackoff):
+			}
+			continue
+		}
+
+		event, err := DecodeEvent(message)
+		if err != nil {
+			log.Printf("Skipping undecodable message at %s[%d]@%d: %v", topic, message.Partition, message.Offset, err)
+			s.deadLetter(ctx, message, groupID, err)
+		} else if err := deliver(ctx, topic, handler, event); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Dropping event %s on topic %s for group %s: %v", event.EventID, topic, groupID, err)
+			s.deadLetter(ctx, message, groupID, err)
+		}
+
+		if err := s.consumer.CommitMessages(ctx, message); err != nil && ctx.Err() == nil {
+			log.Printf("Error committing offset on topic %s: %v", topic, err)
+		}
+	}
+}
+
+// deadLetter moves a message that could not be processed to the dead-letter topic
+func (s *kafkaSubscription) deadLetter(ctx context.Context, message kafka.Message, groupID string, cause error) {
+	if err := s.service.DeadLetter(ctx, message, groupID, cause); err != nil && ctx.Err() == nil {
+		log.Printf("Error moving message to dead-letter topic: %v", err)
+	}
+}
+
+// Close stops the subscription and closes its consumer
+func (s *kafkaSubscription) Close() error {
+	s.cancel()
+	<-s.done
+
+	s.service.mu.Lock()
+	delete(s.service.subscriptions, s)
+	s.service.mu.Unlock()
+
+	return s.consumer.Close()
+}
+
+// SubscribeLatest delivers the events published to a topic from now on to
+// handler, reading every partition without a consumer group. Nothing is
+// committed, so events published while no subscription is open are never
+// delivered; events the handler fails on are dropped. The partitions are
+// looked up once, retrying until the topic exists.
+func (k *KafkaService) SubscribeLatest(topic string, handler EventHandler) (Subscription, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	k.mu.Lock()
+	sub := &latestSubscription{service: k, cancel: cancel}
+	k.subscriptions[sub] = struct{}{}
+	dialer := k.security.dialer()
+	k.mu.Unlock()
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+
+		partitions, err := k.lookupPartitions(ctx, dialer, topic)
+		if err != nil {
+			return
+		}
+		for _, partition := range partitions {
+			reader := kafka.NewReader(kafka.ReaderConfig{
+				Brokers:     k.brokers,
+				Topic:       topic,
+				Partition:   partition.ID,
+				StartOffset: kafka.LastOffset,
+				MaxBytes:    10e6, // 10MB
+				Dialer:      dialer,
+			})
+			sub.wg.Add(1)
+			go sub.run(ctx, reader, topic, handler)
+		}
+		log.Printf("Reading %d partitions of Kafka topic %s from the latest offset", len(partitions), topic)
+	}()
+	return sub, nil
+}
+
+// lookupPartitions returns the partitions of a topic, retrying until the
+// topic exists or ctx is done
+func (k *KafkaService) lookupPartitions(ctx context.Context, dialer *kafka.Dialer, topic string) ([]kafka.Partition, error) {
+	for {
+		var partitions []kafka.Partition
+		var err error
+		for _, broker := range k.brokers {
+			if partitions, err = dialer.LookupPartitions(ctx, "tcp", broker, topic); err == nil && len(partitions) > 0 {
+				return partitions, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("Error looking up partitions of topic %s: %v", topic, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryBackoff * 10):
+		}
+	}
+}
+
+// run reads one partition until the subscription is closed
+func (s *latestSubscription) run(ctx context.Context, reader *kafka.Reader, topic string, handler EventHandler) {
+	defer s.wg.Done()
+	defer reader.Close()
+
+	for {
+		message, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error reading topic %s: %v", topic, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryBackoff):
+			}
+			continue
+		}
+
+		event, err := DecodeEvent(message)
+		if err != nil {
+			log.Printf("Skipping undecodable message at %s[%d]@%d: %v", topic, message.Partition, message.Offset, err)
+			continue
+		}
+		if err := deliver(ctx, topic, handler, event); err != nil && ctx.Err() == nil {
+			log.Printf("Dropping event %s on topic %s: %v", event.EventID, topic, err)
+		}
+	}
+}
+
+// Close stops reading and waits for the in-flight events to finish
+func (s *latestSubscription) Close() error {
+	s.cancel()
+	s.wg.Wait()
+
+	s.service.mu.Lock()
+	delete(s.service.subscriptions, s)
+	s.service.mu.Unlock()
+	return nil
+}
+
+// Close closes all subscriptions, producers and consumers
 func (k *KafkaService) Close() error {
+	k.mu.Lock()
+	subscriptions := make([]Subscription, 0, len(k.subscriptions))
+	for sub := range k.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+	k.mu.Unlock()
+
+	for _, sub := range subscriptions {
+		if err := sub.Close(); err != nil {
+			log.Printf("Error closing subscription: %v", err)
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
 	for topic, producer := range k.producers {
 		if err := producer.Close(); err != nil {
 			log.Printf("Error closing producer for topic %s: %v", topic, err)
@@ -0,0 +1,306 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+
+	"warehouse-shared/models"
+)
+
+// memoryRetention is the number of events kept per topic by the MemoryBus
+const memoryRetention = 10000
+
+// MemoryBus is an in-process EventBus for tests and local development.
+// Events go through the same encoding as on Kafka, so handlers receive
+// the payload as raw JSON exactly as they would from a broker.
+type MemoryBus struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	topics map[string]*memoryTopic
+	subs   map[*memorySubscription]struct{}
+	closed bool
+	latest int // subscriptions without a group so far
+}
+
+// memoryTopic holds the retained events of a topic and the position of each group
+type memoryTopic struct {
+	base     int // offset of messages[0]
+	messages []kafka.Message
+	groups   map[string]*memoryGroup
+}
+
+// memoryGroup is the position of a consumer group in a topic. An event is
+// claimed by one subscriber of the group and committed once it is handled
+// or dead-lettered; an event whose subscriber closes while handling it is
+// given back and claimed again, as Kafka redelivers uncommitted offsets.
+type memoryGroup struct {
+	next     int          // next offset never claimed
+	released []int        // offsets given back, claimed before next
+	inFlight map[int]bool // offsets claimed and not yet committed
+}
+
+// memorySubscription is a subscriber reading a topic on behalf of a group
+type memorySubscription struct {
+	bus     *MemoryBus
+	topic   string
+	groupID string
+	handler EventHandler
+	latest  bool // reads without a group, dropping failed events
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewMemoryBus creates a new in-process event bus
+func NewMemoryBus() *MemoryBus {
+	bus := &MemoryBus{
+		topics: make(map[string]*memoryTopic),
+		subs:   make(map[*memorySubscription]struct{}),
+	}
+	bus.cond = sync.NewCond(&bus.mu)
+	return bus
+}
+
+// Publish appends an event to a topic and wakes up its subscribers
+func (b *MemoryBus) Publish(ctx context.Context, topic, key string, event *models.EventMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if key == "" {
+		key = event.Subject
+	}
+
+	message, err := EncodeEvent(event, []byte(key), EventModeStructured)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("event bus is closed")
+	}
+
+	b.append(topic, message)
+	return nil
+}
+
+// append adds a message to a topic and wakes up its subscribers. Callers hold b.mu.
+func (b *MemoryBus) append(topic string, message kafka.Message) {
+	t := b.topic(topic)
+	message.Topic = topic
+	message.Offset = int64(t.base + len(t.messages))
+	t.messages = append(t.messages, message)
+	if len(t.messages) > memoryRetention {
+		dropped := len(t.messages) - memoryRetention
+		t.messages = append([]kafka.Message(nil), t.messages[dropped:]...)
+		t.base += dropped
+	}
+
+	b.cond.Broadcast()
+}
+
+// Subscribe starts delivering the events of a topic to handler
+func (b *MemoryBus) Subscribe(topic, groupID string, handler EventHandler) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, fmt.Errorf("event bus is closed")
+	}
+
+	t := b.topic(topic)
+	if _, exists := t.groups[groupID]; !exists {
+		t.groups[groupID] = &memoryGroup{next: t.base, inFlight: make(map[int]bool)}
+	}
+	return b.start(topic, groupID, handler, false), nil
+}
+
+// SubscribeLatest starts delivering the events published to a topic from
+// now on to handler, in a group of its own that is dropped when it closes
+func (b *MemoryBus) SubscribeLatest(topic string, handler EventHandler) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, fmt.Errorf("event bus is closed")
+	}
+
+	b.latest++
+	groupID := fmt.Sprintf("(latest-%d)", b.latest)
+	t := b.topic(topic)
+	t.groups[groupID] = &memoryGroup{next: t.base + len(t.messages), inFlight: make(map[int]bool)}
+	return b.start(topic, groupID, handler, true), nil
+}
+
+// start runs a subscription of a group. Callers hold b.mu.
+func (b *MemoryBus) start(topic, groupID string, handler EventHandler, latest bool) *memorySubscription {
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &memorySubscription{
+		bus:     b,
+		topic:   topic,
+		groupID: groupID,
+		handler: handler,
+		latest:  latest,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	b.subs[sub] = struct{}{}
+
+	go sub.run()
+	return sub
+}
+
+// Close stops all subscriptions and rejects further publishing
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	subs := make([]*memorySubscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+	return nil
+}
+
+// topic returns the state of a topic, creating it if needed. Callers hold b.mu.
+func (b *MemoryBus) topic(name string) *memoryTopic {
+	t, exists := b.topics[name]
+	if !exists {
+		t = &memoryTopic{groups: make(map[string]*memoryGroup)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// next blocks until the group has an unclaimed event and claims it,
+// events given back first. Events no longer retained are skipped.
+func (s *memorySubscription) next() (kafka.Message, bool) {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		if s.ctx.Err() != nil {
+			return kafka.Message{}, false
+		}
+
+		t := b.topics[s.topic]
+		g := t.groups[s.groupID]
+		for len(g.released) > 0 {
+			offset := g.released[0]
+			g.released = g.released[1:]
+			if offset >= t.base {
+				g.inFlight[offset] = true
+				return t.messages[offset-t.base], true
+			}
+		}
+		if g.next < t.base {
+			g.next = t.base
+		}
+		if g.next < t.base+len(t.messages) {
+			offset := g.next
+			g.next++
+			g.inFlight[offset] = true
+			return t.messages[offset-t.base], true
+		}
+
+		b.cond.Wait()
+	}
+}
+
+// commit marks a claimed event of the group as handled
+func (s *memorySubscription) commit(message kafka.Message) {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	delete(s.bus.topics[s.topic].groups[s.groupID].inFlight, int(message.Offset))
+}
+
+// release gives a claimed event back to the group, to be claimed again by
+// the next subscriber reading
+func (s *memorySubscription) release(message kafka.Message) {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.topics[s.topic].groups[s.groupID]
+	offset := int(message.Offset)
+	delete(g.inFlight, offset)
+	i := sort.SearchInts(g.released, offset)
+	g.released = append(g.released, 0)
+	copy(g.released[i+1:], g.released[i:])
+	g.released[i] = offset
+	b.cond.Broadcast()
+}
+
+// run delivers events until the subscription is closed
+func (s *memorySubscription) run() {
+	defer close(s.done)
+
+	for {
+		message, ok := s.next()
+		if !ok {
+			return
+		}
+
+		event, err := DecodeEvent(message)
+		if err != nil {
+			log.Printf("Skipping undecodable event on topic %s: %v", s.topic, err)
+			s.deadLetter(message, err)
+			s.commit(message)
+			continue
+		}
+
+		if err := deliver(s.ctx, s.topic, s.handler, event); err != nil {
+			if s.ctx.Err() != nil {
+				s.release(message)
+				return
+			}
+			log.Printf("Dropping event %s on topic %s for group %s: %v", event.EventID, s.topic, s.groupID, err)
+			s.deadLetter(message, err)
+		}
+		s.commit(message)
+	}
+}
+
+// deadLetter moves a message that could not be processed to the dead-letter
+// topic. Subscriptions without a group drop it.
+func (s *memorySubscription) deadLetter(message kafka.Message, cause error) {
+	if s.latest {
+		return
+	}
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.append(DeadLetterTopic(s.topic), deadLetterMessage(message, s.groupID, cause))
+}
+
+// Close stops the subscription and waits for the in-flight event to finish
+func (s *memorySubscription) Close() error {
+	s.cancel()
+
+	s.bus.mu.Lock()
+	delete(s.bus.subs, s)
+	s.bus.cond.Broadcast()
+	s.bus.mu.Unlock()
+
+	<-s.done
+	if s.latest {
+		s.bus.mu.Lock()
+		delete(s.bus.topics[s.topic].groups, s.groupID)
+		s.bus.mu.Unlock()
+	}
+	return nil
+}
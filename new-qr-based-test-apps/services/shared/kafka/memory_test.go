@@ -0,0 +1,210 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/models"
+)
+
+// collector records the events delivered to a handler
+type collector struct {
+	mu     sync.Mutex
+	events []*models.EventMessage
+}
+
+func (c *collector) handle(ctx context.Context, event *models.EventMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+	return nil
+}
+
+func (c *collector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.events)
+}
+
+func publishItems(t *testing.T, bus EventBus, n int) {
+	for i := 0; i < n; i++ {
+		event := models.NewEventMessage(models.EventItemCreated, models.InventoryEvent{ItemID: "ITM-2024-001"})
+		require.NoError(t, bus.Publish(context.Background(), models.TopicInventoryEvents, "", event))
+	}
+}
+
+func TestMemoryBusDeliversToEveryGroup(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	indexer, webhooks := &collector{}, &collector{}
+	_, err := bus.Subscribe(models.TopicInventoryEvents, "indexer", indexer.handle)
+	require.NoError(t, err)
+	_, err = bus.Subscribe(models.TopicInventoryEvents, "webhooks", webhooks.handle)
+	require.NoError(t, err)
+
+	publishItems(t, bus, 5)
+
+	assert.Eventually(t, func() bool { return indexer.count() == 5 && webhooks.count() == 5 }, time.Second, 10*time.Millisecond)
+
+	var data models.InventoryEvent
+	require.NoError(t, indexer.events[0].DecodeData(&data))
+	assert.Equal(t, "ITM-2024-001", data.ItemID)
+}
+
+func TestMemoryBusSharesEventsWithinGroup(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	first, second := &collector{}, &collector{}
+	_, err := bus.Subscribe(models.TopicScanEvents, "scanner", first.handle)
+	require.NoError(t, err)
+	_, err = bus.Subscribe(models.TopicScanEvents, "scanner", second.handle)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		event := models.NewEventMessage(models.EventBarcodeScanned, models.ScanEvent{ScanID: "SCN-2024-001"})
+		require.NoError(t, bus.Publish(context.Background(), models.TopicScanEvents, "", event))
+	}
+
+	assert.Eventually(t, func() bool { return first.count()+second.count() == 20 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 20, first.count()+second.count())
+}
+
+func TestMemoryBusNewGroupReadsRetainedEvents(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	publishItems(t, bus, 3)
+
+	late := &collector{}
+	_, err := bus.Subscribe(models.TopicInventoryEvents, "late", late.handle)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return late.count() == 3 }, time.Second, 10*time.Millisecond)
+}
+
+func TestMemoryBusRetriesFailingHandler(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	var mu sync.Mutex
+	attempts := 0
+	handler := func(ctx context.Context, event *models.EventMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < maxDeliveryAttempts {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}
+
+	_, err := bus.Subscribe(models.TopicShipmentEvents, "retry", handler)
+	require.NoError(t, err)
+	require.NoError(t, bus.Publish(context.Background(), models.TopicShipmentEvents, "", models.NewEventMessage(models.EventShipmentCreated, nil)))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts == maxDeliveryAttempts
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestMemoryBusMovesFailedEventsToDeadLetterTopic(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	failing := func(ctx context.Context, event *models.EventMessage) error {
+		return errors.New("permanent failure")
+	}
+	_, err := bus.Subscribe(models.TopicScanEvents, "failing", failing)
+	require.NoError(t, err)
+
+	dlq := &collector{}
+	_, err = bus.Subscribe(DeadLetterTopic(models.TopicScanEvents), "dlq", dlq.handle)
+	require.NoError(t, err)
+
+	event := models.NewEventMessage(models.EventBarcodeScanned, models.ScanEvent{ScanID: "SCN-1"})
+	require.NoError(t, bus.Publish(context.Background(), models.TopicScanEvents, "", event))
+
+	assert.Eventually(t, func() bool { return dlq.count() == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, event.EventID, dlq.events[0].EventID)
+
+	bus.mu.Lock()
+	message := bus.topics[DeadLetterTopic(models.TopicScanEvents)].messages[0]
+	bus.mu.Unlock()
+	headers := make(map[string]string)
+	for _, header := range message.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	assert.Equal(t, models.TopicScanEvents, headers[HeaderDeadLetterTopic])
+	assert.Equal(t, "failing", headers[HeaderDeadLetterGroup])
+	assert.Equal(t, "permanent failure", headers[HeaderDeadLetterError])
+}
+
+func TestMemoryBusRedeliversEventsOfClosedSubscription(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	started := make(chan struct{})
+	interrupted := func(ctx context.Context, event *models.EventMessage) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	sub, err := bus.Subscribe(models.TopicInventoryEvents, "indexer", interrupted)
+	require.NoError(t, err)
+	publishItems(t, bus, 1)
+
+	<-started
+	require.NoError(t, sub.Close())
+
+	restarted := &collector{}
+	_, err = bus.Subscribe(models.TopicInventoryEvents, "indexer", restarted.handle)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return restarted.count() == 1 }, time.Second, 10*time.Millisecond,
+		"an event not handled is not committed")
+
+	assert.Eventually(t, func() bool {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		return len(bus.topics[models.TopicInventoryEvents].groups["indexer"].inFlight) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMemoryBusSubscribeLatest(t *testing.T) {
+	bus := NewMemoryBus()
+	defer bus.Close()
+
+	publishItems(t, bus, 2)
+	first, second := &collector{}, &collector{}
+	sub, err := bus.SubscribeLatest(models.TopicInventoryEvents, first.handle)
+	require.NoError(t, err)
+	_, err = bus.SubscribeLatest(models.TopicInventoryEvents, second.handle)
+	require.NoError(t, err)
+
+	publishItems(t, bus, 3)
+	assert.Eventually(t, func() bool { return first.count() == 3 && second.count() == 3 }, time.Second, 10*time.Millisecond,
+		"every subscriber gets the events published after it subscribed")
+
+	require.NoError(t, sub.Close())
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	assert.Len(t, bus.topics[models.TopicInventoryEvents].groups, 1, "closed subscriptions leave no group behind")
+}
+
+func TestMemoryBusRejectsPublishAfterClose(t *testing.T) {
+	bus := NewMemoryBus()
+	require.NoError(t, bus.Close())
+
+	err := bus.Publish(context.Background(), models.TopicUserEvents, "", models.NewEventMessage(models.EventUserLogin, nil))
+	assert.Error(t, err)
+}
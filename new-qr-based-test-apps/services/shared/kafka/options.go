@@ -0,0 +1,212 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// ProducerOptions tunes the writer behind a Producer.
+//
+// kafka-go has no idempotent producer, so retried writes can be duplicated
+// on the broker. Consumers already receive events at-least-once and should
+// deduplicate on the event ID where it matters.
+type ProducerOptions struct {
+	RequiredAcks kafka.RequiredAcks // RequireAll, RequireOne or RequireNone
+	MaxAttempts  int                // write attempts before a batch fails
+	BatchSize    int                // messages per batch
+	BatchBytes   int64              // maximum batch size in bytes
+	BatchTimeout time.Duration      // time to wait for a batch to fill up
+	WriteTimeout time.Duration
+	Compression  kafka.Compression // 0 disables compression
+
+	// Async makes writes return as soon as the message is buffered. Failed
+	// batches are reported to OnError, or logged when it is nil. Events
+	// still buffered when the process crashes are lost.
+	Async   bool
+	OnError func(messages []kafka.Message, err error)
+
+	Security *SecurityConfig
+}
+
+// DefaultProducerOptions returns durable settings: writes wait for all
+// in-sync replicas and small batches are flushed after 10ms instead of
+// kafka-go's default of one second.
+func DefaultProducerOptions() ProducerOptions {
+	return ProducerOptions{
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  10,
+		BatchSize:    100,
+		BatchBytes:   1 << 20, // 1MB
+		BatchTimeout: 10 * time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+		Compression:  kafka.Snappy,
+	}
+}
+
+// writer builds a kafka.Writer for a topic from the options
+func (o ProducerOptions) writer(brokers []string, topic string) *kafka.Writer {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		RequiredAcks: o.RequiredAcks,
+		MaxAttempts:  o.MaxAttempts,
+		BatchSize:    o.BatchSize,
+		BatchBytes:   o.BatchBytes,
+		BatchTimeout: o.BatchTimeout,
+		WriteTimeout: o.WriteTimeout,
+		Compression:  o.Compression,
+		Async:        o.Async,
+		Transport:    o.Security.transport(),
+	}
+
+	if o.Async {
+		onError := o.OnError
+		if onError == nil {
+			onError = func(messages []kafka.Message, err error) {
+				log.Printf("Failed to write %d messages to topic %s: %v", len(messages), topic, err)
+			}
+		}
+		writer.Completion = func(messages []kafka.Message, err error) {
+			if err != nil {
+				onError(messages, err)
+			}
+		}
+	}
+
+	return writer
+}
+
+// ParseRequiredAcks parses all, one (or leader) and none
+func ParseRequiredAcks(acks string) (kafka.RequiredAcks, error) {
+	switch strings.ToLower(strings.TrimSpace(acks)) {
+	case "", "all", "-1":
+		return kafka.RequireAll, nil
+	case "one", "leader", "1":
+		return kafka.RequireOne, nil
+	case "none", "0":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("unknown required acks: %q", acks)
+	}
+}
+
+// ParseCompression parses none, gzip, snappy, lz4 and zstd
+func ParseCompression(codec string) (kafka.Compression, error) {
+	switch strings.ToLower(strings.TrimSpace(codec)) {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression codec: %q", codec)
+	}
+}
+
+// SASL mechanisms supported by NewSASLMechanism
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
+// SecurityConfig holds the TLS and SASL settings used to reach the brokers.
+// A nil SecurityConfig connects in plaintext without authentication.
+type SecurityConfig struct {
+	TLS  *tls.Config
+	SASL sasl.Mechanism
+}
+
+// NewSecurityConfig builds a SecurityConfig. TLS is enabled when useTLS is
+// set or a CA file is given; SASL is enabled when a mechanism is given.
+// It returns nil when neither is enabled.
+func NewSecurityConfig(useTLS bool, caFile, mechanism, username, password string) (*SecurityConfig, error) {
+	security := &SecurityConfig{}
+
+	if useTLS || caFile != "" {
+		security.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Kafka CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in Kafka CA file %s", caFile)
+			}
+			security.TLS.RootCAs = pool
+		}
+	}
+
+	if mechanism != "" {
+		saslMechanism, err := NewSASLMechanism(mechanism, username, password)
+		if err != nil {
+			return nil, err
+		}
+		security.SASL = saslMechanism
+	}
+
+	if security.TLS == nil && security.SASL == nil {
+		return nil, nil
+	}
+	return security, nil
+}
+
+// NewSASLMechanism returns the SASL mechanism with the given name
+func NewSASLMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case SASLPlain:
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case SASLScramSHA256:
+		mechanism, err := scram.Mechanism(scram.SHA256, username, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SASL mechanism: %w", err)
+		}
+		return mechanism, nil
+	case SASLScramSHA512:
+		mechanism, err := scram.Mechanism(scram.SHA512, username, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SASL mechanism: %w", err)
+		}
+		return mechanism, nil
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism: %q", name)
+	}
+}
+
+// transport returns the transport used by writers and admin clients
+func (s *SecurityConfig) transport() kafka.RoundTripper {
+	if s == nil {
+		return nil
+	}
+	return &kafka.Transport{TLS: s.TLS, SASL: s.SASL}
+}
+
+// dialer returns the dialer used by readers
+func (s *SecurityConfig) dialer() *kafka.Dialer {
+	if s == nil {
+		return nil
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           s.TLS,
+		SASLMechanism: s.SASL,
+	}
+}
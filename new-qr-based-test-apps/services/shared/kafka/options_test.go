@@ -0,0 +1,77 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequiredAcks(t *testing.T) {
+	for input, expected := range map[string]kafka.RequiredAcks{
+		"":       kafka.RequireAll,
+		"all":    kafka.RequireAll,
+		"leader": kafka.RequireOne,
+		"1":      kafka.RequireOne,
+		"none":   kafka.RequireNone,
+	} {
+		acks, err := ParseRequiredAcks(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, acks, input)
+	}
+
+	_, err := ParseRequiredAcks("most")
+	assert.Error(t, err)
+}
+
+func TestParseCompression(t *testing.T) {
+	codec, err := ParseCompression("zstd")
+	require.NoError(t, err)
+	assert.Equal(t, kafka.Zstd, codec)
+
+	codec, err = ParseCompression("none")
+	require.NoError(t, err)
+	assert.Equal(t, kafka.Compression(0), codec)
+
+	_, err = ParseCompression("brotli")
+	assert.Error(t, err)
+}
+
+func TestProducerOptionsWriter(t *testing.T) {
+	writer := DefaultProducerOptions().writer([]string{"localhost:9092"}, "scan-events")
+	assert.Equal(t, kafka.RequireAll, writer.RequiredAcks)
+	assert.False(t, writer.Async)
+	assert.Nil(t, writer.Completion)
+	assert.Nil(t, writer.Transport)
+
+	var reported error
+	options := DefaultProducerOptions()
+	options.Async = true
+	options.OnError = func(messages []kafka.Message, err error) { reported = err }
+
+	writer = options.writer([]string{"localhost:9092"}, "scan-events")
+	require.NotNil(t, writer.Completion)
+
+	writer.Completion(nil, nil)
+	assert.NoError(t, reported)
+
+	writer.Completion([]kafka.Message{{}}, errors.New("broker unavailable"))
+	assert.EqualError(t, reported, "broker unavailable")
+}
+
+func TestNewSecurityConfig(t *testing.T) {
+	security, err := NewSecurityConfig(false, "", "", "", "")
+	require.NoError(t, err)
+	assert.Nil(t, security)
+
+	security, err = NewSecurityConfig(true, "", SASLScramSHA512, "scanner", "secret")
+	require.NoError(t, err)
+	require.NotNil(t, security)
+	assert.NotNil(t, security.TLS)
+	assert.Equal(t, "SCRAM-SHA-512", security.SASL.Name())
+
+	_, err = NewSecurityConfig(false, "", "kerberos", "", "")
+	assert.Error(t, err)
+}
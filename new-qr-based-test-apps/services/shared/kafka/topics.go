@@ -0,0 +1,354 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"warehouse-shared/models"
+)
+
+// Cleanup policies
+const (
+	CleanupDelete        = "delete"
+	CleanupCompact       = "compact"
+	CleanupCompactDelete = "compact,delete"
+)
+
+// DeadLetterSuffix is appended to a topic name to get its dead-letter topic
+const DeadLetterSuffix = ".dlq"
+
+// DeadLetterTopic returns the dead-letter topic of a topic
+func DeadLetterTopic(topic string) string {
+	return topic + DeadLetterSuffix
+}
+
+// TopicSpec declares the desired configuration of a Kafka topic
+type TopicSpec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	Retention         time.Duration // -1 keeps messages forever
+	CleanupPolicy     string
+	Configs           map[string]string // additional topic-level configs
+}
+
+// configs returns the topic-level configs managed by the spec
+func (s TopicSpec) configs() map[string]string {
+	configs := make(map[string]string, len(s.Configs)+2)
+	for key, value := range s.Configs {
+		configs[key] = value
+	}
+	if s.Retention != 0 {
+		retention := int64(-1)
+		if s.Retention > 0 {
+			retention = s.Retention.Milliseconds()
+		}
+		configs["retention.ms"] = strconv.FormatInt(retention, 10)
+	}
+	if s.CleanupPolicy != "" {
+		configs["cleanup.policy"] = s.CleanupPolicy
+	}
+	return configs
+}
+
+// DefaultTopicSpecs returns the topics used by the warehouse services,
+// their dead-letter topics and the compacted stock level topic
+func DefaultTopicSpecs(replicationFactor int) []TopicSpec {
+	const day = 24 * time.Hour
+
+	specs := []TopicSpec{
+		{Name: models.TopicInventoryEvents, Partitions: 3, Retention: 30 * day, CleanupPolicy: CleanupDelete},
+		{Name: models.TopicShipmentEvents, Partitions: 3, Retention: 30 * day, CleanupPolicy: CleanupDelete},
+		{Name: models.TopicScanEvents, Partitions: 6, Retention: 7 * day, CleanupPolicy: CleanupDelete},
+		{Name: models.TopicUserEvents, Partitions: 2, Retention: 90 * day, CleanupPolicy: CleanupDelete},
+	}
+
+	for _, spec := range specs[:4] {
+		specs = append(specs, TopicSpec{
+			Name:          DeadLetterTopic(spec.Name),
+			Partitions:    1,
+			Retention:     30 * day,
+			CleanupPolicy: CleanupDelete,
+		})
+	}
+
+	specs = append(specs, TopicSpec{
+		Name:          models.TopicStockLevels,
+		Partitions:    3,
+		Retention:     -1,
+		CleanupPolicy: CleanupCompact,
+		Configs: map[string]string{
+			"min.cleanable.dirty.ratio": "0.1",
+			"segment.ms":                strconv.FormatInt((7 * day).Milliseconds(), 10),
+		},
+	})
+
+	for i := range specs {
+		specs[i].ReplicationFactor = replicationFactor
+	}
+	return specs
+}
+
+// Drift actions
+const (
+	DriftActionCreated = "created"
+	DriftActionAltered = "altered"
+	DriftActionManual  = "manual"
+	DriftActionNone    = "none"
+)
+
+// TopicDrift describes a difference between a TopicSpec and the broker
+type TopicDrift struct {
+	Topic    string `json:"topic"`
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Action   string `json:"action"` // created, altered, manual (cannot be fixed automatically) or none (check only)
+}
+
+// String formats the drift for logs and CLI output
+func (d TopicDrift) String() string {
+	return fmt.Sprintf("%s: %s expected %q, actual %q (%s)", d.Topic, d.Field, d.Expected, d.Actual, d.Action)
+}
+
+// ReconcileReport lists the drift found by a reconciliation
+type ReconcileReport struct {
+	Drift []TopicDrift `json:"drift"`
+}
+
+// HasDrift reports whether any topic differs from its spec
+func (r *ReconcileReport) HasDrift() bool {
+	return len(r.Drift) > 0
+}
+
+// Unresolved returns the drift that is still present after reconciliation
+func (r *ReconcileReport) Unresolved() []TopicDrift {
+	var unresolved []TopicDrift
+	for _, d := range r.Drift {
+		if d.Action == DriftActionManual || d.Action == DriftActionNone {
+			unresolved = append(unresolved, d)
+		}
+	}
+	return unresolved
+}
+
+// TopicAdmin provisions topics from TopicSpecs
+type TopicAdmin struct {
+	client *kafka.Client
+}
+
+// NewTopicAdmin creates a new topic admin for a cluster. security may be
+// nil for plaintext brokers.
+func NewTopicAdmin(brokers []string, security *SecurityConfig) *TopicAdmin {
+	return &TopicAdmin{
+		client: &kafka.Client{
+			Addr:      kafka.TCP(brokers...),
+			Timeout:   30 * time.Second,
+			Transport: security.transport(),
+		},
+	}
+}
+
+// Reconcile compares the specs with the brokers. With apply set it creates
+// missing topics, adds partitions and updates configs; the replication
+// factor and partition decreases are only reported.
+func (a *TopicAdmin) Reconcile(ctx context.Context, specs []TopicSpec, apply bool) (*ReconcileReport, error) {
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		names[i] = spec.Name
+	}
+
+	metadata, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: names})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topic metadata: %w", err)
+	}
+
+	existing := make(map[string]kafka.Topic, len(metadata.Topics))
+	for _, topic := range metadata.Topics {
+		if topic.Error == nil {
+			existing[topic.Name] = topic
+		} else if !errors.Is(topic.Error, kafka.UnknownTopicOrPartition) {
+			return nil, fmt.Errorf("failed to read metadata of topic %s: %w", topic.Name, topic.Error)
+		}
+	}
+
+	report := &ReconcileReport{}
+	for _, spec := range specs {
+		topic, exists := existing[spec.Name]
+		if !exists {
+			if err := a.reconcileMissing(ctx, spec, apply, report); err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		if err := a.reconcilePartitions(ctx, spec, topic, apply, report); err != nil {
+			return report, err
+		}
+		if err := a.reconcileConfigs(ctx, spec, apply, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// reconcileMissing creates a topic that does not exist yet
+func (a *TopicAdmin) reconcileMissing(ctx context.Context, spec TopicSpec, apply bool, report *ReconcileReport) error {
+	drift := TopicDrift{Topic: spec.Name, Field: "topic", Expected: "present", Actual: "missing", Action: DriftActionNone}
+	if apply {
+		entries := make([]kafka.ConfigEntry, 0)
+		for name, value := range spec.configs() {
+			entries = append(entries, kafka.ConfigEntry{ConfigName: name, ConfigValue: value})
+		}
+
+		resp, err := a.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: []kafka.TopicConfig{{
+			Topic:             spec.Name,
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+			ConfigEntries:     entries,
+		}}})
+		if err != nil {
+			return fmt.Errorf("failed to create topic %s: %w", spec.Name, err)
+		}
+		if err := resp.Errors[spec.Name]; err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			return fmt.Errorf("failed to create topic %s: %w", spec.Name, err)
+		}
+		drift.Action = DriftActionCreated
+	}
+
+	report.Drift = append(report.Drift, drift)
+	return nil
+}
+
+// reconcilePartitions compares the partition count and replication factor
+func (a *TopicAdmin) reconcilePartitions(ctx context.Context, spec TopicSpec, topic kafka.Topic, apply bool, report *ReconcileReport) error {
+	partitions := len(topic.Partitions)
+	if partitions != spec.Partitions {
+		drift := TopicDrift{
+			Topic:    spec.Name,
+			Field:    "partitions",
+			Expected: strconv.Itoa(spec.Partitions),
+			Actual:   strconv.Itoa(partitions),
+			Action:   DriftActionNone,
+		}
+
+		switch {
+		case partitions > spec.Partitions:
+			// Kafka cannot remove partitions
+			drift.Action = DriftActionManual
+		case apply:
+			resp, err := a.client.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{
+				Topics: []kafka.TopicPartitionsConfig{{Name: spec.Name, Count: int32(spec.Partitions)}},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to add partitions to %s: %w", spec.Name, err)
+			}
+			if err := resp.Errors[spec.Name]; err != nil {
+				return fmt.Errorf("failed to add partitions to %s: %w", spec.Name, err)
+			}
+			drift.Action = DriftActionAltered
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+
+	if partitions > 0 && spec.ReplicationFactor > 0 {
+		replicas := len(topic.Partitions[0].Replicas)
+		if replicas != spec.ReplicationFactor {
+			report.Drift = append(report.Drift, TopicDrift{
+				Topic:    spec.Name,
+				Field:    "replication.factor",
+				Expected: strconv.Itoa(spec.ReplicationFactor),
+				Actual:   strconv.Itoa(replicas),
+				Action:   DriftActionManual,
+			})
+		}
+	}
+
+	return nil
+}
+
+// reconcileConfigs compares the topic-level configs managed by the spec
+func (a *TopicAdmin) reconcileConfigs(ctx context.Context, spec TopicSpec, apply bool, report *ReconcileReport) error {
+	wanted := spec.configs()
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(wanted))
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp, err := a.client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: spec.Name,
+			ConfigNames:  names,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe configs of %s: %w", spec.Name, err)
+	}
+
+	actual := make(map[string]string)
+	for _, resource := range resp.Resources {
+		if resource.Error != nil {
+			return fmt.Errorf("failed to describe configs of %s: %w", spec.Name, resource.Error)
+		}
+		for _, entry := range resource.ConfigEntries {
+			actual[entry.ConfigName] = entry.ConfigValue
+		}
+	}
+
+	var changes []kafka.IncrementalAlterConfigsRequestConfig
+	var drift []TopicDrift
+	for _, name := range names {
+		if actual[name] == wanted[name] {
+			continue
+		}
+		drift = append(drift, TopicDrift{
+			Topic:    spec.Name,
+			Field:    name,
+			Expected: wanted[name],
+			Actual:   actual[name],
+			Action:   DriftActionNone,
+		})
+		changes = append(changes, kafka.IncrementalAlterConfigsRequestConfig{
+			Name:            name,
+			Value:           wanted[name],
+			ConfigOperation: kafka.ConfigOperationSet,
+		})
+	}
+
+	if apply && len(changes) > 0 {
+		resp, err := a.client.IncrementalAlterConfigs(ctx, &kafka.IncrementalAlterConfigsRequest{
+			Resources: []kafka.IncrementalAlterConfigsRequestResource{{
+				ResourceType: kafka.ResourceTypeTopic,
+				ResourceName: spec.Name,
+				Configs:      changes,
+			}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to alter configs of %s: %w", spec.Name, err)
+		}
+		for _, resource := range resp.Resources {
+			if resource.Error != nil {
+				return fmt.Errorf("failed to alter configs of %s: %w", spec.Name, resource.Error)
+			}
+		}
+		for i := range drift {
+			drift[i].Action = DriftActionAltered
+		}
+	}
+
+	report.Drift = append(report.Drift, drift...)
+	return nil
+}
@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/models"
+)
+
+func TestDefaultTopicSpecs(t *testing.T) {
+	specs := DefaultTopicSpecs(3)
+
+	byName := make(map[string]TopicSpec, len(specs))
+	for _, spec := range specs {
+		assert.Equal(t, 3, spec.ReplicationFactor, spec.Name)
+		byName[spec.Name] = spec
+	}
+
+	for _, topic := range []string{models.TopicInventoryEvents, models.TopicShipmentEvents, models.TopicScanEvents, models.TopicUserEvents} {
+		assert.Contains(t, byName, topic)
+		assert.Contains(t, byName, DeadLetterTopic(topic))
+	}
+
+	stockLevels := byName[models.TopicStockLevels]
+	assert.Equal(t, CleanupCompact, stockLevels.CleanupPolicy)
+	assert.Equal(t, "-1", stockLevels.configs()["retention.ms"])
+}
+
+func TestTopicSpecConfigs(t *testing.T) {
+	spec := TopicSpec{
+		Name:          models.TopicScanEvents,
+		Retention:     7 * 24 * time.Hour,
+		CleanupPolicy: CleanupDelete,
+		Configs:       map[string]string{"max.message.bytes": "1048576"},
+	}
+
+	assert.Equal(t, map[string]string{
+		"retention.ms":      "604800000",
+		"cleanup.policy":    "delete",
+		"max.message.bytes": "1048576",
+	}, spec.configs())
+
+	assert.Empty(t, TopicSpec{Name: "plain"}.configs())
+}
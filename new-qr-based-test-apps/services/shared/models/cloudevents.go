@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CloudEvents constants
+const (
+	CloudEventsSpecVersion = "1.0"
+	CloudEventTypePrefix   = "com.warehouse."
+)
+
+// CloudEvent represents an event in the CloudEvents 1.0 JSON format
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            *time.Time      `json:"time,omitempty"`
+	Subject         string          `json:"subject,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// CloudEventType maps an internal event type to its CloudEvents type
+func CloudEventType(eventType string) string {
+	return CloudEventTypePrefix + eventType
+}
+
+// EventTypeFromCloudEvent maps a CloudEvents type back to the internal event type
+func EventTypeFromCloudEvent(ceType string) string {
+	return strings.TrimPrefix(ceType, CloudEventTypePrefix)
+}
+
+// IsJSONContentType checks if a datacontenttype carries JSON data
+func IsJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// ToCloudEvent converts the event message to a CloudEvent
+func (e *EventMessage) ToCloudEvent() (*CloudEvent, error) {
+	ce := &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              e.EventID,
+		Source:          e.Source,
+		Type:            CloudEventType(e.EventType),
+		Subject:         e.Subject,
+		DataContentType: e.DataContentType,
+	}
+
+	if ce.Source == "" {
+		ce.Source = DefaultEventSource
+	}
+	if ce.DataContentType == "" {
+		ce.DataContentType = "application/json"
+	}
+	if !e.Timestamp.IsZero() {
+		timestamp := e.Timestamp.UTC()
+		ce.Time = &timestamp
+	}
+
+	data, err := e.DataBytes()
+	if err != nil {
+		return nil, err
+	}
+	if IsJSONContentType(ce.DataContentType) {
+		ce.Data = data
+	} else {
+		ce.DataBase64 = data
+	}
+
+	return ce, nil
+}
+
+// DataBytes returns the event payload serialized according to its content type
+func (e *EventMessage) DataBytes() ([]byte, error) {
+	switch data := e.Data.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		return data, nil
+	case []byte:
+		return data, nil
+	default:
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal event data: %w", err)
+		}
+		return raw, nil
+	}
+}
+
+// Validate checks that the required CloudEvents attributes are present
+func (c *CloudEvent) Validate() error {
+	if c.SpecVersion != CloudEventsSpecVersion {
+		return fmt.Errorf("unsupported CloudEvents specversion: %q", c.SpecVersion)
+	}
+	if c.ID == "" || c.Source == "" || c.Type == "" {
+		return fmt.Errorf("CloudEvent is missing a required attribute (id, source, type)")
+	}
+	return nil
+}
+
+// ToEventMessage converts the CloudEvent to an event message. JSON data is
+// kept as json.RawMessage so it can be decoded with EventMessage.DecodeData.
+func (c *CloudEvent) ToEventMessage() *EventMessage {
+	event := &EventMessage{
+		EventType:       EventTypeFromCloudEvent(c.Type),
+		EventID:         c.ID,
+		Source:          c.Source,
+		Subject:         c.Subject,
+		DataContentType: c.DataContentType,
+	}
+
+	if c.Time != nil {
+		event.Timestamp = *c.Time
+	}
+
+	switch {
+	case len(c.Data) > 0:
+		event.Data = c.Data
+	case len(c.DataBase64) > 0:
+		event.Data = c.DataBase64
+	}
+
+	return event
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ways count tasks are generated
+const (
+	CountByZone   = "zone"   // every bin holding stock within a location
+	CountByClass  = "abc"    // the items of an ABC class, by issue value
+	CountAtRandom = "random" // a random sample of items
+)
+
+// ABC classes of items by the value of their issues: A items make up the
+// first 80% of it, B items the next 15% and C items the rest
+const (
+	ClassA = "A"
+	ClassB = "B"
+	ClassC = "C"
+)
+
+// Count task statuses
+const (
+	CountOpen            = "open"             // waiting for its operator
+	CountInProgress      = "in_progress"      // bins are being scanned
+	CountPendingApproval = "pending_approval" // adjustments above the threshold wait for a supervisor
+	CountPosted          = "posted"           // every adjustment is posted or rejected
+	CountCancelled       = "cancelled"
+)
+
+// Count line adjustment statuses
+const (
+	AdjustmentPending  = "pending"  // above the threshold, waiting for approval
+	AdjustmentPosted   = "posted"   // recorded in the stock ledger
+	AdjustmentRejected = "rejected" // the stock was left as it was
+)
+
+// CountLine is the count of one item in one bin. Expected is what the bin
+// held when the task was submitted; Counted is nil until the item is
+// scanned or its bin is counted without it.
+type CountLine struct {
+	ItemID        string               `bson:"itemId" json:"itemId"`
+	Name          string               `bson:"name" json:"name"`
+	Location      string               `bson:"location" json:"location"`
+	Expected      int                  `bson:"expected" json:"expected"`
+	Counted       *int                 `bson:"counted,omitempty" json:"counted"`
+	Variance      int                  `bson:"variance" json:"variance"`
+	VarianceValue float64              `bson:"varianceValue" json:"varianceValue"` // variance at the cost price of the item
+	Adjustment    string               `bson:"adjustment,omitempty" json:"adjustment,omitempty"`
+	MovementIDs   []primitive.ObjectID `bson:"movementIds,omitempty" json:"movementIds,omitempty"`
+}
+
+// CountVariance is the variance of an item over the bins of a task against
+// its stock level
+type CountVariance struct {
+	ItemID     string  `bson:"itemId" json:"itemId"`
+	StockLevel int     `bson:"stockLevel" json:"stockLevel"`
+	Counted    int     `bson:"counted" json:"counted"` // stock level once the variances are posted
+	Variance   int     `bson:"variance" json:"variance"`
+	Value      float64 `bson:"value" json:"value"`
+}
+
+// CountTask is a cycle count of bins assigned to an operator. Scanning a
+// bin and then the items in it records counted quantities; adjustments
+// are posted to stock with the task ID as their reference.
+type CountTask struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Method      string             `bson:"method" json:"method"`
+	Scope       string             `bson:"scope,omitempty" json:"scope,omitempty"` // location of a zone task, class of an ABC task
+	Bins        []string           `bson:"bins" json:"bins"`
+	Counted     []string           `bson:"counted" json:"counted"`                           // bins scanned so far
+	CurrentBin  string             `bson:"currentBin,omitempty" json:"currentBin,omitempty"` // bin the scanned items are in
+	Lines       []CountLine        `bson:"lines" json:"lines"`
+	Variances   []CountVariance    `bson:"variances,omitempty" json:"variances,omitempty"`
+	Status      string             `bson:"status" json:"status"`
+	AssignedTo  string             `bson:"assignedTo" json:"assignedTo"`
+	CreatedBy   string             `bson:"createdBy" json:"createdBy"`
+	ReviewedBy  string             `bson:"reviewedBy,omitempty" json:"reviewedBy,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	SubmittedAt *time.Time         `bson:"submittedAt,omitempty" json:"submittedAt,omitempty"`
+	ReviewedAt  *time.Time         `bson:"reviewedAt,omitempty" json:"reviewedAt,omitempty"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
@@ -9,20 +9,51 @@ import (
 
 // EventMessage represents a generic event message for Kafka
 type EventMessage struct {
-	EventType string      `json:"eventType"`
-	EventID   string      `json:"eventId"`
-	Timestamp time.Time   `json:"timestamp"`
-	Data      interface{} `json:"data"`
+	EventType       string      `json:"eventType"`
+	EventID         string      `json:"eventId"`
+	Timestamp       time.Time   `json:"timestamp"`
+	Source          string      `json:"source,omitempty"`
+	Subject         string      `json:"subject,omitempty"`
+	DataContentType string      `json:"dataContentType,omitempty"`
+	Data            interface{} `json:"data"`
+}
+
+// DefaultEventSource is the CloudEvents source used when a service does not set its own
+const DefaultEventSource = "/warehouse"
+
+// subjectProvider is implemented by event payloads that identify the entity they describe
+type subjectProvider interface {
+	EventSubject() string
 }
 
 // NewEventMessage creates a new event message
 func NewEventMessage(eventType string, data interface{}) *EventMessage {
-	return &EventMessage{
-		EventType: eventType,
-		EventID:   uuid.New().String(),
-		Timestamp: time.Now(),
-		Data:      data,
+	event := &EventMessage{
+		EventType:       eventType,
+		EventID:         uuid.New().String(),
+		Timestamp:       time.Now(),
+		Source:          DefaultEventSource,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+
+	if provider, ok := data.(subjectProvider); ok {
+		event.Subject = provider.EventSubject()
 	}
+
+	return event
+}
+
+// WithSource sets the CloudEvents source of the event
+func (e *EventMessage) WithSource(source string) *EventMessage {
+	e.Source = source
+	return e
+}
+
+// WithSubject sets the CloudEvents subject of the event
+func (e *EventMessage) WithSubject(subject string) *EventMessage {
+	e.Subject = subject
+	return e
 }
 
 // ToJSON converts the event message to JSON
@@ -30,6 +61,23 @@ func (e *EventMessage) ToJSON() ([]byte, error) {
 	return json.Marshal(e)
 }
 
+// DecodeData unmarshals the event payload into v. It accepts both payloads
+// built in-process and raw JSON payloads read back from Kafka.
+func (e *EventMessage) DecodeData(v interface{}) error {
+	switch data := e.Data.(type) {
+	case json.RawMessage:
+		return json.Unmarshal(data, v)
+	case []byte:
+		return json.Unmarshal(data, v)
+	default:
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, v)
+	}
+}
+
 // InventoryEvent represents inventory-related events
 type InventoryEvent struct {
 	ItemID  string                 `json:"itemId"`
@@ -64,6 +112,23 @@ type UserEvent struct {
 	Changes map[string]interface{} `json:"changes"`
 }
 
+// EventSubject returns the item the event is about
+func (e InventoryEvent) EventSubject() string { return e.ItemID }
+
+// EventSubject returns the shipment the event is about
+func (e ShipmentEvent) EventSubject() string { return e.ShipmentID }
+
+// EventSubject returns the scanned item, or the scan itself for user scans
+func (e ScanEvent) EventSubject() string {
+	if e.ItemID != "" {
+		return e.ItemID
+	}
+	return e.ScanID
+}
+
+// EventSubject returns the user the event is about
+func (e UserEvent) EventSubject() string { return e.UserID }
+
 // Event type constants
 const (
 	// Inventory events
@@ -96,4 +161,7 @@ const (
 	TopicShipmentEvents  = "shipment-events"
 	TopicScanEvents      = "scan-events"
 	TopicUserEvents      = "user-events"
+
+	// TopicStockLevels is a compacted topic holding the latest stock level per item
+	TopicStockLevels = "stock-levels"
 )
\ No newline at end of file
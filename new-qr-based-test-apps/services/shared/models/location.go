@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Location levels, from the outermost to the innermost
+const (
+	LevelWarehouse = "warehouse"
+	LevelZone      = "zone"
+	LevelAisle     = "aisle"
+	LevelRack      = "rack"
+	LevelBin       = "bin"
+)
+
+// LocationLevels lists the levels of the location hierarchy in order
+var LocationLevels = []string{LevelWarehouse, LevelZone, LevelAisle, LevelRack, LevelBin}
+
+// LocationSeparator joins the parts of a location code
+const LocationSeparator = "-"
+
+// Capacity limits what a location can hold. Zero means unlimited.
+type Capacity struct {
+	MaxUnits    int     `bson:"maxUnits,omitempty" json:"maxUnits,omitempty" validate:"min=0"`
+	MaxWeightKg float64 `bson:"maxWeightKg,omitempty" json:"maxWeightKg,omitempty" validate:"min=0"`
+	MaxVolumeM3 float64 `bson:"maxVolumeM3,omitempty" json:"maxVolumeM3,omitempty" validate:"min=0"`
+}
+
+// Location is a warehouse, zone, aisle, rack or bin. Its code is the path
+// from its warehouse joined with dashes, e.g. JKT-A-01-R2-B04 for bin B04
+// of rack R2 in aisle 01 of zone A in warehouse JKT. Stock is held in bins;
+// Occupied is the number of units in a bin, kept by the stock ledger.
+type Location struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Code      string             `bson:"code" json:"code"`
+	Name      string             `bson:"name,omitempty" json:"name,omitempty"`
+	Level     string             `bson:"level" json:"level"`
+	Parent    string             `bson:"parent,omitempty" json:"parent,omitempty"`
+	Warehouse string             `bson:"warehouse" json:"warehouse"`
+	Zone      string             `bson:"zone,omitempty" json:"zone,omitempty"`
+	Aisle     string             `bson:"aisle,omitempty" json:"aisle,omitempty"`
+	Rack      string             `bson:"rack,omitempty" json:"rack,omitempty"`
+	Bin       string             `bson:"bin,omitempty" json:"bin,omitempty"`
+	Capacity  Capacity           `bson:"capacity" json:"capacity"`
+	Occupied  int                `bson:"occupied" json:"occupied"`
+	Active    bool               `bson:"active" json:"active"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// BinStock is the quantity of an item held at one location, per lot. Items
+// are usually spread over several bins; their total is Item.StockLevel.
+// Stock not tracked by lot has an empty lot. ExpiresAt is copied from the
+// lot so that bins can be picked first expired first out.
+type BinStock struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ItemID    string             `bson:"itemId" json:"itemId"`
+	Location  string             `bson:"location" json:"location"`
+	Warehouse string             `bson:"warehouse" json:"warehouse"`
+	Lot       string             `bson:"lot" json:"lot,omitempty"`
+	ExpiresAt *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	Quantity  int                `bson:"quantity" json:"quantity"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
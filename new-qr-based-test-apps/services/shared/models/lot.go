@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lot expiry events, published to TopicInventoryEvents as InventoryEvents
+// with the lot in their changes
+const (
+	EventLotExpiring = "lot_expiring"
+	EventLotExpired  = "lot_expired"
+)
+
+// Lot is a batch of an item received together. Lot numbers are unique per
+// item and are encoded in item barcodes. Quantity is the stock of the lot
+// over all bins, kept by the stock ledger.
+type Lot struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ItemID          string             `bson:"itemId" json:"itemId"`
+	LotNumber       string             `bson:"lotNumber" json:"lotNumber"`
+	ManufacturedAt  *time.Time         `bson:"manufacturedAt,omitempty" json:"manufacturedAt,omitempty"`
+	ExpiresAt       *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	Quantity        int                `bson:"quantity" json:"quantity"`
+	ExpiringAlertAt *time.Time         `bson:"expiringAlertAt,omitempty" json:"-"`
+	ExpiredAlertAt  *time.Time         `bson:"expiredAlertAt,omitempty" json:"-"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt       time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Expired checks if the lot is past its expiry date at the given time
+func (l *Lot) Expired(at time.Time) bool {
+	return l.ExpiresAt != nil && !at.Before(*l.ExpiresAt)
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,7 +19,11 @@ type Item struct {
 	SellingPrice     float64            `bson:"sellingPrice" json:"sellingPrice" validate:"required,min=0"`
 	ProfitMargin     float64            `bson:"profitMargin" json:"profitMargin"`
 	StockLevel       int                `bson:"stockLevel" json:"stockLevel" validate:"min=0"`
-	WarehouseLocation string            `bson:"warehouseLocation" json:"warehouseLocation"`
+	StockValue       float64            `bson:"stockValue" json:"stockValue"` // value of the stock level under the category's valuation method
+	AverageCost      float64            `bson:"averageCost" json:"averageCost"` // stock value per unit
+	Reserved         int                `bson:"reserved" json:"reserved"` // units of the stock level reserved for shipments
+	WarehouseLocation string            `bson:"warehouseLocation" json:"warehouseLocation"` // default bin of movements without a location
+	Serialized       bool               `bson:"serialized" json:"serialized"` // movements name the serial number of every unit
 	Status           string             `bson:"status" json:"status" validate:"oneof=active inactive discontinued"`
 	CreatedAt        time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt        time.Time          `bson:"updatedAt" json:"updatedAt"`
@@ -31,6 +36,14 @@ func (i *Item) CalculateProfitMargin() {
 	}
 }
 
+// Available returns the units of the stock level not reserved for shipments
+func (i *Item) Available() int {
+	if i.Reserved > i.StockLevel {
+		return 0
+	}
+	return i.StockLevel - i.Reserved
+}
+
 // IsInStock checks if the item is in stock
 func (i *Item) IsInStock() bool {
 	return i.StockLevel > 0 && i.Status == "active"
@@ -40,7 +53,8 @@ func (i *Item) IsInStock() bool {
 type Shipment struct {
 	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	ShipmentID       string             `bson:"shipmentId" json:"shipmentId" validate:"required,regex=^SHP-[0-9]{4}-[0-9]{3}$"`
-	Items            []string           `bson:"items" json:"items" validate:"required,min=1"`
+	Lines            []ShipmentLine     `bson:"lines" json:"lines" validate:"required,min=1,dive"`
+	Totals           ShipmentTotals     `bson:"totals" json:"totals"`
 	Destination      string             `bson:"destination" json:"destination" validate:"required,min=2"`
 	Status           string             `bson:"status" json:"status" validate:"oneof=pending in_transit delivered delayed cancelled"`
 	EstimatedDelivery *time.Time        `bson:"estimatedDelivery" json:"estimatedDelivery"`
@@ -51,6 +65,93 @@ type Shipment struct {
 	UpdatedAt        time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
+// Shipment statuses
+const (
+	ShipmentPending   = "pending"
+	ShipmentInTransit = "in_transit"
+	ShipmentDelivered = "delivered"
+	ShipmentDelayed   = "delayed"
+	ShipmentCancelled = "cancelled"
+)
+
+// VolumetricDivisor converts the volume of a package in cubic centimetres
+// to the weight in kilograms carriers charge for it
+const VolumetricDivisor = 5000.0
+
+// Dimensions are the outer measures of a package in centimetres
+type Dimensions struct {
+	LengthCm float64 `bson:"lengthCm" json:"lengthCm" validate:"min=0"`
+	WidthCm  float64 `bson:"widthCm" json:"widthCm" validate:"min=0"`
+	HeightCm float64 `bson:"heightCm" json:"heightCm" validate:"min=0"`
+}
+
+// Volume returns the volume of the package in cubic centimetres
+func (d Dimensions) Volume() float64 {
+	return d.LengthCm * d.WidthCm * d.HeightCm
+}
+
+// ShipmentLine is a quantity of one item in a shipment. The weight and
+// dimensions are those of one unit as packed.
+type ShipmentLine struct {
+	ItemID     string     `bson:"itemId" json:"itemId" validate:"required"`
+	Quantity   int        `bson:"quantity" json:"quantity" validate:"required,min=1"`
+	UnitPrice  float64    `bson:"unitPrice" json:"unitPrice" validate:"min=0"`
+	WeightKg   float64    `bson:"weightKg" json:"weightKg" validate:"min=0"`
+	Dimensions Dimensions `bson:"dimensions" json:"dimensions"`
+}
+
+// Value returns the value of the line
+func (l *ShipmentLine) Value() float64 {
+	return l.UnitPrice * float64(l.Quantity)
+}
+
+// GrossWeight returns the weight of the line in kilograms
+func (l *ShipmentLine) GrossWeight() float64 {
+	return l.WeightKg * float64(l.Quantity)
+}
+
+// VolumetricWeight returns the weight carriers charge for the volume of
+// the line in kilograms
+func (l *ShipmentLine) VolumetricWeight() float64 {
+	return l.Dimensions.Volume() / VolumetricDivisor * float64(l.Quantity)
+}
+
+// ShipmentTotals sum up the lines of a shipment. Carriers bill the
+// chargeable weight, the greater of the gross and volumetric weights.
+type ShipmentTotals struct {
+	Units              int     `bson:"units" json:"units"`
+	Value              float64 `bson:"value" json:"value"`
+	GrossWeightKg      float64 `bson:"grossWeightKg" json:"grossWeightKg"`
+	VolumetricWeightKg float64 `bson:"volumetricWeightKg" json:"volumetricWeightKg"`
+	ChargeableWeightKg float64 `bson:"chargeableWeightKg" json:"chargeableWeightKg"`
+}
+
+// CalculateTotals sums up the lines of the shipment, values to the cent
+// and weights to the gram
+func (s *Shipment) CalculateTotals() {
+	var totals ShipmentTotals
+	for i := range s.Lines {
+		totals.Units += s.Lines[i].Quantity
+		totals.Value += s.Lines[i].Value()
+		totals.GrossWeightKg += s.Lines[i].GrossWeight()
+		totals.VolumetricWeightKg += s.Lines[i].VolumetricWeight()
+	}
+	totals.Value = math.Round(totals.Value*100) / 100
+	totals.GrossWeightKg = math.Round(totals.GrossWeightKg*1000) / 1000
+	totals.VolumetricWeightKg = math.Round(totals.VolumetricWeightKg*1000) / 1000
+	totals.ChargeableWeightKg = math.Max(totals.GrossWeightKg, totals.VolumetricWeightKg)
+	s.Totals = totals
+}
+
+// ItemIDs returns the IDs of the items of the shipment
+func (s *Shipment) ItemIDs() []string {
+	ids := make([]string, len(s.Lines))
+	for i := range s.Lines {
+		ids[i] = s.Lines[i].ItemID
+	}
+	return ids
+}
+
 // CalculateRemainingTime calculates the remaining time until delivery
 func (s *Shipment) CalculateRemainingTime() {
 	if s.EstimatedDelivery != nil && s.Status == "in_transit" {
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Price change statuses
+const (
+	PriceScheduled = "scheduled" // waiting for its effective date
+	PriceApplied   = "applied"   // the item has, or had, its prices
+	PriceCancelled = "cancelled" // withdrawn before its effective date
+)
+
+// PriceChange sets the cost and selling price of an item from a date. An
+// applied change is in effect until the next one applied, its EffectiveTo;
+// the change in effect has none. The prices it replaced are kept so that
+// the prices of the item before its first change are known.
+type PriceChange struct {
+	ID                   primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ItemID               string             `bson:"itemId" json:"itemId"`
+	CostPrice            float64            `bson:"costPrice" json:"costPrice"`
+	SellingPrice         float64            `bson:"sellingPrice" json:"sellingPrice"`
+	ProfitMargin         float64            `bson:"profitMargin" json:"profitMargin"`
+	PreviousCostPrice    float64            `bson:"previousCostPrice" json:"previousCostPrice"`
+	PreviousSellingPrice float64            `bson:"previousSellingPrice" json:"previousSellingPrice"`
+	EffectiveFrom        time.Time          `bson:"effectiveFrom" json:"effectiveFrom"`
+	EffectiveTo          *time.Time         `bson:"effectiveTo,omitempty" json:"effectiveTo,omitempty"`
+	Status               string             `bson:"status" json:"status"`
+	Reason               string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	ChangedBy            string             `bson:"changedBy" json:"changedBy"`
+	CancelledBy          string             `bson:"cancelledBy,omitempty" json:"cancelledBy,omitempty"`
+	CreatedAt            time.Time          `bson:"createdAt" json:"createdAt"`
+	AppliedAt            *time.Time         `bson:"appliedAt,omitempty" json:"appliedAt,omitempty"`
+	UpdatedAt            time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ProfitMargin is the share of a selling price that is profit, in percent
+// rounded to the hundredth, 0 without a selling price
+func ProfitMargin(costPrice, sellingPrice float64) float64 {
+	if sellingPrice <= 0 {
+		return 0
+	}
+	return math.Round((sellingPrice-costPrice)/sellingPrice*10000) / 100
+}
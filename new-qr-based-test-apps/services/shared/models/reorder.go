@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventLowStock is published to TopicInventoryEvents as an InventoryEvent
+// when a stock alert is raised or becomes critical
+const EventLowStock = "low_stock"
+
+// Stock alert severities
+const (
+	AlertLow      = "low"      // at or below the reorder point
+	AlertCritical = "critical" // at or below the safety stock
+)
+
+// Stock alert statuses
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved" // stock went back above the reorder point
+)
+
+// ReorderPolicy tells when and how much of an item to reorder, for all of
+// its stock or for its stock within one location
+type ReorderPolicy struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ItemID          string             `bson:"itemId" json:"itemId"`
+	Location        string             `bson:"location" json:"location"` // empty for all stock of the item
+	ReorderPoint    int                `bson:"reorderPoint" json:"reorderPoint"`
+	SafetyStock     int                `bson:"safetyStock" json:"safetyStock"`
+	ReorderQuantity int                `bson:"reorderQuantity" json:"reorderQuantity"`
+	UpdatedBy       string             `bson:"updatedBy" json:"updatedBy"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt       time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// StockAlert is raised when the stock of a reorder policy falls to its
+// reorder point. An item and location have at most one unresolved alert.
+type StockAlert struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ItemID          string             `bson:"itemId" json:"itemId"`
+	Location        string             `bson:"location" json:"location"`
+	Severity        string             `bson:"severity" json:"severity"`
+	Status          string             `bson:"status" json:"status"`
+	OnHand          int                `bson:"onHand" json:"onHand"`
+	ReorderPoint    int                `bson:"reorderPoint" json:"reorderPoint"`
+	SafetyStock     int                `bson:"safetyStock" json:"safetyStock"`
+	ReorderQuantity int                `bson:"reorderQuantity" json:"reorderQuantity"`
+	AcknowledgedBy  string             `bson:"acknowledgedBy,omitempty" json:"acknowledgedBy,omitempty"`
+	RaisedAt        time.Time          `bson:"raisedAt" json:"raisedAt"`
+	UpdatedAt       time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ResolvedAt      *time.Time         `bson:"resolvedAt,omitempty" json:"resolvedAt,omitempty"`
+}
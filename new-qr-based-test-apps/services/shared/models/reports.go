@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Report entities
+const (
+	ReportEntityItems     = "items"
+	ReportEntityShipments = "shipments"
+	ReportEntityScanLogs  = "scan_logs"
+)
+
+// ReportFilter restricts the records of a report
+type ReportFilter struct {
+	Field    string      `bson:"field" json:"field" validate:"required"`
+	Operator string      `bson:"operator" json:"operator" validate:"required,oneof=eq ne gt gte lt lte in contains"`
+	Value    interface{} `bson:"value" json:"value"`
+}
+
+// ReportAggregation computes a value per group. Count needs no field.
+type ReportAggregation struct {
+	Function string `bson:"function" json:"function" validate:"required,oneof=count sum avg min max"`
+	Field    string `bson:"field,omitempty" json:"field,omitempty"`
+	Alias    string `bson:"alias,omitempty" json:"alias,omitempty"`
+}
+
+// ReportSort orders the rows of a report by an output column
+type ReportSort struct {
+	Field string `bson:"field" json:"field" validate:"required"`
+	Desc  bool   `bson:"desc" json:"desc"`
+}
+
+// ReportDefinition is a saved report owned by a user
+type ReportDefinition struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	OwnerID      string              `bson:"ownerId" json:"ownerId"`
+	Name         string              `bson:"name" json:"name"`
+	Description  string              `bson:"description" json:"description"`
+	Entity       string              `bson:"entity" json:"entity"`
+	Columns      []string            `bson:"columns" json:"columns"`
+	Filters      []ReportFilter      `bson:"filters" json:"filters"`
+	GroupBy      []string            `bson:"groupBy" json:"groupBy"`
+	Aggregations []ReportAggregation `bson:"aggregations" json:"aggregations"`
+	Sort         []ReportSort        `bson:"sort" json:"sort"`
+	Limit        int                 `bson:"limit" json:"limit"`
+	Schedule     string              `bson:"schedule,omitempty" json:"schedule,omitempty"` // cron expression, empty for manual runs only
+	NextRunAt    *time.Time          `bson:"nextRunAt,omitempty" json:"nextRunAt,omitempty"`
+	LastRunAt    *time.Time          `bson:"lastRunAt,omitempty" json:"lastRunAt,omitempty"`
+	CreatedAt    time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time           `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ReportRun is one execution of a report with its results
+type ReportRun struct {
+	ID         primitive.ObjectID       `bson:"_id,omitempty" json:"id,omitempty"`
+	ReportID   primitive.ObjectID       `bson:"reportId" json:"reportId"`
+	OwnerID    string                   `bson:"ownerId" json:"ownerId"`
+	Trigger    string                   `bson:"trigger" json:"trigger"`
+	Status     string                   `bson:"status" json:"status"`
+	Columns    []string                 `bson:"columns" json:"columns"`
+	Rows       []map[string]interface{} `bson:"rows,omitempty" json:"rows,omitempty"`
+	RowCount   int                      `bson:"rowCount" json:"rowCount"`
+	Truncated  bool                     `bson:"truncated" json:"truncated"`
+	Error      string                   `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt  time.Time                `bson:"startedAt" json:"startedAt"`
+	FinishedAt *time.Time               `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+}
+
+// Report run triggers
+const (
+	ReportTriggerManual   = "manual"
+	ReportTriggerSchedule = "schedule"
+)
+
+// Report run statuses
+const (
+	ReportRunRunning   = "running"
+	ReportRunSucceeded = "succeeded"
+	ReportRunFailed    = "failed"
+)
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reservation statuses
+const (
+	ReservationActive   = "active"   // holds stock for its shipment
+	ReservationReleased = "released" // the shipment was cancelled
+	ReservationIssued   = "issued"   // the stock left with the shipment
+)
+
+// Allocation outcomes of a reservation
+const (
+	AllocationFull        = "allocated"   // all of the requested quantity is reserved
+	AllocationPartial     = "partial"     // some of it is reserved, the rest is backordered
+	AllocationBackordered = "backordered" // none of it is reserved
+)
+
+// StockReservation is the stock of an item set aside for a shipment when
+// it is created. What the item does not have available is backordered.
+// The allocated units count in Item.Reserved while the reservation is
+// active.
+type StockReservation struct {
+	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	ShipmentID  string               `bson:"shipmentId" json:"shipmentId"`
+	ItemID      string               `bson:"itemId" json:"itemId"`
+	Requested   int                  `bson:"requested" json:"requested"`
+	Allocated   int                  `bson:"allocated" json:"allocated"`
+	Backordered int                  `bson:"backordered" json:"backordered"`
+	Status      string               `bson:"status" json:"status"`
+	Serials     []string             `bson:"serials,omitempty" json:"serials,omitempty"`         // units reserved of a serialized item
+	MovementIDs []primitive.ObjectID `bson:"movementIds,omitempty" json:"movementIds,omitempty"` // issues the reservation became
+	CreatedBy   string               `bson:"createdBy" json:"createdBy"`
+	CreatedAt   time.Time            `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time            `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Allocation tells how much of the requested quantity was reserved
+func (r *StockReservation) Allocation() string {
+	switch {
+	case r.Backordered == 0:
+		return AllocationFull
+	case r.Allocated > 0:
+		return AllocationPartial
+	}
+	return AllocationBackordered
+}
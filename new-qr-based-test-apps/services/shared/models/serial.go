@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Serial statuses
+const (
+	SerialInStock  = "in_stock"
+	SerialReserved = "reserved"
+	SerialShipped  = "shipped"
+	SerialReturned = "returned" // back in stock after a return
+	SerialRemoved  = "removed"  // written off by an adjustment
+)
+
+// SerialsHeld are the statuses of units in a bin, which can be moved or shipped
+var SerialsHeld = []string{SerialInStock, SerialReserved, SerialReturned}
+
+// Serial is one unit of a serialized item. Serial numbers are unique over
+// all items. The stock ledger registers units on receipt and keeps their
+// status and location in step with the movements of the item.
+type Serial struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	SerialNumber string             `bson:"serialNumber" json:"serialNumber"`
+	ItemID       string             `bson:"itemId" json:"itemId"`
+	Status       string             `bson:"status" json:"status"`
+	Location     string             `bson:"location" json:"location"` // bin while held, last bin once shipped
+	Lot          string             `bson:"lot,omitempty" json:"lot,omitempty"`
+	ReservedFor  string             `bson:"reservedFor,omitempty" json:"reservedFor,omitempty"` // shipment ID or other reference
+	ShipmentID   string             `bson:"shipmentId,omitempty" json:"shipmentId,omitempty"`
+	History      []SerialEvent      `bson:"history" json:"history"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// SerialEvent is one change in the life of a unit: a movement of its item
+// or a reservation
+type SerialEvent struct {
+	Action     string              `bson:"action" json:"action"`                     // movement type, reserved or released
+	Status     string              `bson:"status,omitempty" json:"status,omitempty"` // status after the change, empty when unchanged
+	Location   string              `bson:"location" json:"location"`
+	Reference  string              `bson:"reference,omitempty" json:"reference,omitempty"`
+	MovementID *primitive.ObjectID `bson:"movementId,omitempty" json:"movementId,omitempty"`
+	UserID     string              `bson:"userId" json:"userId"`
+	At         time.Time           `bson:"at" json:"at"`
+}
+
+// Held checks if the unit is in a bin
+func (s *Serial) Held() bool {
+	for _, status := range SerialsHeld {
+		if s.Status == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Stock movement types
+const (
+	MovementReceipt    = "receipt"
+	MovementIssue      = "issue"
+	MovementAdjustment = "adjustment"
+	MovementTransfer   = "transfer"
+	MovementReturn     = "return"
+)
+
+// StockMovement records one change to the stock of an item. Quantity is
+// positive for stock coming in and negative for stock going out. The unit
+// price is copied from the item when the movement is recorded so that later
+// price changes do not rewrite past profit. The unit cost is what stock
+// came in at, or what it went out at under the valuation method of the
+// item's category; COGS is the cost of the units of an issue.
+type StockMovement struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ItemID            string             `bson:"itemId" json:"itemId" validate:"required"`
+	Type              string             `bson:"type" json:"type" validate:"required,oneof=receipt issue adjustment transfer return"`
+	Quantity          int                `bson:"quantity" json:"quantity"`
+	UnitCost          float64            `bson:"unitCost" json:"unitCost"`
+	UnitPrice         float64            `bson:"unitPrice" json:"unitPrice"`
+	COGS              float64            `bson:"cogs,omitempty" json:"cogs,omitempty"`
+	StockValue        float64            `bson:"stockValue" json:"stockValue"` // value of the item's stock after the movement
+	WarehouseLocation string             `bson:"warehouseLocation" json:"warehouseLocation"`
+	Lot               string             `bson:"lot,omitempty" json:"lot,omitempty"`
+	Serials           []string           `bson:"serials,omitempty" json:"serials,omitempty"`
+	Reason            string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	Reference         string             `bson:"reference,omitempty" json:"reference,omitempty"` // shipment ID, purchase order, count task...
+	UserID            string             `bson:"userId" json:"userId"`
+	CreatedAt         time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// StockLevel is the latest stock of an item, published to the compacted
+// TopicStockLevels keyed by item ID after every movement
+type StockLevel struct {
+	ItemID            string    `json:"itemId"`
+	StockLevel        int       `json:"stockLevel"`
+	WarehouseLocation string    `json:"warehouseLocation"`
+	MovementType      string    `json:"movementType"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// EventSubject returns the item of the stock level
+func (s StockLevel) EventSubject() string { return s.ItemID }
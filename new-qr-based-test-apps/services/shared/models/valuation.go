@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Inventory valuation methods
+const (
+	ValuationFIFO     = "fifo"     // issues cost the oldest cost layers first
+	ValuationAverage  = "average"  // issues cost the moving average cost of the stock
+	ValuationStandard = "standard" // stock and issues are valued at Item.CostPrice
+)
+
+// DefaultValuation is the valuation method of categories without a policy
+const DefaultValuation = ValuationAverage
+
+// ValuationMethods lists the valuation methods
+var ValuationMethods = []string{ValuationFIFO, ValuationAverage, ValuationStandard}
+
+// Categories lists the item categories
+var Categories = []string{"Electronics", "Clothing", "Food", "Books", "Tools", "Other"}
+
+// ValuationPolicy sets the valuation method of an item category. A new
+// method applies from the next movement of each item.
+type ValuationPolicy struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Category  string             `bson:"category" json:"category"`
+	Method    string             `bson:"method" json:"method"`
+	UpdatedBy string             `bson:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// CostLayer is stock of an item that came in at one unit cost, by a
+// receipt, a return or an adjustment. Stock going out draws the oldest
+// layers first, whatever the valuation method, so that FIFO can be turned
+// on at any time.
+type CostLayer struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ItemID     string             `bson:"itemId" json:"itemId"`
+	MovementID primitive.ObjectID `bson:"movementId,omitempty" json:"movementId,omitempty"`
+	Quantity   int                `bson:"quantity" json:"quantity"`
+	Remaining  int                `bson:"remaining" json:"remaining"`
+	UnitCost   float64            `bson:"unitCost" json:"unitCost"`
+	ReceivedAt time.Time          `bson:"receivedAt" json:"receivedAt"`
+}
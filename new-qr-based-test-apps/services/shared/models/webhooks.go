@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookSubscription represents an outbound webhook endpoint
+type WebhookSubscription struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	URL                 string             `bson:"url" json:"url" validate:"required,url"`
+	EventTypes          []string           `bson:"eventTypes" json:"eventTypes" validate:"required,min=1"`
+	Secret              string             `bson:"secret" json:"-"`
+	Description         string             `bson:"description" json:"description"`
+	Active              bool               `bson:"active" json:"active"`
+	ConsecutiveFailures int                `bson:"consecutiveFailures" json:"consecutiveFailures"`
+	DisabledAt          *time.Time         `bson:"disabledAt,omitempty" json:"disabledAt,omitempty"`
+	DisabledReason      string             `bson:"disabledReason,omitempty" json:"disabledReason,omitempty"`
+	CreatedAt           time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt           time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// WebhookEventAll subscribes an endpoint to every event type
+const WebhookEventAll = "*"
+
+// Matches checks if the subscription wants events of the given type
+func (w *WebhookSubscription) Matches(eventType string) bool {
+	for _, t := range w.EventTypes {
+		if t == eventType || t == WebhookEventAll {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery represents one event sent (or to be sent) to a webhook endpoint
+type WebhookDelivery struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	SubscriptionID primitive.ObjectID  `bson:"subscriptionId" json:"subscriptionId"`
+	EventID        string              `bson:"eventId" json:"eventId"`
+	EventType      string              `bson:"eventType" json:"eventType"`
+	URL            string              `bson:"url" json:"url"`
+	Payload        json.RawMessage     `bson:"payload" json:"payload"`
+	Status         string              `bson:"status" json:"status"`
+	Attempts       int                 `bson:"attempts" json:"attempts"`
+	NextAttemptAt  *time.Time          `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time          `bson:"lastAttemptAt,omitempty" json:"lastAttemptAt,omitempty"`
+	LeaseUntil     *time.Time          `bson:"leaseUntil,omitempty" json:"-"`
+	ResponseStatus int                 `bson:"responseStatus,omitempty" json:"responseStatus,omitempty"`
+	ResponseBody   string              `bson:"responseBody,omitempty" json:"responseBody,omitempty"`
+	Error          string              `bson:"error,omitempty" json:"error,omitempty"`
+	ReplayOf       *primitive.ObjectID `bson:"replayOf,omitempty" json:"replayOf,omitempty"`
+	Replay         bool                `bson:"replay" json:"-"` // replays are left out of the one-delivery-per-event index
+	CreatedAt      time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time           `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending    = "pending"
+	WebhookDeliveryDelivering = "delivering"
+	WebhookDeliveryRetrying   = "retrying"
+	WebhookDeliverySucceeded  = "succeeded"
+	WebhookDeliveryFailed     = "failed"
+)
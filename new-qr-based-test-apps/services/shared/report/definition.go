@@ -0,0 +1,321 @@
+// Package report builds, runs and schedules the custom reports of the
+// warehouse dashboard.
+//
+// A report definition selects an entity, filters its records, optionally
+// groups and aggregates them and keeps a set of columns. Items and
+// shipments are queried with a MongoDB aggregation, scan logs with an
+// Elasticsearch search. Every run stores its rows so that they can be
+// downloaded later.
+package report
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/models"
+)
+
+// ErrInvalidDefinition is returned for definitions that cannot be run
+var ErrInvalidDefinition = errors.New("invalid report definition")
+
+// Limits of a report run
+const (
+	DefaultLimit = 1000
+	MaxRows      = 5000 // rows kept per run, larger results are truncated
+)
+
+// Field types
+const (
+	fieldString = "string"
+	fieldNumber = "number"
+	fieldDate   = "date"
+)
+
+// entitySchemas lists the fields a report can use per entity
+var entitySchemas = map[string]map[string]string{
+	models.ReportEntityItems: {
+		"itemId":            fieldString,
+		"name":              fieldString,
+		"category":          fieldString,
+		"barcode":           fieldString,
+		"warehouseLocation": fieldString,
+		"status":            fieldString,
+		"costPrice":         fieldNumber,
+		"sellingPrice":      fieldNumber,
+		"profitMargin":      fieldNumber,
+		"stockLevel":        fieldNumber,
+		"createdAt":         fieldDate,
+		"updatedAt":         fieldDate,
+	},
+	models.ReportEntityShipments: {
+		"shipmentId":        fieldString,
+		"destination":       fieldString,
+		"status":            fieldString,
+		"trackingNumber":    fieldString,
+		"estimatedDelivery": fieldDate,
+		"actualDelivery":    fieldDate,
+		"createdAt":         fieldDate,
+		"updatedAt":         fieldDate,
+	},
+	models.ReportEntityScanLogs: {
+		"scanId":    fieldString,
+		"scanType":  fieldString,
+		"result":    fieldString,
+		"location":  fieldString,
+		"deviceId":  fieldString,
+		"userId":    fieldString,
+		"username":  fieldString,
+		"userRole":  fieldString,
+		"itemId":    fieldString,
+		"category":  fieldString,
+		"action":    fieldString,
+		"timestamp": fieldDate,
+	},
+}
+
+// Fields returns the fields of an entity and their types
+func Fields(entity string) map[string]string {
+	return entitySchemas[entity]
+}
+
+// entityLevels lists the entities that need more than a login to report
+// on. Scan logs name the users who scanned and when.
+var entityLevels = map[string]string{
+	models.ReportEntityScanLogs: auth.AccessLevel3,
+}
+
+// CanReport reports whether a user of an access level may create and run
+// reports on an entity
+func CanReport(accessLevel, entity string) bool {
+	level, ok := entityLevels[entity]
+	return !ok || auth.HasPermission(accessLevel, level)
+}
+
+// Validate checks a definition against the schema of its entity and fills
+// in the defaults: the limit, aggregation aliases and, without columns, the
+// grouped and aggregated columns or every field of the entity.
+func Validate(def *models.ReportDefinition) error {
+	schema, ok := entitySchemas[def.Entity]
+	if !ok {
+		return invalid("unknown entity %q", def.Entity)
+	}
+	if strings.TrimSpace(def.Name) == "" {
+		return invalid("name is required")
+	}
+
+	for _, filter := range def.Filters {
+		kind, ok := schema[filter.Field]
+		if !ok {
+			return invalid("unknown filter field %q", filter.Field)
+		}
+		if _, err := filterValue(kind, filter, time.Now()); err != nil {
+			return invalid("filter on %s: %v", filter.Field, err)
+		}
+	}
+
+	for _, field := range def.GroupBy {
+		if schema[field] != fieldString {
+			return invalid("cannot group by %q", field)
+		}
+	}
+
+	aliases := map[string]bool{}
+	for i := range def.Aggregations {
+		aggregation := &def.Aggregations[i]
+		switch aggregation.Function {
+		case "count":
+			aggregation.Field = ""
+		case "sum", "avg", "min", "max":
+			if schema[aggregation.Field] != fieldNumber {
+				return invalid("cannot %s %q", aggregation.Function, aggregation.Field)
+			}
+		default:
+			return invalid("unknown aggregation %q", aggregation.Function)
+		}
+		if aggregation.Alias == "" {
+			aggregation.Alias = strings.TrimSuffix(aggregation.Function+"_"+aggregation.Field, "_")
+		}
+		if aliases[aggregation.Alias] || schema[aggregation.Alias] != "" {
+			return invalid("duplicate column %q", aggregation.Alias)
+		}
+		aliases[aggregation.Alias] = true
+	}
+
+	available := outputColumns(def, schema)
+	if len(def.Columns) == 0 {
+		def.Columns = available
+	}
+	for _, column := range def.Columns {
+		if !contains(available, column) {
+			return invalid("column %q is not available", column)
+		}
+	}
+	for _, order := range def.Sort {
+		if !contains(available, order.Field) {
+			return invalid("cannot sort by %q", order.Field)
+		}
+	}
+
+	if def.Limit <= 0 {
+		def.Limit = DefaultLimit
+	}
+	if def.Limit > MaxRows {
+		return invalid("limit cannot exceed %d", MaxRows)
+	}
+
+	if def.Schedule != "" {
+		if _, err := NextRun(def.Schedule, time.Now()); err != nil {
+			return invalid("schedule: %v", err)
+		}
+	}
+	return nil
+}
+
+// grouped reports whether the definition aggregates its records
+func grouped(def *models.ReportDefinition) bool {
+	return len(def.GroupBy) > 0 || len(def.Aggregations) > 0
+}
+
+// outputColumns returns the columns a definition can output: the grouped
+// fields and aggregations of grouped reports, every field otherwise
+func outputColumns(def *models.ReportDefinition, schema map[string]string) []string {
+	if grouped(def) {
+		columns := append([]string{}, def.GroupBy...)
+		for _, aggregation := range def.Aggregations {
+			columns = append(columns, aggregation.Alias)
+		}
+		return columns
+	}
+
+	columns := make([]string, 0, len(schema))
+	for field := range schema {
+		columns = append(columns, field)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// NextRun returns the next time a cron schedule fires after a time. The
+// schedule uses the standard five fields or a descriptor such as @daily.
+func NextRun(schedule string, after time.Time) (time.Time, error) {
+	parsed, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parsed.Next(after), nil
+}
+
+// filterValue converts the value of a filter to the type of its field.
+// Date values accept RFC 3339, YYYY-MM-DD and "now" with an optional
+// offset such as "now-7d" or "now-12h", so scheduled reports can cover a
+// moving window.
+func filterValue(kind string, filter models.ReportFilter, now time.Time) (interface{}, error) {
+	if filter.Operator == "in" {
+		// Lists decode as primitive.A when the definition is read back from MongoDB
+		var values []interface{}
+		switch list := filter.Value.(type) {
+		case []interface{}:
+			values = list
+		case primitive.A:
+			values = list
+		}
+		if len(values) == 0 {
+			return nil, errors.New("in expects a non-empty list")
+		}
+		converted := make([]interface{}, len(values))
+		for i, value := range values {
+			v, err := scalarValue(kind, value, now)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = v
+		}
+		return converted, nil
+	}
+
+	if filter.Operator == "contains" && kind != fieldString {
+		return nil, errors.New("contains only applies to text fields")
+	}
+	return scalarValue(kind, filter.Value, now)
+}
+
+// scalarValue converts a single filter value to the type of its field
+func scalarValue(kind string, value interface{}, now time.Time) (interface{}, error) {
+	switch kind {
+	case fieldNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+		return nil, fmt.Errorf("expected a number, got %v", value)
+	case fieldDate:
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a date, got %v", value)
+		}
+		return parseDate(text, now)
+	default:
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected text, got %v", value)
+		}
+		return text, nil
+	}
+}
+
+// parseDate parses an absolute or relative filter date
+func parseDate(value string, now time.Time) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	if offset := strings.TrimPrefix(value, "now-"); offset != value && len(offset) > 1 {
+		unit := offset[len(offset)-1]
+		var amount int
+		if _, err := fmt.Sscanf(offset[:len(offset)-1], "%d", &amount); err == nil && amount > 0 {
+			switch unit {
+			case 'h':
+				return now.Add(-time.Duration(amount) * time.Hour), nil
+			case 'd':
+				return now.AddDate(0, 0, -amount), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*amount), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid relative date %q", value)
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// invalid wraps ErrInvalidDefinition with a reason
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidDefinition, fmt.Sprintf(format, args...))
+}
+
+// contains reports whether list contains value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,337 @@
+package report
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"warehouse-shared/models"
+)
+
+// mongoPipeline builds the aggregation pipeline of an items or shipments
+// report. It asks for one row more than the limit to detect truncation.
+func mongoPipeline(def *models.ReportDefinition, now time.Time) (mongo.Pipeline, error) {
+	schema := entitySchemas[def.Entity]
+
+	match := bson.M{}
+	for _, filter := range def.Filters {
+		value, err := filterValue(schema[filter.Field], filter, now)
+		if err != nil {
+			return nil, invalid("filter on %s: %v", filter.Field, err)
+		}
+
+		condition, _ := match[filter.Field].(bson.M)
+		if condition == nil {
+			condition = bson.M{}
+		}
+		switch filter.Operator {
+		case "eq":
+			condition["$eq"] = value
+		case "contains":
+			condition["$regex"] = regexp.QuoteMeta(value.(string))
+			condition["$options"] = "i"
+		default:
+			condition["$"+filter.Operator] = value
+		}
+		match[filter.Field] = condition
+	}
+
+	pipeline := mongo.Pipeline{}
+	if len(match) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: match}})
+	}
+
+	project := bson.D{{Key: "_id", Value: 0}}
+	if grouped(def) {
+		id := bson.D{}
+		for _, field := range def.GroupBy {
+			id = append(id, bson.E{Key: field, Value: "$" + field})
+		}
+		group := bson.D{{Key: "_id", Value: id}}
+		for _, aggregation := range def.Aggregations {
+			var accumulator bson.M
+			if aggregation.Function == "count" {
+				accumulator = bson.M{"$sum": 1}
+			} else {
+				accumulator = bson.M{"$" + aggregation.Function: "$" + aggregation.Field}
+			}
+			group = append(group, bson.E{Key: aggregation.Alias, Value: accumulator})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$group", Value: group}})
+
+		for _, column := range def.Columns {
+			if contains(def.GroupBy, column) {
+				project = append(project, bson.E{Key: column, Value: "$_id." + column})
+			} else {
+				project = append(project, bson.E{Key: column, Value: 1})
+			}
+		}
+	} else {
+		for _, column := range def.Columns {
+			project = append(project, bson.E{Key: column, Value: 1})
+		}
+	}
+
+	sortStage := bson.D{}
+	for _, order := range def.Sort {
+		direction := 1
+		if order.Desc {
+			direction = -1
+		}
+		sortStage = append(sortStage, bson.E{Key: order.Field, Value: direction})
+	}
+
+	// Sort before projecting so that sorting on a grouped field can use _id
+	if len(sortStage) > 0 {
+		if grouped(def) {
+			for i, e := range sortStage {
+				if contains(def.GroupBy, e.Key) {
+					sortStage[i].Key = "_id." + e.Key
+				}
+			}
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sortStage}})
+	}
+
+	pipeline = append(pipeline,
+		bson.D{{Key: "$limit", Value: def.Limit + 1}},
+		bson.D{{Key: "$project", Value: project}},
+	)
+	return pipeline, nil
+}
+
+// searchBody builds the Elasticsearch request of a scan log report. Grouped
+// reports use a composite aggregation with one metric per aggregation.
+func searchBody(def *models.ReportDefinition, now time.Time) (map[string]interface{}, error) {
+	schema := entitySchemas[def.Entity]
+
+	var filters, mustNot []interface{}
+	for _, filter := range def.Filters {
+		value, err := filterValue(schema[filter.Field], filter, now)
+		if err != nil {
+			return nil, invalid("filter on %s: %v", filter.Field, err)
+		}
+
+		switch filter.Operator {
+		case "eq":
+			filters = append(filters, esTerm("term", filter.Field, value))
+		case "ne":
+			mustNot = append(mustNot, esTerm("term", filter.Field, value))
+		case "in":
+			filters = append(filters, esTerm("terms", filter.Field, value))
+		case "contains":
+			filters = append(filters, esTerm("wildcard", filter.Field, map[string]interface{}{
+				"value":            "*" + escapeWildcard(value.(string)) + "*",
+				"case_insensitive": true,
+			}))
+		default:
+			filters = append(filters, esTerm("range", filter.Field, map[string]interface{}{filter.Operator: value}))
+		}
+	}
+
+	query := map[string]interface{}{"bool": map[string]interface{}{
+		"filter":   nonNil(filters),
+		"must_not": nonNil(mustNot),
+	}}
+
+	if !grouped(def) {
+		var sorts []interface{}
+		for _, order := range def.Sort {
+			direction := "asc"
+			if order.Desc {
+				direction = "desc"
+			}
+			sorts = append(sorts, map[string]interface{}{order.Field: direction})
+		}
+		return map[string]interface{}{
+			"query":   query,
+			"size":    def.Limit + 1,
+			"_source": def.Columns,
+			"sort":    nonNil(sorts),
+		}, nil
+	}
+
+	sources := []interface{}{}
+	for _, field := range def.GroupBy {
+		sources = append(sources, map[string]interface{}{
+			field: map[string]interface{}{"terms": map[string]interface{}{"field": field, "missing_bucket": true}},
+		})
+	}
+	metrics := map[string]interface{}{}
+	for _, aggregation := range def.Aggregations {
+		if aggregation.Function != "count" {
+			metrics[aggregation.Alias] = map[string]interface{}{
+				aggregation.Function: map[string]interface{}{"field": aggregation.Field},
+			}
+		}
+	}
+
+	body := map[string]interface{}{"query": query, "size": 0, "track_total_hits": false}
+	if len(sources) == 0 {
+		// Aggregations over every record, a single row
+		body["aggs"] = metrics
+		return body, nil
+	}
+	body["aggs"] = map[string]interface{}{"groups": map[string]interface{}{
+		"composite": map[string]interface{}{"size": MaxRows + 1, "sources": sources},
+		"aggs":      metrics,
+	}}
+	return body, nil
+}
+
+// searchResponse is the part of an Elasticsearch response read by reports
+type searchResponse struct {
+	Hits struct {
+		Hits []struct {
+			Source map[string]interface{} `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]interface{} `json:"aggregations"`
+}
+
+// searchRows converts a search response into report rows. Grouped rows are
+// sorted and limited here, since composite buckets come ordered by key.
+func searchRows(def *models.ReportDefinition, response *searchResponse) []map[string]interface{} {
+	if !grouped(def) {
+		rows := make([]map[string]interface{}, 0, len(response.Hits.Hits))
+		for _, hit := range response.Hits.Hits {
+			rows = append(rows, selectColumns(hit.Source, def.Columns))
+		}
+		return rows
+	}
+
+	var buckets []map[string]interface{}
+	if groups, ok := response.Aggregations["groups"].(map[string]interface{}); ok {
+		list, _ := groups["buckets"].([]interface{})
+		for _, item := range list {
+			if bucket, ok := item.(map[string]interface{}); ok {
+				buckets = append(buckets, bucket)
+			}
+		}
+	} else if len(def.GroupBy) == 0 {
+		buckets = []map[string]interface{}{response.Aggregations}
+	}
+
+	rows := make([]map[string]interface{}, 0, len(buckets))
+	for _, bucket := range buckets {
+		row := map[string]interface{}{}
+		if key, ok := bucket["key"].(map[string]interface{}); ok {
+			for _, field := range def.GroupBy {
+				row[field] = key[field]
+			}
+		}
+		for _, aggregation := range def.Aggregations {
+			if aggregation.Function == "count" {
+				row[aggregation.Alias] = bucket["doc_count"]
+				continue
+			}
+			if metric, ok := bucket[aggregation.Alias].(map[string]interface{}); ok {
+				row[aggregation.Alias] = metric["value"]
+			}
+		}
+		rows = append(rows, selectColumns(row, def.Columns))
+	}
+
+	sortRows(rows, def.Sort)
+	if len(rows) > def.Limit+1 {
+		rows = rows[:def.Limit+1]
+	}
+	return rows
+}
+
+// sortRows sorts rows in place by the report sort columns
+func sortRows(rows []map[string]interface{}, orders []models.ReportSort) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, order := range orders {
+			c := compareValues(rows[i][order.Field], rows[j][order.Field])
+			if c == 0 {
+				continue
+			}
+			if order.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// compareValues orders numbers and strings, with missing values first
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	x, _ := a.(string)
+	y, _ := b.(string)
+	return strings.Compare(x, y)
+}
+
+// normalizeRow converts the BSON values of an aggregation result into
+// plain values that encode the same way as search results
+func normalizeRow(row bson.M, columns []string) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(row))
+	for key, value := range row {
+		switch v := value.(type) {
+		case primitive.DateTime:
+			normalized[key] = v.Time().UTC()
+		case primitive.ObjectID:
+			normalized[key] = v.Hex()
+		case int32:
+			normalized[key] = float64(v)
+		case int64:
+			normalized[key] = float64(v)
+		default:
+			normalized[key] = v
+		}
+	}
+	return selectColumns(normalized, columns)
+}
+
+// selectColumns returns a row with exactly the report columns
+func selectColumns(row map[string]interface{}, columns []string) map[string]interface{} {
+	selected := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		selected[column] = row[column]
+	}
+	return selected
+}
+
+// esTerm builds a single-field query clause such as term or range
+func esTerm(kind, field string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{kind: map[string]interface{}{field: value}}
+}
+
+// escapeWildcard escapes the wildcard characters of a search term
+func escapeWildcard(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`).Replace(value)
+}
+
+// nonNil returns an empty list instead of nil, which JSON encodes as null
+func nonNil(list []interface{}) []interface{} {
+	if list == nil {
+		return []interface{}{}
+	}
+	return list
+}
@@ -0,0 +1,209 @@
+package report
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"warehouse-shared/auth"
+	"warehouse-shared/models"
+)
+
+var now = time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+func TestValidate(t *testing.T) {
+	def := &models.ReportDefinition{
+		Name:         "Stock by category",
+		Entity:       models.ReportEntityItems,
+		GroupBy:      []string{"category"},
+		Aggregations: []models.ReportAggregation{{Function: "count"}, {Function: "sum", Field: "stockLevel"}},
+		Sort:         []models.ReportSort{{Field: "sum_stockLevel", Desc: true}},
+	}
+	require.NoError(t, Validate(def))
+	assert.Equal(t, []string{"category", "count", "sum_stockLevel"}, def.Columns)
+	assert.Equal(t, DefaultLimit, def.Limit)
+
+	plain := &models.ReportDefinition{Name: "Shipments", Entity: models.ReportEntityShipments}
+	require.NoError(t, Validate(plain))
+	assert.Contains(t, plain.Columns, "shipmentId")
+
+	invalidDefs := map[string]*models.ReportDefinition{
+		"entity":      {Name: "x", Entity: "users"},
+		"group":       {Name: "x", Entity: models.ReportEntityItems, GroupBy: []string{"stockLevel"}},
+		"sum text":    {Name: "x", Entity: models.ReportEntityItems, Aggregations: []models.ReportAggregation{{Function: "sum", Field: "name"}}},
+		"column":      {Name: "x", Entity: models.ReportEntityItems, GroupBy: []string{"category"}, Columns: []string{"name"}},
+		"filter":      {Name: "x", Entity: models.ReportEntityItems, Filters: []models.ReportFilter{{Field: "stockLevel", Operator: "gt", Value: "ten"}}},
+		"in":          {Name: "x", Entity: models.ReportEntityItems, Filters: []models.ReportFilter{{Field: "status", Operator: "in", Value: "active"}}},
+		"schedule":    {Name: "x", Entity: models.ReportEntityItems, Schedule: "every day"},
+		"limit":       {Name: "x", Entity: models.ReportEntityItems, Limit: MaxRows + 1},
+		"sort":        {Name: "x", Entity: models.ReportEntityItems, Sort: []models.ReportSort{{Field: "unknown"}}},
+		"alias clash": {Name: "x", Entity: models.ReportEntityItems, Aggregations: []models.ReportAggregation{{Function: "count", Alias: "name"}}},
+	}
+	for name, def := range invalidDefs {
+		assert.ErrorIs(t, Validate(def), ErrInvalidDefinition, name)
+	}
+}
+
+func TestCanReport(t *testing.T) {
+	assert.True(t, CanReport(auth.AccessLevel1, models.ReportEntityItems))
+	assert.False(t, CanReport(auth.AccessLevel2, models.ReportEntityScanLogs))
+	assert.True(t, CanReport(auth.AccessLevel3, models.ReportEntityScanLogs))
+	assert.True(t, CanReport(auth.AccessLevel5, models.ReportEntityScanLogs))
+}
+
+func TestParseDate(t *testing.T) {
+	for value, expected := range map[string]time.Time{
+		"now":                  now,
+		"now-7d":               now.AddDate(0, 0, -7),
+		"now-12h":              now.Add(-12 * time.Hour),
+		"now-2w":               now.AddDate(0, 0, -14),
+		"2024-01-31":           time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		"2024-01-31T08:00:00Z": time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC),
+	} {
+		parsed, err := parseDate(value, now)
+		require.NoError(t, err, value)
+		assert.True(t, expected.Equal(parsed), value)
+	}
+
+	for _, value := range []string{"now-", "now-7y", "yesterday"} {
+		_, err := parseDate(value, now)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	next, err := NextRun("0 6 * * 1", now) // Mondays at 06:00
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 18, 6, 0, 0, 0, time.UTC), next)
+
+	next, err = NextRun("@daily", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC), next)
+}
+
+func TestMongoPipeline(t *testing.T) {
+	def := &models.ReportDefinition{
+		Name:    "Low stock electronics",
+		Entity:  models.ReportEntityItems,
+		Columns: []string{"category", "count"},
+		Filters: []models.ReportFilter{
+			{Field: "stockLevel", Operator: "lt", Value: 10.0},
+			{Field: "stockLevel", Operator: "gte", Value: 1.0},
+			{Field: "name", Operator: "contains", Value: "usb.c"},
+			{Field: "updatedAt", Operator: "gte", Value: "now-7d"},
+		},
+		GroupBy:      []string{"category"},
+		Aggregations: []models.ReportAggregation{{Function: "count"}},
+		Sort:         []models.ReportSort{{Field: "category"}},
+		Limit:        50,
+	}
+	require.NoError(t, Validate(def))
+
+	pipeline, err := mongoPipeline(def, now)
+	require.NoError(t, err)
+	require.Len(t, pipeline, 5)
+
+	match := pipeline[0][0].Value.(bson.M)
+	assert.Equal(t, bson.M{"$lt": 10.0, "$gte": 1.0}, match["stockLevel"])
+	assert.Equal(t, bson.M{"$regex": `usb\.c`, "$options": "i"}, match["name"])
+	assert.Equal(t, bson.M{"$gte": now.AddDate(0, 0, -7)}, match["updatedAt"])
+
+	assert.Equal(t, "$group", pipeline[1][0].Key)
+	assert.Equal(t, bson.D{{Key: "_id.category", Value: 1}}, pipeline[2][0].Value)
+	assert.Equal(t, 51, pipeline[3][0].Value)
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: 0},
+		{Key: "category", Value: "$_id.category"},
+		{Key: "count", Value: 1},
+	}, pipeline[4][0].Value)
+}
+
+func TestNormalizeRow(t *testing.T) {
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	row := normalizeRow(bson.M{
+		"itemId":     "ITM-2024-001",
+		"stockLevel": int32(4),
+		"createdAt":  primitive.NewDateTimeFromTime(created),
+		"extra":      true,
+	}, []string{"itemId", "stockLevel", "createdAt", "status"})
+
+	assert.Equal(t, map[string]interface{}{
+		"itemId":     "ITM-2024-001",
+		"stockLevel": 4.0,
+		"createdAt":  created,
+		"status":     nil,
+	}, row)
+}
+
+func TestSearchBody(t *testing.T) {
+	def := &models.ReportDefinition{
+		Name:   "Failed scans",
+		Entity: models.ReportEntityScanLogs,
+		Filters: []models.ReportFilter{
+			{Field: "result", Operator: "eq", Value: "failure"},
+			{Field: "location", Operator: "in", Value: primitive.A{"WH-A", "WH-B"}},
+			{Field: "deviceId", Operator: "ne", Value: "TEST-1"},
+			{Field: "timestamp", Operator: "gte", Value: "now-1d"},
+		},
+		Columns: []string{"scanId", "timestamp"},
+		Sort:    []models.ReportSort{{Field: "timestamp", Desc: true}},
+		Limit:   20,
+	}
+	require.NoError(t, Validate(def))
+
+	body, err := searchBody(def, now)
+	require.NoError(t, err)
+	raw, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"query": {"bool": {
+			"filter": [
+				{"term": {"result": "failure"}},
+				{"terms": {"location": ["WH-A", "WH-B"]}},
+				{"range": {"timestamp": {"gte": "2024-03-14T12:00:00Z"}}}
+			],
+			"must_not": [{"term": {"deviceId": "TEST-1"}}]
+		}},
+		"size": 21,
+		"_source": ["scanId", "timestamp"],
+		"sort": [{"timestamp": "desc"}]
+	}`, string(raw))
+}
+
+func TestSearchRowsGrouped(t *testing.T) {
+	def := &models.ReportDefinition{
+		Name:         "Scans per location",
+		Entity:       models.ReportEntityScanLogs,
+		GroupBy:      []string{"location"},
+		Aggregations: []models.ReportAggregation{{Function: "count", Alias: "scans"}},
+		Sort:         []models.ReportSort{{Field: "scans", Desc: true}},
+		Limit:        1,
+	}
+	require.NoError(t, Validate(def))
+
+	body, err := searchBody(def, now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, body["size"])
+
+	var response searchResponse
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"hits": {"hits": []},
+		"aggregations": {"groups": {"buckets": [
+			{"key": {"location": "WH-A"}, "doc_count": 3},
+			{"key": {"location": "WH-B"}, "doc_count": 7},
+			{"key": {"location": "WH-C"}, "doc_count": 5}
+		]}}
+	}`), &response))
+
+	rows := searchRows(def, &response)
+	assert.Equal(t, []map[string]interface{}{
+		{"location": "WH-B", "scans": 7.0},
+		{"location": "WH-C", "scans": 5.0},
+	}, rows, "one row more than the limit to detect truncation")
+}
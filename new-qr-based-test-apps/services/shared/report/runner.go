@@ -0,0 +1,203 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// entityCollections maps the MongoDB-backed entities to their collections
+var entityCollections = map[string]string{
+	models.ReportEntityItems:     database.ItemsCollection,
+	models.ReportEntityShipments: database.ShipmentsCollection,
+}
+
+// Runner executes report definitions and records their runs
+type Runner struct {
+	store   *Store
+	mongo   *database.MongoDB
+	es      *database.ElasticsearchClient
+	timeout time.Duration
+}
+
+// NewRunner creates a new report runner. Runs are cut off after timeout.
+func NewRunner(store *Store, mongo *database.MongoDB, es *database.ElasticsearchClient, timeout time.Duration) *Runner {
+	return &Runner{store: store, mongo: mongo, es: es, timeout: timeout}
+}
+
+// Run executes a definition and stores the run with its rows. A failing
+// query is recorded as a failed run; the error is only returned when the
+// run could not be stored.
+func (r *Runner) Run(ctx context.Context, def *models.ReportDefinition, trigger string) (*models.ReportRun, error) {
+	run := &models.ReportRun{
+		ReportID:  def.ID,
+		OwnerID:   def.OwnerID,
+		Trigger:   trigger,
+		Status:    models.ReportRunRunning,
+		Columns:   def.Columns,
+		StartedAt: time.Now(),
+	}
+	if err := r.store.createRun(ctx, run); err != nil {
+		return nil, err
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	rows, err := r.query(queryCtx, def, run.StartedAt)
+	cancel()
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if err != nil {
+		run.Status = models.ReportRunFailed
+		run.Error = err.Error()
+	} else {
+		run.Status = models.ReportRunSucceeded
+		if len(rows) > def.Limit {
+			rows = rows[:def.Limit]
+			run.Truncated = true
+		}
+		run.Rows = rows
+		run.RowCount = len(rows)
+	}
+
+	if err := r.store.finishRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// query fetches the rows of a definition, at most one more than its limit
+func (r *Runner) query(ctx context.Context, def *models.ReportDefinition, now time.Time) ([]map[string]interface{}, error) {
+	if err := Validate(def); err != nil {
+		return nil, err
+	}
+
+	if def.Entity == models.ReportEntityScanLogs {
+		body, err := searchBody(def, now)
+		if err != nil {
+			return nil, err
+		}
+		var response searchResponse
+		if err := r.es.Search(ctx, database.ScanLogsIndex, body, &response); err != nil {
+			return nil, err
+		}
+		return searchRows(def, &response), nil
+	}
+
+	pipeline, err := mongoPipeline(def, now)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := r.mongo.GetCollection(entityCollections[def.Entity]).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run report query: %w", err)
+	}
+
+	var results []bson.M
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode report rows: %w", err)
+	}
+	rows := make([]map[string]interface{}, len(results))
+	for i, result := range results {
+		rows[i] = normalizeRow(result, def.Columns)
+	}
+	return rows, nil
+}
+
+// Scheduler runs the scheduled reports when they are due. Several
+// instances can run a scheduler: each due run is claimed by one of them.
+type Scheduler struct {
+	store        *Store
+	runner       *Runner
+	pollInterval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a new report scheduler
+func NewScheduler(store *Store, runner *Runner, pollInterval time.Duration) *Scheduler {
+	return &Scheduler{store: store, runner: runner, pollInterval: pollInterval}
+}
+
+// Start checks for due reports every poll interval
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go s.run(ctx)
+
+	log.Printf("Report scheduler started, polling every %s", s.pollInterval)
+}
+
+// Stop stops the scheduler and waits for the report being run
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+}
+
+// run polls for due reports until the scheduler is stopped
+func (s *Scheduler) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.runDue(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue claims and runs the reports due at now. A report that missed
+// several runs while no scheduler was up runs once and resumes its schedule.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	defs, err := s.store.dueDefinitions(ctx, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error finding due reports: %v", err)
+		}
+		return
+	}
+
+	for i := range defs {
+		def := &defs[i]
+		next, err := NextRun(def.Schedule, now)
+		if err != nil {
+			log.Printf("Invalid schedule %q of report %s: %v", def.Schedule, def.ID.Hex(), err)
+			continue
+		}
+
+		claimed, err := s.store.claim(ctx, def, next)
+		if err != nil {
+			log.Printf("Error claiming report %s: %v", def.ID.Hex(), err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		run, err := s.runner.Run(ctx, def, models.ReportTriggerSchedule)
+		if err != nil {
+			log.Printf("Error running report %s: %v", def.ID.Hex(), err)
+			continue
+		}
+		if run.Status == models.ReportRunFailed {
+			log.Printf("Scheduled report %s failed: %s", def.ID.Hex(), run.Error)
+		}
+	}
+}
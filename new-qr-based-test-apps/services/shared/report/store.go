@@ -0,0 +1,247 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// ErrNotFound is returned when a definition or run does not exist or
+// belongs to another user
+var ErrNotFound = errors.New("report not found")
+
+// Store persists report definitions and runs in MongoDB
+type Store struct {
+	definitions *mongo.Collection
+	runs        *mongo.Collection
+}
+
+// NewStore creates a new report store
+func NewStore(db *database.MongoDB) *Store {
+	return &Store{
+		definitions: db.GetCollection(database.ReportDefinitionsCollection),
+		runs:        db.GetCollection(database.ReportRunsCollection),
+	}
+}
+
+// EnsureIndexes creates the indexes used by the API and the scheduler
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	_, err := s.definitions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "nextRunAt", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create report definition indexes: %w", err)
+	}
+
+	if _, err := s.runs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "reportId", Value: 1}, {Key: "startedAt", Value: -1}},
+	}); err != nil {
+		return fmt.Errorf("failed to create report run index: %w", err)
+	}
+	return nil
+}
+
+// CreateDefinition stores a new definition
+func (s *Store) CreateDefinition(ctx context.Context, def *models.ReportDefinition) error {
+	now := time.Now()
+	def.ID = primitive.NewObjectID()
+	def.CreatedAt = now
+	def.UpdatedAt = now
+	if err := schedule(def, now); err != nil {
+		return err
+	}
+
+	if _, err := s.definitions.InsertOne(ctx, def); err != nil {
+		return fmt.Errorf("failed to create report definition: %w", err)
+	}
+	return nil
+}
+
+// GetDefinition returns a definition of a user
+func (s *Store) GetDefinition(ctx context.Context, id primitive.ObjectID, ownerID string) (*models.ReportDefinition, error) {
+	var def models.ReportDefinition
+	err := s.definitions.FindOne(ctx, bson.M{"_id": id, "ownerId": ownerID}).Decode(&def)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report definition: %w", err)
+	}
+	return &def, nil
+}
+
+// ListDefinitions returns the definitions of a user, newest first
+func (s *Store) ListDefinitions(ctx context.Context, ownerID string) ([]models.ReportDefinition, error) {
+	cursor, err := s.definitions.Find(ctx, bson.M{"ownerId": ownerID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list report definitions: %w", err)
+	}
+
+	defs := []models.ReportDefinition{}
+	if err := cursor.All(ctx, &defs); err != nil {
+		return nil, fmt.Errorf("failed to decode report definitions: %w", err)
+	}
+	return defs, nil
+}
+
+// UpdateDefinition replaces the query and schedule of a definition. The
+// next run is recomputed from the new schedule.
+func (s *Store) UpdateDefinition(ctx context.Context, def *models.ReportDefinition) error {
+	now := time.Now()
+	def.UpdatedAt = now
+	if err := schedule(def, now); err != nil {
+		return err
+	}
+
+	set := bson.M{
+		"name":         def.Name,
+		"description":  def.Description,
+		"entity":       def.Entity,
+		"columns":      def.Columns,
+		"filters":      def.Filters,
+		"groupBy":      def.GroupBy,
+		"aggregations": def.Aggregations,
+		"sort":         def.Sort,
+		"limit":        def.Limit,
+		"updatedAt":    now,
+	}
+	update := bson.M{"$set": set}
+	if def.Schedule == "" {
+		update["$unset"] = bson.M{"schedule": "", "nextRunAt": ""}
+	} else {
+		set["schedule"] = def.Schedule
+		set["nextRunAt"] = def.NextRunAt
+	}
+
+	err := s.definitions.FindOneAndUpdate(ctx, bson.M{"_id": def.ID, "ownerId": def.OwnerID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(def)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update report definition: %w", err)
+	}
+	return nil
+}
+
+// DeleteDefinition removes a definition and its runs
+func (s *Store) DeleteDefinition(ctx context.Context, id primitive.ObjectID, ownerID string) error {
+	result, err := s.definitions.DeleteOne(ctx, bson.M{"_id": id, "ownerId": ownerID})
+	if err != nil {
+		return fmt.Errorf("failed to delete report definition: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := s.runs.DeleteMany(ctx, bson.M{"reportId": id}); err != nil {
+		return fmt.Errorf("failed to delete report runs: %w", err)
+	}
+	return nil
+}
+
+// ListRuns returns the runs of a report without their rows, newest first
+func (s *Store) ListRuns(ctx context.Context, reportID primitive.ObjectID, ownerID string, limit int) ([]models.ReportRun, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "startedAt", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"rows": 0})
+	cursor, err := s.runs.Find(ctx, bson.M{"reportId": reportID, "ownerId": ownerID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list report runs: %w", err)
+	}
+
+	runs := []models.ReportRun{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, fmt.Errorf("failed to decode report runs: %w", err)
+	}
+	return runs, nil
+}
+
+// GetRun returns a run of a user's report with its rows
+func (s *Store) GetRun(ctx context.Context, reportID, runID primitive.ObjectID, ownerID string) (*models.ReportRun, error) {
+	var run models.ReportRun
+	err := s.runs.FindOne(ctx, bson.M{"_id": runID, "reportId": reportID, "ownerId": ownerID}).Decode(&run)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report run: %w", err)
+	}
+	return &run, nil
+}
+
+// createRun stores a run that has just started
+func (s *Store) createRun(ctx context.Context, run *models.ReportRun) error {
+	run.ID = primitive.NewObjectID()
+	if _, err := s.runs.InsertOne(ctx, run); err != nil {
+		return fmt.Errorf("failed to create report run: %w", err)
+	}
+	return nil
+}
+
+// finishRun stores the outcome of a run and the run time of its report
+func (s *Store) finishRun(ctx context.Context, run *models.ReportRun) error {
+	if _, err := s.runs.ReplaceOne(ctx, bson.M{"_id": run.ID}, run); err != nil {
+		return fmt.Errorf("failed to save report run: %w", err)
+	}
+
+	if _, err := s.definitions.UpdateOne(ctx, bson.M{"_id": run.ReportID},
+		bson.M{"$set": bson.M{"lastRunAt": run.StartedAt}}); err != nil {
+		return fmt.Errorf("failed to update report definition: %w", err)
+	}
+	return nil
+}
+
+// dueDefinitions returns the scheduled definitions whose next run has come
+func (s *Store) dueDefinitions(ctx context.Context, now time.Time) ([]models.ReportDefinition, error) {
+	cursor, err := s.definitions.Find(ctx, bson.M{"nextRunAt": bson.M{"$lte": now}},
+		options.Find().SetSort(bson.D{{Key: "nextRunAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due reports: %w", err)
+	}
+
+	var defs []models.ReportDefinition
+	if err := cursor.All(ctx, &defs); err != nil {
+		return nil, fmt.Errorf("failed to decode due reports: %w", err)
+	}
+	return defs, nil
+}
+
+// claim moves the next run of a due definition forward. Only the instance
+// whose update matches the old next run gets to run the report.
+func (s *Store) claim(ctx context.Context, def *models.ReportDefinition, next time.Time) (bool, error) {
+	result, err := s.definitions.UpdateOne(ctx,
+		bson.M{"_id": def.ID, "nextRunAt": def.NextRunAt},
+		bson.M{"$set": bson.M{"nextRunAt": next}})
+	if err != nil {
+		return false, fmt.Errorf("failed to claim report run: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// schedule sets the next run of a definition from its schedule
+func schedule(def *models.ReportDefinition, now time.Time) error {
+	def.NextRunAt = nil
+	if def.Schedule == "" {
+		return nil
+	}
+
+	next, err := NextRun(def.Schedule, now)
+	if err != nil {
+		return invalid("schedule: %v", err)
+	}
+	def.NextRunAt = &next
+	return nil
+}
@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"warehouse-shared/database/mongotest"
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// receivedRequest is a webhook request seen by the test receiver
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is an httptest webhook endpoint answering with a scripted
+// sequence of statuses, the last one repeated
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		status := r.statuses[0]
+		if len(r.statuses) > 1 {
+			r.statuses = r.statuses[1:]
+		}
+		r.requests = append(r.requests, receivedRequest{header: req.Header.Clone(), body: body})
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+// newTestDispatcher returns a dispatcher on a test database with one
+// subscription to stock updates sent to the receiver
+func newTestDispatcher(t *testing.T, config DispatcherConfig, url string) (*Dispatcher, *models.WebhookSubscription) {
+	store := NewStore(mongotest.Connect(t))
+	require.NoError(t, store.EnsureIndexes(context.Background()))
+
+	sub := &models.WebhookSubscription{
+		URL:        url,
+		EventTypes: []string{models.EventStockUpdated},
+		Secret:     "whsec_test",
+		Active:     true,
+	}
+	require.NoError(t, store.CreateSubscription(context.Background(), sub))
+
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = 5 * time.Second
+	}
+	return NewDispatcher(store, kafka.NewMemoryBus(), config), sub
+}
+
+// sendDue attempts every delivery that is due, the way the delivery loop does
+func sendDue(t *testing.T, d *Dispatcher) int {
+	sent := 0
+	for {
+		delivery, err := d.store.claimDue(context.Background(), time.Minute)
+		require.NoError(t, err)
+		if delivery == nil {
+			return sent
+		}
+		d.attempt(context.Background(), delivery)
+		sent++
+	}
+}
+
+func deliveriesOf(t *testing.T, d *Dispatcher, eventID string) []models.WebhookDelivery {
+	deliveries, _, err := d.store.ListDeliveries(context.Background(), DeliveryFilter{EventID: eventID}, 0, 100)
+	require.NoError(t, err)
+	return deliveries
+}
+
+func TestDispatcherSendsSignedDelivery(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	d, sub := newTestDispatcher(t, DefaultDispatcherConfig(), r.URL)
+
+	event := models.NewEventMessage(models.EventStockUpdated, map[string]interface{}{"itemId": "ITM-2024-001"})
+	require.NoError(t, d.handleEvent(context.Background(), event))
+	assert.Equal(t, 1, sendDue(t, d))
+
+	requests := r.received()
+	require.Len(t, requests, 1)
+	req := requests[0]
+	assert.Equal(t, kafka.CloudEventsContentType, req.header.Get("Content-Type"))
+	assert.Equal(t, models.EventStockUpdated, req.header.Get(HeaderEventType))
+	assert.Equal(t, Sign(sub.Secret, req.header.Get(HeaderTimestamp), req.body), req.header.Get(HeaderSignature))
+	assert.Contains(t, string(req.body), event.EventID)
+
+	deliveries := deliveriesOf(t, d, event.EventID)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, deliveries[0].ID.Hex(), req.header.Get(HeaderDeliveryID))
+	assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].ResponseStatus)
+}
+
+func TestDispatcherRetriesServerErrors(t *testing.T) {
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusOK)
+	d, _ := newTestDispatcher(t, DispatcherConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		DisableAfter:   5,
+	}, r.URL)
+
+	event := models.NewEventMessage(models.EventStockUpdated, nil)
+	require.NoError(t, d.handleEvent(context.Background(), event))
+	assert.Equal(t, 1, sendDue(t, d))
+
+	deliveries := deliveriesOf(t, d, event.EventID)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.WebhookDeliveryRetrying, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseStatus)
+	require.NotNil(t, deliveries[0].NextAttemptAt)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, sendDue(t, d))
+
+	deliveries = deliveriesOf(t, d, event.EventID)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Len(t, r.received(), 2)
+}
+
+func TestDispatcherDisablesFailingEndpoint(t *testing.T) {
+	r := newReceiver(t, http.StatusServiceUnavailable)
+	d, sub := newTestDispatcher(t, DispatcherConfig{MaxAttempts: 1, DisableAfter: 2}, r.URL)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.handleEvent(ctx, models.NewEventMessage(models.EventStockUpdated, nil)))
+		assert.Equal(t, 1, sendDue(t, d))
+	}
+
+	disabled, err := d.store.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.False(t, disabled.Active)
+	assert.NotNil(t, disabled.DisabledAt)
+	assert.Equal(t, 2, disabled.ConsecutiveFailures)
+
+	event := models.NewEventMessage(models.EventStockUpdated, nil)
+	require.NoError(t, d.handleEvent(ctx, event))
+	assert.Empty(t, deliveriesOf(t, d, event.EventID), "disabled endpoints get no new deliveries")
+	assert.Len(t, r.received(), 2)
+}
+
+func TestDispatcherFailsDeliveriesOfDeletedSubscription(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	d, sub := newTestDispatcher(t, DefaultDispatcherConfig(), r.URL)
+	ctx := context.Background()
+
+	event := models.NewEventMessage(models.EventStockUpdated, nil)
+	require.NoError(t, d.handleEvent(ctx, event))
+	require.NoError(t, d.store.DeleteSubscription(ctx, sub.ID))
+	assert.Equal(t, 1, sendDue(t, d))
+
+	deliveries := deliveriesOf(t, d, event.EventID)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.WebhookDeliveryFailed, deliveries[0].Status)
+	assert.Nil(t, deliveries[0].NextAttemptAt)
+	assert.Empty(t, r.received())
+}
+
+func TestDispatcherKeepsDeliveryWhenSubscriptionLookupFails(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	d, _ := newTestDispatcher(t, DefaultDispatcherConfig(), r.URL)
+
+	event := models.NewEventMessage(models.EventStockUpdated, nil)
+	require.NoError(t, d.handleEvent(context.Background(), event))
+	delivery, err := d.store.claimDue(context.Background(), 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NotNil(t, delivery)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.attempt(ctx, delivery)
+
+	deliveries := deliveriesOf(t, d, event.EventID)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.WebhookDeliveryDelivering, deliveries[0].Status, "the delivery stays leased")
+	assert.Zero(t, deliveries[0].Attempts)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, sendDue(t, d), "the delivery is claimed again once its lease runs out")
+	deliveries = deliveriesOf(t, d, event.EventID)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Len(t, r.received(), 1)
+}
+
+func TestDispatcherIgnoresRedeliveredEvents(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	d, _ := newTestDispatcher(t, DefaultDispatcherConfig(), r.URL)
+	ctx := context.Background()
+
+	event := models.NewEventMessage(models.EventStockUpdated, nil)
+	require.NoError(t, d.handleEvent(ctx, event))
+	require.NoError(t, d.handleEvent(ctx, event))
+	require.Len(t, deliveriesOf(t, d, event.EventID), 1)
+
+	assert.Equal(t, 1, sendDue(t, d))
+	require.NoError(t, d.handleEvent(ctx, event))
+	assert.Equal(t, 0, sendDue(t, d))
+
+	original := deliveriesOf(t, d, event.EventID)[0]
+	replay, err := d.Replay(ctx, original.ID)
+	require.NoError(t, err)
+	assert.Equal(t, original.ID, *replay.ReplayOf)
+	require.NoError(t, d.handleEvent(ctx, event))
+
+	assert.Len(t, deliveriesOf(t, d, event.EventID), 2, "replays are delivered again")
+	assert.Equal(t, 1, sendDue(t, d))
+	assert.Len(t, r.received(), 2)
+}
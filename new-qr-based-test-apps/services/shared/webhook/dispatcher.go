@@ -0,0 +1,373 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"warehouse-shared/kafka"
+	"warehouse-shared/models"
+)
+
+// Headers sent with every webhook request
+const (
+	HeaderDeliveryID = "X-Webhook-Delivery"
+	HeaderEventType  = "X-Webhook-Event"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderSignature  = "X-Webhook-Signature"
+)
+
+// ConsumerGroup is the Kafka consumer group of the dispatcher
+const ConsumerGroup = "webhook-dispatcher"
+
+// Topics are the event topics forwarded to webhook endpoints
+var Topics = []string{
+	models.TopicInventoryEvents,
+	models.TopicShipmentEvents,
+	models.TopicScanEvents,
+}
+
+// maxResponseBody is the number of response bytes kept in the delivery log
+const maxResponseBody = 1024
+
+// DispatcherConfig holds the retry and failure settings of the dispatcher
+type DispatcherConfig struct {
+	MaxAttempts    int           // attempts per delivery before it fails
+	InitialBackoff time.Duration // delay before the first retry, doubled on each retry
+	MaxBackoff     time.Duration
+	DisableAfter   int // consecutive failed deliveries before an endpoint is disabled
+	Workers        int
+	PollInterval   time.Duration
+	RequestTimeout time.Duration
+}
+
+// DefaultDispatcherConfig returns the default dispatcher settings
+func DefaultDispatcherConfig() DispatcherConfig {
+	return DispatcherConfig{
+		MaxAttempts:    6,
+		InitialBackoff: 30 * time.Second,
+		MaxBackoff:     time.Hour,
+		DisableAfter:   5,
+		Workers:        4,
+		PollInterval:   5 * time.Second,
+		RequestTimeout: 10 * time.Second,
+	}
+}
+
+// Dispatcher turns events into signed webhook deliveries and sends them
+type Dispatcher struct {
+	store  *Store
+	bus    kafka.EventBus
+	client *http.Client
+	config DispatcherConfig
+
+	subscriptions []kafka.Subscription
+	wake          chan struct{}
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(store *Store, bus kafka.EventBus, config DispatcherConfig) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		bus:    bus,
+		client: &http.Client{Timeout: config.RequestTimeout},
+		config: config,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Start subscribes to the event topics and starts sending deliveries
+func (d *Dispatcher) Start() error {
+	for _, topic := range Topics {
+		sub, err := d.bus.Subscribe(topic, ConsumerGroup, d.handleEvent)
+		if err != nil {
+			d.Stop()
+			return fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+		}
+		d.subscriptions = append(d.subscriptions, sub)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.wg.Add(1)
+	go d.run(ctx)
+
+	log.Printf("Webhook dispatcher started for topics: %v", Topics)
+	return nil
+}
+
+// Stop stops consuming events and waits for in-flight deliveries
+func (d *Dispatcher) Stop() {
+	for _, sub := range d.subscriptions {
+		if err := sub.Close(); err != nil {
+			log.Printf("Error closing webhook subscription: %v", err)
+		}
+	}
+	d.subscriptions = nil
+
+	if d.cancel != nil {
+		d.cancel()
+		d.wg.Wait()
+	}
+}
+
+// Replay queues a new delivery with the payload of an earlier one
+func (d *Dispatcher) Replay(ctx context.Context, deliveryID primitive.ObjectID) (*models.WebhookDelivery, error) {
+	original, err := d.store.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := d.store.GetSubscription(ctx, original.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if !sub.Active {
+		return nil, fmt.Errorf("webhook subscription %s is disabled", sub.ID.Hex())
+	}
+
+	replay := &models.WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		URL:            sub.URL,
+		Payload:        original.Payload,
+		ReplayOf:       &original.ID,
+	}
+	if err := d.store.createDelivery(ctx, replay); err != nil {
+		return nil, err
+	}
+
+	d.notify()
+	return replay, nil
+}
+
+// handleEvent creates a delivery for every subscription matching the
+// event. Subscriptions that already have a delivery of the event, because
+// the bus delivered it again, are skipped.
+func (d *Dispatcher) handleEvent(ctx context.Context, event *models.EventMessage) error {
+	subs, err := d.store.ActiveSubscriptions(ctx, event.EventType)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	ce, err := event.ToCloudEvent()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(ce)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	queued := false
+	for _, sub := range subs {
+		delivery := &models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        event.EventID,
+			EventType:      event.EventType,
+			URL:            sub.URL,
+			Payload:        payload,
+		}
+		created, err := d.store.queueDelivery(ctx, delivery)
+		if err != nil {
+			return err
+		}
+		queued = queued || created
+	}
+
+	if queued {
+		d.notify()
+	}
+	return nil
+}
+
+// notify wakes up the delivery loop without blocking
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends due deliveries whenever new ones are queued or the poll interval elapses
+func (d *Dispatcher) run(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	workers := make(chan struct{}, d.config.Workers)
+	var inflight sync.WaitGroup
+	defer inflight.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+
+		for ctx.Err() == nil {
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			delivery, err := d.store.claimDue(ctx, d.config.RequestTimeout*2)
+			if err != nil || delivery == nil {
+				<-workers
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Error claiming webhook delivery: %v", err)
+				}
+				break
+			}
+
+			inflight.Add(1)
+			go func() {
+				defer inflight.Done()
+				defer func() { <-workers }()
+				d.attempt(ctx, delivery)
+			}()
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome. A delivery fails
+// for good only when its subscription was deleted or disabled; when the
+// subscription cannot be read it stays leased and is claimed again once
+// the lease runs out.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	sub, err := d.store.GetSubscription(ctx, delivery.SubscriptionID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error loading webhook subscription of delivery %s: %v", delivery.ID.Hex(), err)
+		return
+	}
+	if err != nil || !sub.Active {
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.Error = "webhook subscription was deleted or disabled"
+		if err := d.store.saveAttempt(ctx, delivery); err != nil {
+			log.Printf("Error saving webhook delivery %s: %v", delivery.ID.Hex(), err)
+		}
+		return
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+
+	status, body, sendErr := d.send(ctx, sub, delivery)
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	delivery.Error = ""
+	if sendErr != nil {
+		delivery.Error = sendErr.Error()
+	}
+
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		if err := d.store.recordSuccess(ctx, sub.ID); err != nil {
+			log.Printf("Error resetting webhook failures for %s: %v", sub.ID.Hex(), err)
+		}
+
+	case delivery.Attempts < d.config.MaxAttempts:
+		next := now.Add(d.backoff(delivery.Attempts))
+		delivery.Status = models.WebhookDeliveryRetrying
+		delivery.NextAttemptAt = &next
+
+	default:
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		disabled, err := d.store.recordFailure(ctx, sub.ID, d.config.DisableAfter)
+		if err != nil {
+			log.Printf("Error recording webhook failure for %s: %v", sub.ID.Hex(), err)
+		}
+		if disabled {
+			log.Printf("Disabled webhook subscription %s (%s) after repeated failures", sub.ID.Hex(), sub.URL)
+		}
+	}
+
+	if err := d.store.saveAttempt(ctx, delivery); err != nil {
+		log.Printf("Error saving webhook delivery %s: %v", delivery.ID.Hex(), err)
+	}
+}
+
+// send POSTs the signed payload and returns the response status and body
+func (d *Dispatcher) send(ctx context.Context, sub *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", kafka.CloudEventsContentType)
+	req.Header.Set(HeaderDeliveryID, delivery.ID.Hex())
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(body), fmt.Errorf("webhook endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// backoff returns the delay before the next attempt, doubling per attempt
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := float64(d.config.InitialBackoff) * math.Pow(2, float64(attempts-1))
+	if delay > float64(d.config.MaxBackoff) {
+		return d.config.MaxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// Sign computes the signature header value for a payload. Receivers verify
+// it by computing HMAC-SHA256 over "<timestamp>.<body>" with their secret.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateSecret returns a random signing secret for a new subscription
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"warehouse-shared/models"
+)
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"id":"evt-1"}`)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1700000000." + string(payload)))
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.Equal(t, expected, Sign("whsec_test", "1700000000", payload))
+	assert.NotEqual(t, expected, Sign("other-secret", "1700000000", payload))
+	assert.NotEqual(t, expected, Sign("whsec_test", "1700000001", payload))
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{config: DispatcherConfig{InitialBackoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}}
+
+	assert.Equal(t, 30*time.Second, d.backoff(1))
+	assert.Equal(t, time.Minute, d.backoff(2))
+	assert.Equal(t, 4*time.Minute, d.backoff(4))
+	assert.Equal(t, 5*time.Minute, d.backoff(5))
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	sub := &models.WebhookSubscription{EventTypes: []string{models.EventShipmentStatusChanged}}
+	assert.True(t, sub.Matches(models.EventShipmentStatusChanged))
+	assert.False(t, sub.Matches(models.EventStockUpdated))
+
+	sub.EventTypes = []string{models.WebhookEventAll}
+	assert.True(t, sub.Matches(models.EventStockUpdated))
+}
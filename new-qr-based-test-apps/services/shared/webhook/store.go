@@ -0,0 +1,357 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"warehouse-shared/database"
+	"warehouse-shared/models"
+)
+
+// ErrNotFound is returned when a subscription or delivery does not exist
+var ErrNotFound = errors.New("webhook not found")
+
+// Store persists webhook subscriptions and deliveries in MongoDB
+type Store struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+}
+
+// NewStore creates a new webhook store
+func NewStore(db *database.MongoDB) *Store {
+	return &Store{
+		subscriptions: db.GetCollection(database.WebhookSubscriptionsCollection),
+		deliveries:    db.GetCollection(database.WebhookDeliveriesCollection),
+	}
+}
+
+// EnsureIndexes creates the indexes used by the dispatcher and the delivery log
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	if _, err := s.subscriptions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "active", Value: 1}, {Key: "eventTypes", Value: 1}},
+	}); err != nil {
+		return fmt.Errorf("failed to create webhook subscription index: %w", err)
+	}
+
+	_, err := s.deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+		{Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "eventId", Value: 1}}},
+		{
+			// One delivery of an event per subscription, however often the
+			// event is redelivered; replays are sent again on purpose
+			Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "eventId", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"replay": false}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery indexes: %w", err)
+	}
+	return nil
+}
+
+// CreateSubscription stores a new subscription
+func (s *Store) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	now := time.Now()
+	sub.ID = primitive.NewObjectID()
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+
+	if _, err := s.subscriptions.InsertOne(ctx, sub); err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// GetSubscription returns a subscription by ID
+func (s *Store) GetSubscription(ctx context.Context, id primitive.ObjectID) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := s.subscriptions.FindOne(ctx, bson.M{"_id": id}).Decode(&sub)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// ListSubscriptions returns all subscriptions, newest first
+func (s *Store) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	cursor, err := s.subscriptions.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+
+	subs := []models.WebhookSubscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// ActiveSubscriptions returns the active subscriptions interested in an event type
+func (s *Store) ActiveSubscriptions(ctx context.Context, eventType string) ([]models.WebhookSubscription, error) {
+	filter := bson.M{
+		"active":     true,
+		"eventTypes": bson.M{"$in": bson.A{eventType, models.WebhookEventAll}},
+	}
+
+	cursor, err := s.subscriptions.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook subscriptions: %w", err)
+	}
+
+	var subs []models.WebhookSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// UpdateSubscription applies changes to a subscription. Re-activating an
+// endpoint clears its failure counter.
+func (s *Store) UpdateSubscription(ctx context.Context, id primitive.ObjectID, changes bson.M) (*models.WebhookSubscription, error) {
+	set := bson.M{"updatedAt": time.Now()}
+	for key, value := range changes {
+		set[key] = value
+	}
+
+	update := bson.M{"$set": set}
+	if active, ok := changes["active"].(bool); ok && active {
+		set["consecutiveFailures"] = 0
+		update["$unset"] = bson.M{"disabledAt": "", "disabledReason": ""}
+	}
+
+	var sub models.WebhookSubscription
+	err := s.subscriptions.FindOneAndUpdate(ctx, bson.M{"_id": id}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&sub)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// DeleteSubscription removes a subscription. Its delivery log is kept.
+func (s *Store) DeleteSubscription(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.subscriptions.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// recordSuccess resets the failure counter of a subscription
+func (s *Store) recordSuccess(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.subscriptions.UpdateOne(ctx,
+		bson.M{"_id": id, "consecutiveFailures": bson.M{"$ne": 0}},
+		bson.M{"$set": bson.M{"consecutiveFailures": 0, "updatedAt": time.Now()}})
+	return err
+}
+
+// recordFailure counts a failed delivery and disables the subscription once
+// disableAfter deliveries in a row have failed. It reports whether the
+// subscription was disabled.
+func (s *Store) recordFailure(ctx context.Context, id primitive.ObjectID, disableAfter int) (bool, error) {
+	var sub models.WebhookSubscription
+	err := s.subscriptions.FindOneAndUpdate(ctx, bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"consecutiveFailures": 1}, "$set": bson.M{"updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&sub)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !sub.Active || disableAfter <= 0 || sub.ConsecutiveFailures < disableAfter {
+		return false, nil
+	}
+
+	now := time.Now()
+	_, err = s.subscriptions.UpdateOne(ctx, bson.M{"_id": id, "active": true}, bson.M{"$set": bson.M{
+		"active":         false,
+		"disabledAt":     now,
+		"disabledReason": fmt.Sprintf("%d consecutive failed deliveries", sub.ConsecutiveFailures),
+		"updatedAt":      now,
+	}})
+	return err == nil, err
+}
+
+// DeliveryFilter selects deliveries from the delivery log
+type DeliveryFilter struct {
+	SubscriptionID *primitive.ObjectID
+	EventID        string
+	EventType      string
+	Status         string
+	Since          *time.Time
+	Until          *time.Time
+}
+
+// ListDeliveries queries the delivery log, newest first. It returns the
+// requested page and the total number of matching deliveries.
+func (s *Store) ListDeliveries(ctx context.Context, filter DeliveryFilter, offset, limit int) ([]models.WebhookDelivery, int64, error) {
+	query := bson.M{}
+	if filter.SubscriptionID != nil {
+		query["subscriptionId"] = *filter.SubscriptionID
+	}
+	if filter.EventID != "" {
+		query["eventId"] = filter.EventID
+	}
+	if filter.EventType != "" {
+		query["eventType"] = filter.EventType
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.Since != nil || filter.Until != nil {
+		created := bson.M{}
+		if filter.Since != nil {
+			created["$gte"] = *filter.Since
+		}
+		if filter.Until != nil {
+			created["$lt"] = *filter.Until
+		}
+		query["createdAt"] = created
+	}
+
+	total, err := s.deliveries.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count webhook deliveries: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := s.deliveries.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+	}
+	return deliveries, total, nil
+}
+
+// GetDelivery returns a delivery by ID
+func (s *Store) GetDelivery(ctx context.Context, id primitive.ObjectID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := s.deliveries.FindOne(ctx, bson.M{"_id": id}).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// createDelivery stores a new pending replay that is due immediately
+func (s *Store) createDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	pending(delivery)
+	delivery.Replay = true
+
+	if _, err := s.deliveries.InsertOne(ctx, delivery); err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// queueDelivery stores a pending delivery of an event to a subscription
+// that is due immediately, unless the event was queued for it before. It
+// reports whether the delivery was queued, so that an event redelivered by
+// the bus is sent only once.
+func (s *Store) queueDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error) {
+	pending(delivery)
+	delivery.Replay = false
+
+	filter := bson.M{
+		"subscriptionId": delivery.SubscriptionID,
+		"eventId":        delivery.EventID,
+		"replay":         false,
+	}
+	result, err := s.deliveries.UpdateOne(ctx, filter, bson.M{"$setOnInsert": delivery},
+		options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Queued concurrently by another dispatcher instance
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to queue webhook delivery: %w", err)
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// pending resets a new delivery to pending and due immediately
+func pending(delivery *models.WebhookDelivery) {
+	now := time.Now()
+	delivery.ID = primitive.NewObjectID()
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.NextAttemptAt = &now
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+}
+
+// claimDue leases the next due delivery so that only one dispatcher
+// instance attempts it. Deliveries whose lease expired are claimable again.
+func (s *Store) claimDue(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	filter := bson.M{"$or": bson.A{
+		bson.M{
+			"status":        bson.M{"$in": bson.A{models.WebhookDeliveryPending, models.WebhookDeliveryRetrying}},
+			"nextAttemptAt": bson.M{"$lte": now},
+		},
+		bson.M{
+			"status":     models.WebhookDeliveryDelivering,
+			"leaseUntil": bson.M{"$lte": now},
+		},
+	}}
+	update := bson.M{"$set": bson.M{
+		"status":     models.WebhookDeliveryDelivering,
+		"leaseUntil": now.Add(lease),
+		"updatedAt":  now,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery models.WebhookDelivery
+	err := s.deliveries.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// saveAttempt stores the outcome of a delivery attempt and releases the lease
+func (s *Store) saveAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now()
+	delivery.LeaseUntil = nil
+
+	_, err := s.deliveries.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery)
+	if err != nil {
+		return fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+	return nil
+}